@@ -2,8 +2,11 @@ package main
 
 import (
 	"errors"
+	"fmt"
+	"os"
 
 	"github.com/1Password/shell-plugins/plugins"
+	"github.com/1Password/shell-plugins/sdk/provision"
 	"github.com/1Password/shell-plugins/sdk/rpc/proto"
 	"github.com/1Password/shell-plugins/sdk/rpc/server"
 	"github.com/1Password/shell-plugins/sdk/schema"
@@ -15,6 +18,16 @@ import (
 var PluginName string
 
 func main() {
+	// Provisioners can have the executable the plugin provisions for call back into the plugin, see
+	// provision.RunCallback.
+	if ok, err := provision.RunCallback(os.Args[1:], os.Stdout); ok {
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+
 	plugin.Serve(&plugin.ServeConfig{
 		HandshakeConfig: plugin.HandshakeConfig{
 			ProtocolVersion:  proto.Version,
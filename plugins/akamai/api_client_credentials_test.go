@@ -20,7 +20,7 @@ func TestAPIClientCredentialsProvisioner(t *testing.T) {
 			ExpectedOutput: sdk.ProvisionOutput{
 				CommandLine: []string{"--edgerc", "/tmp/.edgerc", "--section", "default"},
 				Files: map[string]sdk.OutputFile{
-					"/tmp/.edgerc": {Contents: []byte(plugintest.LoadFixture(t, ".edgerc-single"))},
+					"/tmp/.edgerc": {Contents: []byte(plugintest.LoadFixture(t, ".edgerc-single")), Mode: 0600},
 				},
 				Environment: map[string]string{
 					"EDGERC": "/tmp/.edgerc",
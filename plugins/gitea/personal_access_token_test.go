@@ -20,6 +20,7 @@ func TestPersonalAccessTokenProvisioner(t *testing.T) {
 				Files: map[string]sdk.OutputFile{
 					ConfigPath(): {
 						Contents: []byte(plugintest.LoadFixture(t, "config.yml")),
+						Mode:     0600,
 					},
 				},
 			},
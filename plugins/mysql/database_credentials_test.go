@@ -52,6 +52,7 @@ func TestDatabaseCredentialsProvisioner(t *testing.T) {
 				Files: map[string]sdk.OutputFile{
 					"/tmp/my.cnf": {
 						Contents: []byte(plugintest.LoadFixture(t, "mysql.cnf")),
+						Mode:     0600,
 					},
 				},
 			},
@@ -1,9 +1,60 @@
 package sdk
 
+import (
+	"sort"
+	"strings"
+)
+
 type Diagnostics struct {
-	Errors []Error
+	Errors   []Error
+	Warnings []Warning
 }
 
 type Error struct {
 	Message string
 }
+
+// Warning is reported for problems that don't make the operation fail, but that the user should be aware of.
+type Warning struct {
+	Message string
+}
+
+// redacted is what secret values in diagnostics get replaced with.
+const redacted = "<redacted>"
+
+// minRedactLength is the minimum length of values that get redacted. Shorter values, such as a single digit, would
+// redact innocent parts of messages while not revealing much of a secret.
+const minRedactLength = 4
+
+// Redact replaces every occurrence of the specified (sensitive) values in the messages of the errors and warnings,
+// so that it's safe to show them to the user or write them to logs, even if a secret ended up in a message by
+// accident.
+func (d *Diagnostics) Redact(values ...string) {
+	var secrets []string
+	for _, value := range values {
+		if len(value) >= minRedactLength {
+			secrets = append(secrets, value)
+		}
+	}
+	if len(secrets) == 0 {
+		return
+	}
+
+	// Redact longer values first, so that a value that contains another value is redacted completely.
+	sort.Slice(secrets, func(i, j int) bool {
+		return len(secrets[i]) > len(secrets[j])
+	})
+
+	redact := func(message string) string {
+		for _, secret := range secrets {
+			message = strings.ReplaceAll(message, secret, redacted)
+		}
+		return message
+	}
+	for i := range d.Errors {
+		d.Errors[i].Message = redact(d.Errors[i].Message)
+	}
+	for i := range d.Warnings {
+		d.Warnings[i].Message = redact(d.Warnings[i].Message)
+	}
+}
@@ -0,0 +1,31 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiagnosticsRedact(t *testing.T) {
+	diagnostics := Diagnostics{
+		Errors: []Error{
+			{Message: "invalid token ghp_abc123, expected 40 characters"},
+			{Message: "unexpected response for user wendy: 401"},
+		},
+		Warnings: []Warning{
+			{Message: "token ghp_abc123 expires soon"},
+		},
+	}
+
+	diagnostics.Redact("ghp_abc123", "abc1", "401", "")
+
+	assert.Equal(t, Diagnostics{
+		Errors: []Error{
+			{Message: "invalid token <redacted>, expected 40 characters"},
+			{Message: "unexpected response for user wendy: 401"},
+		},
+		Warnings: []Warning{
+			{Message: "token <redacted> expires soon"},
+		},
+	}, diagnostics)
+}
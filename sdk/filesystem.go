@@ -0,0 +1,88 @@
+package sdk
+
+import (
+	"os"
+)
+
+// FileSystem abstracts the file system operations of provisioners that modify files directly, instead of through
+// the files on ProvisionOutput, such as provisioners that append to a user's config file. This allows testing those
+// provisioners against an in-memory file system, see plugintest.NewMemoryFileSystem.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Stat(name string) (os.FileInfo, error)
+	Lstat(name string) (os.FileInfo, error)
+	Chmod(name string, mode os.FileMode) error
+	Rename(oldpath string, newpath string) error
+	Remove(name string) error
+	RemoveAll(path string) error
+	MkdirAll(path string, perm os.FileMode) error
+	Symlink(oldname string, newname string) error
+	Readlink(name string) (string, error)
+
+	// OverwriteFile writes the data over the contents of the existing file in place, without truncating or
+	// recreating it, and flushes it to disk. This is used to scrub files before removing them.
+	OverwriteFile(name string, data []byte) error
+}
+
+// OSFileSystem is the FileSystem that operates on the actual file system of the OS.
+type OSFileSystem struct{}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+func (OSFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(name, data, perm)
+}
+
+func (OSFileSystem) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFileSystem) Lstat(name string) (os.FileInfo, error) {
+	return os.Lstat(name)
+}
+
+func (OSFileSystem) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (OSFileSystem) Rename(oldpath string, newpath string) error {
+	return os.Rename(oldpath, newpath)
+}
+
+func (OSFileSystem) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OSFileSystem) RemoveAll(path string) error {
+	return os.RemoveAll(path)
+}
+
+func (OSFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	return os.MkdirAll(path, perm)
+}
+
+func (OSFileSystem) Symlink(oldname string, newname string) error {
+	return os.Symlink(oldname, newname)
+}
+
+func (OSFileSystem) Readlink(name string) (string, error) {
+	return os.Readlink(name)
+}
+
+func (OSFileSystem) OverwriteFile(name string, data []byte) error {
+	f, err := os.OpenFile(name, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
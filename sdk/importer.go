@@ -3,6 +3,7 @@ package sdk
 import (
 	"context"
 	"path/filepath"
+	"sort"
 	"time"
 )
 
@@ -16,8 +17,23 @@ type ImportCandidate struct {
 	Fields    map[FieldName]string
 	NameHint  string
 	ExpiresAt *time.Time
+
+	// (Optional) Score indicates how likely it is that the candidate is the credential the user is looking for,
+	// where a higher score is more likely. If not set, a score gets derived from the source of the candidate and
+	// how many fields it has, see ImportOutput.Rank.
+	Score int
 }
 
+// Scores of the different kinds of import sources. Environment variables are ranked highest, since they've been set
+// explicitly for the current environment, followed by config files and all other sources, such as the keychain.
+// The scores are far enough apart that the completeness of a candidate only matters among candidates of the same
+// kind of source.
+const (
+	ScoreOtherSource  = 100
+	ScoreFileSource   = 200
+	ScoreEnvVarSource = 300
+)
+
 func (c *ImportCandidate) Equal(other ImportCandidate) bool {
 	if len(c.Fields) != len(other.Fields) {
 		return false
@@ -49,6 +65,10 @@ type ImportInput struct {
 
 	// Supported values: "darwin", "linux"
 	OS string
+
+	// IncludeRunningProcesses is set if the user explicitly opted in to importing credentials from the command-line
+	// args of their running processes, see importer.TryRunningProcess.
+	IncludeRunningProcesses bool
 }
 
 type ImportOutput struct {
@@ -75,6 +95,120 @@ func (out *ImportOutput) AllCandidates() (candidates []ImportCandidate) {
 	return
 }
 
+// Deduplicate collapses candidates with identical field values into a single candidate, which is kept in the attempt
+// with the highest-ranked source, so that ranking the output afterwards still prefers it: the score of the candidate if
+// it has one set, or the score of the source of its attempt otherwise, see Rank. On ties, the candidate is kept in the
+// first attempt it occurs in. The name hint and expiry of the duplicates are preserved if the kept candidate lacks
+// them. Candidates that differ in any field remain separate.
+func (out *ImportOutput) Deduplicate() {
+	type occurrence struct {
+		attempt *ImportAttempt
+		index   int
+	}
+	rank := func(o occurrence) int {
+		if score := o.attempt.Candidates[o.index].Score; score != 0 {
+			return score
+		}
+		return o.attempt.Source.score()
+	}
+
+	var groups [][]occurrence
+	for _, attempt := range out.Attempts {
+		for i, candidate := range attempt.Candidates {
+			found := false
+			for g, group := range groups {
+				if group[0].attempt.Candidates[group[0].index].Equal(candidate) {
+					groups[g] = append(group, occurrence{attempt, i})
+					found = true
+					break
+				}
+			}
+			if !found {
+				groups = append(groups, []occurrence{{attempt, i}})
+			}
+		}
+	}
+
+	kept := make(map[occurrence]ImportCandidate, len(groups))
+	for _, group := range groups {
+		best := group[0]
+		for _, o := range group[1:] {
+			if rank(o) > rank(best) {
+				best = o
+			}
+		}
+
+		merged := best.attempt.Candidates[best.index]
+		for _, o := range group {
+			duplicate := o.attempt.Candidates[o.index]
+			if merged.NameHint == "" {
+				merged.NameHint = duplicate.NameHint
+			}
+			if merged.ExpiresAt == nil {
+				merged.ExpiresAt = duplicate.ExpiresAt
+			}
+			if merged.Score < duplicate.Score {
+				merged.Score = duplicate.Score
+			}
+		}
+		kept[best] = merged
+	}
+
+	for _, attempt := range out.Attempts {
+		candidates := make([]ImportCandidate, 0, len(attempt.Candidates))
+		for i := range attempt.Candidates {
+			if candidate, ok := kept[occurrence{attempt, i}]; ok {
+				candidates = append(candidates, candidate)
+			}
+		}
+		attempt.Candidates = candidates
+	}
+}
+
+// Rank scores all candidates that don't have a score set yet, and sorts the candidates so that the most likely
+// candidate comes first: both the candidates in each attempt and the attempts themselves, by their best candidate.
+// The derived score of a candidate is the score of its source, plus one for each of the specified fields that the
+// candidate has a value for. The order of candidates with the same score is preserved.
+func (out *ImportOutput) Rank(fieldNames []FieldName) {
+	bestScores := make(map[*ImportAttempt]int, len(out.Attempts))
+	for _, attempt := range out.Attempts {
+		for i := range attempt.Candidates {
+			candidate := &attempt.Candidates[i]
+			if candidate.Score == 0 {
+				candidate.Score = attempt.Source.score()
+				for _, fieldName := range fieldNames {
+					if candidate.Fields[fieldName] != "" {
+						candidate.Score++
+					}
+				}
+			}
+		}
+
+		sort.SliceStable(attempt.Candidates, func(i, j int) bool {
+			return attempt.Candidates[i].Score > attempt.Candidates[j].Score
+		})
+		if len(attempt.Candidates) > 0 {
+			bestScores[attempt] = attempt.Candidates[0].Score
+		}
+	}
+
+	sort.SliceStable(out.Attempts, func(i, j int) bool {
+		return bestScores[out.Attempts[i]] > bestScores[out.Attempts[j]]
+	})
+}
+
+// score returns the score of candidates found in this source.
+func (src ImportSource) score() int {
+	switch {
+	case len(src.Env) > 0:
+		return ScoreEnvVarSource
+	case len(src.Files) > 0:
+		return ScoreFileSource
+	default:
+		return ScoreOtherSource
+	}
+}
+
 func (out *ImportOutput) NewAttempt(src ImportSource) *ImportAttempt {
 	attempt := &ImportAttempt{
 		Source: src,
@@ -91,6 +225,10 @@ func (out *ImportAttempt) AddError(err error) {
 	out.Diagnostics.Errors = append(out.Diagnostics.Errors, Error{err.Error()})
 }
 
+func (out *ImportAttempt) AddWarning(message string) {
+	out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, Warning{message})
+}
+
 func (in *ImportInput) FromHomeDir(path ...string) string {
 	return filepath.Join(append([]string{in.HomeDir}, path...)...)
 }
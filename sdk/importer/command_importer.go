@@ -0,0 +1,65 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// commandTimeout is how long a command run by TryCommand can take, so that a command that waits for input or hangs
+// doesn't block importing.
+const commandTimeout = 5 * time.Second
+
+// TryCommand runs the command specified by argv, e.g. []string{"gh", "auth", "token"}, and adds the import candidate
+// that the parse function returns for its stdout. It's meant for executables that expose their current credentials
+// through a subcommand. The command is executed directly, without a shell, and only the commands that the plugin
+// author passes in are ever run. It's a no-op if the executable is not installed or the command exits with a
+// non-zero exit code, e.g. because the user isn't logged in. The command gets no stdin and is killed after
+// 5 seconds. Its stderr is discarded and never included in any diagnostic, since it could contain secrets.
+func TryCommand(argv []string, parse func(stdout []byte) (sdk.ImportCandidate, error)) sdk.Importer {
+	return func(ctx context.Context, in sdk.ImportInput, out *sdk.ImportOutput) {
+		if len(argv) == 0 {
+			return
+		}
+
+		commandLine := strings.Join(argv, " ")
+		if _, err := exec.LookPath(argv[0]); err != nil {
+			return
+		}
+
+		attempt := out.NewAttempt(SourceOther("command", commandLine))
+
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Stderr = io.Discard
+		stdout, err := cmd.Output()
+		if ctx.Err() == context.DeadlineExceeded {
+			attempt.AddError(fmt.Errorf("running '%s' timed out after %s", commandLine, commandTimeout))
+			return
+		}
+		if err != nil {
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) {
+				attempt.AddError(fmt.Errorf("running '%s': %w", commandLine, err))
+			}
+			return
+		}
+
+		candidate, err := parse(stdout)
+		if err != nil {
+			attempt.AddError(fmt.Errorf("parsing output of '%s': %w", commandLine, err))
+			return
+		}
+		if len(candidate.Fields) > 0 {
+			attempt.AddCandidate(candidate)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package importer
+
+import (
+	"errors"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+)
+
+func TestTryCommand(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("the test commands require a POSIX shell")
+	}
+
+	parseToken := func(stdout []byte) (sdk.ImportCandidate, error) {
+		token := strings.TrimSpace(string(stdout))
+		if strings.ContainsAny(token, " ") {
+			return sdk.ImportCandidate{}, errors.New("unexpected output")
+		}
+		return sdk.ImportCandidate{
+			Fields: map[sdk.FieldName]string{"Token": token},
+		}, nil
+	}
+
+	plugintest.TestImporter(t, TryCommand([]string{"sh", "-c", "echo tok_EXAMPLE"}, parseToken), map[string]plugintest.ImportCase{
+		"output": {
+			ExpectedCandidates: []sdk.ImportCandidate{
+				{Fields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"}},
+			},
+		},
+	})
+
+	plugintest.TestImporter(t, TryCommand([]string{"sh", "-c", "echo hunter2 >&2; exit 1"}, parseToken), map[string]plugintest.ImportCase{
+		"non-zero exit code": {
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{Source: SourceOther("command", "sh -c echo hunter2 >&2; exit 1")},
+				},
+			},
+		},
+	})
+
+	plugintest.TestImporter(t, TryCommand([]string{"sh", "-c", "echo not a token"}, parseToken), map[string]plugintest.ImportCase{
+		"parse error": {
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{
+						Source: SourceOther("command", "sh -c echo not a token"),
+						Diagnostics: sdk.Diagnostics{
+							Errors: []sdk.Error{{Message: "parsing output of 'sh -c echo not a token': unexpected output"}},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	plugintest.TestImporter(t, TryCommand([]string{"op-plugin-missing-executable"}, parseToken), map[string]plugintest.ImportCase{
+		"not installed": {
+			ExpectedOutput: &sdk.ImportOutput{},
+		},
+	})
+}
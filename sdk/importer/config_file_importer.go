@@ -0,0 +1,444 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/internal/dotenv"
+	"github.com/1Password/shell-plugins/sdk/internal/keypath"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// maxGlobFiles is the maximum number of files that TryFilesGlob scans, so that a pattern that matches a lot more
+// files than expected doesn't slow down importing.
+const maxGlobFiles = 100
+
+// TryTOMLFile tries to parse the TOML file at the specified path, and adds an import candidate with the fields
+// found in the file. The mapping specifies the key path of each field, where dots separate nested tables, e.g.
+// "registries.crates-io.token", and dots that are part of a key can be escaped with a backslash, e.g.
+// "registries.crates\\.io.token". Keys that are not present in the file are skipped. If the file doesn't exist, no
+// candidates are added.
+func TryTOMLFile(path string, mapping map[string]sdk.FieldName) sdk.Importer {
+	return TryFile(path, func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt) {
+		var config map[string]any
+		if err := contents.ToTOML(&config); err != nil {
+			out.AddError(err)
+			return
+		}
+
+		fields := fieldsFromMapping(config, mapping)
+		if len(fields) > 0 {
+			out.AddCandidate(sdk.ImportCandidate{
+				Fields: fields,
+			})
+		}
+	})
+}
+
+// TryFilesGlob tries to parse each file that matches the glob pattern, e.g. "~/.config/myapp/*.json", and adds an
+// import candidate for each file with the fields found in it. The format of each file is detected like for
+// TryConfigFile. The mapping specifies the key path of each field, like for TryTOMLFile. Each candidate gets the
+// filename without its extension as its name hint, so that users can tell the candidates apart. At most 100 files
+// are scanned, with a warning if more files match, and files that can't be read are skipped with a warning. If no
+// files match the pattern, no candidates are added.
+func TryFilesGlob(pattern string, mapping map[string]sdk.FieldName) sdk.Importer {
+	return func(ctx context.Context, in sdk.ImportInput, out *sdk.ImportOutput) {
+		matches, truncated, err := globFiles(resolvePath(pattern, in), maxGlobFiles)
+		if err != nil {
+			out.NewAttempt(SourceFile(pattern)).AddError(fmt.Errorf("invalid glob pattern: %w", err))
+			return
+		}
+		if truncated {
+			out.NewAttempt(SourceFile(pattern)).AddWarning(fmt.Sprintf("more than %d files match %s, only the first %d are scanned", maxGlobFiles, pattern, maxGlobFiles))
+		}
+
+		for _, match := range matches {
+			if ctx.Err() != nil {
+				return
+			}
+
+			info, err := os.Stat(match)
+			if err != nil || info.IsDir() {
+				continue
+			}
+
+			path := unresolvePath(pattern, match, in)
+			attempt := out.NewAttempt(SourceFile(path))
+			contents, err := os.ReadFile(match)
+			if os.IsPermission(err) {
+				attempt.AddWarning(fmt.Sprintf("skipping %s: permission denied", path))
+				continue
+			} else if err != nil {
+				attempt.AddError(err)
+				continue
+			}
+
+			config, err := parseConfigFile(match, contents)
+			if err != nil {
+				attempt.AddError(fmt.Errorf("parsing %s: %w", path, err))
+				continue
+			}
+
+			fields := fieldsFromMapping(config, mapping)
+			if len(fields) > 0 {
+				name := filepath.Base(match)
+				attempt.AddCandidate(sdk.ImportCandidate{
+					Fields:   fields,
+					NameHint: SanitizeNameHint(strings.TrimSuffix(name, filepath.Ext(name))),
+				})
+			}
+		}
+	}
+}
+
+// globFiles returns the files that match the pattern, like filepath.Glob, in lexical order. Unlike filepath.Glob, it
+// stops looking for matches once it has found the specified number of files, and reports whether there are more.
+// Only the directories that can contain matches are read, and directories themselves are never returned.
+func globFiles(pattern string, limit int) ([]string, bool, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, false, err
+	}
+
+	// Only the part of the pattern after the last directory without wildcards needs to be matched.
+	pattern = filepath.Clean(pattern)
+	root := pattern
+	for strings.ContainsAny(root, "*?[") {
+		root = filepath.Dir(root)
+	}
+	var segments []string
+	if root != pattern {
+		rest, err := filepath.Rel(root, pattern)
+		if err != nil {
+			return nil, false, err
+		}
+		segments = strings.Split(rest, string(filepath.Separator))
+	}
+
+	var matches []string
+	truncated := false
+	var walk func(path string, segments []string) bool
+	walk = func(path string, segments []string) bool {
+		if len(segments) == 0 {
+			if info, err := os.Stat(path); err != nil || info.IsDir() {
+				return true
+			}
+			if len(matches) == limit {
+				truncated = true
+				return false
+			}
+			matches = append(matches, path)
+			return true
+		}
+
+		// Directories that can't be read are skipped, like filepath.Glob does.
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			return true
+		}
+		for _, entry := range entries {
+			if matched, _ := filepath.Match(segments[0], entry.Name()); matched && !walk(filepath.Join(path, entry.Name()), segments[1:]) {
+				return false
+			}
+		}
+		return true
+	}
+	walk(root, segments)
+	return matches, truncated, nil
+}
+
+// parseConfigFile parses the contents of a config file without knowing its format in advance, see TryConfigFile for
+// how the format is detected. If none of the parsers succeed, the error of the first format that was tried is
+// returned, since that's the format the file is most likely meant to be in.
+func parseConfigFile(path string, contents FileContents) (map[string]any, error) {
+	if !utf8.Valid(contents) || bytes.IndexByte(contents, 0) >= 0 {
+		return nil, errNotTextFile
+	}
+
+	var formats []configFormat
+	if format, ok := configFormatFromExtension(path); ok {
+		formats = append(formats, format)
+	}
+	if format, ok := configFormatFromContents(contents); ok {
+		formats = append(formats, format)
+	}
+	formats = append(formats, configFormatJSON, configFormatYAML, configFormatTOML, configFormatINI)
+
+	var firstErr error
+	tried := make(map[configFormat]bool)
+	for _, format := range formats {
+		if tried[format] {
+			continue
+		}
+		tried[format] = true
+
+		config, err := parseConfigAs(format, contents)
+		if err == nil && config != nil {
+			return config, nil
+		}
+		if firstErr == nil {
+			firstErr = err
+		}
+	}
+	if firstErr == nil {
+		firstErr = errUnknownConfigFormat
+	}
+	return nil, firstErr
+}
+
+var (
+	errNotTextFile         = errors.New("not a text file")
+	errUnknownConfigFormat = errors.New("the file is not valid JSON, YAML, TOML, or INI")
+)
+
+// configFormat is a file format that config files can be parsed from.
+type configFormat string
+
+const (
+	configFormatJSON configFormat = "JSON"
+	configFormatYAML configFormat = "YAML"
+	configFormatTOML configFormat = "TOML"
+	configFormatINI  configFormat = "INI"
+)
+
+// configFormatFromExtension returns the format of a config file based on the extension of its path.
+func configFormatFromExtension(path string) (configFormat, bool) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return configFormatJSON, true
+	case ".yaml", ".yml":
+		return configFormatYAML, true
+	case ".toml":
+		return configFormatTOML, true
+	case ".ini", ".cfg", ".conf":
+		return configFormatINI, true
+	default:
+		return "", false
+	}
+}
+
+// iniSectionHeader matches a line that consists of only an INI section header, e.g. "[profile work]".
+var iniSectionHeader = regexp.MustCompile(`^\[[^\[\]]+\]\s*$`)
+
+// configFormatFromContents guesses the format of a config file from its first line that isn't empty or a comment.
+func configFormatFromContents(contents FileContents) (configFormat, bool) {
+	scanner := bufio.NewScanner(bytes.NewReader(bytes.TrimPrefix(contents, []byte("\xef\xbb\xbf"))))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";"):
+			continue
+		case strings.HasPrefix(line, "{"):
+			return configFormatJSON, true
+		case strings.HasPrefix(line, "---"):
+			return configFormatYAML, true
+		case iniSectionHeader.MatchString(line):
+			return configFormatINI, true
+		}
+		return "", false
+	}
+	return "", false
+}
+
+// parseConfigAs parses the contents of a config file in the specified format. Sections of INI files become nested
+// tables, except for the keys outside of any section, which end up at the top level.
+func parseConfigAs(format configFormat, contents FileContents) (config map[string]any, err error) {
+	// The contents could be anything, including binary data, so make sure a parser can't take down the importer.
+	defer func() {
+		if r := recover(); r != nil {
+			config, err = nil, fmt.Errorf("parsing as %s failed: %v", format, r)
+		}
+	}()
+
+	switch format {
+	case configFormatTOML:
+		err = contents.ToTOML(&config)
+	case configFormatYAML:
+		// yaml.v3 decodes nested mappings as map[string]any, which is what lookupKeyPath expects.
+		err = yaml.Unmarshal(contents, &config)
+	case configFormatINI:
+		iniFile, err := contents.ToINI()
+		if err != nil {
+			return nil, err
+		}
+		config = make(map[string]any)
+		for _, section := range iniFile.Sections() {
+			table := config
+			if section.Name() != ini.DefaultSection {
+				table = make(map[string]any)
+				config[section.Name()] = table
+			}
+			for _, key := range section.Keys() {
+				table[key.Name()] = key.Value()
+			}
+		}
+	default:
+		err = contents.ToJSON(&config)
+	}
+	return config, err
+}
+
+// TryConfigFile tries to parse the config file at the specified path without knowing its format in advance, and
+// adds an import candidate with the fields found in the file. The format is detected from the extension first, then
+// from the contents: a leading "{" means JSON, "---" means YAML, and a "[section]" header means INI. If that doesn't
+// work, JSON, YAML, TOML, and INI are tried in that order. The mapping specifies the key path of each field, like for
+// TryTOMLFile, where the first key of an INI file is the section name, e.g. "default.token". If the file is binary
+// or none of the parsers succeed, the file is skipped with a warning. If the file doesn't exist, no candidates are
+// added.
+func TryConfigFile(path string, mapping map[string]sdk.FieldName) sdk.Importer {
+	return TryFile(path, func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt) {
+		config, err := parseConfigFile(path, contents)
+		if errors.Is(err, errNotTextFile) {
+			out.AddWarning(fmt.Sprintf("skipping %s: %s", path, err))
+			return
+		} else if err != nil {
+			out.AddWarning(fmt.Sprintf("skipping %s: %s", path, errUnknownConfigFormat))
+			return
+		}
+
+		fields := fieldsFromMapping(config, mapping)
+		if len(fields) > 0 {
+			out.AddCandidate(sdk.ImportCandidate{
+				Fields: fields,
+			})
+		}
+	})
+}
+
+// TryINIFile tries to parse the INI file at the specified path, and adds an import candidate for each section whose
+// name matches the section pattern. The pattern is a regular expression that has to match the full section name,
+// e.g. "default|profile .+". The mapping specifies which key in the section maps to which field. Keys that are not
+// present in a section are skipped. Each candidate gets the section name as its name hint, so that users can tell
+// the candidates apart. If the pattern contains a capture group, the first group is used as the name hint instead,
+// so "profile (.+)" results in "foo" for the section "[profile foo]". If the file doesn't exist, no candidates are
+// added.
+func TryINIFile(path string, sectionPattern string, mapping map[string]sdk.FieldName) sdk.Importer {
+	return TryFile(path, func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt) {
+		pattern, err := regexp.Compile("^(?:" + sectionPattern + ")$")
+		if err != nil {
+			out.AddError(fmt.Errorf("invalid section pattern: %w", err))
+			return
+		}
+
+		configFile, err := contents.ToINI()
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+
+		for _, section := range configFile.Sections() {
+			match := pattern.FindStringSubmatch(section.Name())
+			if match == nil {
+				continue
+			}
+
+			fields := make(map[sdk.FieldName]string)
+			for key, fieldName := range mapping {
+				if section.HasKey(key) && section.Key(key).Value() != "" {
+					fields[fieldName] = section.Key(key).Value()
+				}
+			}
+			if len(fields) == 0 {
+				continue
+			}
+
+			nameHint := section.Name()
+			if len(match) > 1 && match[1] != "" {
+				nameHint = match[1]
+			}
+
+			out.AddCandidate(sdk.ImportCandidate{
+				Fields:   fields,
+				NameHint: SanitizeNameHint(nameHint),
+			})
+		}
+	})
+}
+
+// DotEnvOption can be used to change how TryDotEnvFile parses the file.
+type DotEnvOption func(*dotenv.Parser)
+
+// ExpandDotEnvReferences can be used to resolve "${VAR}" references in values. References are resolved against the
+// variables defined earlier in the same file first, and against the environment otherwise. References in
+// single-quoted values are never resolved.
+func ExpandDotEnvReferences() DotEnvOption {
+	return func(p *dotenv.Parser) {
+		p.ExpandReferences = true
+	}
+}
+
+// TryDotEnvFile tries to parse the .env file at the specified path, and adds an import candidate with the fields
+// found in the file. The mapping specifies which variable maps to which field. Each line of the file has the format
+// "KEY=value", optionally prefixed with "export". Values can be single-quoted, double-quoted, or unquoted. Blank lines
+// and comments starting with "#" are ignored. If the file doesn't exist, no candidates are added.
+func TryDotEnvFile(path string, mapping map[string]sdk.FieldName, opts ...DotEnvOption) sdk.Importer {
+	return TryFile(path, func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt) {
+		parser := dotenv.Parser{}
+		for _, opt := range opts {
+			opt(&parser)
+		}
+
+		vars, err := parser.Parse(contents)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+
+		fields := make(map[sdk.FieldName]string)
+		for key, fieldName := range mapping {
+			if value, ok := vars[key]; ok && value != "" {
+				fields[fieldName] = value
+			}
+		}
+		if len(fields) > 0 {
+			out.AddCandidate(sdk.ImportCandidate{
+				Fields: fields,
+			})
+		}
+	})
+}
+
+// fieldsFromMapping looks up the value of each key path in the mapping in the parsed config, and returns the
+// fields for all non-empty values that were found.
+func fieldsFromMapping(config map[string]any, mapping map[string]sdk.FieldName) map[sdk.FieldName]string {
+	fields := make(map[sdk.FieldName]string)
+	for keyPath, fieldName := range mapping {
+		if value, ok := lookupKeyPath(config, keypath.Split(keyPath)); ok && value != "" {
+			fields[fieldName] = value
+		}
+	}
+	return fields
+}
+
+func lookupKeyPath(config map[string]any, keys []string) (string, bool) {
+	var current any = config
+	for _, key := range keys {
+		table, ok := current.(map[string]any)
+		if !ok {
+			return "", false
+		}
+
+		current, ok = table[key]
+		if !ok {
+			return "", false
+		}
+	}
+
+	switch value := current.(type) {
+	case map[string]any, []any, []map[string]any:
+		return "", false
+	case string:
+		return value, true
+	default:
+		return fmt.Sprint(value), true
+	}
+}
@@ -0,0 +1,96 @@
+package importer
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/schema/fieldname"
+)
+
+// dockerConfig is the part of ~/.docker/config.json that TryDockerConfig reads.
+type dockerConfig struct {
+	Auths map[string]struct {
+		Auth     string `json:"auth"`
+		Username string `json:"username"`
+		Password string `json:"password"`
+	} `json:"auths"`
+	CredHelpers map[string]string `json:"credHelpers"`
+	CredsStore  string            `json:"credsStore"`
+}
+
+// TryDockerConfig tries to find registry credentials in ~/.docker/config.json, and adds an import candidate for each
+// registry in the "auths" map, with the Username, Password, and Registry fields. The name hint is the hostname of
+// the registry.
+//
+// Docker only uses the credentials in the file if no credential helper is configured for the registry, so registries
+// with an entry in "credHelpers" are skipped, and so are all registries if "credsStore" is set. The secrets of these
+// registries are stored by the helper instead, so they can't be imported from the file. Entries that only contain an
+// identity token are skipped as well.
+func TryDockerConfig() sdk.Importer {
+	return TryFile("~/.docker/config.json", func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt) {
+		var config dockerConfig
+		if err := contents.ToJSON(&config); err != nil {
+			out.AddError(err)
+			return
+		}
+
+		if config.CredsStore != "" {
+			return
+		}
+
+		registries := make([]string, 0, len(config.Auths))
+		for registry := range config.Auths {
+			registries = append(registries, registry)
+		}
+		sort.Strings(registries)
+
+		for _, registry := range registries {
+			if config.CredHelpers[registry] != "" {
+				continue
+			}
+
+			entry := config.Auths[registry]
+			username, password := entry.Username, entry.Password
+			if entry.Auth != "" {
+				decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+				if err != nil {
+					out.AddError(fmt.Errorf("decoding auth for registry %s: %w", registry, err))
+					continue
+				}
+				var ok bool
+				username, password, ok = strings.Cut(string(decoded), ":")
+				if !ok {
+					out.AddError(fmt.Errorf("decoding auth for registry %s: expected username:password", registry))
+					continue
+				}
+			}
+			if username == "" || password == "" {
+				continue
+			}
+
+			out.AddCandidate(sdk.ImportCandidate{
+				Fields: map[sdk.FieldName]string{
+					fieldname.Username: username,
+					fieldname.Password: password,
+					fieldname.Registry: registry,
+				},
+				NameHint: SanitizeNameHint(dockerRegistryHost(registry)),
+			})
+		}
+	})
+}
+
+// dockerRegistryHost returns the hostname of the registry, which can be specified as a URL, e.g.
+// "https://index.docker.io/v1/", or as a hostname with an optional port.
+func dockerRegistryHost(registry string) string {
+	host := registry
+	if i := strings.Index(host, "://"); i >= 0 {
+		host = host[i+len("://"):]
+	}
+	host, _, _ = strings.Cut(host, "/")
+	return host
+}
@@ -0,0 +1,73 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/1Password/shell-plugins/sdk/schema/fieldname"
+)
+
+func TestTryDockerConfig(t *testing.T) {
+	plugintest.TestImporter(t, TryDockerConfig(), map[string]plugintest.ImportCase{
+		"auths": {
+			Files: map[string]string{
+				"~/.docker/config.json": `{
+					"auths": {
+						"https://index.docker.io/v1/": {"auth": "d2VuZHk6aHVudGVyMg=="},
+						"registry.acme.io:5000": {"auth": "Y2k6Z2xwYXQ6RVhBTVBMRQ=="},
+						"ghcr.io": {"auth": "d2VuZHk6aHVudGVyMg=="},
+						"quay.io": {"identitytoken": "EXAMPLE"}
+					},
+					"credHelpers": {
+						"ghcr.io": "gh"
+					}
+				}`,
+			},
+			ExpectedCandidates: []sdk.ImportCandidate{
+				{
+					Fields: map[sdk.FieldName]string{
+						fieldname.Username: "wendy",
+						fieldname.Password: "hunter2",
+						fieldname.Registry: "https://index.docker.io/v1/",
+					},
+					NameHint: "index.docker.io",
+				},
+				{
+					Fields: map[sdk.FieldName]string{
+						fieldname.Username: "ci",
+						fieldname.Password: "glpat:EXAMPLE",
+						fieldname.Registry: "registry.acme.io:5000",
+					},
+					NameHint: "registry.acme.io:5000",
+				},
+			},
+		},
+		"creds store": {
+			Files: map[string]string{
+				"~/.docker/config.json": `{
+					"auths": {
+						"https://index.docker.io/v1/": {}
+					},
+					"credsStore": "desktop"
+				}`,
+			},
+			ExpectedCandidates: nil,
+		},
+		"invalid auth": {
+			Files: map[string]string{
+				"~/.docker/config.json": `{"auths": {"ghcr.io": {"auth": "not base64"}}}`,
+			},
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{
+						Source: sdk.ImportSource{Files: []string{"~/.docker/config.json"}},
+						Diagnostics: sdk.Diagnostics{
+							Errors: []sdk.Error{{Message: "decoding auth for registry ghcr.io: illegal base64 data at input byte 3"}},
+						},
+					},
+				},
+			},
+		},
+	})
+}
@@ -1,9 +1,13 @@
 package importer
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
 	"encoding/json"
 	"encoding/xml"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
@@ -16,13 +20,7 @@ import (
 
 func TryFile(path string, result func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt)) sdk.Importer {
 	return func(ctx context.Context, in sdk.ImportInput, out *sdk.ImportOutput) {
-		abspath := path
-		if strings.HasPrefix(path, "~/") {
-			abspath = filepath.Join(in.HomeDir, strings.TrimPrefix(path, "~/"))
-		} else if strings.HasPrefix(path, "/") {
-			abspath = filepath.Join(in.RootDir, path)
-		}
-
+		abspath := resolvePath(path, in)
 		attempt := out.NewAttempt(SourceFile(path))
 		contents, err := os.ReadFile(abspath)
 		if os.IsNotExist(err) {
@@ -36,6 +34,65 @@ func TryFile(path string, result func(ctx context.Context, contents FileContents
 	}
 }
 
+// maxDecompressedSize is the maximum size of a gzipped file after decompressing, which protects against files that
+// decompress to a lot more data than any config file would contain.
+const maxDecompressedSize = 10 << 20
+
+// TryGzippedFile works like TryFile, but gunzips the file contents before passing them to the result function. If
+// the file isn't gzipped or decompresses to more than 10 MiB, an error is reported.
+func TryGzippedFile(path string, result func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt)) sdk.Importer {
+	return TryFile(path, func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt) {
+		r, err := gzip.NewReader(bytes.NewReader(contents))
+		if err != nil {
+			out.AddError(fmt.Errorf("decompressing %s: %w", path, err))
+			return
+		}
+		defer r.Close()
+
+		decompressed, err := io.ReadAll(io.LimitReader(r, maxDecompressedSize+1))
+		if err != nil {
+			out.AddError(fmt.Errorf("decompressing %s: %w", path, err))
+			return
+		}
+		if len(decompressed) > maxDecompressedSize {
+			out.AddError(fmt.Errorf("decompressing %s: file is larger than %d bytes", path, maxDecompressedSize))
+			return
+		}
+
+		result(ctx, decompressed, in, out)
+	})
+}
+
+// resolvePath resolves a path starting with "~/" relative to the home dir, and an absolute path relative to the
+// root dir.
+func resolvePath(path string, in sdk.ImportInput) string {
+	if strings.HasPrefix(path, "~/") {
+		return filepath.Join(in.HomeDir, strings.TrimPrefix(path, "~/"))
+	} else if strings.HasPrefix(path, "/") {
+		return filepath.Join(in.RootDir, path)
+	}
+	return path
+}
+
+// unresolvePath reverts resolvePath, so that a path found on disk can be shown to the user in the same form as the
+// path it was resolved from.
+func unresolvePath(path string, abspath string, in sdk.ImportInput) string {
+	prefix, base := "", ""
+	if strings.HasPrefix(path, "~/") {
+		prefix, base = "~/", in.HomeDir
+	} else if strings.HasPrefix(path, "/") {
+		prefix, base = "/", in.RootDir
+	} else {
+		return abspath
+	}
+
+	rel, err := filepath.Rel(base, abspath)
+	if err != nil {
+		return abspath
+	}
+	return prefix + filepath.ToSlash(rel)
+}
+
 type FileContents []byte
 
 func (fc FileContents) ToString() string {
@@ -0,0 +1,64 @@
+package importer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+)
+
+func TestTryGzippedFile(t *testing.T) {
+	var compressed bytes.Buffer
+	w := gzip.NewWriter(&compressed)
+	_, _ = w.Write([]byte(`{"token": "tok_EXAMPLE"}`))
+	_ = w.Close()
+
+	plugintest.TestImporter(t, TryGzippedFile("~/.tool/credentials.json.gz", func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt) {
+		var config struct {
+			Token string `json:"token"`
+		}
+		if err := contents.ToJSON(&config); err != nil {
+			out.AddError(err)
+			return
+		}
+		out.AddCandidate(sdk.ImportCandidate{
+			Fields: map[sdk.FieldName]string{
+				"Token": config.Token,
+			},
+		})
+	}), map[string]plugintest.ImportCase{
+		"gzipped file": {
+			Files: map[string]string{
+				"~/.tool/credentials.json.gz": compressed.String(),
+			},
+			ExpectedCandidates: []sdk.ImportCandidate{
+				{
+					Fields: map[sdk.FieldName]string{
+						"Token": "tok_EXAMPLE",
+					},
+				},
+			},
+		},
+		"not gzipped": {
+			Files: map[string]string{
+				"~/.tool/credentials.json.gz": `{"token": "tok_EXAMPLE"}`,
+			},
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{
+						Source: sdk.ImportSource{Files: []string{"~/.tool/credentials.json.gz"}},
+						Diagnostics: sdk.Diagnostics{
+							Errors: []sdk.Error{{Message: "decompressing ~/.tool/credentials.json.gz: gzip: invalid header"}},
+						},
+					},
+				},
+			},
+		},
+		"no file": {
+			ExpectedCandidates: nil,
+		},
+	})
+}
@@ -0,0 +1,59 @@
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// keychainItemNotFoundExitCode is the exit code of the `security` command when the requested item does not exist.
+const keychainItemNotFoundExitCode = 44
+
+// MacKeychainGenericPassword tries to read the generic password stored under the specified service name in the
+// macOS login keychain, and adds an import candidate with the password as the specified field. It's a no-op on
+// other operating systems or if the keychain doesn't contain an item for the service. The `security` command is
+// killed after 5 seconds, like the commands of TryCommand. The password is never included in any error.
+func MacKeychainGenericPassword(service string, fieldName sdk.FieldName) sdk.Importer {
+	return func(ctx context.Context, in sdk.ImportInput, out *sdk.ImportOutput) {
+		if in.OS != "darwin" {
+			return
+		}
+
+		attempt := out.NewAttempt(SourceOther("macOS Keychain", service))
+
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+
+		cmd := exec.CommandContext(ctx, "security", "find-generic-password", "-s", service, "-w")
+		stdout, err := cmd.Output()
+		if ctx.Err() == context.DeadlineExceeded {
+			// The keychain can prompt the user for access, which shouldn't block importing.
+			attempt.AddError(fmt.Errorf("reading keychain item for service '%s' timed out after %s", service, commandTimeout))
+			return
+		}
+		if err != nil {
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				if exitErr.ExitCode() != keychainItemNotFoundExitCode {
+					attempt.AddError(fmt.Errorf("reading keychain item for service '%s' failed with exit code %d", service, exitErr.ExitCode()))
+				}
+				return
+			}
+			attempt.AddError(fmt.Errorf("reading keychain item for service '%s': %w", service, err))
+			return
+		}
+
+		password := strings.TrimSuffix(string(stdout), "\n")
+		if password != "" {
+			attempt.AddCandidate(sdk.ImportCandidate{
+				Fields: map[sdk.FieldName]string{
+					fieldName: password,
+				},
+			})
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"path"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// PassStorePassword is the key in the mapping of TryPassStore that the first line of the entry, which holds the
+// password by convention, gets mapped by.
+const PassStorePassword = "password"
+
+// passEntryNotFoundExitCode is the exit code of `pass show` when the entry doesn't exist in the password store. Other
+// non-zero exit codes are passed through from gpg, which fails if the key of the store can't be unlocked.
+const passEntryNotFoundExitCode = 1
+
+// TryPassStore tries to read the entry at the specified path from the password store of pass, the standard Unix
+// password manager, by running `pass show <entryPath>`, and adds an import candidate with the fields in the mapping.
+// The first line of the entry is the password, which can be mapped using the PassStorePassword key. The lines after it
+// that have the form "key: value" can be mapped using their key, e.g. "login" for a "login: wendy" line. Other lines
+// and keys that are not in the mapping are ignored.
+//
+// It's a no-op if pass is not installed or the entry doesn't exist. If the GPG key of the store is locked and can't be
+// unlocked without user interaction, an error is reported that asks the user to unlock the store first. Just like
+// with TryCommand, pass gets no stdin, is killed after 5 seconds, and its stderr is discarded.
+func TryPassStore(entryPath string, mapping map[string]sdk.FieldName) sdk.Importer {
+	return func(ctx context.Context, in sdk.ImportInput, out *sdk.ImportOutput) {
+		if _, err := exec.LookPath("pass"); err != nil {
+			return
+		}
+
+		attempt := out.NewAttempt(SourceOther("pass", entryPath))
+
+		ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+		defer cancel()
+
+		// The "--" makes sure the entry path never gets interpreted as an option.
+		cmd := exec.CommandContext(ctx, "pass", "show", "--", entryPath)
+		cmd.Stderr = io.Discard
+		stdout, err := cmd.Output()
+		if err != nil {
+			var exitErr *exec.ExitError
+			if ctx.Err() == context.DeadlineExceeded || (errors.As(err, &exitErr) && exitErr.ExitCode() != passEntryNotFoundExitCode) {
+				// gpg either failed to decrypt the entry or is waiting for the passphrase.
+				attempt.AddError(fmt.Errorf("the password store is locked: unlock it by running 'pass show %s' and try again", entryPath))
+			} else if !errors.As(err, &exitErr) {
+				attempt.AddError(fmt.Errorf("running 'pass show %s': %w", entryPath, err))
+			}
+			return
+		}
+
+		fields := make(map[sdk.FieldName]string)
+		for key, value := range parsePassEntry(stdout) {
+			if fieldName, ok := mapping[key]; ok && value != "" {
+				fields[fieldName] = value
+			}
+		}
+		if len(fields) == 0 {
+			return
+		}
+
+		attempt.AddCandidate(sdk.ImportCandidate{
+			Fields:   fields,
+			NameHint: SanitizeNameHint(path.Base(entryPath)),
+		})
+	}
+}
+
+// parsePassEntry parses the decrypted contents of a pass entry into the password on the first line, keyed by
+// PassStorePassword, and the "key: value" pairs on the lines after it. A pair can't override the password.
+func parsePassEntry(contents []byte) map[string]string {
+	values := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	for first := true; scanner.Scan(); first = false {
+		line := strings.TrimSuffix(scanner.Text(), "\r")
+		if first {
+			values[PassStorePassword] = line
+			continue
+		}
+
+		key, value, ok := strings.Cut(line, ":")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || key == PassStorePassword {
+			continue
+		}
+		if _, exists := values[key]; !exists {
+			values[key] = strings.TrimSpace(value)
+		}
+	}
+	return values
+}
@@ -0,0 +1,94 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakePass is a stand-in for pass, with an unlocked entry at "dev/tool", a locked entry at "dev/locked", and no other
+// entries, using the exit codes of pass.
+const fakePass = `#!/bin/sh
+case "$3" in
+dev/tool)
+	printf 'hunter2\nlogin: wendy\nurl: https://tool.example.com\nsome note\npassword: overridden\n'
+	;;
+dev/locked)
+	echo "gpg: decryption failed: No secret key" >&2
+	exit 2
+	;;
+*)
+	echo "Error: $3 is not in the password store." >&2
+	exit 1
+	;;
+esac
+`
+
+func TestTryPassStore(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("pass is not available on Windows")
+	}
+
+	binDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(binDir, "pass"), []byte(fakePass), 0700)
+	assert.NoError(t, err)
+	t.Setenv("PATH", binDir)
+
+	mapping := map[string]sdk.FieldName{
+		PassStorePassword: "Password",
+		"login":           "Username",
+		"url":             "Website",
+	}
+
+	plugintest.TestImporter(t, TryPassStore("dev/tool", mapping), map[string]plugintest.ImportCase{
+		"entry": {
+			ExpectedCandidates: []sdk.ImportCandidate{
+				{
+					Fields: map[sdk.FieldName]string{
+						"Password": "hunter2",
+						"Username": "wendy",
+						"Website":  "https://tool.example.com",
+					},
+					NameHint: "tool",
+				},
+			},
+		},
+	})
+
+	plugintest.TestImporter(t, TryPassStore("dev/missing", mapping), map[string]plugintest.ImportCase{
+		"missing entry": {
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{Source: SourceOther("pass", "dev/missing")},
+				},
+			},
+		},
+	})
+
+	plugintest.TestImporter(t, TryPassStore("dev/locked", mapping), map[string]plugintest.ImportCase{
+		"locked store": {
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{
+						Source: SourceOther("pass", "dev/locked"),
+						Diagnostics: sdk.Diagnostics{
+							Errors: []sdk.Error{{Message: "the password store is locked: unlock it by running 'pass show dev/locked' and try again"}},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	t.Setenv("PATH", t.TempDir())
+	plugintest.TestImporter(t, TryPassStore("dev/tool", mapping), map[string]plugintest.ImportCase{
+		"not installed": {
+			ExpectedOutput: &sdk.ImportOutput{},
+		},
+	})
+}
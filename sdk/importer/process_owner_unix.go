@@ -0,0 +1,14 @@
+//go:build !windows
+
+package importer
+
+import (
+	"os"
+	"syscall"
+)
+
+// ownedByCurrentUser returns whether the file is owned by the user that runs the plugin.
+func ownedByCurrentUser(info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && int(stat.Uid) == os.Getuid()
+}
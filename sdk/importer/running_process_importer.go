@@ -0,0 +1,132 @@
+package importer
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// TryRunningProcess tries to find a credential that's passed as a command-line arg to a running process of the
+// executable with the specified name, e.g. "tool" for a process started with `tool serve --token=xxx`, and adds an
+// import candidate with the credential as the specified field. The args of the process are joined with spaces and
+// matched against argPattern, a regular expression with exactly one capture group for the credential, so that both
+// `--token=(\S+)` and `--token (\S+)` can be used.
+//
+// Since the args of other processes can contain all kinds of sensitive data, this importer is a no-op unless the user
+// explicitly opted in, see ImportInput.IncludeRunningProcesses. Only the processes of the current user are scanned,
+// using /proc on Linux and `ps` on macOS, and neither the args nor the credential are ever included in any
+// diagnostics. It's a no-op on other operating systems.
+func TryRunningProcess(processName string, argPattern string, fieldName sdk.FieldName) sdk.Importer {
+	return func(ctx context.Context, in sdk.ImportInput, out *sdk.ImportOutput) {
+		if !in.IncludeRunningProcesses || (in.OS != "linux" && in.OS != "darwin") {
+			return
+		}
+
+		attempt := out.NewAttempt(SourceOther("running process", processName))
+
+		pattern, err := regexp.Compile(argPattern)
+		if err != nil {
+			attempt.AddError(fmt.Errorf("invalid arg pattern '%s': %w", argPattern, err))
+			return
+		}
+		if pattern.NumSubexp() != 1 {
+			attempt.AddError(fmt.Errorf("invalid arg pattern '%s': it has to contain exactly one capture group", argPattern))
+			return
+		}
+
+		var processes [][]string
+		if in.OS == "linux" {
+			processes, err = linuxProcessArgs(in)
+		} else {
+			processes, err = darwinProcessArgs(ctx)
+		}
+		if err != nil {
+			attempt.AddError(fmt.Errorf("listing running processes: %w", err))
+			return
+		}
+
+		seen := make(map[string]bool)
+		for _, args := range processes {
+			if len(args) == 0 || filepath.Base(args[0]) != processName {
+				continue
+			}
+
+			match := pattern.FindStringSubmatch(strings.Join(args[1:], " "))
+			if match == nil || match[1] == "" || seen[match[1]] {
+				continue
+			}
+			seen[match[1]] = true
+
+			attempt.AddCandidate(sdk.ImportCandidate{
+				Fields: map[sdk.FieldName]string{
+					fieldName: match[1],
+				},
+			})
+		}
+	}
+}
+
+// linuxProcessArgs returns the args of the processes of the current user, read from /proc/<pid>/cmdline. Processes
+// that exit while scanning or whose args can't be read are skipped.
+func linuxProcessArgs(in sdk.ImportInput) ([][]string, error) {
+	procDir := in.FromRootDir("proc")
+	entries, err := os.ReadDir(procDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var processes [][]string
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() || pid == os.Getpid() {
+			continue
+		}
+
+		// The /proc/<pid> dir is owned by the user that the process runs as.
+		info, err := entry.Info()
+		if err != nil || !ownedByCurrentUser(info) {
+			continue
+		}
+
+		cmdline, err := os.ReadFile(filepath.Join(procDir, entry.Name(), "cmdline"))
+		if err != nil || len(cmdline) == 0 {
+			continue
+		}
+		processes = append(processes, strings.Split(strings.TrimSuffix(string(cmdline), "\x00"), "\x00"))
+	}
+	return processes, nil
+}
+
+// darwinProcessArgs returns the args of the processes of the current user, as listed by `ps`. Since ps joins the args
+// with spaces, args that contain spaces are split up.
+func darwinProcessArgs(ctx context.Context) ([][]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, commandTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, "ps", "-U", strconv.Itoa(os.Getuid()), "-o", "pid=,command=")
+	stdout, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("running ps: %w", err)
+	}
+
+	var processes [][]string
+	scanner := bufio.NewScanner(bytes.NewReader(stdout))
+	scanner.Buffer(nil, 1024*1024)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] == strconv.Itoa(os.Getpid()) {
+			continue
+		}
+		processes = append(processes, fields[1:])
+	}
+	return processes, scanner.Err()
+}
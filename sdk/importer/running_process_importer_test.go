@@ -0,0 +1,81 @@
+package importer
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/1Password/shell-plugins/sdk/schema/fieldname"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTryRunningProcess(t *testing.T) {
+	files := map[string]string{
+		"/proc/4242/cmdline": "/usr/local/bin/tool\x00serve\x00--token=tok_EXAMPLE\x00",
+		"/proc/4243/cmdline": "tool\x00serve\x00--token\x00tok_OTHER\x00",
+		"/proc/4244/cmdline": "tool\x00serve\x00--token=tok_EXAMPLE\x00",
+		"/proc/4245/cmdline": "/usr/bin/other-tool\x00--token=tok_UNRELATED\x00",
+		"/proc/4246/cmdline": "tool\x00version\x00",
+		"/proc/self/cmdline": "tool\x00--token=tok_SELF\x00",
+	}
+
+	plugintest.TestImporter(t, TryRunningProcess("tool", `--token[= ](\S+)`, fieldname.Token), map[string]plugintest.ImportCase{
+		"opted in": {
+			OS:                      "linux",
+			IncludeRunningProcesses: true,
+			Files:                   files,
+			ExpectedCandidates: []sdk.ImportCandidate{
+				{Fields: map[sdk.FieldName]string{fieldname.Token: "tok_EXAMPLE"}},
+				{Fields: map[sdk.FieldName]string{fieldname.Token: "tok_OTHER"}},
+			},
+		},
+		"not opted in": {
+			OS:    "linux",
+			Files: files,
+		},
+	})
+
+	plugintest.TestImporter(t, TryRunningProcess("tool", `--token=\S+`, fieldname.Token), map[string]plugintest.ImportCase{
+		"no capture group": {
+			OS:                      "linux",
+			IncludeRunningProcesses: true,
+			Files:                   files,
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{
+						Source: SourceOther("running process", "tool"),
+						Diagnostics: sdk.Diagnostics{
+							Errors: []sdk.Error{{Message: `invalid arg pattern '--token=\S+': it has to contain exactly one capture group`}},
+						},
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestTryRunningProcessSkipsOtherUsers(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("changing the owner of the fake process requires root")
+	}
+
+	rootDir := t.TempDir()
+	procDir := filepath.Join(rootDir, "proc", "4242")
+	assert.NoError(t, os.MkdirAll(procDir, 0755))
+	assert.NoError(t, os.WriteFile(filepath.Join(procDir, "cmdline"), []byte("tool\x00--token=tok_EXAMPLE\x00"), 0644))
+	assert.NoError(t, os.Chown(procDir, 65534, 65534))
+
+	out := sdk.ImportOutput{}
+	TryRunningProcess("tool", `--token=(\S+)`, fieldname.Token)(context.Background(), sdk.ImportInput{
+		RootDir:                 rootDir,
+		OS:                      "linux",
+		IncludeRunningProcesses: true,
+	}, &out)
+
+	assert.Len(t, out.Attempts, 1)
+	assert.Empty(t, out.Attempts[0].Candidates)
+	assert.Empty(t, out.Attempts[0].Diagnostics.Errors)
+}
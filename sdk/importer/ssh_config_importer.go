@@ -0,0 +1,333 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// sshAgentTimeout is how long TrySSHConfigIdentityFiles waits for the SSH agent to list its keys.
+const sshAgentTimeout = 2 * time.Second
+
+// TrySSHConfigIdentityFiles tries to find the private keys referenced by IdentityFile directives in ~/.ssh/config,
+// and adds an import candidate for each key with its contents stored in the specified field. Paths starting with
+// "~/" or "%d/" are resolved relative to the home dir, and relative paths relative to ~/.ssh. Paths that contain
+// other tokens, such as "%h", are skipped, since they depend on the host that gets connected to. Include
+// directives are not followed.
+//
+// Each candidate gets the first host without wildcards that the key is used for as its name hint, and the filename
+// of the key otherwise. Keys that are protected with a passphrase are skipped with a warning, since they can't be
+// used without the passphrase, and so are keys that are already loaded in the SSH agent at SSH_AUTH_SOCK. Keys that
+// are referenced but don't exist are skipped silently.
+func TrySSHConfigIdentityFiles(fieldName sdk.FieldName) sdk.Importer {
+	return func(ctx context.Context, in sdk.ImportInput, out *sdk.ImportOutput) {
+		const configPath = "~/.ssh/config"
+		config, err := os.ReadFile(resolvePath(configPath, in))
+		if os.IsNotExist(err) {
+			return
+		} else if err != nil {
+			out.NewAttempt(SourceFile(configPath)).AddError(err)
+			return
+		}
+
+		var agentKeys map[string]bool
+		for _, identity := range parseSSHConfigIdentityFiles(config) {
+			if ctx.Err() != nil {
+				return
+			}
+
+			path := identity.path
+			if !identity.supported {
+				out.NewAttempt(SourceFile(configPath)).AddWarning(fmt.Sprintf("skipping IdentityFile %s: only the %%d token is supported", path))
+				continue
+			}
+
+			contents, err := os.ReadFile(resolvePath(path, in))
+			if os.IsNotExist(err) {
+				continue
+			}
+
+			attempt := out.NewAttempt(SourceFile(path))
+			if os.IsPermission(err) {
+				attempt.AddWarning(fmt.Sprintf("skipping %s: permission denied", path))
+				continue
+			} else if err != nil {
+				attempt.AddError(err)
+				continue
+			}
+
+			key, err := parseSSHPrivateKey(contents)
+			if err != nil {
+				attempt.AddError(fmt.Errorf("parsing %s: %w", path, err))
+				continue
+			}
+			if key.encrypted {
+				attempt.AddWarning(fmt.Sprintf("skipping %s: the key is protected with a passphrase", path))
+				continue
+			}
+
+			publicKey := key.publicKey
+			if publicKey == nil {
+				publicKey = readSSHPublicKey(resolvePath(path, in) + ".pub")
+			}
+			if publicKey != nil {
+				if agentKeys == nil {
+					agentKeys = sshAgentKeys(ctx)
+				}
+				if agentKeys[string(publicKey)] {
+					attempt.AddWarning(fmt.Sprintf("skipping %s: the key is already loaded in the SSH agent", path))
+					continue
+				}
+			}
+
+			nameHint := filepath.Base(path)
+			for _, host := range identity.hosts {
+				if !strings.ContainsAny(host, "*?") {
+					nameHint = host
+					break
+				}
+			}
+
+			attempt.AddCandidate(sdk.ImportCandidate{
+				Fields: map[sdk.FieldName]string{
+					fieldName: string(contents),
+				},
+				NameHint: SanitizeNameHint(nameHint),
+			})
+		}
+	}
+}
+
+// sshConfigIdentity is an IdentityFile referenced in an SSH config, with the hosts it's used for.
+type sshConfigIdentity struct {
+	// path is the path converted by sshIdentityFilePath, or the path as specified in the config if it's not
+	// supported.
+	path      string
+	supported bool
+	hosts     []string
+}
+
+// parseSSHConfigIdentityFiles returns the IdentityFile paths in the SSH config, in the order they first occur in.
+// Keys that are used for multiple hosts are only returned once, even if they're referenced by different paths.
+func parseSSHConfigIdentityFiles(config []byte) []*sshConfigIdentity {
+	var identities []*sshConfigIdentity
+	byPath := make(map[string]*sshConfigIdentity)
+
+	// Directives before the first Host or Match block apply to all hosts.
+	hosts := []string{"*"}
+	for _, line := range strings.Split(string(config), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		keyword, args := line, ""
+		if i := strings.IndexAny(line, " \t="); i >= 0 {
+			keyword = line[:i]
+			args = strings.TrimLeft(strings.TrimSpace(line[i:]), "=")
+			args = strings.TrimSpace(args)
+		}
+
+		switch strings.ToLower(keyword) {
+		case "host":
+			hosts = nil
+			for _, pattern := range strings.Fields(args) {
+				if !strings.HasPrefix(pattern, "!") {
+					hosts = append(hosts, pattern)
+				}
+			}
+		case "match":
+			hosts = nil
+		case "identityfile":
+			path := strings.Trim(args, `"`)
+			if path == "" || strings.EqualFold(path, "none") {
+				continue
+			}
+
+			converted, supported := sshIdentityFilePath(path)
+			if supported {
+				path = converted
+			}
+
+			identity, ok := byPath[path]
+			if !ok {
+				identity = &sshConfigIdentity{path: path, supported: supported}
+				byPath[path] = identity
+				identities = append(identities, identity)
+			}
+			identity.hosts = append(identity.hosts, hosts...)
+		}
+	}
+	return identities
+}
+
+// sshIdentityFilePath converts an IdentityFile path to a path that can be resolved by resolvePath. It returns false
+// if the path contains tokens that can't be expanded without knowing the host.
+func sshIdentityFilePath(path string) (string, bool) {
+	path = strings.ReplaceAll(path, "%d/", "~/")
+	if strings.Contains(strings.ReplaceAll(path, "%%", ""), "%") {
+		return "", false
+	}
+	path = strings.ReplaceAll(path, "%%", "%")
+
+	if !strings.HasPrefix(path, "~/") && !filepath.IsAbs(path) {
+		path = "~/.ssh/" + path
+	}
+	return path, true
+}
+
+// sshPrivateKey contains the properties of a private key that TrySSHConfigIdentityFiles needs.
+type sshPrivateKey struct {
+	encrypted bool
+
+	// publicKey is the public key in the SSH wire format. It's only known for keys in the OpenSSH format.
+	publicKey []byte
+}
+
+// parseSSHPrivateKey parses a PEM-encoded private key in the OpenSSH, PKCS#1, PKCS#8 or SEC 1 format. The key itself
+// is not decoded, only whether it's encrypted and its public key if it's stored alongside it.
+func parseSSHPrivateKey(contents []byte) (sshPrivateKey, error) {
+	block, _ := pem.Decode(contents)
+	if block == nil || !strings.HasSuffix(block.Type, "PRIVATE KEY") {
+		return sshPrivateKey{}, errors.New("not a PEM-encoded private key")
+	}
+
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return parseOpenSSHPrivateKey(block.Bytes)
+	case "ENCRYPTED PRIVATE KEY":
+		return sshPrivateKey{encrypted: true}, nil
+	default:
+		// Encrypted PKCS#1 and SEC 1 keys specify the cipher in a PEM header.
+		_, encrypted := block.Headers["DEK-Info"]
+		return sshPrivateKey{encrypted: encrypted}, nil
+	}
+}
+
+// parseOpenSSHPrivateKey parses the unencrypted header of a key in the OpenSSH format, as specified in
+// https://github.com/openssh/openssh-portable/blob/master/PROTOCOL.key.
+func parseOpenSSHPrivateKey(key []byte) (sshPrivateKey, error) {
+	const magic = "openssh-key-v1\x00"
+	if !bytes.HasPrefix(key, []byte(magic)) {
+		return sshPrivateKey{}, errors.New("invalid OpenSSH private key")
+	}
+	rest := key[len(magic):]
+
+	var cipherName, publicKey []byte
+	var ok bool
+	if cipherName, rest, ok = readSSHString(rest); !ok {
+		return sshPrivateKey{}, errors.New("invalid OpenSSH private key")
+	}
+	// Skip the KDF name and options.
+	for i := 0; i < 2 && ok; i++ {
+		_, rest, ok = readSSHString(rest)
+	}
+	if !ok || len(rest) < 4 {
+		return sshPrivateKey{}, errors.New("invalid OpenSSH private key")
+	}
+	rest = rest[4:]
+	if publicKey, _, ok = readSSHString(rest); !ok {
+		return sshPrivateKey{}, errors.New("invalid OpenSSH private key")
+	}
+
+	return sshPrivateKey{
+		encrypted: string(cipherName) != "none",
+		publicKey: publicKey,
+	}, nil
+}
+
+// readSSHPublicKey reads the public key from a file in the authorized_keys format, and returns it in the SSH wire
+// format. It returns nil if the file doesn't exist or can't be parsed.
+func readSSHPublicKey(path string) []byte {
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+
+	fields := strings.Fields(string(contents))
+	if len(fields) < 2 {
+		return nil
+	}
+	publicKey, err := base64.StdEncoding.DecodeString(fields[1])
+	if err != nil {
+		return nil
+	}
+	return publicKey
+}
+
+// sshAgentKeys returns the public keys, in the SSH wire format, that are loaded in the SSH agent at SSH_AUTH_SOCK.
+// If no agent is running or it can't be reached, no keys are returned.
+func sshAgentKeys(ctx context.Context) map[string]bool {
+	keys := make(map[string]bool)
+	socket := os.Getenv("SSH_AUTH_SOCK")
+	if socket == "" {
+		return keys
+	}
+
+	dialer := net.Dialer{Timeout: sshAgentTimeout}
+	conn, err := dialer.DialContext(ctx, "unix", socket)
+	if err != nil {
+		return keys
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(sshAgentTimeout))
+
+	// Request the identities, as specified in https://datatracker.ietf.org/doc/html/draft-miller-ssh-agent.
+	const (
+		requestIdentities = 11
+		identitiesAnswer  = 12
+		maxResponseSize   = 256 << 10
+	)
+	if _, err := conn.Write([]byte{0, 0, 0, 1, requestIdentities}); err != nil {
+		return keys
+	}
+
+	var length uint32
+	if err := binary.Read(conn, binary.BigEndian, &length); err != nil || length == 0 || length > maxResponseSize {
+		return keys
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(conn, response); err != nil || response[0] != identitiesAnswer || len(response) < 5 {
+		return keys
+	}
+
+	count := binary.BigEndian.Uint32(response[1:5])
+	rest := response[5:]
+	for i := uint32(0); i < count; i++ {
+		var publicKey []byte
+		var ok bool
+		if publicKey, rest, ok = readSSHString(rest); !ok {
+			break
+		}
+		// Skip the comment.
+		if _, rest, ok = readSSHString(rest); !ok {
+			break
+		}
+		keys[string(publicKey)] = true
+	}
+	return keys
+}
+
+// readSSHString reads a string in the SSH wire format, which is prefixed with its length as a uint32.
+func readSSHString(b []byte) (s []byte, rest []byte, ok bool) {
+	if len(b) < 4 {
+		return nil, nil, false
+	}
+	length := binary.BigEndian.Uint32(b)
+	if uint64(len(b)-4) < uint64(length) {
+		return nil, nil, false
+	}
+	return b[4 : 4+length], b[4+length:], true
+}
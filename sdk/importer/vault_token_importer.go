@@ -0,0 +1,61 @@
+package importer
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/schema/fieldname"
+)
+
+// defaultVaultTokenPath is where the Vault CLI stores the token after logging in.
+const defaultVaultTokenPath = "~/.vault-token"
+
+// vaultTokenSink is the part of a token sink file written by Vault Agent that TryVaultToken reads. Sinks with
+// response wrapping contain the wrapping info, and encrypted sinks contain the encrypted token as the payload.
+type vaultTokenSink struct {
+	Token           string `json:"token"`
+	WrappedAccessor string `json:"wrapped_accessor"`
+	Payload         string `json:"payload"`
+}
+
+// TryVaultToken tries to read a HashiCorp Vault token from the file at the specified path, or ~/.vault-token if the
+// path is empty, and adds an import candidate with the Token field. The file can hold the bare token, like the one the
+// Vault CLI writes, or be a JSON token sink written by Vault Agent, in which case the token is read from its "token"
+// key. Tokens in sinks with response wrapping have to be unwrapped first, and encrypted sinks can't be imported at
+// all, so an error is reported for these instead. It's a no-op if the file doesn't exist or is empty.
+func TryVaultToken(path string) sdk.Importer {
+	if path == "" {
+		path = defaultVaultTokenPath
+	}
+	return TryFile(path, func(ctx context.Context, contents FileContents, in sdk.ImportInput, out *sdk.ImportAttempt) {
+		token := strings.TrimSpace(contents.ToString())
+		if strings.HasPrefix(token, "{") {
+			var sink vaultTokenSink
+			if err := json.Unmarshal([]byte(token), &sink); err != nil {
+				out.AddError(fmt.Errorf("parsing token sink %s: %w", path, err))
+				return
+			}
+			switch {
+			case sink.Payload != "":
+				out.AddError(fmt.Errorf("the token sink %s is encrypted and can't be imported", path))
+				return
+			case sink.WrappedAccessor != "":
+				out.AddError(fmt.Errorf("the token in %s is response-wrapped: unwrap it with 'vault unwrap' and import the result instead", path))
+				return
+			}
+			token = strings.TrimSpace(sink.Token)
+		}
+		if token == "" {
+			return
+		}
+
+		out.AddCandidate(sdk.ImportCandidate{
+			Fields: map[sdk.FieldName]string{
+				fieldname.Token: token,
+			},
+		})
+	})
+}
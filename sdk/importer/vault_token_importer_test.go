@@ -0,0 +1,70 @@
+package importer
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/1Password/shell-plugins/sdk/schema/fieldname"
+)
+
+func TestTryVaultToken(t *testing.T) {
+	plugintest.TestImporter(t, TryVaultToken(""), map[string]plugintest.ImportCase{
+		"bare token": {
+			Files: map[string]string{
+				"~/.vault-token": "hvs.EXAMPLE\n",
+			},
+			ExpectedCandidates: []sdk.ImportCandidate{
+				{Fields: map[sdk.FieldName]string{fieldname.Token: "hvs.EXAMPLE"}},
+			},
+		},
+		"no file": {
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{Source: SourceFile("~/.vault-token")},
+				},
+			},
+		},
+	})
+
+	plugintest.TestImporter(t, TryVaultToken("~/.vault-agent/sink"), map[string]plugintest.ImportCase{
+		"token sink": {
+			Files: map[string]string{
+				"~/.vault-agent/sink": `{"token": "hvs.EXAMPLE", "accessor": "EXAMPLE", "ttl": 3600}`,
+			},
+			ExpectedCandidates: []sdk.ImportCandidate{
+				{Fields: map[sdk.FieldName]string{fieldname.Token: "hvs.EXAMPLE"}},
+			},
+		},
+		"wrapped token sink": {
+			Files: map[string]string{
+				"~/.vault-agent/sink": `{"token": "hvs.WRAPPING", "ttl": 300, "wrapped_accessor": "EXAMPLE"}`,
+			},
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{
+						Source: SourceFile("~/.vault-agent/sink"),
+						Diagnostics: sdk.Diagnostics{
+							Errors: []sdk.Error{{Message: "the token in ~/.vault-agent/sink is response-wrapped: unwrap it with 'vault unwrap' and import the result instead"}},
+						},
+					},
+				},
+			},
+		},
+		"encrypted token sink": {
+			Files: map[string]string{
+				"~/.vault-agent/sink": `{"curve25519_public_key": "EXAMPLE", "nonce": "EXAMPLE", "payload": "EXAMPLE"}`,
+			},
+			ExpectedOutput: &sdk.ImportOutput{
+				Attempts: []*sdk.ImportAttempt{
+					{
+						Source: SourceFile("~/.vault-agent/sink"),
+						Diagnostics: sdk.Diagnostics{
+							Errors: []sdk.Error{{Message: "the token sink ~/.vault-agent/sink is encrypted and can't be imported"}},
+						},
+					},
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,107 @@
+package sdk
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportOutputDeduplicate(t *testing.T) {
+	expiresAt := time.Now().Add(time.Hour)
+	out := ImportOutput{
+		Attempts: []*ImportAttempt{
+			{
+				Candidates: []ImportCandidate{
+					{Fields: map[FieldName]string{"Token": "abc"}},
+					{Fields: map[FieldName]string{"Token": "def"}},
+				},
+			},
+			{
+				Candidates: []ImportCandidate{
+					{Fields: map[FieldName]string{"Token": "abc"}, NameHint: "work", ExpiresAt: &expiresAt},
+					{Fields: map[FieldName]string{"Token": "abc", "Host": "example.com"}},
+				},
+			},
+		},
+	}
+
+	out.Deduplicate()
+
+	assert.Equal(t, []ImportCandidate{
+		{Fields: map[FieldName]string{"Token": "abc"}, NameHint: "work", ExpiresAt: &expiresAt},
+		{Fields: map[FieldName]string{"Token": "def"}},
+	}, out.Attempts[0].Candidates)
+	assert.Equal(t, []ImportCandidate{
+		{Fields: map[FieldName]string{"Token": "abc", "Host": "example.com"}},
+	}, out.Attempts[1].Candidates)
+}
+
+func TestImportOutputDeduplicateKeepsHighestRankedSource(t *testing.T) {
+	configFile := &ImportAttempt{
+		Source: ImportSource{Files: []string{"~/.config/tool.yml"}},
+		Candidates: []ImportCandidate{
+			{Fields: map[FieldName]string{"Token": "abc"}, NameHint: "work"},
+		},
+	}
+	envVars := &ImportAttempt{
+		Source: ImportSource{Env: []string{"TOOL_TOKEN"}},
+		Candidates: []ImportCandidate{
+			{Fields: map[FieldName]string{"Token": "abc"}},
+		},
+	}
+	out := ImportOutput{
+		Attempts: []*ImportAttempt{configFile, envVars},
+	}
+
+	out.Deduplicate()
+	out.Rank([]FieldName{"Token"})
+
+	assert.Empty(t, configFile.Candidates)
+	assert.Equal(t, []ImportCandidate{
+		{Fields: map[FieldName]string{"Token": "abc"}, NameHint: "work", Score: ScoreEnvVarSource + 1},
+	}, envVars.Candidates)
+	assert.Equal(t, []*ImportAttempt{envVars, configFile}, out.Attempts)
+}
+
+func TestImportOutputRank(t *testing.T) {
+	keychain := &ImportAttempt{
+		Source: ImportSource{Other: CustomSource{Type: "macOS Keychain"}},
+		Candidates: []ImportCandidate{
+			{Fields: map[FieldName]string{"Token": "keychain"}},
+		},
+	}
+	configFile := &ImportAttempt{
+		Source: ImportSource{Files: []string{"~/.config/tool.yml"}},
+		Candidates: []ImportCandidate{
+			{Fields: map[FieldName]string{"Token": "partial"}},
+			{Fields: map[FieldName]string{"Token": "complete", "Host": "example.com"}},
+		},
+	}
+	envVars := &ImportAttempt{
+		Source: ImportSource{Env: []string{"TOOL_TOKEN"}},
+		Candidates: []ImportCandidate{
+			{Fields: map[FieldName]string{"Token": "env"}},
+		},
+	}
+	explicit := &ImportAttempt{
+		Source: ImportSource{Other: CustomSource{Type: "Custom"}},
+		Candidates: []ImportCandidate{
+			{Fields: map[FieldName]string{"Token": "explicit"}, Score: 1000},
+		},
+	}
+	out := ImportOutput{
+		Attempts: []*ImportAttempt{keychain, configFile, envVars, explicit},
+	}
+
+	out.Rank([]FieldName{"Token", "Host"})
+
+	assert.Equal(t, []*ImportAttempt{explicit, envVars, configFile, keychain}, out.Attempts)
+	assert.Equal(t, []ImportCandidate{
+		{Fields: map[FieldName]string{"Token": "complete", "Host": "example.com"}, Score: ScoreFileSource + 2},
+		{Fields: map[FieldName]string{"Token": "partial"}, Score: ScoreFileSource + 1},
+	}, configFile.Candidates)
+	assert.Equal(t, ScoreEnvVarSource+1, envVars.Candidates[0].Score)
+	assert.Equal(t, ScoreOtherSource+1, keychain.Candidates[0].Score)
+	assert.Equal(t, 1000, explicit.Candidates[0].Score)
+}
@@ -0,0 +1,106 @@
+package dotenv
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+)
+
+var referencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// Parser parses the contents of .env files, for both importer.TryDotEnvFile and provision.DotEnvField. Each line has
+// the format "KEY=value", optionally prefixed with "export". Values can be single-quoted, double-quoted, or unquoted.
+// Blank lines and comments starting with "#" are ignored.
+type Parser struct {
+	// ExpandReferences resolves "${VAR}" references in values that aren't single-quoted, against the variables
+	// defined earlier in the same file first, and against the environment otherwise.
+	ExpandReferences bool
+}
+
+// Parse returns the variables defined in the .env file. If a variable is defined more than once, the last definition
+// wins. Errors contain the number of the offending line, but never the value on it.
+func (p Parser) Parse(contents []byte) (map[string]string, error) {
+	vars := make(map[string]string)
+	scanner := bufio.NewScanner(bytes.NewReader(contents))
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if rest := strings.TrimPrefix(line, "export"); rest != line && (rest == "" || rest[0] == ' ' || rest[0] == '\t') {
+			line = strings.TrimSpace(rest)
+		}
+
+		key, rawValue, ok := strings.Cut(line, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" || strings.ContainsAny(key, " \t") {
+			return nil, fmt.Errorf("invalid line %d: expected KEY=value", lineNumber)
+		}
+
+		value, quote, err := unquoteValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return nil, fmt.Errorf("invalid value for %s on line %d: %w", key, lineNumber, err)
+		}
+
+		if p.ExpandReferences && quote != '\'' {
+			value = referencePattern.ReplaceAllStringFunc(value, func(reference string) string {
+				name := referencePattern.FindStringSubmatch(reference)[1]
+				if resolved, ok := vars[name]; ok {
+					return resolved
+				}
+				return os.Getenv(name)
+			})
+		}
+
+		vars[key] = value
+	}
+	return vars, scanner.Err()
+}
+
+// unquoteValue returns the value without its quotes, along with the quote character that was used, if any.
+// Escape sequences are only interpreted in double-quoted values. Unquoted values end at an inline comment.
+func unquoteValue(value string) (string, byte, error) {
+	if value == "" {
+		return "", 0, nil
+	}
+
+	quote := value[0]
+	if quote != '"' && quote != '\'' {
+		if i := strings.Index(value, " #"); i >= 0 {
+			value = value[:i]
+		}
+		return strings.TrimSpace(value), 0, nil
+	}
+
+	var unquoted strings.Builder
+	for i := 1; i < len(value); i++ {
+		c := value[i]
+		switch {
+		case c == quote:
+			rest := strings.TrimSpace(value[i+1:])
+			if rest != "" && !strings.HasPrefix(rest, "#") {
+				return "", 0, fmt.Errorf("unexpected characters after closing quote")
+			}
+			return unquoted.String(), quote, nil
+		case c == '\\' && quote == '"' && i+1 < len(value):
+			i++
+			switch value[i] {
+			case 'n':
+				unquoted.WriteByte('\n')
+			case 't':
+				unquoted.WriteByte('\t')
+			default:
+				unquoted.WriteByte(value[i])
+			}
+		default:
+			unquoted.WriteByte(c)
+		}
+	}
+	return "", 0, fmt.Errorf("missing closing quote")
+}
@@ -0,0 +1,25 @@
+package keypath
+
+import "strings"
+
+// Split splits a key path into its keys, for the key paths of provision.FieldsAsJSON, provision.FieldJSONPath, and
+// the config file importers. Dots separate nested keys, e.g. "auths.registry.auth", and dots that are part of a key
+// can be escaped with a backslash, e.g. "auths.ghcr\\.io.auth". Keys can be empty, so callers have to reject paths
+// like "auths..auth" if they don't make sense for them.
+func Split(path string) []string {
+	var keys []string
+	var key strings.Builder
+	for i := 0; i < len(path); i++ {
+		switch {
+		case path[i] == '\\' && i+1 < len(path) && path[i+1] == '.':
+			key.WriteByte('.')
+			i++
+		case path[i] == '.':
+			keys = append(keys, key.String())
+			key.Reset()
+		default:
+			key.WriteByte(path[i])
+		}
+	}
+	return append(keys, key.String())
+}
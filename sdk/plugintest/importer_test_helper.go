@@ -33,6 +33,8 @@ func TestImporter(t *testing.T, importer sdk.Importer, cases map[string]ImportCa
 				HomeDir: filepath.Join(fsRoot, "~"),
 				RootDir: fsRoot,
 				OS:      c.OS,
+
+				IncludeRunningProcesses: c.IncludeRunningProcesses,
 			}
 
 			for path, contents := range c.Files {
@@ -79,6 +81,10 @@ type ImportCase struct {
 	// OS can be used to test OS-specific importers. Supported values: "darwin", "linux"
 	OS string
 
+	// IncludeRunningProcesses can be used to test importers that scan running processes, which the user has to opt in
+	// to. Their args can be set as Files, e.g. /proc/<pid>/cmdline on Linux.
+	IncludeRunningProcesses bool
+
 	// ExpectedCandidates is a shorthand to set the expected import candidates. Mutually exclusive with ExpectedOutput.
 	ExpectedCandidates []sdk.ImportCandidate
 
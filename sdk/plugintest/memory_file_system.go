@@ -0,0 +1,273 @@
+package plugintest
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// maxSymlinkHops is the number of symlinks that are followed before giving up, like the OS does for symlink loops.
+const maxSymlinkHops = 40
+
+// MemoryFileSystem is an in-memory sdk.FileSystem that can be used to test provisioners that modify files directly,
+// without touching the actual file system.
+type MemoryFileSystem struct {
+	mu    sync.Mutex
+	files map[string]memoryFile
+	dirs  map[string]os.FileMode
+}
+
+type memoryFile struct {
+	contents []byte
+	mode     os.FileMode
+
+	// link is the target of the symlink, if the file is a symlink.
+	link string
+}
+
+// NewMemoryFileSystem returns an empty in-memory file system. Only directories created using MkdirAll are tracked:
+// writing a file to any path succeeds, even if its directory doesn't exist.
+func NewMemoryFileSystem() *MemoryFileSystem {
+	return &MemoryFileSystem{
+		files: make(map[string]memoryFile),
+		dirs:  make(map[string]os.FileMode),
+	}
+}
+
+// resolve follows symlinks until it finds a regular file. The returned path is the path of that file, which is
+// returned even if the file doesn't exist, e.g. for a dangling symlink.
+func (m *MemoryFileSystem) resolve(op string, name string) (string, memoryFile, error) {
+	path := filepath.Clean(name)
+	for i := 0; i < maxSymlinkHops; i++ {
+		file, ok := m.files[path]
+		if !ok {
+			return path, file, &fs.PathError{Op: op, Path: name, Err: fs.ErrNotExist}
+		}
+		if file.link == "" {
+			return path, file, nil
+		}
+
+		if filepath.IsAbs(file.link) {
+			path = filepath.Clean(file.link)
+		} else {
+			path = filepath.Join(filepath.Dir(path), file.link)
+		}
+	}
+	return path, memoryFile{}, &fs.PathError{Op: op, Path: name, Err: syscall.ELOOP}
+}
+
+func (m *MemoryFileSystem) ReadFile(name string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, file, err := m.resolve("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(nil), file.contents...), nil
+}
+
+func (m *MemoryFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, file, err := m.resolve("open", name)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	} else if err != nil {
+		file = memoryFile{mode: perm}
+	}
+	file.contents = append([]byte(nil), data...)
+	m.files[path] = file
+	return nil
+}
+
+func (m *MemoryFileSystem) Stat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if mode, ok := m.dirs[filepath.Clean(name)]; ok {
+		return memoryFileInfo{name: filepath.Base(name), file: memoryFile{mode: os.ModeDir | mode}}, nil
+	}
+
+	_, file, err := m.resolve("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return memoryFileInfo{name: filepath.Base(name), file: file}, nil
+}
+
+func (m *MemoryFileSystem) Lstat(name string) (os.FileInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return nil, &fs.PathError{Op: "lstat", Path: name, Err: fs.ErrNotExist}
+	}
+	return memoryFileInfo{name: filepath.Base(name), file: file}, nil
+}
+
+func (m *MemoryFileSystem) Chmod(name string, mode os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.dirs[filepath.Clean(name)]; ok {
+		m.dirs[filepath.Clean(name)] = mode.Perm()
+		return nil
+	}
+
+	path, file, err := m.resolve("chmod", name)
+	if err != nil {
+		return err
+	}
+	file.mode = mode
+	m.files[path] = file
+	return nil
+}
+
+func (m *MemoryFileSystem) Rename(oldpath string, newpath string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	oldpath = filepath.Clean(oldpath)
+	file, ok := m.files[oldpath]
+	if !ok {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: fs.ErrNotExist}
+	}
+	delete(m.files, oldpath)
+	m.files[filepath.Clean(newpath)] = file
+	return nil
+}
+
+func (m *MemoryFileSystem) Remove(name string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	name = filepath.Clean(name)
+	if _, ok := m.dirs[name]; ok {
+		// Like os.Remove, only empty directories can be removed.
+		prefix := name + string(filepath.Separator)
+		for path := range m.files {
+			if strings.HasPrefix(path, prefix) {
+				return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+			}
+		}
+		for path := range m.dirs {
+			if strings.HasPrefix(path, prefix) {
+				return &fs.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+			}
+		}
+		delete(m.dirs, name)
+		return nil
+	}
+
+	if _, ok := m.files[name]; !ok {
+		return &fs.PathError{Op: "remove", Path: name, Err: fs.ErrNotExist}
+	}
+	delete(m.files, name)
+	return nil
+}
+
+func (m *MemoryFileSystem) RemoveAll(path string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path = filepath.Clean(path)
+	prefix := path + string(filepath.Separator)
+	for name := range m.files {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(m.files, name)
+		}
+	}
+	for name := range m.dirs {
+		if name == path || strings.HasPrefix(name, prefix) {
+			delete(m.dirs, name)
+		}
+	}
+	return nil
+}
+
+func (m *MemoryFileSystem) MkdirAll(path string, perm os.FileMode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for dir := filepath.Clean(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if _, ok := m.dirs[dir]; ok {
+			break
+		}
+		m.dirs[dir] = perm.Perm()
+	}
+	return nil
+}
+
+func (m *MemoryFileSystem) Symlink(oldname string, newname string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	newname = filepath.Clean(newname)
+	if _, ok := m.files[newname]; ok {
+		return &os.LinkError{Op: "symlink", Old: oldname, New: newname, Err: fs.ErrExist}
+	}
+	m.files[newname] = memoryFile{mode: os.ModeSymlink | 0777, link: oldname}
+	return nil
+}
+
+func (m *MemoryFileSystem) Readlink(name string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	file, ok := m.files[filepath.Clean(name)]
+	if !ok {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrNotExist}
+	} else if file.link == "" {
+		return "", &fs.PathError{Op: "readlink", Path: name, Err: fs.ErrInvalid}
+	}
+	return file.link, nil
+}
+
+func (m *MemoryFileSystem) OverwriteFile(name string, data []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	path, file, err := m.resolve("open", name)
+	if err != nil {
+		return err
+	}
+	contents := append([]byte(nil), file.contents...)
+	if len(data) > len(contents) {
+		contents = append(contents, make([]byte, len(data)-len(contents))...)
+	}
+	copy(contents, data)
+	file.contents = contents
+	m.files[path] = file
+	return nil
+}
+
+// Paths returns the paths of all files in the file system, including symlinks.
+func (m *MemoryFileSystem) Paths() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	paths := make([]string, 0, len(m.files))
+	for path := range m.files {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+type memoryFileInfo struct {
+	name string
+	file memoryFile
+}
+
+func (i memoryFileInfo) Name() string       { return i.name }
+func (i memoryFileInfo) Size() int64        { return int64(len(i.file.contents)) }
+func (i memoryFileInfo) Mode() os.FileMode  { return i.file.mode }
+func (i memoryFileInfo) ModTime() time.Time { return time.Time{} }
+func (i memoryFileInfo) IsDir() bool        { return i.file.mode.IsDir() }
+func (i memoryFileInfo) Sys() any           { return nil }
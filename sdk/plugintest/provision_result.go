@@ -0,0 +1,114 @@
+package plugintest
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+// ProvisionResult contains what a provisioner provisioned when invoked with RunProvision, for tests that want to check
+// specific parts of the output instead of comparing the whole output like TestProvisioner does.
+type ProvisionResult struct {
+	// Files contains the contents of the files in the provision output, keyed by path.
+	Files map[string][]byte
+
+	// EnvVars contains the environment variables in the provision output.
+	EnvVars map[string]string
+
+	// Args contains the command line in the provision output, which only consists of the args that got provisioned.
+	Args []string
+
+	// Errors contains the messages of the errors that got reported.
+	Errors []string
+
+	// Output is the full provision output.
+	Output sdk.ProvisionOutput
+
+	// FileSystem is the file system that the provisioner ran against, for provisioners that write files directly.
+	FileSystem *MemoryFileSystem
+}
+
+// RunProvision invokes the specified provisioner with the item fields, using the same input as TestProvisioner, and
+// returns what it provisioned.
+func RunProvision(t *testing.T, provisioner sdk.Provisioner, fields map[sdk.FieldName]string) ProvisionResult {
+	t.Helper()
+
+	in := newProvisionInput(ProvisionCase{ItemFields: fields})
+	out := newProvisionOutput(ProvisionCase{})
+	provisioner.Provision(context.Background(), in, &out)
+
+	result := ProvisionResult{
+		Files:      out.ProvisionedFiles(),
+		EnvVars:    out.Environment,
+		Args:       out.CommandLine,
+		Output:     out,
+		FileSystem: in.FileSystem.(*MemoryFileSystem),
+	}
+	for _, err := range out.Diagnostics.Errors {
+		result.Errors = append(result.Errors, err.Message)
+	}
+	return result
+}
+
+// AssertNoErrors asserts that the provisioner didn't report any errors.
+func AssertNoErrors(t *testing.T, result ProvisionResult) bool {
+	t.Helper()
+	return assert.Empty(t, result.Errors, "provisioning reported errors")
+}
+
+// AssertErrorContains asserts that the provisioner reported an error that contains the specified substring.
+func AssertErrorContains(t *testing.T, result ProvisionResult, substring string) bool {
+	t.Helper()
+	for _, message := range result.Errors {
+		if strings.Contains(message, substring) {
+			return true
+		}
+	}
+	return assert.Fail(t, "no error contains the expected substring", "substring: %q\nerrors: %q", substring, result.Errors)
+}
+
+// AssertFileContains asserts that a file was provisioned at the specified path and that it contains the substring.
+func AssertFileContains(t *testing.T, result ProvisionResult, path string, substring string) bool {
+	t.Helper()
+	contents, ok := result.Files[path]
+	if !ok {
+		return assert.Fail(t, "no file provisioned at the expected path", "path: %s\nfiles: %v", path, filePaths(result.Files))
+	}
+	if !bytes.Contains(contents, []byte(substring)) {
+		return assert.Fail(t, "file doesn't contain the expected substring", "path: %s\nsubstring: %q\ncontents: %q", path, substring, contents)
+	}
+	return true
+}
+
+// AssertEnvVar asserts that the environment variable was provisioned with the specified value.
+func AssertEnvVar(t *testing.T, result ProvisionResult, name string, value string) bool {
+	t.Helper()
+	actual, ok := result.EnvVars[name]
+	if !ok {
+		return assert.Fail(t, "environment variable not provisioned", "name: %s", name)
+	}
+	return assert.Equal(t, value, actual, "value of environment variable %s", name)
+}
+
+// AssertArgs asserts that the specified args were provisioned consecutively, in the specified order.
+func AssertArgs(t *testing.T, result ProvisionResult, args ...string) bool {
+	t.Helper()
+	for i := 0; i+len(args) <= len(result.Args); i++ {
+		if assert.ObjectsAreEqual(args, result.Args[i:i+len(args)]) {
+			return true
+		}
+	}
+	return assert.Fail(t, "args not provisioned", "expected: %q\nargs: %q", args, result.Args)
+}
+
+func filePaths(files map[string][]byte) []string {
+	paths := make([]string, 0, len(files))
+	for path := range files {
+		paths = append(paths, path)
+	}
+	return paths
+}
@@ -0,0 +1,40 @@
+package plugintest
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+// tokenProvisioner provisions the token field as an env var, a file, and an arg.
+type tokenProvisioner struct {
+	sdk.Provisioner
+}
+
+func (p tokenProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	token, ok := in.ItemFields["Token"]
+	if !ok {
+		out.AddError(fmt.Errorf("no value present in the item for field 'Token'"))
+		return
+	}
+	out.AddEnvVar("TOOL_TOKEN", token)
+	out.AddSecretFile(in.FromTempDir("config"), []byte("token = "+token+"\n"))
+	out.AddArgs("--config", in.FromTempDir("config"))
+}
+
+func TestRunProvision(t *testing.T) {
+	result := RunProvision(t, tokenProvisioner{}, map[sdk.FieldName]string{"Token": "tok_EXAMPLE"})
+	AssertNoErrors(t, result)
+	AssertEnvVar(t, result, "TOOL_TOKEN", "tok_EXAMPLE")
+	AssertFileContains(t, result, "/tmp/config", "token = tok_EXAMPLE")
+	AssertArgs(t, result, "--config", "/tmp/config")
+	assert.Equal(t, []string{"--config", "/tmp/config"}, result.Args)
+
+	result = RunProvision(t, tokenProvisioner{}, nil)
+	AssertErrorContains(t, result, "field 'Token'")
+	assert.Empty(t, result.Files)
+
+}
@@ -27,20 +27,21 @@ func TestProvisioner(t *testing.T, provisioner sdk.Provisioner, cases map[string
 			}
 
 			ctx := context.Background()
+			in := newProvisionInput(c)
+			out := newProvisionOutput(c)
+			provisioner.Provision(ctx, in, &out)
 
-			in := sdk.ProvisionInput{
-				ItemFields: c.ItemFields,
-				HomeDir:    "~",
-				TempDir:    "/tmp",
+			// Only compare the log, the actions, and the sensitivity of env vars if the test case specifies what to
+			// expect.
+			if c.ExpectedOutput.Log == nil {
+				out.Log = nil
 			}
-
-			out := sdk.ProvisionOutput{
-				Environment: make(map[string]string),
-				Files:       make(map[string]sdk.OutputFile),
-				CommandLine: c.CommandLine,
+			if c.ExpectedOutput.Actions == nil {
+				out.Actions = nil
+			}
+			if c.ExpectedOutput.NonSensitiveEnvVars == nil {
+				out.NonSensitiveEnvVars = nil
 			}
-
-			provisioner.Provision(ctx, in, &out)
 
 			description := fmt.Sprintf("Provision: %s", name)
 			assert.Equal(t, c.ExpectedOutput, out, description)
@@ -48,10 +49,39 @@ func TestProvisioner(t *testing.T, provisioner sdk.Provisioner, cases map[string
 	}
 }
 
+// newProvisionInput returns the input to invoke a provisioner with in tests.
+func newProvisionInput(c ProvisionCase) sdk.ProvisionInput {
+	return sdk.ProvisionInput{
+		ItemFields:      c.ItemFields,
+		ItemFiles:       c.ItemFiles,
+		ItemFieldGroups: c.ItemFieldGroups,
+		HomeDir:         "~",
+		TempDir:         "/tmp",
+
+		// Provisioners that modify files directly shouldn't touch the actual file system in tests.
+		FileSystem: NewMemoryFileSystem(),
+	}
+}
+
+// newProvisionOutput returns the output to invoke a provisioner with in tests.
+func newProvisionOutput(c ProvisionCase) sdk.ProvisionOutput {
+	return sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+		CommandLine: c.CommandLine,
+	}
+}
+
 type ProvisionCase struct {
 	// ItemFields can be used to populate the item fields to pass to the provisioner.
 	ItemFields map[sdk.FieldName]string
 
+	// ItemFiles can be used to populate the file attachments of the item to pass to the provisioner.
+	ItemFiles map[string][]byte
+
+	// ItemFieldGroups can be used to populate the fields of the sections of the item to pass to the provisioner.
+	ItemFieldGroups map[string]map[sdk.FieldName]string
+
 	// CommandLine can be used to populate the command line to pass to the provisioner.
 	CommandLine []string
 
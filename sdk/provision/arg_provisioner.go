@@ -0,0 +1,140 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// ArgProvisioner provisions one or more secrets as a command-line argument, for executables that only accept
+// credentials on the command line.
+type ArgProvisioner struct {
+	sdk.Provisioner
+
+	format     string
+	fieldNames []sdk.FieldName
+	priority   *int
+}
+
+// FieldAsArg returns a provisioner that appends the value of the field to the command line as a single argument,
+// formatted using the format string, e.g. "--token=%s". Provisioning fails if the field is not present in the item.
+//
+// Arguments are visible to other processes of the same user, so prefer provisioning secrets as environment variables
+// or files whenever the executable supports it.
+func FieldAsArg(fieldName sdk.FieldName, format string) sdk.Provisioner {
+	return FieldsAsArg(format, fieldName)
+}
+
+// FieldsAsArg returns a provisioner that appends a single argument to the command line, formatted using the format
+// string with the values of the fields in the specified order, e.g. "--auth=%s:%s" for a username and a password.
+// The format string only supports "%s", and "%%" for a literal percent sign. Provisioning fails if any of the fields
+// is not present in the item.
+func FieldsAsArg(format string, fieldNames ...sdk.FieldName) sdk.Provisioner {
+	return ArgProvisioner{
+		format:     format,
+		fieldNames: fieldNames,
+	}
+}
+
+// FieldAsArgWithPriority works like provision.FieldAsArg, but adds the argument with the specified priority, so that
+// its position on the command line doesn't depend on the order in which the provisioners run. Arguments with a lower
+// priority come first, and all prioritized arguments come after the arguments that were appended without a priority.
+func FieldAsArgWithPriority(priority int, fieldName sdk.FieldName, format string) sdk.Provisioner {
+	return FieldsAsArgWithPriority(priority, format, fieldName)
+}
+
+// FieldsAsArgWithPriority works like provision.FieldsAsArg, but adds the argument with the specified priority. See
+// provision.FieldAsArgWithPriority.
+func FieldsAsArgWithPriority(priority int, format string, fieldNames ...sdk.FieldName) sdk.Provisioner {
+	return ArgProvisioner{
+		format:     format,
+		fieldNames: fieldNames,
+		priority:   &priority,
+	}
+}
+
+func (p ArgProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	verbs, err := countFormatVerbs(p.format)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+	if verbs != len(p.fieldNames) {
+		out.AddError(fmt.Errorf("invalid format '%s': expected %d placeholders for the fields, got %d", p.format, len(p.fieldNames), verbs))
+		return
+	}
+
+	values := make([]any, len(p.fieldNames))
+	for i, fieldName := range p.fieldNames {
+		value, ok := in.ItemFields[fieldName]
+		if !ok {
+			out.AddError(fmt.Errorf("no value present in the item for field '%s'", fieldName))
+			return
+		}
+		values[i] = value
+	}
+
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindArgs,
+			Target: p.format,
+		})
+		return
+	}
+
+	if p.priority != nil {
+		out.AddPrioritizedArgs(*p.priority, fmt.Sprintf(p.format, values...))
+		out.AddLog(sdk.LogEntry{
+			Provisioner: p.Description(),
+			Message:     fmt.Sprintf("added arg with format %s and priority %d", p.format, *p.priority),
+		})
+		return
+	}
+
+	out.AddArgs(fmt.Sprintf(p.format, values...))
+	out.AddLog(sdk.LogEntry{
+		Provisioner: p.Description(),
+		Message:     fmt.Sprintf("added arg with format %s", p.format),
+	})
+}
+
+func (p ArgProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	// Nothing to do here: the command line is gone when the process exits.
+}
+
+func (p ArgProvisioner) Description() string {
+	var fieldNames []string
+	for _, fieldName := range p.fieldNames {
+		fieldNames = append(fieldNames, fieldName.String())
+	}
+	return fmt.Sprintf("Provision fields as command-line argument: %s", strings.Join(fieldNames, ", "))
+}
+
+// countFormatVerbs returns the number of "%s" verbs in the format string. Any other verb results in an error, since
+// field values are always strings.
+func countFormatVerbs(format string) (int, error) {
+	count := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == '%' {
+			i++
+			continue
+		}
+		if i+1 < len(format) && format[i+1] == 's' {
+			count++
+			i++
+			continue
+		}
+		return 0, fmt.Errorf("invalid format '%s': only %%s is supported", format)
+	}
+	return count, nil
+}
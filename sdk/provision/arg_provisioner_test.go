@@ -0,0 +1,100 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+)
+
+func TestFieldAsArg(t *testing.T) {
+	plugintest.TestProvisioner(t, FieldAsArg("Token", "--token=%s"), map[string]plugintest.ProvisionCase{
+		"default": {
+			ItemFields: map[sdk.FieldName]string{
+				"Token": "tok_EXAMPLE",
+			},
+			CommandLine: []string{"tool", "deploy"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				CommandLine: []string{"tool", "deploy", "--token=tok_EXAMPLE"},
+			},
+		},
+		"missing field": {
+			CommandLine: []string{"tool"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				CommandLine: []string{"tool"},
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "no value present in the item for field 'Token'"}},
+				},
+			},
+		},
+	})
+}
+
+func TestFieldsAsArg(t *testing.T) {
+	plugintest.TestProvisioner(t, FieldsAsArg("--auth=%s:%s%%", "Username", "Password"), map[string]plugintest.ProvisionCase{
+		"default": {
+			ItemFields: map[sdk.FieldName]string{
+				"Username": "wendy",
+				"Password": "hunter2",
+			},
+			CommandLine: []string{"tool"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				CommandLine: []string{"tool", "--auth=wendy:hunter2%"},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, FieldsAsArg("--auth=%s", "Username", "Password"), map[string]plugintest.ProvisionCase{
+		"too few placeholders": {
+			ItemFields: map[sdk.FieldName]string{
+				"Username": "wendy",
+				"Password": "hunter2",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "invalid format '--auth=%s': expected 2 placeholders for the fields, got 1"}},
+				},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, FieldsAsArg("--port=%d", "Port"), map[string]plugintest.ProvisionCase{
+		"unsupported verb": {
+			ItemFields: map[sdk.FieldName]string{
+				"Port": "8080",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "invalid format '--port=%d': only %s is supported"}},
+				},
+			},
+		},
+	})
+}
+
+func TestFieldAsArgWithPriority(t *testing.T) {
+	// The token is provisioned first, but has to come after the config file on the command line.
+	provisioner := Composite(
+		FieldAsArgWithPriority(20, "Token", "--token=%s"),
+		TempFile(FieldAsFile("Config"), Filename("config"), AddArgsWithPriority(10, "--config", "{{ .Path }}")),
+		FieldAsArg("Username", "--user=%s"),
+	)
+
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"default": {
+			ItemFields: map[sdk.FieldName]string{
+				"Token":    "tok_EXAMPLE",
+				"Config":   "debug = true",
+				"Username": "wendy",
+			},
+			CommandLine: []string{"tool", "deploy"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				CommandLine: []string{"tool", "deploy", "--user=wendy", "--config", "/tmp/config", "--token=tok_EXAMPLE"},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/config": {Contents: []byte("debug = true"), Mode: 0600},
+				},
+				ArgGroups: []sdk.ArgGroup{{Priority: 10, Size: 2}, {Priority: 20, Size: 1}},
+			},
+		},
+	})
+}
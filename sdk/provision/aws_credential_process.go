@@ -0,0 +1,214 @@
+package provision
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// awsCredentialProcessPathKey is the key that the path of the socket that serves the credentials gets bound to, so
+// that the AWS config file can refer to it.
+const awsCredentialProcessPathKey = "aws-credential-process"
+
+// AWSCredentialProcessCommand is the first argument that the plugin executable gets started with when AWS runs the
+// credential_process that AWSCredentialProcess sets up, see RunCallback.
+const AWSCredentialProcessCommand = "aws-credential-process"
+
+// awsCredentialProcessKeys are the keys of a profile that take precedence over credential_process, and are therefore
+// left out of the profile that the credentials get provisioned for.
+var awsCredentialProcessKeys = []string{"credential_process", "aws_access_key_id", "aws_secret_access_key", "aws_session_token"}
+
+// pluginExecutable returns the path of the executable of the plugin, which the credential_process calls back into.
+var pluginExecutable = os.Executable
+
+// AWSCredentialProcess returns a provisioner that makes the AWS CLI and SDKs get their credentials from a
+// credential_process, instead of from static credentials on disk. The credentials are served on a Unix socket in the
+// temp dir, see CredentialHelperSocket, for as long as the executable runs, so AWS can run the credential_process as
+// often as it needs to. The credential_process calls back into the plugin executable, which has to pass its arguments
+// to RunCallback. See AWSCredentialProcessOutput for how the fields are mapped.
+//
+// The config file pointed to by AWS_CONFIG_FILE is a copy of the user's config file, either the one AWS_CONFIG_FILE
+// already points to or ~/.aws/config, in which credential_process is set for the profile selected by AWS_PROFILE, or
+// the default profile otherwise. Static credentials of that profile are left out of the copy, since AWS would prefer
+// them, but static credentials of that profile in the shared credentials file still take precedence. The same options
+// as for TempFile can be used to change where the config file is stored or how its path is passed to the executable.
+// Not supported on Windows.
+func AWSCredentialProcess(accessKeyIDField sdk.FieldName, secretAccessKeyField sdk.FieldName, sessionTokenField sdk.FieldName, expirationField sdk.FieldName, opts ...FileOption) sdk.Provisioner {
+	output := AWSCredentialProcessOutput(accessKeyIDField, secretAccessKeyField, sessionTokenField, expirationField)
+	defaults := []FileOption{
+		Filename("aws-config"),
+		SetPathAsEnvVar("AWS_CONFIG_FILE"),
+	}
+	return Composite(
+		CredentialHelperSocket(
+			awsCredentialProcessHandler(output),
+			Filename("aws-credentials.sock"),
+			BindPathAs(awsCredentialProcessPathKey),
+		),
+		TempFile(awsCredentialProcessConfig(output), append(defaults, opts...)...),
+	)
+}
+
+// AWSCredentialProcessOutput can be used to generate the JSON that AWS expects a credential_process to print, with
+// the version set to 1. The session token and expiration fields are optional: they are left out of the JSON if the
+// field name is empty or the item doesn't have the field. The expiration has to be an RFC 3339 timestamp, e.g.
+// "2024-01-02T15:04:05Z", and is converted to UTC.
+func AWSCredentialProcessOutput(accessKeyIDField sdk.FieldName, secretAccessKeyField sdk.FieldName, sessionTokenField sdk.FieldName, expirationField sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		output := struct {
+			Version         int
+			AccessKeyID     string `json:"AccessKeyId"`
+			SecretAccessKey string
+			SessionToken    string `json:",omitempty"`
+			Expiration      string `json:",omitempty"`
+		}{
+			Version: 1,
+		}
+
+		for _, fieldName := range []sdk.FieldName{accessKeyIDField, secretAccessKeyField} {
+			if _, ok := in.ItemFields[fieldName]; !ok {
+				return nil, fmt.Errorf("no value present in the item for field '%s'", fieldName)
+			}
+		}
+		output.AccessKeyID = in.ItemFields[accessKeyIDField]
+		output.SecretAccessKey = in.ItemFields[secretAccessKeyField]
+
+		if sessionTokenField != "" {
+			output.SessionToken = in.ItemFields[sessionTokenField]
+		}
+
+		if expiration, ok := in.ItemFields[expirationField]; ok && expirationField != "" {
+			parsed, err := time.Parse(time.RFC3339, expiration)
+			if err != nil {
+				return nil, fmt.Errorf("value of field '%s' is not an RFC 3339 timestamp", expirationField)
+			}
+			output.Expiration = parsed.UTC().Format(time.RFC3339)
+		}
+
+		return json.Marshal(output)
+	})
+}
+
+// RunCallback runs the callback into the plugin executable that the arguments ask for, if any, writing its output to
+// stdout. It returns false if the arguments are not a callback, in which case the executable should serve the plugin
+// as usual. Currently, the only callback is the credential_process of AWSCredentialProcess.
+func RunCallback(args []string, stdout io.Writer) (bool, error) {
+	if len(args) != 2 || args[0] != AWSCredentialProcessCommand {
+		return false, nil
+	}
+
+	output, err := callCredentialHelper(args[1], "get", nil)
+	if err != nil {
+		return true, err
+	}
+	_, err = stdout.Write(output)
+	return true, err
+}
+
+// awsCredentialProcessHandler serves the output of the credential_process on every "get" request, so that AWS can
+// run the credential_process as often as it needs to.
+func awsCredentialProcessHandler(output ItemToFileContents) CredentialHelperHandler {
+	return CredentialHelperHandler(func(fields map[sdk.FieldName]string, action string, payload []byte) ([]byte, error) {
+		if action != "get" {
+			return nil, fmt.Errorf("action '%s' is not supported", action)
+		}
+		return output(sdk.ProvisionInput{ItemFields: fields})
+	})
+}
+
+// awsCredentialProcessConfig generates a copy of the user's AWS config file in which the profile gets its credentials
+// from the plugin executable, through the socket.
+func awsCredentialProcessConfig(output ItemToFileContents) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		// Fail during provisioning instead of only when AWS runs the credential_process.
+		if _, err := output(in); err != nil {
+			return nil, err
+		}
+
+		path, ok := in.BoundPaths[awsCredentialProcessPathKey]
+		if !ok {
+			return nil, fmt.Errorf("no path bound to '%s'", awsCredentialProcessPathKey)
+		}
+		executable, err := pluginExecutable()
+		if err != nil {
+			return nil, fmt.Errorf("looking up the plugin executable: %w", err)
+		}
+
+		configPath := os.Getenv("AWS_CONFIG_FILE")
+		if configPath == "" {
+			configPath = filepath.Join(in.HomeDir, ".aws", "config")
+		}
+		config, err := in.FS().ReadFile(configPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, fmt.Errorf("reading AWS config file %s: %w", configPath, err)
+		}
+
+		section := "default"
+		if profile := os.Getenv("AWS_PROFILE"); profile != "" && profile != "default" {
+			section = "profile " + profile
+		}
+		command := strings.Join([]string{shellQuote(executable), AWSCredentialProcessCommand, shellQuote(path)}, " ")
+		return setAWSConfigValue(config, section, "credential_process", command), nil
+	})
+}
+
+// setAWSConfigValue returns the AWS config with the key of the section set to the value, adding the section if the
+// config doesn't have it yet. The keys that take precedence over credential_process are removed from the section.
+// Everything else is kept as is, including comments and nested values.
+func setAWSConfigValue(config []byte, section string, key string, value string) []byte {
+	var result bytes.Buffer
+	found, inSection := false, false
+	for _, line := range strings.SplitAfter(string(config), "\n") {
+		if line == "" {
+			continue
+		}
+		trimmed := strings.TrimSpace(line)
+		if strings.HasPrefix(trimmed, "[") && strings.HasSuffix(trimmed, "]") {
+			inSection = strings.TrimSpace(trimmed[1:len(trimmed)-1]) == section
+			if !strings.HasSuffix(line, "\n") {
+				line += "\n"
+			}
+			result.WriteString(line)
+			if inSection {
+				found = true
+				result.WriteString(fmt.Sprintf("%s = %s\n", key, value))
+			}
+			continue
+		}
+
+		// Nested values are indented, so only lines that aren't can set a key of the section.
+		if inSection && line[0] != ' ' && line[0] != '\t' {
+			if isAWSCredentialProcessKey(trimmed) {
+				continue
+			}
+		}
+		result.WriteString(line)
+	}
+
+	if !found {
+		if result.Len() > 0 && !bytes.HasSuffix(result.Bytes(), []byte("\n")) {
+			result.WriteString("\n")
+		}
+		result.WriteString(fmt.Sprintf("[%s]\n%s = %s\n", section, key, value))
+	}
+	return result.Bytes()
+}
+
+// isAWSCredentialProcessKey returns whether the line of an AWS config file sets one of the keys that take precedence
+// over credential_process.
+func isAWSCredentialProcessKey(line string) bool {
+	name, _, _ := strings.Cut(line, "=")
+	for _, key := range awsCredentialProcessKeys {
+		if strings.TrimSpace(name) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,310 @@
+package provision
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// fileBackup records the state of a user-owned file before a provisioner modified it, so that it can be restored
+// exactly during deprovisioning.
+type fileBackup struct {
+	Existed  bool
+	Contents []byte
+	Mode     os.FileMode
+
+	// LinkTarget is the target of the symlink at the path, if the path was a symlink instead of a regular file. It's
+	// only recorded by backupLink.
+	LinkTarget string `json:",omitempty"`
+}
+
+var errNoBackup = errors.New("no backup found")
+
+// backupPath returns the path in the temp dir where the backup of the specified file is stored. The backup gets
+// removed along with the temp dir.
+func backupPath(tempDir string, path string) string {
+	return filepath.Join(tempDir, fmt.Sprintf(".backup-%x", sha256.Sum256([]byte(path))))
+}
+
+// backupFile stores the current state of the specified file in the temp dir, including whether it existed at all.
+// If a backup already exists, it is left untouched, so that the original state is never overwritten by a state that
+// was already modified by a provisioner.
+func backupFile(fsys sdk.FileSystem, tempDir string, path string) error {
+	if _, err := fsys.Stat(backupPath(tempDir, path)); err == nil {
+		return nil
+	}
+
+	var backup fileBackup
+	info, err := fsys.Stat(path)
+	if err == nil {
+		backup.Existed = true
+		backup.Mode = info.Mode().Perm()
+		backup.Contents, err = fsys.ReadFile(path)
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("backing up %s: %w", path, err)
+	}
+
+	return writeBackup(fsys, tempDir, path, backup)
+}
+
+// backupLink stores the current state of the specified path in the temp dir like backupFile, but without following
+// a symlink at the path: the target of the symlink is recorded instead, even if the target doesn't exist.
+func backupLink(fsys sdk.FileSystem, tempDir string, path string) error {
+	if _, err := fsys.Stat(backupPath(tempDir, path)); err == nil {
+		return nil
+	}
+
+	var backup fileBackup
+	info, err := fsys.Lstat(path)
+	if err == nil {
+		backup.Existed = true
+		backup.Mode = info.Mode().Perm()
+		if info.Mode()&os.ModeSymlink != 0 {
+			backup.LinkTarget, err = fsys.Readlink(path)
+		} else {
+			backup.Contents, err = fsys.ReadFile(path)
+		}
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("backing up %s: %w", path, err)
+	}
+
+	return writeBackup(fsys, tempDir, path, backup)
+}
+
+// writeBackup stores the backup of the specified file in the temp dir.
+func writeBackup(fsys sdk.FileSystem, tempDir string, path string, backup fileBackup) error {
+	encoded, err := json.Marshal(backup)
+	if err != nil {
+		return err
+	}
+
+	err = fsys.MkdirAll(tempDir, 0700)
+	if err != nil {
+		return err
+	}
+
+	return writeFileAtomic(fsys, backupPath(tempDir, path), encoded, 0600)
+}
+
+// restoreLink restores the specified path to the state recorded by backupLink. Whatever is at the path now is
+// removed first, without following it if it's a symlink. If no backup is present, the path is left untouched and
+// errNoBackup is returned.
+func restoreLink(fsys sdk.FileSystem, tempDir string, path string) error {
+	backup, err := readBackup(fsys, tempDir, path)
+	if err != nil {
+		return err
+	}
+
+	err = fsys.Remove(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	if backup.LinkTarget != "" {
+		err = fsys.Symlink(backup.LinkTarget, path)
+	} else if backup.Existed {
+		err = writeFileAtomic(fsys, path, backup.Contents, backup.Mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	return fsys.Remove(backupPath(tempDir, path))
+}
+
+// readBackup returns the backup of the specified file. Returns errNoBackup if the file was not backed up.
+func readBackup(fsys sdk.FileSystem, tempDir string, path string) (fileBackup, error) {
+	var backup fileBackup
+	encoded, err := fsys.ReadFile(backupPath(tempDir, path))
+	if os.IsNotExist(err) {
+		return backup, errNoBackup
+	} else if err != nil {
+		return backup, err
+	}
+
+	err = json.Unmarshal(encoded, &backup)
+	return backup, err
+}
+
+// restoreFile restores the specified file to the state recorded by backupFile: the original contents and permissions
+// are written back, or the file is removed if it didn't exist before. If no backup is present, the file is left
+// untouched and errNoBackup is returned.
+func restoreFile(fsys sdk.FileSystem, tempDir string, path string) error {
+	backup, err := readBackup(fsys, tempDir, path)
+	if err != nil {
+		return err
+	}
+
+	if !backup.Existed {
+		err = fsys.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		err = writeFileAtomic(fsys, path, backup.Contents, backup.Mode)
+		if err != nil {
+			return err
+		}
+	}
+
+	return fsys.Remove(backupPath(tempDir, path))
+}
+
+// writeFileAtomic writes the contents to a temporary file next to the specified path and renames it afterwards, so
+// that the file is never left partially written.
+func writeFileAtomic(fsys sdk.FileSystem, path string, contents []byte, mode os.FileMode) error {
+	suffix, err := randomFilename()
+	if err != nil {
+		return err
+	}
+	tmpPath := filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+"."+suffix)
+
+	err = fsys.WriteFile(tmpPath, contents, mode)
+	if err == nil {
+		// The permissions passed to WriteFile are affected by the umask.
+		err = fsys.Chmod(tmpPath, mode)
+	}
+	if err == nil {
+		err = fsys.Rename(tmpPath, path)
+	}
+	if err != nil {
+		_ = fsys.Remove(tmpPath)
+		return err
+	}
+	return nil
+}
+
+// writeFileIfChanged works like writeFileAtomic, but leaves the file untouched if it already has exactly the same
+// contents and permissions, so that rewriting a file on every run doesn't change its modification time and trigger
+// file watchers. Returns whether the file was written.
+func writeFileIfChanged(fsys sdk.FileSystem, path string, contents []byte, mode os.FileMode) (bool, error) {
+	if fileUpToDate(fsys, path, contents, mode) {
+		return false, nil
+	}
+	return true, writeFileAtomic(fsys, path, contents, mode)
+}
+
+// fileUpToDate returns whether the file at the specified path is a regular file with the specified contents and mode.
+func fileUpToDate(fsys sdk.FileSystem, path string, contents []byte, mode os.FileMode) bool {
+	info, err := fsys.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Mode().Perm() != mode.Perm() {
+		return false
+	}
+	existing, err := fsys.ReadFile(path)
+	return err == nil && sha256.Sum256(existing) == sha256.Sum256(contents)
+}
+
+// provisionedMarkerPath returns the path in the temp dir that records that the file at the specified path has been
+// provisioned during this run. Other keys than paths can be used to record that something else has been provisioned,
+// e.g. the provisioner of a condition that held.
+func provisionedMarkerPath(tempDir string, key string) string {
+	return filepath.Join(tempDir, fmt.Sprintf(".provisioned-%x", sha256.Sum256([]byte(key))))
+}
+
+// recordProvisioned records in the temp dir that the file at the specified path has been provisioned during this run,
+// so that deprovisioning only ever removes files that this run put in place.
+func recordProvisioned(fsys sdk.FileSystem, tempDir string, key string) error {
+	err := fsys.MkdirAll(tempDir, 0700)
+	if err != nil {
+		return err
+	}
+	return fsys.WriteFile(provisionedMarkerPath(tempDir, key), nil, 0600)
+}
+
+// wasProvisioned returns whether recordProvisioned has been called for the file at the specified path during this run.
+func wasProvisioned(fsys sdk.FileSystem, tempDir string, key string) bool {
+	_, err := fsys.Stat(provisionedMarkerPath(tempDir, key))
+	return err == nil
+}
+
+// createdDirsPath returns the path in the temp dir where the directories that were created for the specified file
+// are recorded.
+func createdDirsPath(tempDir string, path string) string {
+	return filepath.Join(tempDir, fmt.Sprintf(".created-dirs-%x", sha256.Sum256([]byte(path))))
+}
+
+// createParentDirs creates the missing parent directories of the specified file, accessible only by the current user,
+// and records which directories it created in the temp dir, so that removeCreatedDirs removes exactly those.
+// Directories that already existed are left untouched.
+func createParentDirs(fsys sdk.FileSystem, tempDir string, path string) error {
+	if _, err := fsys.Stat(createdDirsPath(tempDir, path)); err == nil {
+		return nil
+	}
+	if _, err := fsys.Lstat(path); err == nil {
+		// The file already exists, so its parent directories do as well.
+		return nil
+	}
+
+	var created []string
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		_, err := fsys.Stat(dir)
+		if err == nil {
+			break
+		} else if !os.IsNotExist(err) {
+			return fmt.Errorf("creating parent directories of %s: %w", path, err)
+		}
+		created = append(created, dir)
+	}
+	if len(created) == 0 {
+		return nil
+	}
+
+	// Record the directories before creating them, so that they also get removed if creating one of them fails.
+	encoded, err := json.Marshal(created)
+	if err != nil {
+		return err
+	}
+	err = fsys.MkdirAll(tempDir, 0700)
+	if err == nil {
+		err = writeFileAtomic(fsys, createdDirsPath(tempDir, path), encoded, 0600)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = fsys.MkdirAll(created[0], 0700)
+	for i := len(created) - 1; i >= 0 && err == nil; i-- {
+		// The permissions passed to MkdirAll are affected by the umask.
+		err = fsys.Chmod(created[i], 0700)
+	}
+	if err != nil {
+		return fmt.Errorf("creating parent directories of %s: %w", path, err)
+	}
+	return nil
+}
+
+// removeCreatedDirs removes the directories that createParentDirs created for the specified file, deepest first.
+// Directories that are not empty anymore, e.g. because the executable or the user added files to them, are kept.
+// Returns the directories that were kept.
+func removeCreatedDirs(fsys sdk.FileSystem, tempDir string, path string) (kept []string, err error) {
+	encoded, err := fsys.ReadFile(createdDirsPath(tempDir, path))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	err = json.Unmarshal(encoded, &created)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, dir := range created {
+		err = fsys.Remove(dir)
+		if err != nil && !os.IsNotExist(err) {
+			// The parents of a directory that is kept can't be removed either.
+			kept = created[i:]
+			break
+		}
+	}
+
+	return kept, fsys.Remove(createdDirsPath(tempDir, path))
+}
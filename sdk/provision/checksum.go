@@ -0,0 +1,86 @@
+package provision
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+const (
+	// ChecksumSHA256 computes the checksum with SHA-256.
+	ChecksumSHA256 = "sha256"
+
+	// ChecksumSHA1 computes the checksum with SHA-1. Only use this for executables that don't support SHA-256.
+	ChecksumSHA1 = "sha1"
+)
+
+const (
+	// ChecksumHex encodes the checksum as lowercase hex, which is the default.
+	ChecksumHex = "hex"
+
+	// ChecksumBase64 encodes the checksum with standard base64.
+	ChecksumBase64 = "base64"
+)
+
+// WithChecksumEnvVar can be used to set an environment variable to the checksum of the provisioned file, for
+// executables that verify their credential file against a checksum passed in the environment. The algorithm can be
+// ChecksumSHA256 or ChecksumSHA1, and the checksum is computed over the contents as they are written to the file, so
+// after converting line endings and compressing. Use WithChecksumEncoding to encode the checksum with base64 instead
+// of hex. When combined with provision.AppendToFile, the checksum only covers the appended contents, and when combined
+// with provision.WithTTL, it only covers the initial contents, since the environment can't change after the executable
+// has started.
+func WithChecksumEnvVar(envVarName string, algo string) FileOption {
+	return func(p *FileProvisioner) {
+		p.checksumEnvVar = envVarName
+		p.checksumAlgo = algo
+	}
+}
+
+// WithChecksumEncoding can be used to set the encoding of the checksum of provision.WithChecksumEnvVar, which can be
+// ChecksumHex or ChecksumBase64.
+func WithChecksumEncoding(encoding string) FileOption {
+	return func(p *FileProvisioner) {
+		p.checksumEncoding = encoding
+	}
+}
+
+// checksum returns the encoded checksum of the contents.
+func (p FileProvisioner) checksum(contents []byte) (string, error) {
+	var h hash.Hash
+	switch p.checksumAlgo {
+	case ChecksumSHA256:
+		h = sha256.New()
+	case ChecksumSHA1:
+		h = sha1.New()
+	default:
+		return "", fmt.Errorf("unsupported checksum algorithm '%s', use '%s' or '%s'", p.checksumAlgo, ChecksumSHA256, ChecksumSHA1)
+	}
+	h.Write(contents)
+	sum := h.Sum(nil)
+
+	switch p.checksumEncoding {
+	case "", ChecksumHex:
+		return hex.EncodeToString(sum), nil
+	case ChecksumBase64:
+		return base64.StdEncoding.EncodeToString(sum), nil
+	default:
+		return "", fmt.Errorf("unsupported checksum encoding '%s', use '%s' or '%s'", p.checksumEncoding, ChecksumHex, ChecksumBase64)
+	}
+}
+
+// provisionChecksum sets the environment variable of provision.WithChecksumEnvVar to the checksum.
+func (p FileProvisioner) provisionChecksum(checksum string, dryRun bool, out *sdk.ProvisionOutput) {
+	if dryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindEnvVar,
+			Target: p.checksumEnvVar,
+		})
+		return
+	}
+	out.AddEnvVar(p.checksumEnvVar, checksum)
+}
@@ -0,0 +1,66 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+)
+
+func TestWithChecksumEnvVar(t *testing.T) {
+	files := map[string]sdk.OutputFile{
+		"/tmp/creds": {Contents: []byte("hunter2"), Mode: 0600},
+	}
+	for name, tc := range map[string]struct {
+		opts     []FileOption
+		expected sdk.ProvisionOutput
+	}{
+		"sha256": {
+			opts: []FileOption{WithChecksumEnvVar("TOOL_CREDS_SHA256", ChecksumSHA256)},
+			expected: sdk.ProvisionOutput{
+				Environment: map[string]string{"TOOL_CREDS_SHA256": "f52fbd32b2b3b86ff88ef6c490628285f482af15ddcb29541f94bcf526a3f6c7"},
+				Files:       files,
+			},
+		},
+		"sha1": {
+			opts: []FileOption{WithChecksumEnvVar("TOOL_CREDS_SHA1", ChecksumSHA1)},
+			expected: sdk.ProvisionOutput{
+				Environment: map[string]string{"TOOL_CREDS_SHA1": "f3bbbd66a63d4bf1747940578ec3d0103530e21d"},
+				Files:       files,
+			},
+		},
+		"base64": {
+			opts: []FileOption{WithChecksumEnvVar("TOOL_CREDS_SHA256", ChecksumSHA256), WithChecksumEncoding(ChecksumBase64)},
+			expected: sdk.ProvisionOutput{
+				Environment: map[string]string{"TOOL_CREDS_SHA256": "9S+9MrKzuG/4jvbEkGKChfSCrxXdyylUH5S89Saj9sc="},
+				Files:       files,
+			},
+		},
+		"unsupported algorithm": {
+			opts: []FileOption{WithChecksumEnvVar("TOOL_CREDS_MD5", "md5")},
+			expected: sdk.ProvisionOutput{
+				Environment: map[string]string{},
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "unsupported checksum algorithm 'md5', use 'sha256' or 'sha1'"}},
+				},
+			},
+		},
+		"unsupported encoding": {
+			opts: []FileOption{WithChecksumEnvVar("TOOL_CREDS_SHA256", ChecksumSHA256), WithChecksumEncoding("base32")},
+			expected: sdk.ProvisionOutput{
+				Environment: map[string]string{},
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "unsupported checksum encoding 'base32', use 'hex' or 'base64'"}},
+				},
+			},
+		},
+	} {
+		provisioner := TempFile(FieldAsFile("Token"), append([]FileOption{Filename("creds")}, tc.opts...)...)
+		plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+			name: {
+				ItemFields:     map[sdk.FieldName]string{"Token": "hunter2"},
+				ExpectedOutput: tc.expected,
+			},
+		})
+	}
+}
@@ -0,0 +1,184 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// CompositeProvisioner runs multiple provisioners as one.
+type CompositeProvisioner struct {
+	sdk.Provisioner
+
+	provisioners []sdk.Provisioner
+}
+
+// Composite returns a provisioner that runs the specified provisioners in order, for executables that need multiple
+// provisioners at once, like an environment variable and a config file. If one of the provisioners fails, the
+// provisioners that already succeeded are deprovisioned in reverse order, and the remaining provisioners don't run.
+// The provisioner that failed is not deprovisioned. Deprovisioning also happens in reverse order.
+//
+// Provisioners that depend on other ones, for example because they symlink to a file that another provisioner writes,
+// can declare this using Named. Such provisioners are provisioned after, and deprovisioned before, the provisioners
+// they depend on, regardless of the order they're specified in.
+func Composite(provisioners ...sdk.Provisioner) sdk.Provisioner {
+	return CompositeProvisioner{
+		provisioners: provisioners,
+	}
+}
+
+func (p CompositeProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	provisioners, err := p.ordered()
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	for i, provisioner := range provisioners {
+		scratch := newScratchOutput(out)
+		if err := ctx.Err(); err != nil {
+			// Don't start the next provisioner if provisioning has been aborted, but do roll back the previous ones.
+			scratch.AddError(err)
+		} else {
+			provisioner.Provision(ctx, in, scratch)
+		}
+		if len(scratch.Diagnostics.Errors) == 0 {
+			applyScratchOutput(out, scratch)
+			continue
+		}
+
+		out.Diagnostics.Errors = append(out.Diagnostics.Errors, scratch.Diagnostics.Errors...)
+
+		// Only roll back the provisioners that succeeded: deprovisioning the one that failed could remove files it
+		// never wrote, e.g. a file at a fixed path that already existed.
+		rollback(ctx, provisioners[:i], in, out)
+		return
+	}
+}
+
+func (p CompositeProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	provisioners, err := p.ordered()
+	if err != nil {
+		// Provisioning failed for the same reason, but the provisioners can handle being deprovisioned anyway.
+		provisioners = p.provisioners
+	}
+	p.deprovision(ctx, provisioners, in, out)
+}
+
+// ordered returns the provisioners in the order they get provisioned in, which is the order they were specified in,
+// except that provisioners declared using Named run after the provisioners they depend on. Deprovisioning happens in
+// reverse order, so that dependents are always torn down first.
+func (p CompositeProvisioner) ordered() ([]sdk.Provisioner, error) {
+	indices := make(map[string]int)
+	for i, provisioner := range p.provisioners {
+		if named, ok := provisioner.(NamedProvisioner); ok {
+			if _, exists := indices[named.name]; exists {
+				return nil, fmt.Errorf("multiple provisioners are named '%s'", named.name)
+			}
+			indices[named.name] = i
+		}
+	}
+
+	dependencies := make([][]int, len(p.provisioners))
+	for i, provisioner := range p.provisioners {
+		named, ok := provisioner.(NamedProvisioner)
+		if !ok {
+			continue
+		}
+		for _, dependency := range named.dependencies {
+			j, ok := indices[dependency]
+			if !ok {
+				return nil, fmt.Errorf("provisioner '%s' depends on '%s', which is not part of the same composite", named.name, dependency)
+			}
+			dependencies[i] = append(dependencies[i], j)
+		}
+	}
+
+	// Repeatedly pick the first provisioner whose dependencies have all been picked, so that the specified order is
+	// kept wherever the dependencies allow it.
+	ordered := make([]sdk.Provisioner, 0, len(p.provisioners))
+	picked := make([]bool, len(p.provisioners))
+	for len(ordered) < len(p.provisioners) {
+		next := -1
+		for i := range p.provisioners {
+			if !picked[i] && allPicked(picked, dependencies[i]) {
+				next = i
+				break
+			}
+		}
+		if next < 0 {
+			var names []string
+			for i, provisioner := range p.provisioners {
+				if named, ok := provisioner.(NamedProvisioner); ok && !picked[i] {
+					names = append(names, fmt.Sprintf("'%s'", named.name))
+				}
+			}
+			return nil, fmt.Errorf("the provisioners %s depend on each other in a cycle", strings.Join(names, ", "))
+		}
+		picked[next] = true
+		ordered = append(ordered, p.provisioners[next])
+	}
+	return ordered, nil
+}
+
+func allPicked(picked []bool, indices []int) bool {
+	for _, i := range indices {
+		if !picked[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// deprovision deprovisions the specified provisioners in reverse order.
+func (p CompositeProvisioner) deprovision(ctx context.Context, provisioners []sdk.Provisioner, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	for i := len(provisioners) - 1; i >= 0; i-- {
+		provisioners[i].Deprovision(ctx, in, out)
+	}
+}
+
+func (p CompositeProvisioner) Description() string {
+	var descriptions []string
+	for _, provisioner := range p.provisioners {
+		descriptions = append(descriptions, provisioner.Description())
+	}
+
+	return strings.Join(descriptions, "; ")
+}
+
+// NamedProvisioner runs a provisioner of a Composite under a name that other provisioners of it can depend on.
+type NamedProvisioner struct {
+	sdk.Provisioner
+
+	name         string
+	dependencies []string
+	provisioner  sdk.Provisioner
+}
+
+// Named returns a provisioner that runs the specified provisioner under the specified name, so that other provisioners
+// of the same Composite can declare that they depend on it. The provisioner itself depends on the provisioners of the
+// Composite with the names in dependsOn, if any, and gets provisioned after them and deprovisioned before them.
+// Provisioning fails if a dependency is not part of the Composite, if two provisioners have the same name, or if the
+// dependencies form a cycle. The returned provisioner has to be passed to Composite directly, not wrapped in another
+// provisioner, for its dependencies to be taken into account.
+func Named(name string, provisioner sdk.Provisioner, dependsOn ...string) sdk.Provisioner {
+	return NamedProvisioner{
+		name:         name,
+		dependencies: dependsOn,
+		provisioner:  provisioner,
+	}
+}
+
+func (p NamedProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	p.provisioner.Provision(ctx, in, out)
+}
+
+func (p NamedProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	p.provisioner.Deprovision(ctx, in, out)
+}
+
+func (p NamedProvisioner) Description() string {
+	return p.provisioner.Description()
+}
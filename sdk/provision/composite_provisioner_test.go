@@ -0,0 +1,272 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingProvisioner struct {
+	sdk.Provisioner
+
+	name   string
+	fail   bool
+	events *[]string
+}
+
+func (p recordingProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	*p.events = append(*p.events, "provision "+p.name)
+	if p.fail {
+		out.AddError(errors.New(p.name + " failed"))
+		return
+	}
+	out.AddEnvVar(p.name, "value")
+}
+
+func (p recordingProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	*p.events = append(*p.events, "deprovision "+p.name)
+}
+
+func (p recordingProvisioner) Description() string {
+	return p.name
+}
+
+func TestCompositeRollsBackOnFailure(t *testing.T) {
+	var events []string
+	provisioner := Composite(
+		recordingProvisioner{name: "A", events: &events},
+		recordingProvisioner{name: "B", events: &events},
+		recordingProvisioner{name: "C", fail: true, events: &events},
+		recordingProvisioner{name: "D", events: &events},
+	)
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{}, &out)
+
+	assert.Equal(t, []string{"provision A", "provision B", "provision C", "deprovision B", "deprovision A"}, events)
+	assert.Equal(t, []sdk.Error{{Message: "C failed"}}, out.Diagnostics.Errors)
+}
+
+func TestCompositeRollbackLeavesFilesOfFailedProvisioner(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	assert.NoError(t, fsys.WriteFile("/home/user/.tool/credentials", []byte("user data"), 0600))
+
+	var events []string
+	provisioner := Composite(
+		recordingProvisioner{name: "A", events: &events},
+		TempFile(FieldAsFile("Token"), AtFixedPath("/home/user/.tool/credentials"), FailIfExists(), WithSecureDelete()),
+	)
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp/op-test",
+		FileSystem: fsys,
+		ItemFields: map[sdk.FieldName]string{"Token": "secret"},
+	}, &out)
+	assert.Len(t, out.Diagnostics.Errors, 1)
+	assert.Equal(t, []string{"provision A", "deprovision A"}, events)
+
+	contents, err := fsys.ReadFile("/home/user/.tool/credentials")
+	assert.NoError(t, err)
+	assert.Equal(t, "user data", string(contents))
+}
+
+func TestCompositeRollbackKeepsFileSystemAndLog(t *testing.T) {
+	fs := plugintest.NewMemoryFileSystem()
+	var rollbackFS sdk.FileSystem
+	provisioner := Composite(
+		loggingProvisioner{name: "A", fs: &rollbackFS},
+		recordingProvisioner{name: "B", fail: true, events: &[]string{}},
+	)
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{FileSystem: fs}, &out)
+
+	assert.Same(t, fs, rollbackFS)
+	assert.Equal(t, []sdk.LogEntry{{Provisioner: "A", Message: "rolled back"}}, out.Log)
+}
+
+// loggingProvisioner records the file system it's deprovisioned with and logs the deprovisioning.
+type loggingProvisioner struct {
+	sdk.Provisioner
+
+	name string
+	fs   *sdk.FileSystem
+}
+
+func (p loggingProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+}
+
+func (p loggingProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	*p.fs = in.FileSystem
+	out.AddLog(sdk.LogEntry{Provisioner: p.name, Message: "rolled back"})
+}
+
+func (p loggingProvisioner) Description() string {
+	return p.name
+}
+
+func TestCompositeDeprovisionsInReverseOrder(t *testing.T) {
+	var events []string
+	provisioner := Composite(
+		recordingProvisioner{name: "A", events: &events},
+		recordingProvisioner{name: "B", events: &events},
+	)
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{}, &out)
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{}, &sdk.DeprovisionOutput{})
+
+	assert.Equal(t, []string{"provision A", "provision B", "deprovision B", "deprovision A"}, events)
+	assert.Equal(t, map[string]string{"A": "value", "B": "value"}, out.Environment)
+	assert.Equal(t, "A; B", provisioner.Description())
+}
+
+func TestCompositeCancelledContext(t *testing.T) {
+	var events []string
+	ctx, cancel := context.WithCancel(context.Background())
+	provisioner := Composite(
+		recordingProvisioner{name: "A", events: &events},
+		cancellingProvisioner{cancel: cancel},
+		recordingProvisioner{name: "B", events: &events},
+	)
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(ctx, sdk.ProvisionInput{}, &out)
+
+	assert.Equal(t, []string{"provision A", "deprovision A"}, events)
+	assert.Equal(t, []sdk.Error{{Message: context.Canceled.Error()}}, out.Diagnostics.Errors)
+}
+
+// cancellingProvisioner cancels the context while provisioning, to simulate provisioning getting aborted halfway.
+type cancellingProvisioner struct {
+	sdk.Provisioner
+
+	cancel context.CancelFunc
+}
+
+func (p cancellingProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	p.cancel()
+}
+
+func (p cancellingProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+}
+
+func (p cancellingProvisioner) Description() string {
+	return "cancel"
+}
+
+func TestCompositeActions(t *testing.T) {
+	provisioner := Composite(
+		EnvVars(map[string]sdk.FieldName{"TOKEN": "Token"}),
+		TempFile(FieldAsFile("Token"), Filename("token"), SetPathAsEnvVar("TOKEN_FILE")),
+	)
+
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"actions": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"TOKEN":      "hunter2",
+					"TOKEN_FILE": "/tmp/token",
+				},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/token": {Contents: []byte("hunter2"), Mode: 0600},
+				},
+				Actions: []sdk.ProvisionAction{
+					{Kind: sdk.ActionKindEnvVar, Target: "TOKEN"},
+					{Kind: sdk.ActionKindFile, Target: "/tmp/token", Mode: 0600, Size: 7},
+					{Kind: sdk.ActionKindEnvVar, Target: "TOKEN_FILE"},
+				},
+			},
+		},
+	})
+}
+
+func TestCompositeDependencies(t *testing.T) {
+	provision := func(provisioner sdk.Provisioner) sdk.ProvisionOutput {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		provisioner.Provision(context.Background(), sdk.ProvisionInput{}, &out)
+		return out
+	}
+
+	t.Run("dependents are torn down first", func(t *testing.T) {
+		var events []string
+		provisioner := Composite(
+			Named("symlink", recordingProvisioner{name: "symlink", events: &events}, "file"),
+			recordingProvisioner{name: "env", events: &events},
+			Named("file", recordingProvisioner{name: "file", events: &events}),
+		)
+
+		out := provision(provisioner)
+		assert.Empty(t, out.Diagnostics.Errors)
+		provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{}, &sdk.DeprovisionOutput{})
+
+		assert.Equal(t, []string{
+			"provision env", "provision file", "provision symlink",
+			"deprovision symlink", "deprovision file", "deprovision env",
+		}, events)
+	})
+
+	t.Run("rollback respects dependencies", func(t *testing.T) {
+		var events []string
+		provisioner := Composite(
+			Named("symlink", recordingProvisioner{name: "symlink", fail: true, events: &events}, "file"),
+			Named("file", recordingProvisioner{name: "file", events: &events}),
+			recordingProvisioner{name: "env", events: &events},
+		)
+
+		out := provision(provisioner)
+		assert.Equal(t, []sdk.Error{{Message: "symlink failed"}}, out.Diagnostics.Errors)
+		assert.Equal(t, []string{"provision file", "provision symlink", "deprovision file"}, events)
+	})
+
+	for description, scenario := range map[string]struct {
+		provisioner   sdk.Provisioner
+		expectedError string
+	}{
+		"unknown dependency": {
+			provisioner:   Composite(Named("symlink", recordingProvisioner{name: "symlink"}, "file")),
+			expectedError: "provisioner 'symlink' depends on 'file', which is not part of the same composite",
+		},
+		"duplicate name": {
+			provisioner:   Composite(Named("file", recordingProvisioner{name: "A"}), Named("file", recordingProvisioner{name: "B"})),
+			expectedError: "multiple provisioners are named 'file'",
+		},
+		"cycle": {
+			provisioner: Composite(
+				Named("A", recordingProvisioner{name: "A"}, "B"),
+				Named("B", recordingProvisioner{name: "B"}, "A"),
+			),
+			expectedError: "the provisioners 'A', 'B' depend on each other in a cycle",
+		},
+	} {
+		t.Run(description, func(t *testing.T) {
+			out := provision(scenario.provisioner)
+			assert.Equal(t, []sdk.Error{{Message: scenario.expectedError}}, out.Diagnostics.Errors)
+			assert.Empty(t, out.Environment)
+		})
+	}
+}
@@ -0,0 +1,79 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// conditionalProvisioners counts the provisioners created by When, to tell them apart in the temp dir.
+var conditionalProvisioners uint64
+
+// ConditionalProvisioner runs a provisioner only if a condition holds.
+type ConditionalProvisioner struct {
+	sdk.Provisioner
+
+	id          uint64
+	predicate   func(in sdk.ProvisionInput) bool
+	provisioner sdk.Provisioner
+}
+
+// When returns a provisioner that only runs the specified provisioner if the predicate holds for the provision
+// input. This can be used to provision different variants of a credential differently, for example by combining
+// When(HasFields("Token"), ...) and When(HasFields("Username", "Password"), ...) using Composite.
+//
+// Since the predicate can't be evaluated during deprovisioning, whether it held is recorded in the temp dir, and the
+// provisioner is only deprovisioned if it did.
+func When(predicate func(in sdk.ProvisionInput) bool, provisioner sdk.Provisioner) sdk.Provisioner {
+	return ConditionalProvisioner{
+		id:          atomic.AddUint64(&conditionalProvisioners, 1),
+		predicate:   predicate,
+		provisioner: provisioner,
+	}
+}
+
+// HasFields returns a predicate for When that holds if the item has a value for all of the specified fields.
+func HasFields(fieldNames ...sdk.FieldName) func(in sdk.ProvisionInput) bool {
+	return func(in sdk.ProvisionInput) bool {
+		for _, fieldName := range fieldNames {
+			if in.ItemFields[fieldName] == "" {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func (p ConditionalProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	if !p.predicate(in) {
+		return
+	}
+
+	if !in.DryRun {
+		err := recordProvisioned(in.FS(), in.TempDir, p.key())
+		if err != nil {
+			out.AddError(fmt.Errorf("recording that the condition holds: %w", err))
+			return
+		}
+	}
+	p.provisioner.Provision(ctx, in, out)
+}
+
+func (p ConditionalProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	if !wasProvisioned(in.FS(), in.TempDir, p.key()) {
+		return
+	}
+	p.provisioner.Deprovision(ctx, in, out)
+}
+
+func (p ConditionalProvisioner) Description() string {
+	return p.provisioner.Description() + " (if applicable)"
+}
+
+// key identifies this provisioner in the temp dir. Plugins create their provisioners in the same order every time they
+// are loaded, so the key is the same during provisioning and deprovisioning.
+func (p ConditionalProvisioner) key() string {
+	return fmt.Sprintf("when-%d", p.id)
+}
@@ -0,0 +1,69 @@
+package provision
+
+import (
+	"context"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWhen(t *testing.T) {
+	provisioner := Composite(
+		When(HasFields("Token"), EnvVars(map[string]sdk.FieldName{"TOOL_TOKEN": "Token"})),
+		When(HasFields("Username", "Password"), EnvVars(map[string]sdk.FieldName{
+			"TOOL_USER":     "Username",
+			"TOOL_PASSWORD": "Password",
+		})),
+	)
+
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"token": {
+			ItemFields: map[sdk.FieldName]string{
+				"Token": "secret",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{"TOOL_TOKEN": "secret"},
+			},
+		},
+		"username and password": {
+			ItemFields: map[sdk.FieldName]string{
+				"Username": "wendy",
+				"Password": "hunter2",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"TOOL_USER":     "wendy",
+					"TOOL_PASSWORD": "hunter2",
+				},
+			},
+		},
+		"only username": {
+			ItemFields: map[sdk.FieldName]string{
+				"Username": "wendy",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{},
+		},
+	})
+}
+
+func TestWhenOnlyDeprovisionsIfConditionHeld(t *testing.T) {
+	var events []string
+	provisioner := Composite(
+		When(HasFields("Token"), recordingProvisioner{name: "token", events: &events}),
+		When(HasFields("Username", "Password"), recordingProvisioner{name: "password", events: &events}),
+	)
+
+	fsys := plugintest.NewMemoryFileSystem()
+	out := sdk.ProvisionOutput{Environment: make(map[string]string)}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp/op-test",
+		FileSystem: fsys,
+		ItemFields: map[sdk.FieldName]string{"Token": "secret"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp/op-test", FileSystem: fsys}, &sdk.DeprovisionOutput{})
+	assert.Equal(t, []string{"provision token", "deprovision token"}, events)
+}
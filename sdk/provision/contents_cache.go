@@ -0,0 +1,104 @@
+package provision
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"sort"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// WithContentsCache can be used when generating the file contents is slow, for example because the contents
+// function exchanges the item's credentials for a token or builds a keystore, and the executable is invoked often.
+// The generated contents are stored in the encrypted cache under the specified key, which has to be unique among the
+// provisioners of the plugin, and reused by consecutive runs for up to the TTL. For credentials that expire, the TTL
+// should be shorter than their lifetime.
+//
+// Only generating the contents is cached: the file itself is not reused across runs. It's still written to the temp
+// dir of every run, which gets removed after the executable exits, so its path can differ between runs.
+//
+// The cached contents are only reused if the item fields, the item files, and the bound paths are exactly the same as
+// when the contents were generated, so editing the item invalidates the cache. Contents that depend on anything else,
+// such as the current time, should not be cached.
+func WithContentsCache(key string, ttl time.Duration) FileOption {
+	return func(p *FileProvisioner) {
+		p.cacheKey = key
+		p.cacheTTL = ttl
+	}
+}
+
+// cachedFileContents is the data that WithContentsCache stores in the encrypted cache.
+type cachedFileContents struct {
+	Fingerprint string
+	Contents    []byte
+}
+
+// contentsCacheKey returns the key in the encrypted cache that the file contents are stored under.
+func (p FileProvisioner) contentsCacheKey() string {
+	return "file-contents/" + p.cacheKey
+}
+
+// cachedContents returns the contents stored in the encrypted cache, if they were generated from the same input and
+// haven't expired yet.
+func (p FileProvisioner) cachedContents(in sdk.ProvisionInput) ([]byte, bool) {
+	entry, ok := in.Cache[p.contentsCacheKey()]
+	if !ok || !time.Now().Before(entry.ExpiresAt) {
+		return nil, false
+	}
+
+	var cached cachedFileContents
+	if !in.Cache.Get(p.contentsCacheKey(), &cached) || cached.Fingerprint != contentsFingerprint(in) {
+		return nil, false
+	}
+	return cached.Contents, true
+}
+
+// cacheContents stores the contents in the encrypted cache, along with the fingerprint of the input they were
+// generated from.
+func (p FileProvisioner) cacheContents(in sdk.ProvisionInput, out *sdk.ProvisionOutput, contents []byte) error {
+	if out.Cache.Puts == nil {
+		out.Cache.Puts = make(sdk.CacheState)
+	}
+	return out.Cache.Put(p.contentsCacheKey(), cachedFileContents{
+		Fingerprint: contentsFingerprint(in),
+		Contents:    contents,
+	}, time.Now().Add(p.cacheTTL))
+}
+
+// contentsFingerprint returns a hash of everything in the input that the file contents can be derived from. Only the
+// hash is stored, so that the cache doesn't contain another copy of every field.
+func contentsFingerprint(in sdk.ProvisionInput) string {
+	h := sha256.New()
+	write := func(kind string, values map[string][]byte) {
+		keys := make([]string, 0, len(values))
+		for key := range values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		h.Write([]byte(kind))
+		for _, key := range keys {
+			// Length prefixes make sure that different inputs can't result in the same byte stream.
+			for _, b := range [][]byte{[]byte(key), values[key]} {
+				_ = binary.Write(h, binary.BigEndian, uint64(len(b)))
+				h.Write(b)
+			}
+		}
+	}
+
+	fields := make(map[string][]byte, len(in.ItemFields))
+	for name, value := range in.ItemFields {
+		fields[name.String()] = []byte(value)
+	}
+	paths := make(map[string][]byte, len(in.BoundPaths))
+	for key, path := range in.BoundPaths {
+		paths[key] = []byte(path)
+	}
+
+	write("fields", fields)
+	write("files", in.ItemFiles)
+	write("paths", paths)
+	return hex.EncodeToString(h.Sum(nil))
+}
@@ -0,0 +1,70 @@
+package provision
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithContentsCache(t *testing.T) {
+	calls := 0
+	provisioner := TempFile(func(in sdk.ProvisionInput) ([]byte, error) {
+		calls++
+		return []byte(in.ItemFields["Token"]), nil
+	}, Filename("token"), WithContentsCache("token", time.Hour))
+
+	provision := func(fields map[sdk.FieldName]string, cache sdk.CacheState) sdk.ProvisionOutput {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		provisioner.Provision(context.Background(), sdk.ProvisionInput{
+			TempDir:    "/tmp",
+			FileSystem: plugintest.NewMemoryFileSystem(),
+			ItemFields: fields,
+			Cache:      cache,
+		}, &out)
+		assert.Empty(t, out.Diagnostics.Errors)
+		return out
+	}
+
+	fields := map[sdk.FieldName]string{"Token": "tok_EXAMPLE"}
+	first := provision(fields, nil)
+	assert.Equal(t, 1, calls)
+	assert.Equal(t, []byte("tok_EXAMPLE"), first.Files["/tmp/token"].Contents)
+	entry, ok := first.Cache.Puts["file-contents/token"]
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Hour), entry.ExpiresAt, time.Minute)
+	assert.NotContains(t, string(entry.Data), "tok_EXAMPLE", "the fields should only be stored as a fingerprint")
+
+	t.Run("reuses cached contents", func(t *testing.T) {
+		calls = 0
+		out := provision(fields, first.Cache.Puts)
+		assert.Equal(t, 0, calls)
+		assert.Equal(t, []byte("tok_EXAMPLE"), out.Files["/tmp/token"].Contents)
+		assert.Empty(t, out.Cache.Puts)
+	})
+
+	t.Run("item has been edited", func(t *testing.T) {
+		calls = 0
+		out := provision(map[sdk.FieldName]string{"Token": "tok_EDITED"}, first.Cache.Puts)
+		assert.Equal(t, 1, calls)
+		assert.Equal(t, []byte("tok_EDITED"), out.Files["/tmp/token"].Contents)
+		assert.Contains(t, out.Cache.Puts, "file-contents/token")
+	})
+
+	t.Run("cached contents have expired", func(t *testing.T) {
+		calls = 0
+		expired := sdk.CacheState{"file-contents/token": first.Cache.Puts["file-contents/token"]}
+		entry := expired["file-contents/token"]
+		entry.ExpiresAt = time.Now().Add(-time.Second)
+		expired["file-contents/token"] = entry
+
+		provision(fields, expired)
+		assert.Equal(t, 1, calls)
+	})
+}
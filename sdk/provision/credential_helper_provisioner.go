@@ -0,0 +1,280 @@
+package provision
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// credentialHelperTimeout is how long a single connection to the credential helper socket can take, so that a
+// misbehaving client can't keep deprovisioning from finishing.
+const credentialHelperTimeout = 10 * time.Second
+
+// defaultCredentialHelperSocketName is the name of the socket in the temp dir if no other path is specified. It's
+// kept short, since the length of socket paths is limited to around 100 bytes on most platforms.
+const defaultCredentialHelperSocketName = "helper.sock"
+
+// CredentialHelperHandler handles a single request of a credential helper protocol, such as Docker's. The action
+// specifies what the client is asking for, e.g. "get", and the payload contains the input for that action, e.g. the
+// server URL. The returned bytes are sent back to the client.
+type CredentialHelperHandler func(fields map[sdk.FieldName]string, action string, payload []byte) ([]byte, error)
+
+// CredentialHelperProvisioner provisions one or more secrets by serving a credential helper protocol on a Unix
+// socket, so that the secrets are only handed out when the executable asks for them.
+type CredentialHelperProvisioner struct {
+	sdk.Provisioner
+
+	handler CredentialHelperHandler
+	socket  FileProvisioner
+	servers *credentialHelperServers
+}
+
+// CredentialHelperSocket returns a provisioner that creates a Unix socket in the temp dir and serves requests to it
+// using the specified handler for as long as the executable runs. The same options as for TempFile can be used to
+// specify where the socket is created and how its path is passed to the executable, for example SetPathAsEnvVar or
+// AddArgs. If no path is specified, the socket is created as "helper.sock" in the temp dir.
+//
+// Each connection carries a single request: the action on the first line, followed by the payload until the client
+// closes its side of the connection for writing. The response starts with "ok" or "error" on the first line,
+// followed by the output of the handler or the error message respectively.
+func CredentialHelperSocket(handler CredentialHelperHandler, opts ...FileOption) sdk.Provisioner {
+	socket := FileProvisioner{}
+	for _, opt := range opts {
+		opt(&socket)
+	}
+	if socket.outpathFixed == "" && socket.outfileName == "" {
+		socket.outfileName = defaultCredentialHelperSocketName
+	}
+	return CredentialHelperProvisioner{
+		handler: handler,
+		socket:  socket,
+		servers: &credentialHelperServers{
+			byTempDir: make(map[string][]*credentialHelperServer),
+		},
+	}
+}
+
+// DockerCredentialHelper returns a handler that implements the "get" action of the Docker credential helper
+// protocol, returning the values of the specified fields as the username and secret for any server URL. All other
+// actions are rejected, since the credentials are managed in 1Password.
+func DockerCredentialHelper(usernameField sdk.FieldName, secretField sdk.FieldName) CredentialHelperHandler {
+	return CredentialHelperHandler(func(fields map[sdk.FieldName]string, action string, payload []byte) ([]byte, error) {
+		if action != "get" {
+			return nil, fmt.Errorf("action '%s' is not supported", action)
+		}
+
+		secret, ok := fields[secretField]
+		if !ok {
+			return nil, fmt.Errorf("no value present in the item for field '%s'", secretField)
+		}
+
+		return json.Marshal(struct {
+			ServerURL string
+			Username  string
+			Secret    string
+		}{
+			ServerURL: strings.TrimSpace(string(payload)),
+			Username:  fields[usernameField],
+			Secret:    secret,
+		})
+	})
+}
+
+func (p CredentialHelperProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	outpath, err := p.socket.outpath(in)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindFile,
+			Target: outpath,
+		})
+	} else {
+		err = p.servers.start(in.TempDir, outpath, p.handler, in.ItemFields)
+		if err != nil {
+			out.AddError(fmt.Errorf("creating credential helper socket: %w", err))
+			return
+		}
+		out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindFile, Target: outpath, Mode: os.ModeSocket | defaultFileMode})
+	}
+
+	p.socket.provisionOutpath(outpath, in.DryRun, out)
+}
+
+func (p CredentialHelperProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	for _, err := range p.servers.stop(in.TempDir) {
+		out.AddError(err)
+	}
+	if p.socket.ramDisk != RAMDiskNever {
+		p.socket.removeRAMDiskDir(in, out)
+	}
+}
+
+func (p CredentialHelperProvisioner) Description() string {
+	return "Provision secret through a credential helper socket"
+}
+
+// credentialHelperServers keeps track of the credential helper servers that are running for each provisioning run,
+// identified by temp dir, so that they can be stopped during deprovisioning.
+type credentialHelperServers struct {
+	mu        sync.Mutex
+	byTempDir map[string][]*credentialHelperServer
+}
+
+type credentialHelperServer struct {
+	path     string
+	listener net.Listener
+	handler  CredentialHelperHandler
+	fields   map[sdk.FieldName]string
+	wg       sync.WaitGroup
+}
+
+func (s *credentialHelperServers) start(tempDir string, path string, handler CredentialHelperHandler, fields map[sdk.FieldName]string) error {
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	err = os.Chmod(path, defaultFileMode)
+	if err != nil {
+		_ = listener.Close()
+		return err
+	}
+
+	server := &credentialHelperServer{
+		path:     path,
+		listener: listener,
+		handler:  handler,
+		fields:   make(map[sdk.FieldName]string, len(fields)),
+	}
+	for name, value := range fields {
+		server.fields[name] = value
+	}
+
+	s.mu.Lock()
+	s.byTempDir[tempDir] = append(s.byTempDir[tempDir], server)
+	s.mu.Unlock()
+
+	server.wg.Add(1)
+	go server.serve()
+	return nil
+}
+
+// stop closes the listeners of all credential helper servers for the specified temp dir, waits for the requests
+// that are in progress, and removes the sockets.
+func (s *credentialHelperServers) stop(tempDir string) (errs []error) {
+	s.mu.Lock()
+	servers := s.byTempDir[tempDir]
+	delete(s.byTempDir, tempDir)
+	s.mu.Unlock()
+
+	for _, server := range servers {
+		err := server.listener.Close()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("closing credential helper socket %s: %w", server.path, err))
+		}
+		server.wg.Wait()
+
+		err = os.Remove(server.path)
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("removing credential helper socket %s: %w", server.path, err))
+		}
+	}
+	return errs
+}
+
+func (s *credentialHelperServer) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			// The listener has been closed during deprovisioning.
+			return
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(conn)
+		}()
+	}
+}
+
+// handle serves a single request on the connection. Only the error message of the handler is sent back to the
+// client, which should never contain a secret.
+func (s *credentialHelperServer) handle(conn net.Conn) {
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(credentialHelperTimeout))
+
+	reader := bufio.NewReader(conn)
+	action, err := reader.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return
+	}
+
+	payload, err := io.ReadAll(reader)
+	if err != nil {
+		return
+	}
+
+	response, err := s.handler(s.fields, strings.TrimSpace(action), payload)
+	if err != nil {
+		_, _ = conn.Write([]byte("error\n" + err.Error()))
+		return
+	}
+	_, _ = conn.Write(append([]byte("ok\n"), response...))
+}
+
+// callCredentialHelper sends a single request to the credential helper socket at the specified path, and returns the
+// output of the handler, or its error message as an error.
+func callCredentialHelper(path string, action string, payload []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", path, credentialHelperTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("connecting to credential helper socket: %w", err)
+	}
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(credentialHelperTimeout))
+
+	_, err = conn.Write(append([]byte(action+"\n"), payload...))
+	if err != nil {
+		return nil, err
+	}
+	if unixConn, ok := conn.(*net.UnixConn); ok {
+		err = unixConn.CloseWrite()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	response, err := io.ReadAll(conn)
+	if err != nil {
+		return nil, err
+	}
+	status, output, _ := strings.Cut(string(response), "\n")
+	switch status {
+	case "ok":
+		return []byte(output), nil
+	case "error":
+		return nil, errors.New(output)
+	default:
+		return nil, fmt.Errorf("unexpected response from credential helper socket")
+	}
+}
@@ -0,0 +1,62 @@
+package provision
+
+import (
+	"context"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCredentialHelperSocket(t *testing.T) {
+	tempDir := t.TempDir()
+	provisioner := CredentialHelperSocket(DockerCredentialHelper("Username", "Token"), SetPathAsEnvVar("HELPER_SOCKET"))
+
+	in := sdk.ProvisionInput{
+		TempDir: tempDir,
+		ItemFields: map[sdk.FieldName]string{
+			"Username": "wendy",
+			"Token":    "dckr_pat_EXAMPLE",
+		},
+	}
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), in, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+
+	path := filepath.Join(defaultFileDir(t, tempDir), "helper.sock")
+	assert.Equal(t, path, out.Environment["HELPER_SOCKET"])
+
+	assert.Equal(t, `ok
+{"ServerURL":"ghcr.io","Username":"wendy","Secret":"dckr_pat_EXAMPLE"}`, requestCredentialHelper(t, path, "get\nghcr.io\n"))
+	assert.Equal(t, "error\naction 'erase' is not supported", requestCredentialHelper(t, path, "erase\nghcr.io\n"))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: tempDir}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.NoFileExists(t, path)
+	assert.NoDirExists(t, ramDiskDir(tempDir))
+
+	_, err := net.Dial("unix", path)
+	assert.Error(t, err)
+}
+
+func requestCredentialHelper(t *testing.T, path string, request string) string {
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	defer conn.Close()
+
+	_, err = conn.Write([]byte(request))
+	require.NoError(t, err)
+	require.NoError(t, conn.(*net.UnixConn).CloseWrite())
+
+	response, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	return string(response)
+}
@@ -0,0 +1,20 @@
+package provision
+
+import "github.com/99designs/keyring"
+
+// osCredentialStore returns the login keychain. The keychain backend requires cgo, so if the plugin was built
+// without it, errNoCredentialStore is returned.
+func osCredentialStore() (credentialStore, error) {
+	store := keyringCredentialStore{
+		config: func(service string) keyring.Config {
+			return keyring.Config{
+				AllowedBackends: []keyring.BackendType{keyring.KeychainBackend},
+				ServiceName:     service,
+			}
+		},
+	}
+	if _, err := store.open(""); err != nil {
+		return nil, err
+	}
+	return store, nil
+}
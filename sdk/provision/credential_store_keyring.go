@@ -0,0 +1,63 @@
+//go:build darwin || windows
+
+package provision
+
+import (
+	"context"
+	"errors"
+
+	"github.com/99designs/keyring"
+)
+
+// keyringCredentialStore is a credential store that uses the keyring backend of the platform.
+type keyringCredentialStore struct {
+	config func(service string) keyring.Config
+}
+
+func (s keyringCredentialStore) open(service string) (keyring.Keyring, error) {
+	ring, err := keyring.Open(s.config(service))
+	if errors.Is(err, keyring.ErrNoAvailImpl) {
+		return nil, errNoCredentialStore
+	}
+	return ring, err
+}
+
+func (s keyringCredentialStore) Get(ctx context.Context, service string, account string) ([]byte, bool, error) {
+	ring, err := s.open(service)
+	if err != nil {
+		return nil, false, err
+	}
+
+	item, err := ring.Get(account)
+	if errors.Is(err, keyring.ErrKeyNotFound) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return item.Data, true, nil
+}
+
+func (s keyringCredentialStore) Set(ctx context.Context, service string, account string, secret []byte) error {
+	ring, err := s.open(service)
+	if err != nil {
+		return err
+	}
+	return ring.Set(keyring.Item{
+		Key:   account,
+		Data:  secret,
+		Label: service,
+	})
+}
+
+func (s keyringCredentialStore) Delete(ctx context.Context, service string, account string) error {
+	ring, err := s.open(service)
+	if err != nil {
+		return err
+	}
+
+	err = ring.Remove(account)
+	if errors.Is(err, keyring.ErrKeyNotFound) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,71 @@
+package provision
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// secretToolCredentialStore stores secrets in the Secret Service using the secret-tool command of libsecret, so that
+// the plugin doesn't have to talk D-Bus itself. The attributes are the same as the ones used by libsecret-based tools,
+// such as the Python keyring package.
+type secretToolCredentialStore struct {
+	path string
+}
+
+// osCredentialStore returns the Secret Service, if secret-tool is installed and the session has a D-Bus.
+func osCredentialStore() (credentialStore, error) {
+	if os.Getenv("DBUS_SESSION_BUS_ADDRESS") == "" {
+		return nil, fmt.Errorf("%w: the session has no D-Bus", errNoCredentialStore)
+	}
+	path, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return nil, fmt.Errorf("%w: secret-tool is not installed", errNoCredentialStore)
+	}
+	return secretToolCredentialStore{path: path}, nil
+}
+
+func (s secretToolCredentialStore) Get(ctx context.Context, service string, account string) ([]byte, bool, error) {
+	var stdout bytes.Buffer
+	err := s.run(ctx, nil, &stdout, "lookup", "service", service, "username", account)
+	if _, ok := err.(*exec.ExitError); ok {
+		// secret-tool exits with 1 without any output if there's no matching item. Other failures are reported on
+		// stderr, in which case run wraps the error.
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	return stdout.Bytes(), true, nil
+}
+
+func (s secretToolCredentialStore) Set(ctx context.Context, service string, account string, secret []byte) error {
+	label := fmt.Sprintf("%s (%s)", service, account)
+	return s.run(ctx, bytes.NewReader(secret), nil, "store", "--label", label, "service", service, "username", account)
+}
+
+func (s secretToolCredentialStore) Delete(ctx context.Context, service string, account string) error {
+	return s.run(ctx, nil, nil, "clear", "service", service, "username", account)
+}
+
+// run runs secret-tool with the args. The secret is always passed on stdin, so that it doesn't show up in the process
+// list.
+func (s secretToolCredentialStore) run(ctx context.Context, stdin *bytes.Reader, stdout *bytes.Buffer, args ...string) error {
+	var stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, s.path, args...)
+	if stdin != nil {
+		cmd.Stdin = stdin
+	}
+	if stdout != nil {
+		cmd.Stdout = stdout
+	}
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil && stderr.Len() > 0 {
+		return fmt.Errorf("secret-tool %s: %w: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return err
+}
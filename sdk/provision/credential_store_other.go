@@ -0,0 +1,7 @@
+//go:build !darwin && !windows && !linux
+
+package provision
+
+func osCredentialStore() (credentialStore, error) {
+	return nil, errNoCredentialStore
+}
@@ -0,0 +1,220 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// credentialStore is the credential store of the operating system.
+type credentialStore interface {
+	// Get returns the secret stored for the service and account, or false if there is none.
+	Get(ctx context.Context, service string, account string) ([]byte, bool, error)
+
+	// Set stores the secret for the service and account, replacing the secret that's stored already, if any.
+	Set(ctx context.Context, service string, account string, secret []byte) error
+
+	// Delete removes the secret for the service and account. It's a no-op if there is none.
+	Delete(ctx context.Context, service string, account string) error
+}
+
+// errNoCredentialStore is returned by openCredentialStore if the OS doesn't have a credential store, or if it's not
+// available in the current session.
+var errNoCredentialStore = errors.New("no OS credential store available")
+
+// openCredentialStore opens the credential store of the operating system. It's a variable so that tests can replace
+// the store with an in-memory one.
+var openCredentialStore = osCredentialStore
+
+// CredentialStoreProvisioner provisions a secret as an entry in the credential store of the operating system.
+type CredentialStoreProvisioner struct {
+	sdk.Provisioner
+
+	service  string
+	account  string
+	secret   ItemToFileContents
+	previous *previousSecrets
+}
+
+// previousSecrets keeps the secrets that were stored in the credential store before provisioning, for each
+// provisioning run, identified by temp dir, so that they can be restored during deprovisioning. They're only kept in
+// memory, since writing them to the temp dir would put a secret that the user stored in the credential store on disk.
+type previousSecrets struct {
+	mu        sync.Mutex
+	byTempDir map[string][]byte
+}
+
+func (s *previousSecrets) put(tempDir string, secret []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.byTempDir[tempDir] = secret
+}
+
+// take returns the previous secret for the temp dir and forgets it, or false if there is none.
+func (s *previousSecrets) take(tempDir string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	secret, ok := s.byTempDir[tempDir]
+	delete(s.byTempDir, tempDir)
+	return secret, ok
+}
+
+// OSCredentialStore returns a provisioner that stores the secret in the credential store of the operating system
+// under the service and account, for executables that read their credentials from there instead of from a file:
+// * macOS: a generic password in the login keychain, with the service and account as its attributes.
+// * Linux: an item in the default collection of the Secret Service, with the attributes "service" and "username".
+// * Windows: a generic credential in the Credential Manager, with "<service>:<account>" as its target name.
+//
+// On Linux, the secret-tool command of libsecret has to be installed. If a secret is already stored under the service
+// and account, it gets restored after the executable exits, and the entry is removed otherwise. The previous secret is
+// only kept in the memory of the plugin: if it's lost, e.g. because the plugin crashed, the entry is removed and a
+// warning is reported instead of restoring it. If the operating
+// system has no credential store, or it's not available, e.g. because the session has no D-Bus, the secret is not
+// stored and a warning is reported instead.
+func OSCredentialStore(service string, account string, secret ItemToFileContents) sdk.Provisioner {
+	return CredentialStoreProvisioner{
+		service: service,
+		account: account,
+		secret:  secret,
+		previous: &previousSecrets{
+			byTempDir: make(map[string][]byte),
+		},
+	}
+}
+
+func (p CredentialStoreProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	secret, err := p.secret(in)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindCredentialStore,
+			Target: p.target(),
+			Size:   len(secret),
+		})
+		return
+	}
+
+	store, err := openCredentialStore()
+	if errors.Is(err, errNoCredentialStore) {
+		out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{
+			Message: fmt.Sprintf("%s: the secret for %s has not been stored", err, p.target()),
+		})
+		return
+	} else if err != nil {
+		out.AddError(fmt.Errorf("opening OS credential store: %w", err))
+		return
+	}
+
+	fsys := in.FS()
+	if _, err := readBackup(fsys, in.TempDir, p.backupKey()); errors.Is(err, errNoBackup) {
+		existing, found, err := store.Get(ctx, p.service, p.account)
+		if err != nil {
+			out.AddError(fmt.Errorf("reading %s from OS credential store: %w", p.target(), err))
+			return
+		}
+
+		// Only whether a secret existed is recorded in the temp dir, the secret itself is kept in memory.
+		err = writeBackup(fsys, in.TempDir, p.backupKey(), fileBackup{Existed: found})
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+		if found {
+			p.previous.put(in.TempDir, existing)
+		}
+	} else if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	err = store.Set(ctx, p.service, p.account, secret)
+	if err != nil {
+		out.AddError(fmt.Errorf("storing %s in OS credential store: %w", p.target(), err))
+		return
+	}
+	out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindCredentialStore, Target: p.target(), Size: len(secret)})
+	out.AddLog(p.logEntry("stored secret for %s in OS credential store (%d bytes)", p.target(), len(secret)))
+}
+
+func (p CredentialStoreProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	if in.DryRun {
+		return
+	}
+
+	fsys := in.FS()
+	backup, err := readBackup(fsys, in.TempDir, p.backupKey())
+	if errors.Is(err, errNoBackup) {
+		// Nothing was stored, e.g. because there is no credential store or provisioning failed.
+		return
+	} else if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	store, err := openCredentialStore()
+	if err != nil {
+		out.AddError(fmt.Errorf("opening OS credential store: %w", err))
+		return
+	}
+
+	previous, restore := p.previous.take(in.TempDir)
+	if backup.Existed && !restore {
+		out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{
+			Message: fmt.Sprintf("the previous secret for %s could not be restored in the OS credential store and has been removed", p.target()),
+		})
+	}
+	if restore {
+		err = store.Set(ctx, p.service, p.account, previous)
+	} else {
+		err = store.Delete(ctx, p.service, p.account)
+	}
+	if err != nil {
+		out.AddError(fmt.Errorf("removing %s from OS credential store: %w", p.target(), err))
+		return
+	}
+
+	err = fsys.Remove(backupPath(in.TempDir, p.backupKey()))
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if restore {
+		out.AddLog(p.logEntry("restored previous secret for %s in OS credential store", p.target()))
+	} else {
+		out.AddLog(p.logEntry("removed secret for %s from OS credential store", p.target()))
+	}
+}
+
+func (p CredentialStoreProvisioner) Description() string {
+	return fmt.Sprintf("Store secret in OS credential store for %s", p.target())
+}
+
+// target returns how the entry in the credential store is referred to in logs, diagnostics, and actions.
+func (p CredentialStoreProvisioner) target() string {
+	return p.service + "/" + p.account
+}
+
+// backupKey returns the key under which the previous secret gets backed up in the temp dir.
+func (p CredentialStoreProvisioner) backupKey() string {
+	return "credential-store:" + p.target()
+}
+
+func (p CredentialStoreProvisioner) logEntry(format string, args ...any) sdk.LogEntry {
+	return sdk.LogEntry{
+		Provisioner: p.Description(),
+		Message:     fmt.Sprintf(format, args...),
+	}
+}
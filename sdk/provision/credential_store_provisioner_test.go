@@ -0,0 +1,148 @@
+package provision
+
+import (
+	"context"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// memoryCredentialStore is an in-memory credentialStore, keyed by "<service>/<account>".
+type memoryCredentialStore map[string][]byte
+
+func (s memoryCredentialStore) Get(ctx context.Context, service string, account string) ([]byte, bool, error) {
+	secret, ok := s[service+"/"+account]
+	return secret, ok, nil
+}
+
+func (s memoryCredentialStore) Set(ctx context.Context, service string, account string, secret []byte) error {
+	s[service+"/"+account] = secret
+	return nil
+}
+
+func (s memoryCredentialStore) Delete(ctx context.Context, service string, account string) error {
+	delete(s, service+"/"+account)
+	return nil
+}
+
+func TestOSCredentialStore(t *testing.T) {
+	store := memoryCredentialStore{}
+	openErr := error(nil)
+	defer func(original func() (credentialStore, error)) { openCredentialStore = original }(openCredentialStore)
+	openCredentialStore = func() (credentialStore, error) {
+		if openErr != nil {
+			return nil, openErr
+		}
+		return store, nil
+	}
+
+	provisioner := OSCredentialStore("example-cli", "default", FieldAsFile("Token"))
+	fields := map[sdk.FieldName]string{"Token": "tok_EXAMPLE"}
+
+	run := func(t *testing.T, dryRun bool) (sdk.ProvisionOutput, func() sdk.DeprovisionOutput) {
+		fsys := plugintest.NewMemoryFileSystem()
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		provisioner.Provision(context.Background(), sdk.ProvisionInput{
+			TempDir:    "/tmp",
+			ItemFields: fields,
+			DryRun:     dryRun,
+			FileSystem: fsys,
+		}, &out)
+		require.Empty(t, out.Diagnostics.Errors)
+
+		return out, func() sdk.DeprovisionOutput {
+			var deprovisionOut sdk.DeprovisionOutput
+			provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{
+				TempDir:    "/tmp",
+				DryRun:     dryRun,
+				FileSystem: fsys,
+			}, &deprovisionOut)
+			require.Empty(t, deprovisionOut.Diagnostics.Errors)
+			return deprovisionOut
+		}
+	}
+
+	t.Run("stores and removes secret", func(t *testing.T) {
+		out, deprovision := run(t, false)
+		assert.Equal(t, []byte("tok_EXAMPLE"), store["example-cli/default"])
+		assert.Equal(t, []sdk.ProvisionAction{
+			{Kind: sdk.ActionKindCredentialStore, Target: "example-cli/default", Size: 11},
+		}, out.Actions)
+		assert.Empty(t, out.Files)
+
+		deprovision()
+		assert.NotContains(t, store, "example-cli/default")
+	})
+
+	t.Run("restores existing secret", func(t *testing.T) {
+		store["example-cli/default"] = []byte("tok_PREVIOUS")
+		_, deprovision := run(t, false)
+		assert.Equal(t, []byte("tok_EXAMPLE"), store["example-cli/default"])
+
+		out := deprovision()
+		assert.Equal(t, []byte("tok_PREVIOUS"), store["example-cli/default"])
+		assert.Equal(t, "restored previous secret for example-cli/default in OS credential store", out.Log[0].Message)
+		delete(store, "example-cli/default")
+	})
+
+	t.Run("no credential store", func(t *testing.T) {
+		openErr = errNoCredentialStore
+		defer func() { openErr = nil }()
+
+		out, deprovision := run(t, false)
+		assert.Equal(t, []sdk.Warning{
+			{Message: "no OS credential store available: the secret for example-cli/default has not been stored"},
+		}, out.Diagnostics.Warnings)
+		assert.Empty(t, out.Actions)
+		deprovision()
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		out, deprovision := run(t, true)
+		assert.Equal(t, []sdk.DryRunEntry{
+			{Kind: sdk.DryRunKindCredentialStore, Target: "example-cli/default", Size: 11},
+		}, out.DryRunLog)
+		assert.Empty(t, store)
+		deprovision()
+	})
+}
+
+func TestOSCredentialStoreKeepsPreviousSecretOffDisk(t *testing.T) {
+	store := memoryCredentialStore{"example-cli/default": []byte("tok_PREVIOUS")}
+	defer func(original func() (credentialStore, error)) { openCredentialStore = original }(openCredentialStore)
+	openCredentialStore = func() (credentialStore, error) { return store, nil }
+
+	fsys := plugintest.NewMemoryFileSystem()
+	in := sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+		FileSystem: fsys,
+	}
+	out := sdk.ProvisionOutput{}
+	OSCredentialStore("example-cli", "default", FieldAsFile("Token")).Provision(context.Background(), in, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+
+	for _, path := range fsys.Paths() {
+		contents, err := fsys.ReadFile(path)
+		require.NoError(t, err)
+		assert.NotContains(t, string(contents), "tok_PREVIOUS", path)
+	}
+
+	// A different provisioner, e.g. one of a plugin that got restarted, doesn't know the previous secret anymore.
+	var deprovisionOut sdk.DeprovisionOutput
+	OSCredentialStore("example-cli", "default", FieldAsFile("Token")).Deprovision(context.Background(), sdk.DeprovisionInput{
+		TempDir:    "/tmp",
+		FileSystem: fsys,
+	}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.Equal(t, []sdk.Warning{
+		{Message: "the previous secret for example-cli/default could not be restored in the OS credential store and has been removed"},
+	}, deprovisionOut.Diagnostics.Warnings)
+	assert.NotContains(t, store, "example-cli/default")
+}
@@ -0,0 +1,17 @@
+package provision
+
+import "github.com/99designs/keyring"
+
+// osCredentialStore returns the Windows Credential Manager. Credentials are stored with "<service>:<account>" as their
+// target name, which is the convention most tools that read from the Credential Manager follow.
+func osCredentialStore() (credentialStore, error) {
+	return keyringCredentialStore{
+		config: func(service string) keyring.Config {
+			return keyring.Config{
+				AllowedBackends: []keyring.BackendType{keyring.WinCredBackend},
+				ServiceName:     service,
+				WinCredPrefix:   service + ":",
+			}
+		},
+	}, nil
+}
@@ -0,0 +1,188 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// DirectoryProvisioner provisions a directory tree of secret files in the temp dir.
+type DirectoryProvisioner struct {
+	sdk.Provisioner
+
+	layout     map[string]ItemToFileContents
+	dirName    string
+	dirEnvVars []string
+}
+
+// DirectoryOption can be used to influence the behavior of the directory provisioner.
+type DirectoryOption func(*DirectoryProvisioner)
+
+// defaultDirName is the name of the directory in the temp dir if DirectoryName is not set.
+const defaultDirName = "config"
+
+// Directory returns a provisioner that creates a directory in the temp dir with a file for each entry in the layout,
+// for executables that expect a whole config directory, like gcloud. The keys of the layout are the paths of the
+// files relative to the directory, using forward slashes, e.g. "configurations/config_default". Subdirectories get
+// created as needed, accessible only by the current user. Provisioning is atomic: if the contents of any of the files
+// can't be generated, none of the files are provisioned. During deprovisioning, the files and the directories that
+// were created for them get removed.
+func Directory(layout map[string]ItemToFileContents, opts ...DirectoryOption) sdk.Provisioner {
+	p := DirectoryProvisioner{
+		layout:  layout,
+		dirName: defaultDirName,
+	}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
+
+// DirectoryName can be used to set the name of the directory in the temp dir, which defaults to "config". Plugins
+// that provision multiple directories have to give each of them a different name.
+func DirectoryName(name string) DirectoryOption {
+	return func(p *DirectoryProvisioner) {
+		p.dirName = name
+	}
+}
+
+// SetDirAsEnvVar can be used to provision the path of the directory as one or more environment variables.
+func SetDirAsEnvVar(envVarNames ...string) DirectoryOption {
+	return func(p *DirectoryProvisioner) {
+		p.dirEnvVars = envVarNames
+	}
+}
+
+func (p DirectoryProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	if err := validateFilename(p.dirName); err != nil {
+		out.AddError(err)
+		return
+	}
+	dir := filepath.Join(in.TempDir, p.dirName)
+
+	// Generate all contents first, so that nothing gets provisioned if any of them fails.
+	relPaths := p.relPaths()
+	contents := make(map[string][]byte, len(relPaths))
+	for _, relPath := range relPaths {
+		if err := validateLayoutPath(relPath); err != nil {
+			out.AddError(err)
+			return
+		}
+		fileContents, err := p.layout[relPath](in)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+		contents[relPath] = fileContents
+	}
+
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if in.DryRun {
+		for _, relPath := range relPaths {
+			out.AddDryRunEntry(sdk.DryRunEntry{
+				Kind:   sdk.DryRunKindFile,
+				Target: filepath.Join(dir, filepath.FromSlash(relPath)),
+				Size:   len(contents[relPath]),
+			})
+		}
+		for _, envVarName := range p.dirEnvVars {
+			out.AddDryRunEntry(sdk.DryRunEntry{
+				Kind:   sdk.DryRunKindEnvVar,
+				Target: envVarName,
+			})
+		}
+		return
+	}
+
+	fsys := in.FS()
+	if err := fsys.MkdirAll(in.TempDir, 0700); err != nil {
+		out.AddError(err)
+		return
+	}
+	for _, relPath := range relPaths {
+		outpath := filepath.Join(dir, filepath.FromSlash(relPath))
+		if err := createParentDirs(fsys, in.TempDir, outpath); err != nil {
+			out.AddError(err)
+			return
+		}
+		out.AddFile(outpath, sdk.OutputFile{Contents: contents[relPath], Mode: 0600})
+	}
+
+	for _, envVarName := range p.dirEnvVars {
+		out.AddNonSensitiveEnvVar(envVarName, dir)
+	}
+	out.AddLog(p.logEntry("provisioned %d files in directory %s", len(relPaths), dir))
+}
+
+func (p DirectoryProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	if in.DryRun || validateFilename(p.dirName) != nil {
+		return
+	}
+	dir := filepath.Join(in.TempDir, p.dirName)
+
+	// Files are removed in reverse order, so that the directories created for a file are only removed after the
+	// files that were provisioned to them later.
+	fsys := in.FS()
+	relPaths := p.relPaths()
+	for i := len(relPaths) - 1; i >= 0; i-- {
+		if validateLayoutPath(relPaths[i]) != nil {
+			continue
+		}
+		outpath := filepath.Join(dir, filepath.FromSlash(relPaths[i]))
+
+		err := fsys.Remove(outpath)
+		if err != nil && !os.IsNotExist(err) {
+			out.AddError(fmt.Errorf("removing %s: %w", outpath, err))
+			return
+		}
+
+		kept, err := removeCreatedDirs(fsys, in.TempDir, outpath)
+		if err != nil {
+			out.AddError(fmt.Errorf("removing parent directories of %s: %w", outpath, err))
+			return
+		}
+		if len(kept) > 0 {
+			out.AddLog(p.logEntry("kept directory %s created for %s, since it's not empty", kept[0], outpath))
+		}
+	}
+}
+
+func (p DirectoryProvisioner) Description() string {
+	return fmt.Sprintf("Provision directory %s with %d secret files", p.dirName, len(p.layout))
+}
+
+// relPaths returns the paths of the files in the layout in a deterministic order.
+func (p DirectoryProvisioner) relPaths() []string {
+	relPaths := make([]string, 0, len(p.layout))
+	for relPath := range p.layout {
+		relPaths = append(relPaths, relPath)
+	}
+	sort.Strings(relPaths)
+	return relPaths
+}
+
+func (p DirectoryProvisioner) logEntry(format string, args ...any) sdk.LogEntry {
+	return sdk.LogEntry{
+		Provisioner: p.Description(),
+		Message:     fmt.Sprintf(format, args...),
+	}
+}
+
+// validateLayoutPath makes sure the path of a file in the layout can't be used to escape the directory, since files
+// outside of it won't be cleaned up and could overwrite existing files.
+func validateLayoutPath(relPath string) error {
+	if relPath == "" || relPath == "." || path.IsAbs(relPath) || path.Clean(relPath) != relPath || relPath == ".." || strings.HasPrefix(relPath, "../") || strings.Contains(relPath, `\`) {
+		return fmt.Errorf("invalid path '%s' in directory layout: paths have to be relative, use forward slashes, and can't refer to a parent directory", relPath)
+	}
+	return nil
+}
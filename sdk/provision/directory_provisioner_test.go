@@ -0,0 +1,107 @@
+package provision
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectory(t *testing.T) {
+	provisioner := Directory(map[string]ItemToFileContents{
+		"credentials.json":                     FieldAsFile("Credentials"),
+		"configurations/config_default":        FieldAsFile("Config"),
+		"configurations/nested/active_account": FieldAsFile("Account"),
+	}, DirectoryName("gcloud"), SetDirAsEnvVar("CLOUDSDK_CONFIG"))
+
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"default": {
+			ItemFields: map[sdk.FieldName]string{
+				"Credentials": `{"type": "service_account"}`,
+				"Config":      "[core]",
+				"Account":     "wendy@example.com",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"CLOUDSDK_CONFIG": "/tmp/gcloud",
+				},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/gcloud/credentials.json":                     {Contents: []byte(`{"type": "service_account"}`), Mode: 0600},
+					"/tmp/gcloud/configurations/config_default":        {Contents: []byte("[core]"), Mode: 0600},
+					"/tmp/gcloud/configurations/nested/active_account": {Contents: []byte("wendy@example.com"), Mode: 0600},
+				},
+			},
+		},
+		"field missing": {
+			ItemFields: map[sdk.FieldName]string{
+				"Credentials": `{"type": "service_account"}`,
+				"Config":      "[core]",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{},
+				Files:       map[string]sdk.OutputFile{},
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "no value present in the item for field 'Account'"}},
+				},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, Directory(map[string]ItemToFileContents{"../escaped": FieldAsFile("Token")}), map[string]plugintest.ProvisionCase{
+		"path outside of directory": {
+			ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{},
+				Files:       map[string]sdk.OutputFile{},
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "invalid path '../escaped' in directory layout: paths have to be relative, use forward slashes, and can't refer to a parent directory"}},
+				},
+			},
+		},
+	})
+}
+
+func TestDirectoryDeprovision(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	require.NoError(t, fsys.MkdirAll("/tmp", 0700))
+
+	provisioner := Directory(map[string]ItemToFileContents{
+		"a/token":   FieldAsFile("Token"),
+		"a/b/token": FieldAsFile("Token"),
+		"c/token":   FieldAsFile("Token"),
+	})
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+		FileSystem: fsys,
+	}, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+
+	// Write the files like the CLI would.
+	for path, file := range out.Files {
+		require.NoError(t, fsys.WriteFile(path, file.Contents, file.Mode))
+	}
+	info, err := fsys.Stat("/tmp/config/a/b")
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	var deprovisionOut sdk.DeprovisionOutput
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp", FileSystem: fsys}, &deprovisionOut)
+	require.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.Empty(t, deprovisionOut.Log)
+
+	for _, path := range []string{"/tmp/config/a/b/token", "/tmp/config/a/b", "/tmp/config/c", "/tmp/config"} {
+		_, err := fsys.Stat(path)
+		assert.True(t, os.IsNotExist(err), path)
+	}
+	_, err = fsys.Stat("/tmp")
+	assert.NoError(t, err)
+}
@@ -0,0 +1,80 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/internal/dotenv"
+)
+
+// DotEnvFieldProvisioner provisions the variables defined in a field in the .env format as environment variables.
+type DotEnvFieldProvisioner struct {
+	sdk.Provisioner
+
+	FieldName sdk.FieldName
+}
+
+// DotEnvField returns a provisioner that provisions all variables defined in the specified field as environment
+// variables, for items that store an entire .env file in a single field. This is the counterpart of
+// importer.TryDotEnvFile: each line has the format "KEY=value", optionally prefixed with "export", values can be
+// single-quoted, double-quoted, or unquoted, and blank lines and comments starting with "#" are ignored. Provisioning
+// fails with the number of the offending line if the field contains a malformed line, or if the field is missing.
+func DotEnvField(fieldName sdk.FieldName) sdk.Provisioner {
+	return DotEnvFieldProvisioner{
+		FieldName: fieldName,
+	}
+}
+
+func (p DotEnvFieldProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	value, ok := in.ItemFields[p.FieldName]
+	if !ok {
+		out.AddError(fmt.Errorf("no value present in the item for field '%s'", p.FieldName))
+		return
+	}
+
+	// Parse all lines first, so that nothing gets provisioned if any of them is malformed.
+	vars, err := dotenv.Parser{}.Parse([]byte(value))
+	if err != nil {
+		out.AddError(fmt.Errorf("parsing field '%s': %w", p.FieldName, err))
+		return
+	}
+	for envVarName := range vars {
+		if !isEnvVarName(envVarName) {
+			out.AddError(fmt.Errorf("parsing field '%s': invalid environment variable name '%s'", p.FieldName, envVarName))
+			return
+		}
+	}
+
+	envVarNames := make([]string, 0, len(vars))
+	for envVarName := range vars {
+		envVarNames = append(envVarNames, envVarName)
+	}
+	sort.Strings(envVarNames)
+
+	// Don't provision anything if provisioning has been aborted in the meantime.
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	for _, envVarName := range envVarNames {
+		if in.DryRun {
+			out.AddDryRunEntry(sdk.DryRunEntry{
+				Kind:   sdk.DryRunKindEnvVar,
+				Target: envVarName,
+			})
+			continue
+		}
+		out.AddEnvVar(envVarName, vars[envVarName])
+	}
+}
+
+func (p DotEnvFieldProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	// Nothing to do here: environment variables get wiped automatically when the process exits.
+}
+
+func (p DotEnvFieldProvisioner) Description() string {
+	return fmt.Sprintf("Provision environment variables defined in field '%s'", p.FieldName)
+}
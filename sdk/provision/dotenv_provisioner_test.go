@@ -0,0 +1,81 @@
+package provision
+
+import (
+	"context"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDotEnvField(t *testing.T) {
+	plugintest.TestProvisioner(t, DotEnvField("Environment"), map[string]plugintest.ProvisionCase{
+		"default": {
+			ItemFields: map[sdk.FieldName]string{
+				"Environment": "# Settings for the staging cluster\n" +
+					"API_TOKEN=tok_EXAMPLE\n" +
+					"export API_URL=\"https://api.example.com\"\n" +
+					"\n" +
+					"GREETING='hello # world'\n" +
+					"MULTILINE=\"first\\nsecond\"\n" +
+					"REGION=eu-west-1 # inline comment\n",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"API_TOKEN": "tok_EXAMPLE",
+					"API_URL":   "https://api.example.com",
+					"GREETING":  "hello # world",
+					"MULTILINE": "first\nsecond",
+					"REGION":    "eu-west-1",
+				},
+			},
+		},
+		"malformed line": {
+			ItemFields: map[sdk.FieldName]string{
+				"Environment": "API_TOKEN=tok_EXAMPLE\n\nAPI_URL\n",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "parsing field 'Environment': invalid line 3: expected KEY=value"}}},
+			},
+		},
+		"unterminated quote": {
+			ItemFields: map[sdk.FieldName]string{
+				"Environment": "API_TOKEN=\"tok_EXAMPLE\n",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "parsing field 'Environment': invalid value for API_TOKEN on line 1: missing closing quote"}}},
+			},
+		},
+		"invalid name": {
+			ItemFields: map[sdk.FieldName]string{
+				"Environment": "API-TOKEN=tok_EXAMPLE\n",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "parsing field 'Environment': invalid environment variable name 'API-TOKEN'"}}},
+			},
+		},
+		"field missing": {
+			ItemFields: map[sdk.FieldName]string{},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "no value present in the item for field 'Environment'"}}},
+			},
+		},
+	})
+}
+
+func TestDotEnvFieldCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	DotEnvField("Environment").Provision(ctx, sdk.ProvisionInput{
+		ItemFields: map[sdk.FieldName]string{"Environment": "API_TOKEN=tok_EXAMPLE\n"},
+	}, &out)
+
+	assert.Empty(t, out.Environment)
+	assert.Equal(t, []sdk.Error{{Message: context.Canceled.Error()}}, out.Diagnostics.Errors)
+}
@@ -2,6 +2,7 @@ package provision
 
 import (
 	"context"
+	"encoding/base64"
 	"fmt"
 	"strings"
 
@@ -13,21 +14,163 @@ type EnvVarProvisioner struct {
 	sdk.Provisioner
 
 	Schema map[string]sdk.FieldName
+
+	prefix     string
+	transforms map[string]EnvVarTransform
+	computed   map[string]ItemToEnvVarValue
+	required   bool
+}
+
+// EnvVarTransform transforms the value of a field before it gets provisioned as an environment variable.
+type EnvVarTransform func(value string) (string, error)
+
+// ItemToEnvVarValue computes the value of an environment variable from the 1Password item.
+type ItemToEnvVarValue func(in sdk.ProvisionInput) (string, error)
+
+// BuildFromFields can be used to compute the value of an environment variable from multiple fields, for example to
+// assemble a connection string from a host, username, and password.
+func BuildFromFields(build func(fields map[sdk.FieldName]string) (string, error)) ItemToEnvVarValue {
+	return ItemToEnvVarValue(func(in sdk.ProvisionInput) (string, error) {
+		return build(in.ItemFields)
+	})
 }
 
 // EnvVars creates an EnvVarProvisioner that provisions secrets as environment variables, based
 // on the specified schema of field name and environment variable name.
-func EnvVars(schema map[string]sdk.FieldName) sdk.Provisioner {
-	return EnvVarProvisioner{
+func EnvVars(schema map[string]sdk.FieldName, opts ...EnvVarOption) sdk.Provisioner {
+	p := EnvVarProvisioner{
 		Schema: schema,
 	}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
+
+// FieldAsEnvVar returns a provisioner that provisions the value of a single field as an environment variable. Unlike
+// EnvVars, which skips fields that are not present in the item, provisioning fails if the field is missing, just like
+// with FieldAsFile. The same options as for EnvVars can be used, for example WithEnvVarTransform with the same
+// environment variable name to transform the value.
+func FieldAsEnvVar(envVarName string, fieldName sdk.FieldName, opts ...EnvVarOption) sdk.Provisioner {
+	p := EnvVarProvisioner{
+		Schema:   map[string]sdk.FieldName{envVarName: fieldName},
+		required: true,
+	}
+	for _, opt := range opts {
+		opt(&p)
+	}
+	return p
+}
+
+// FieldAsEnvVarBase64 works like FieldAsEnvVar, but provisions the value of the field encoded with standard base64, for
+// tools that expect a base64-encoded credential in an environment variable, like DOCKER_AUTH_CONFIG.
+func FieldAsEnvVarBase64(envVarName string, fieldName sdk.FieldName, opts ...EnvVarOption) sdk.Provisioner {
+	return FieldAsEnvVar(envVarName, fieldName, append([]EnvVarOption{WithEnvVarTransform(envVarName, Base64Encode)}, opts...)...)
+}
+
+// FieldAsEnvVarBase64Decoded works like FieldAsEnvVar, but provisions the base64-decoded value of the field, for fields
+// that store a credential in its encoded form. Just like with FieldAsFileBase64, the standard and URL-safe encodings
+// are accepted, with and without padding.
+func FieldAsEnvVarBase64Decoded(envVarName string, fieldName sdk.FieldName, opts ...EnvVarOption) sdk.Provisioner {
+	return FieldAsEnvVar(envVarName, fieldName, append([]EnvVarOption{WithEnvVarTransform(envVarName, Base64Decode)}, opts...)...)
+}
+
+// Base64Encode is a transform that encodes the value with standard base64. It can be used with WithEnvVarTransform.
+func Base64Encode(value string) (string, error) {
+	return base64.StdEncoding.EncodeToString([]byte(value)), nil
+}
+
+// Base64Decode is a transform that decodes a base64-encoded value. It can be used with WithEnvVarTransform.
+func Base64Decode(value string) (string, error) {
+	decoded, err := decodeBase64(value)
+	if err != nil {
+		return "", fmt.Errorf("value is not valid base64")
+	}
+	return string(decoded), nil
+}
+
+// EnvVarOption can be used to influence the behavior of the environment variable provisioner.
+type EnvVarOption func(*EnvVarProvisioner)
+
+// WithEnvVarPrefix can be used to prepend a prefix to the names of all environment variables in the schema, for
+// example to avoid clashing with other tools in a shared shell. The values are left untouched. To also provision
+// environment variables with fully custom names, combine this provisioner with one that has no prefix set.
+func WithEnvVarPrefix(prefix string) EnvVarOption {
+	return func(p *EnvVarProvisioner) {
+		p.prefix = prefix
+	}
+}
+
+// WithEnvVarTransform can be used to transform the value of the field of an environment variable in the schema before
+// it gets provisioned, for example to prefix a token with "Bearer ". If the transform returns an error, provisioning
+// is aborted.
+func WithEnvVarTransform(envVarName string, transform EnvVarTransform) EnvVarOption {
+	return func(p *EnvVarProvisioner) {
+		if p.transforms == nil {
+			p.transforms = make(map[string]EnvVarTransform)
+		}
+		p.transforms[envVarName] = transform
+	}
+}
+
+// WithComputedEnvVar can be used to provision an environment variable with a value that is computed from the item,
+// instead of taken from a single field. If computing the value returns an error, provisioning is aborted.
+func WithComputedEnvVar(envVarName string, value ItemToEnvVarValue) EnvVarOption {
+	return func(p *EnvVarProvisioner) {
+		if p.computed == nil {
+			p.computed = make(map[string]ItemToEnvVarValue)
+		}
+		p.computed[envVarName] = value
+	}
 }
 
 func (p EnvVarProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	// Resolve all values first, so that nothing gets provisioned if any of them fails.
+	values := make(map[string]string)
 	for envVarName, fieldName := range p.Schema {
-		if value, ok := in.ItemFields[fieldName]; ok {
-			out.AddEnvVar(envVarName, value)
+		value, ok := in.ItemFields[fieldName]
+		if !ok {
+			if p.required {
+				out.AddError(fmt.Errorf("no value present in the item for field '%s'", fieldName))
+				return
+			}
+			continue
 		}
+
+		if transform, ok := p.transforms[envVarName]; ok {
+			transformed, err := transform(value)
+			if err != nil {
+				out.AddError(fmt.Errorf("transforming value of %s: %w", envVarName, err))
+				return
+			}
+			value = transformed
+		}
+		values[envVarName] = value
+	}
+
+	for envVarName, compute := range p.computed {
+		value, err := compute(in)
+		if err != nil {
+			out.AddError(fmt.Errorf("computing value of %s: %w", envVarName, err))
+			return
+		}
+		values[envVarName] = value
+	}
+
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	for envVarName, value := range values {
+		if in.DryRun {
+			out.AddDryRunEntry(sdk.DryRunEntry{
+				Kind:   sdk.DryRunKindEnvVar,
+				Target: p.prefix + envVarName,
+			})
+			continue
+		}
+		out.AddEnvVar(p.prefix+envVarName, value)
 	}
 }
 
@@ -38,7 +181,10 @@ func (p EnvVarProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionIn
 func (p EnvVarProvisioner) Description() string {
 	var envVarNames []string
 	for envVarName := range p.Schema {
-		envVarNames = append(envVarNames, envVarName)
+		envVarNames = append(envVarNames, p.prefix+envVarName)
+	}
+	for envVarName := range p.computed {
+		envVarNames = append(envVarNames, p.prefix+envVarName)
 	}
 
 	return fmt.Sprintf("Provision environment variables: %s", strings.Join(envVarNames, ", "))
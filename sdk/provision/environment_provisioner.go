@@ -0,0 +1,173 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// DefaultEnvironment is the name to pass to ForEnvironment for the provisioner that runs if no environment is
+// selected, or if none of the other environments match the selected one.
+const DefaultEnvironment = "default"
+
+// EnvironmentProvisioner runs a provisioner only for a specific environment.
+type EnvironmentProvisioner struct {
+	sdk.Provisioner
+
+	name        string
+	provisioner sdk.Provisioner
+}
+
+// ForEnvironment returns a provisioner that only runs the specified provisioner if the environment with the specified
+// name is selected, see SelectedEnvironment on the provision input. This can be used to provision the credentials of
+// multiple environments, like staging and prod, from a single plugin. Use SelectEnvironment to select the
+// environment using an environment variable and to fail if no environment matches. The provisioner for
+// DefaultEnvironment runs if no environment is selected.
+//
+// Like with When, the selected environment is recorded in the temp dir, so that the provisioner is only
+// deprovisioned if its environment was selected.
+func ForEnvironment(name string, provisioner sdk.Provisioner) sdk.Provisioner {
+	return EnvironmentProvisioner{
+		name:        name,
+		provisioner: provisioner,
+	}
+}
+
+func (p EnvironmentProvisioner) matches(selected string) bool {
+	return selected == p.name || (selected == "" && p.name == DefaultEnvironment)
+}
+
+func (p EnvironmentProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	if !p.matches(in.SelectedEnvironment) {
+		return
+	}
+
+	if !in.DryRun {
+		err := recordProvisioned(in.FS(), in.TempDir, p.key())
+		if err != nil {
+			out.AddError(fmt.Errorf("recording the selected environment: %w", err))
+			return
+		}
+	}
+	p.provisioner.Provision(ctx, in, out)
+}
+
+func (p EnvironmentProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	if !wasProvisioned(in.FS(), in.TempDir, p.key()) {
+		return
+	}
+	p.provisioner.Deprovision(ctx, in, out)
+}
+
+func (p EnvironmentProvisioner) Description() string {
+	return fmt.Sprintf("%s (for environment %s)", p.provisioner.Description(), p.name)
+}
+
+// key identifies the environment of this provisioner in the temp dir.
+func (p EnvironmentProvisioner) key() string {
+	return "environment-" + p.name
+}
+
+// EnvironmentSelector selects the environment to run the provisioners of ForEnvironment for.
+type EnvironmentSelector struct {
+	sdk.Provisioner
+
+	envVarName   string
+	provisioners []sdk.Provisioner
+}
+
+// SelectEnvironment returns a provisioner that runs the specified provisioners in order, like Composite, for the
+// environment selected by the environment variable, e.g. TOOL_ENV, unless SelectedEnvironment is already set on the
+// provision input. Provisioners returned by ForEnvironment only run if their environment is selected, and all other
+// provisioners always run. If the selected environment has no provisioner, the one for DefaultEnvironment runs
+// instead. Provisioning fails if there's no default either, with an error that lists the environments that do have a
+// provisioner. Only the provisioners of the selected environment and the ones that always run are deprovisioned, and
+// none at all if no environment could be selected.
+func SelectEnvironment(envVarName string, provisioners ...sdk.Provisioner) sdk.Provisioner {
+	return EnvironmentSelector{
+		envVarName:   envVarName,
+		provisioners: provisioners,
+	}
+}
+
+func (p EnvironmentSelector) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	selected := in.SelectedEnvironment
+	if selected == "" {
+		selected = os.Getenv(p.envVarName)
+	}
+
+	matched := ""
+	hasDefault := false
+	for _, provisioner := range p.provisioners {
+		if env, ok := provisioner.(EnvironmentProvisioner); ok {
+			if selected != "" && env.name == selected {
+				matched = selected
+			}
+			hasDefault = hasDefault || env.name == DefaultEnvironment
+		}
+	}
+	if matched == "" {
+		if !hasDefault {
+			if selected == "" {
+				out.AddError(fmt.Errorf("no environment selected: set %s to one of: %s", p.envVarName, p.environments()))
+			} else {
+				out.AddError(fmt.Errorf("environment '%s' is not configured, available environments: %s", selected, p.environments()))
+			}
+			return
+		}
+		matched = DefaultEnvironment
+	}
+
+	if !in.DryRun {
+		err := recordProvisioned(in.FS(), in.TempDir, p.key())
+		if err != nil {
+			out.AddError(fmt.Errorf("recording the selected environment: %w", err))
+			return
+		}
+	}
+
+	in.SelectedEnvironment = matched
+	out.AddLog(sdk.LogEntry{
+		Provisioner: p.Description(),
+		Message:     fmt.Sprintf("selected environment %s", matched),
+	})
+	Composite(p.provisioners...).Provision(ctx, in, out)
+}
+
+func (p EnvironmentSelector) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	if !wasProvisioned(in.FS(), in.TempDir, p.key()) {
+		return
+	}
+	// The provisioners of ForEnvironment only deprovision if their environment was selected.
+	Composite(p.provisioners...).Deprovision(ctx, in, out)
+}
+
+func (p EnvironmentSelector) Description() string {
+	return fmt.Sprintf("Provision credentials of the environment selected by %s: %s", p.envVarName, p.environments())
+}
+
+// key identifies this selector in the temp dir.
+func (p EnvironmentSelector) key() string {
+	return "select-environment-" + p.envVarName
+}
+
+// environments returns the names of the environments that have a provisioner, for error messages.
+func (p EnvironmentSelector) environments() string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, provisioner := range p.provisioners {
+		if env, ok := provisioner.(EnvironmentProvisioner); ok && !seen[env.name] {
+			seen[env.name] = true
+			names = append(names, env.name)
+		}
+	}
+	if len(names) == 0 {
+		return "none"
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
@@ -0,0 +1,129 @@
+package provision
+
+import (
+	"context"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSelectEnvironment(t *testing.T) {
+	fields := map[sdk.FieldName]string{
+		"Staging Token": "tok_STAGING",
+		"Prod Token":    "tok_PROD",
+		"Host":          "tool.example.com",
+	}
+	provisioner := SelectEnvironment("TOOL_ENV",
+		ForEnvironment("staging", FieldAsEnvVar("TOOL_TOKEN", "Staging Token")),
+		ForEnvironment("prod", FieldAsEnvVar("TOOL_TOKEN", "Prod Token")),
+		FieldAsEnvVar("TOOL_HOST", "Host"),
+	)
+
+	t.Setenv("TOOL_ENV", "prod")
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"selected by env var": {
+			ItemFields: fields,
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"TOOL_TOKEN": "tok_PROD",
+					"TOOL_HOST":  "tool.example.com",
+				},
+			},
+		},
+	})
+
+	t.Setenv("TOOL_ENV", "qa")
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"not configured": {
+			ItemFields: fields,
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "environment 'qa' is not configured, available environments: prod, staging"}},
+				},
+			},
+		},
+	})
+
+	t.Setenv("TOOL_ENV", "")
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"not selected": {
+			ItemFields: fields,
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "no environment selected: set TOOL_ENV to one of: prod, staging"}},
+				},
+			},
+		},
+	})
+
+	withDefault := SelectEnvironment("TOOL_ENV",
+		ForEnvironment("prod", FieldAsEnvVar("TOOL_TOKEN", "Prod Token")),
+		ForEnvironment(DefaultEnvironment, FieldAsEnvVar("TOOL_TOKEN", "Staging Token")),
+	)
+	t.Setenv("TOOL_ENV", "qa")
+	plugintest.TestProvisioner(t, withDefault, map[string]plugintest.ProvisionCase{
+		"falls back to default": {
+			ItemFields: fields,
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"TOOL_TOKEN": "tok_STAGING",
+				},
+			},
+		},
+	})
+}
+
+func TestForEnvironment(t *testing.T) {
+	provisioner := ForEnvironment("staging", FieldAsEnvVar("TOOL_TOKEN", "Token"))
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"skipped": {
+			ItemFields: map[sdk.FieldName]string{"Token": "tok_STAGING"},
+		},
+	})
+
+	out := sdk.ProvisionOutput{Environment: make(map[string]string)}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:             "/tmp",
+		FileSystem:          plugintest.NewMemoryFileSystem(),
+		SelectedEnvironment: "staging",
+		ItemFields:          map[sdk.FieldName]string{"Token": "tok_STAGING"},
+	}, &out)
+	assert.Equal(t, map[string]string{"TOOL_TOKEN": "tok_STAGING"}, out.Environment)
+}
+
+func TestSelectEnvironmentOnlyDeprovisionsSelectedEnvironment(t *testing.T) {
+	var events []string
+	provisioner := SelectEnvironment("TOOL_ENV",
+		ForEnvironment("staging", recordingProvisioner{name: "staging", events: &events}),
+		ForEnvironment("prod", recordingProvisioner{name: "prod", events: &events}),
+		recordingProvisioner{name: "host", events: &events},
+	)
+
+	deprovision := func(fsys sdk.FileSystem) {
+		provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp/op-test", FileSystem: fsys}, &sdk.DeprovisionOutput{})
+	}
+
+	t.Run("environment selected", func(t *testing.T) {
+		events = nil
+		fsys := plugintest.NewMemoryFileSystem()
+		out := sdk.ProvisionOutput{Environment: make(map[string]string)}
+		provisioner.Provision(context.Background(), sdk.ProvisionInput{TempDir: "/tmp/op-test", FileSystem: fsys, SelectedEnvironment: "prod"}, &out)
+		assert.Empty(t, out.Diagnostics.Errors)
+
+		deprovision(fsys)
+		assert.Equal(t, []string{"provision prod", "provision host", "deprovision host", "deprovision prod"}, events)
+	})
+
+	t.Run("no environment selected", func(t *testing.T) {
+		events = nil
+		fsys := plugintest.NewMemoryFileSystem()
+		out := sdk.ProvisionOutput{Environment: make(map[string]string)}
+		provisioner.Provision(context.Background(), sdk.ProvisionInput{TempDir: "/tmp/op-test", FileSystem: fsys, SelectedEnvironment: "dev"}, &out)
+		assert.Len(t, out.Diagnostics.Errors, 1)
+
+		deprovision(fsys)
+		assert.Empty(t, events)
+	})
+}
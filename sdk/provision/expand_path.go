@@ -0,0 +1,101 @@
+package provision
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// expandPath expands a leading "~" to the home dir and references to environment variables of the invoking user in
+// the path, using $VAR and ${VAR} on Unix and %VAR% on Windows.
+func expandPath(path string, homeDir string) (string, error) {
+	return expandPathFor(runtime.GOOS, path, homeDir, os.LookupEnv)
+}
+
+func expandPathFor(goos string, path string, homeDir string, lookupEnv func(string) (string, bool)) (string, error) {
+	if path == "~" || strings.HasPrefix(path, "~/") || (goos == "windows" && strings.HasPrefix(path, `~\`)) {
+		if homeDir == "" {
+			return "", fmt.Errorf("expanding %s: the home directory is unknown", path)
+		}
+		path = filepath.Join(homeDir, path[1:])
+	}
+
+	var expanded strings.Builder
+	for i := 0; i < len(path); i++ {
+		name, length, err := envVarReference(goos, path[i:])
+		if err != nil {
+			return "", fmt.Errorf("expanding %s: %w", path, err)
+		}
+		if length == 0 {
+			expanded.WriteByte(path[i])
+			continue
+		}
+
+		value, ok := lookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("expanding %s: environment variable %s is not set", path, name)
+		}
+		expanded.WriteString(value)
+		i += length - 1
+	}
+	return expanded.String(), nil
+}
+
+// envVarReference returns the name of the environment variable referenced at the start of s and the length of the
+// reference, which is 0 if s doesn't start with a reference.
+func envVarReference(goos string, s string) (string, int, error) {
+	if goos == "windows" {
+		if s[0] != '%' {
+			return "", 0, nil
+		}
+		// A percent sign is a valid character in file names, so only %NAME% counts as a reference. Names on Windows
+		// can contain characters like parentheses, e.g. %ProgramFiles(x86)%.
+		end := strings.IndexByte(s[1:], '%')
+		if end <= 0 || strings.ContainsAny(s[1:end+1], `=\/`) {
+			return "", 0, nil
+		}
+		return s[1 : end+1], end + 2, nil
+	}
+
+	if s[0] != '$' || len(s) == 1 {
+		return "", 0, nil
+	}
+	if s[1] == '{' {
+		end := strings.IndexByte(s, '}')
+		if end < 0 {
+			return "", 0, fmt.Errorf("missing closing brace in %s", s)
+		}
+		if !isEnvVarName(s[2:end]) {
+			return "", 0, fmt.Errorf("invalid environment variable name '%s'", s[2:end])
+		}
+		return s[2:end], end + 1, nil
+	}
+
+	length := 1
+	for length < len(s) && isEnvVarNameChar(s[length], length == 1) {
+		length++
+	}
+	if length == 1 {
+		// A lone dollar sign, e.g. in "price$.txt".
+		return "", 0, nil
+	}
+	return s[1:length], length, nil
+}
+
+func isEnvVarName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		if !isEnvVarNameChar(name[i], i == 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func isEnvVarNameChar(c byte, first bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (!first && c >= '0' && c <= '9')
+}
@@ -0,0 +1,82 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExpandPath(t *testing.T) {
+	env := map[string]string{
+		"HOME":              "/home/wendy",
+		"XDG_CONFIG_HOME":   "/home/wendy/.config",
+		"APPDATA":           `C:\Users\wendy\AppData\Roaming`,
+		"ProgramFiles(x86)": `C:\Program Files (x86)`,
+	}
+	lookupEnv := func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+
+	for _, tc := range []struct {
+		goos     string
+		path     string
+		expected string
+		err      string
+	}{
+		{goos: "linux", path: "~/.config/tool/creds", expected: "/home/wendy/.config/tool/creds"},
+		{goos: "linux", path: "~", expected: "/home/wendy"},
+		{goos: "linux", path: "~wendy/creds", expected: "~wendy/creds"},
+		{goos: "linux", path: "$HOME/.tool/creds", expected: "/home/wendy/.tool/creds"},
+		{goos: "darwin", path: "${XDG_CONFIG_HOME}/tool/creds", expected: "/home/wendy/.config/tool/creds"},
+		{goos: "linux", path: "/tmp/price$.txt", expected: "/tmp/price$.txt"},
+		{goos: "linux", path: "/tmp/%APPDATA%", expected: "/tmp/%APPDATA%"},
+		{goos: "linux", path: "$TOOL_HOME/creds", err: "expanding $TOOL_HOME/creds: environment variable TOOL_HOME is not set"},
+		{goos: "linux", path: "${HOME/creds", err: "expanding ${HOME/creds: missing closing brace in ${HOME/creds"},
+		{goos: "linux", path: "${}/creds", err: "expanding ${}/creds: invalid environment variable name ''"},
+		{goos: "windows", path: `%APPDATA%\tool\creds`, expected: `C:\Users\wendy\AppData\Roaming\tool\creds`},
+		{goos: "windows", path: `%ProgramFiles(x86)%\tool\creds`, expected: `C:\Program Files (x86)\tool\creds`},
+		{goos: "windows", path: `C:\tool\100%\creds`, expected: `C:\tool\100%\creds`},
+		{goos: "windows", path: `C:\$HOME\creds`, expected: `C:\$HOME\creds`},
+		{goos: "windows", path: `%LOCALAPPDATA%\tool\creds`, err: `expanding %LOCALAPPDATA%\tool\creds: environment variable LOCALAPPDATA is not set`},
+	} {
+		expanded, err := expandPathFor(tc.goos, tc.path, "/home/wendy", lookupEnv)
+		if tc.err != "" {
+			assert.EqualError(t, err, tc.err, tc.path)
+			continue
+		}
+		assert.NoError(t, err, tc.path)
+		assert.Equal(t, tc.expected, expanded, tc.path)
+	}
+
+	_, err := expandPathFor("linux", "~/creds", "", lookupEnv)
+	assert.EqualError(t, err, "expanding ~/creds: the home directory is unknown")
+}
+
+func TestAtFixedPathExpansion(t *testing.T) {
+	t.Setenv("TOOL_CONFIG_DIR", "/etc/tool")
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), AtFixedPath("${TOOL_CONFIG_DIR}/creds")), map[string]plugintest.ProvisionCase{
+		"expanded": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Files: map[string]sdk.OutputFile{
+					"/etc/tool/creds": {Contents: []byte("hunter2"), Mode: 0600},
+				},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), AtFixedPath("$TOOL_MISSING_DIR/creds")), map[string]plugintest.ProvisionCase{
+		"not set": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "invalid fixed path: expanding $TOOL_MISSING_DIR/creds: environment variable TOOL_MISSING_DIR is not set"}},
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,93 @@
+package provision
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/internal/keypath"
+)
+
+// FieldJSONPath can be used with WithComputedEnvVar to provision a single value of a field that contains a JSON
+// document, e.g. FieldJSONPath("Credentials", "credentials.token"). Like for FieldsAsJSON, dots separate nested keys
+// and can be escaped with a backslash if they're part of a key. Keys that are numbers index arrays, like in
+// "accounts.0.token". Strings are provisioned without their quotes, and other values, including objects and arrays,
+// as they appear in the JSON. Provisioning fails if the field is missing or not valid JSON, or if there's no value at
+// the path.
+func FieldJSONPath(fieldName sdk.FieldName, jsonPath string) ItemToEnvVarValue {
+	return ItemToEnvVarValue(func(in sdk.ProvisionInput) (string, error) {
+		return fieldJSONPathValue(in, fieldName, jsonPath)
+	})
+}
+
+// FieldJSONPathAsFile can be used to store a single value of a field that contains a JSON document as a file, for
+// example a nested service account key. See FieldJSONPath for the supported paths and how values are formatted.
+func FieldJSONPathAsFile(fieldName sdk.FieldName, jsonPath string) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		value, err := fieldJSONPathValue(in, fieldName, jsonPath)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(value), nil
+	})
+}
+
+func fieldJSONPathValue(in sdk.ProvisionInput, fieldName sdk.FieldName, jsonPath string) (string, error) {
+	keys := keypath.Split(jsonPath)
+	for _, key := range keys {
+		if key == "" {
+			return "", fmt.Errorf("invalid JSON path '%s': keys can't be empty", jsonPath)
+		}
+	}
+
+	value, ok := in.ItemFields[fieldName]
+	if !ok {
+		return "", fmt.Errorf("no value present in the item for field '%s'", fieldName)
+	}
+	if !json.Valid([]byte(value)) {
+		// The error of the decoder is not included, since it can contain parts of the value.
+		return "", fmt.Errorf("value of field '%s' is not valid JSON", fieldName)
+	}
+
+	raw := json.RawMessage(value)
+	for _, key := range keys {
+		var found bool
+		raw, found = jsonChild(raw, key)
+		if !found {
+			return "", fmt.Errorf("no value present at '%s' in the JSON of field '%s'", jsonPath, fieldName)
+		}
+	}
+
+	raw = bytes.TrimSpace(raw)
+	switch {
+	case bytes.Equal(raw, []byte("null")):
+		return "", fmt.Errorf("the value at '%s' in the JSON of field '%s' is null", jsonPath, fieldName)
+	case raw[0] == '"':
+		var s string
+		err := json.Unmarshal(raw, &s)
+		return s, err
+	default:
+		return string(raw), nil
+	}
+}
+
+// jsonChild returns the member of the object or the element of the array with the specified key or index.
+func jsonChild(raw json.RawMessage, key string) (json.RawMessage, bool) {
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &object); err == nil {
+		child, ok := object[key]
+		return child, ok && object != nil
+	}
+
+	var array []json.RawMessage
+	if err := json.Unmarshal(raw, &array); err == nil {
+		index, err := strconv.Atoi(key)
+		if err != nil || index < 0 || index >= len(array) {
+			return nil, false
+		}
+		return array[index], true
+	}
+	return nil, false
+}
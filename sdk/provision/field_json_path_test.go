@@ -0,0 +1,115 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldJSONPath(t *testing.T) {
+	in := sdk.ProvisionInput{
+		ItemFields: map[sdk.FieldName]string{
+			"Credentials": `{
+				"credentials": {"token": "tok_EXAMPLE", "expires_in": 3600, "admin": false},
+				"accounts": [{"id": "acme"}, {"id": "initech", "scopes": ["read", "write"]}],
+				"a/b": {"c.d": "escaped"},
+				"empty": null
+			}`,
+			"Invalid": `{"credentials": `,
+		},
+	}
+
+	for description, scenario := range map[string]struct {
+		fieldName     sdk.FieldName
+		path          string
+		expected      string
+		expectedError string
+	}{
+		"dot path":     {fieldName: "Credentials", path: "credentials.token", expected: "tok_EXAMPLE"},
+		"number":       {fieldName: "Credentials", path: "credentials.expires_in", expected: "3600"},
+		"bool":         {fieldName: "Credentials", path: "credentials.admin", expected: "false"},
+		"array index":  {fieldName: "Credentials", path: "accounts.1.id", expected: "initech"},
+		"nested index": {fieldName: "Credentials", path: "accounts.1.scopes.0", expected: "read"},
+		"nested array": {fieldName: "Credentials", path: "accounts.1.scopes", expected: `["read", "write"]`},
+		"object":       {fieldName: "Credentials", path: "accounts.0", expected: `{"id": "acme"}`},
+		"escaped dot":  {fieldName: "Credentials", path: `a/b.c\.d`, expected: "escaped"},
+		"missing key": {
+			fieldName:     "Credentials",
+			path:          "credentials.secret",
+			expectedError: "no value present at 'credentials.secret' in the JSON of field 'Credentials'",
+		},
+		"index out of range": {
+			fieldName:     "Credentials",
+			path:          "accounts.2.id",
+			expectedError: "no value present at 'accounts.2.id' in the JSON of field 'Credentials'",
+		},
+		"path into string": {
+			fieldName:     "Credentials",
+			path:          "credentials.token.value",
+			expectedError: "no value present at 'credentials.token.value' in the JSON of field 'Credentials'",
+		},
+		"null": {
+			fieldName:     "Credentials",
+			path:          "empty",
+			expectedError: "the value at 'empty' in the JSON of field 'Credentials' is null",
+		},
+		"invalid JSON": {
+			fieldName:     "Invalid",
+			path:          "credentials",
+			expectedError: "value of field 'Invalid' is not valid JSON",
+		},
+		"field missing": {
+			fieldName:     "Config",
+			path:          "credentials.token",
+			expectedError: "no value present in the item for field 'Config'",
+		},
+		"invalid path": {
+			fieldName:     "Credentials",
+			path:          "credentials..token",
+			expectedError: "invalid JSON path 'credentials..token': keys can't be empty",
+		},
+		"empty path": {
+			fieldName:     "Credentials",
+			path:          "",
+			expectedError: "invalid JSON path '': keys can't be empty",
+		},
+	} {
+		t.Run(description, func(t *testing.T) {
+			value, err := FieldJSONPath(scenario.fieldName, scenario.path)(in)
+			if scenario.expectedError != "" {
+				assert.EqualError(t, err, scenario.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, scenario.expected, value)
+		})
+	}
+}
+
+func TestFieldJSONPathProvisioners(t *testing.T) {
+	fields := map[sdk.FieldName]string{
+		"Credentials": `{"credentials": {"token": "tok_EXAMPLE"}, "key": {"type": "service_account"}}`,
+	}
+
+	plugintest.TestProvisioner(t, EnvVars(nil, WithComputedEnvVar("TOOL_TOKEN", FieldJSONPath("Credentials", "credentials.token"))), map[string]plugintest.ProvisionCase{
+		"env var": {
+			ItemFields: fields,
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{"TOOL_TOKEN": "tok_EXAMPLE"},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldJSONPathAsFile("Credentials", "key"), Filename("key.json")), map[string]plugintest.ProvisionCase{
+		"file": {
+			ItemFields: fields,
+			ExpectedOutput: sdk.ProvisionOutput{
+				Files: map[string]sdk.OutputFile{
+					"/tmp/key.json": {Contents: []byte(`{"type": "service_account"}`), Mode: 0600},
+				},
+			},
+		},
+	})
+}
@@ -0,0 +1,263 @@
+package provision
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/internal/keypath"
+)
+
+// FileContentsFromTemplate can be used to render a Go text/template with the item fields as the file contents.
+// Fields are available by their name with the spaces removed, so the value of "Access Key ID" can be referenced
+// as "{{ .AccessKeyID }}". Fields can also be referenced by their exact name using "{{ field "Access Key ID" }}".
+// Referencing a field that is not present in the item results in an error.
+//
+// Besides the built-in template functions, the following functions are available:
+// * `base64`: encodes the value using standard base64 encoding, e.g. "{{ base64 .Token }}".
+// * `quote`: wraps the value in double quotes and escapes it, e.g. "{{ quote .Password }}".
+// * `path`: returns the path bound to the key using provision.BindPathAs, e.g. "{{ path "configfile" }}".
+// * `urlencode`: percent-encodes the value like URLEncoded, e.g. "postgres://app:{{ urlencode .Password }}@db/app".
+// * `json`: encodes the value as a JSON string like JSONString, e.g. "password: {{ json .Password }}".
+func FileContentsFromTemplate(tmpl string) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		funcs := template.FuncMap{
+			"base64": func(value string) string {
+				return base64.StdEncoding.EncodeToString([]byte(value))
+			},
+			"quote":     strconv.Quote,
+			"urlencode": urlEncode,
+			"json": func(value string) (string, error) {
+				encoded, err := jsonString([]byte(value))
+				return string(encoded), err
+			},
+			"field": func(name string) (string, error) {
+				if value, ok := in.ItemFields[sdk.FieldName(name)]; ok {
+					return value, nil
+				}
+				return "", fmt.Errorf("no value present in the item for field '%s'", name)
+			},
+			"path": func(key string) (string, error) {
+				if path, ok := in.BoundPaths[key]; ok {
+					return path, nil
+				}
+				return "", fmt.Errorf("no path bound to '%s'", key)
+			},
+		}
+
+		t, err := template.New("file").Funcs(funcs).Option("missingkey=error").Parse(tmpl)
+		if err != nil {
+			return nil, fmt.Errorf("parsing file template: %w", err)
+		}
+
+		data := make(map[string]string)
+		for fieldName, value := range in.ItemFields {
+			data[strings.ReplaceAll(fieldName.String(), " ", "")] = value
+		}
+
+		var result bytes.Buffer
+		err = t.Execute(&result, data)
+		if err != nil {
+			return nil, fmt.Errorf("rendering file template: %w", err)
+		}
+
+		return result.Bytes(), nil
+	})
+}
+
+// FieldsAsFile can be used to store the values of multiple fields as a single file, joined by the separator in the
+// specified order. This is useful for files that bundle multiple values, such as a certificate chain consisting of
+// a leaf, intermediate, and root certificate. All fields have to be present in the item.
+func FieldsAsFile(separator string, fieldNames ...sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		values := make([]string, len(fieldNames))
+		for i, fieldName := range fieldNames {
+			value, ok := in.ItemFields[fieldName]
+			if !ok {
+				return nil, fmt.Errorf("no value present in the item for field '%s'", fieldName)
+			}
+			values[i] = value
+		}
+
+		return []byte(strings.Join(values, separator)), nil
+	})
+}
+
+// optionalFieldSuffix marks a field in the mapping of FieldsAsJSON as optional, see OptionalField.
+const optionalFieldSuffix = "?"
+
+// OptionalField marks a field in the mapping of FieldsAsJSON as optional, so that its key is left out of the JSON
+// object if the item doesn't have the field, instead of failing to provision.
+func OptionalField(fieldName sdk.FieldName) sdk.FieldName {
+	return fieldName + optionalFieldSuffix
+}
+
+// FieldsAsJSON can be used to store multiple fields as a JSON object. The mapping specifies the JSON path of each
+// field, where dots separate nested objects. For example, "auths.registry.auth" results in {"auths": {"registry":
+// {"auth": "..."}}}. Dots that are part of a key can be escaped with a backslash, e.g. "auths.ghcr\\.io.auth".
+// Provisioning fails if a field is not present in the item, unless it's marked as optional using OptionalField.
+func FieldsAsJSON(mapping map[string]sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		// Sort the paths, so that the same error is reported if more than one path fails.
+		paths := make([]string, 0, len(mapping))
+		for path := range mapping {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+
+		result := make(map[string]any)
+		for _, path := range paths {
+			fieldName := mapping[path]
+			optional := strings.HasSuffix(string(fieldName), optionalFieldSuffix)
+			fieldName = sdk.FieldName(strings.TrimSuffix(string(fieldName), optionalFieldSuffix))
+
+			value, ok := in.ItemFields[fieldName]
+			if !ok && optional {
+				continue
+			} else if !ok {
+				return nil, fmt.Errorf("no value present in the item for field '%s'", fieldName)
+			}
+
+			err := setJSONPath(result, keypath.Split(path), value)
+			if err != nil {
+				return nil, fmt.Errorf("setting JSON path '%s': %w", path, err)
+			}
+		}
+
+		return json.MarshalIndent(result, "", "  ")
+	})
+}
+
+// FieldsAsJSONFile returns a file provisioner that stores multiple fields as a JSON file. See FieldsAsJSON for how
+// the mapping is specified.
+func FieldsAsJSONFile(mapping map[string]sdk.FieldName, opts ...FileOption) sdk.Provisioner {
+	return TempFile(FieldsAsJSON(mapping), opts...)
+}
+
+// EnvOrField can be used to store the value of the environment variable as a file if it's set in the environment the
+// executable is invoked from, and the value of the field otherwise. This allows users to override a value of the item,
+// such as a region, for a single invocation. Only the specified environment variable is read. Like os.LookupEnv, an
+// environment variable that is set to an empty value counts as set, so `VAR= tool` provisions an empty file instead
+// of the value of the field. Provisioning fails if neither the environment variable nor the field is set.
+func EnvOrField(envVarName string, fieldName sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		if value, ok := in.LookupEnv(envVarName); ok {
+			return []byte(value), nil
+		}
+		if value, ok := in.ItemFields[fieldName]; ok {
+			return []byte(value), nil
+		}
+		return nil, fmt.Errorf("environment variable %s is not set and no value is present in the item for field '%s'", envVarName, fieldName)
+	})
+}
+
+// URLEncoded can be used to percent-encode the file contents of another ItemToFileContents, so that a value with
+// special characters such as "@", "&", or "/" can be embedded in any part of a URL, e.g. the password in a database
+// connection string. All characters except letters, digits, "-", ".", "_", and "~" are encoded, and spaces are
+// encoded as "%20" instead of "+".
+func URLEncoded(contents ItemToFileContents) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		value, err := contents(in)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(urlEncode(string(value))), nil
+	})
+}
+
+// urlEncode percent-encodes all characters of the value that are not unreserved according to RFC 3986.
+func urlEncode(value string) string {
+	// QueryEscape encodes "+" itself, so any "+" left in the result stands for a space.
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+// JSONString can be used to encode the file contents of another ItemToFileContents as a JSON string, including the
+// surrounding double quotes, so that a value with quotes, backslashes, or line breaks can be embedded in a JSON
+// document. Non-ASCII characters are kept as is, and invalid UTF-8 is replaced with the Unicode replacement character.
+func JSONString(contents ItemToFileContents) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		value, err := contents(in)
+		if err != nil {
+			return nil, err
+		}
+		return jsonString(value)
+	})
+}
+
+// jsonString encodes the value as a JSON string, without escaping HTML characters.
+func jsonString(value []byte) ([]byte, error) {
+	var encoded bytes.Buffer
+	encoder := json.NewEncoder(&encoded)
+	encoder.SetEscapeHTML(false)
+	err := encoder.Encode(string(value))
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(encoded.Bytes(), []byte("\n")), nil
+}
+
+// Gzipped can be used to gzip the file contents of another ItemToFileContents, for executables that expect
+// compressed payloads. The level is one of the compress/gzip levels, e.g. gzip.DefaultCompression or
+// gzip.BestCompression. To also convert line endings before compressing, use provision.WithGzip instead.
+func Gzipped(contents ItemToFileContents, level int) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		uncompressed, err := contents(in)
+		if err != nil {
+			return nil, err
+		}
+		return gzipContents(uncompressed, level)
+	})
+}
+
+// gzipContents compresses the contents using the specified gzip level.
+func gzipContents(contents []byte, level int) ([]byte, error) {
+	var compressed bytes.Buffer
+	w, err := gzip.NewWriterLevel(&compressed, level)
+	if err != nil {
+		return nil, err
+	}
+	_, err = w.Write(contents)
+	if err == nil {
+		err = w.Close()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("compressing file contents: %w", err)
+	}
+	return compressed.Bytes(), nil
+}
+
+func setJSONPath(obj map[string]any, keys []string, value string) error {
+	for i, key := range keys {
+		if key == "" {
+			return fmt.Errorf("empty key")
+		}
+
+		if i == len(keys)-1 {
+			if _, exists := obj[key]; exists {
+				return fmt.Errorf("key '%s' is already set", key)
+			}
+			obj[key] = value
+			return nil
+		}
+
+		switch child := obj[key].(type) {
+		case nil:
+			nested := make(map[string]any)
+			obj[key] = nested
+			obj = nested
+		case map[string]any:
+			obj = child
+		default:
+			return fmt.Errorf("key '%s' is not an object", key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,65 @@
+package provision
+
+import (
+	"encoding/binary"
+	"fmt"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encoding specifies the character encoding that the file provisioner should write files with.
+type Encoding string
+
+const (
+	// EncodingUTF8 leaves the contents as UTF-8, without a byte order mark.
+	EncodingUTF8 Encoding = ""
+	// EncodingUTF16LE transcodes the contents to little-endian UTF-16, without a byte order mark.
+	EncodingUTF16LE Encoding = "utf-16le"
+	// EncodingUTF16LEBOM transcodes the contents to little-endian UTF-16, prefixed with a byte order mark. This is what
+	// Windows tools usually mean by "Unicode".
+	EncodingUTF16LEBOM Encoding = "utf-16le-bom"
+	// EncodingUTF16BE transcodes the contents to big-endian UTF-16, without a byte order mark.
+	EncodingUTF16BE Encoding = "utf-16be"
+	// EncodingUTF16BEBOM transcodes the contents to big-endian UTF-16, prefixed with a byte order mark.
+	EncodingUTF16BEBOM Encoding = "utf-16be-bom"
+)
+
+// WithEncoding can be used to tell the file provisioner to transcode the file contents, which have to be valid UTF-8,
+// to the specified encoding before writing the file. This is useful for Windows tools that expect UTF-16 encoded
+// config files. The contents are transcoded after converting line endings and before compressing.
+func WithEncoding(encoding Encoding) FileOption {
+	return func(p *FileProvisioner) {
+		p.encoding = encoding
+	}
+}
+
+// encodeContents transcodes the UTF-8 contents to the specified encoding.
+func encodeContents(contents []byte, encoding Encoding) ([]byte, error) {
+	var order binary.ByteOrder
+	bom := false
+	switch encoding {
+	case EncodingUTF8:
+		return contents, nil
+	case EncodingUTF16LE, EncodingUTF16LEBOM:
+		order, bom = binary.LittleEndian, encoding == EncodingUTF16LEBOM
+	case EncodingUTF16BE, EncodingUTF16BEBOM:
+		order, bom = binary.BigEndian, encoding == EncodingUTF16BEBOM
+	default:
+		return nil, fmt.Errorf("unsupported encoding '%s'", encoding)
+	}
+
+	if !utf8.Valid(contents) {
+		return nil, fmt.Errorf("file contents are not valid UTF-8, so they can't be encoded as %s", encoding)
+	}
+
+	runes := []rune(string(contents))
+	if bom {
+		runes = append([]rune{'\uFEFF'}, runes...)
+	}
+	units := utf16.Encode(runes)
+	encoded := make([]byte, 2*len(units))
+	for i, unit := range units {
+		order.PutUint16(encoded[2*i:], unit)
+	}
+	return encoded, nil
+}
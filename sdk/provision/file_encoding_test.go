@@ -0,0 +1,67 @@
+package provision
+
+import (
+	"encoding/binary"
+	"testing"
+	"unicode/utf16"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithEncoding(t *testing.T) {
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Config"), Filename("config.ini"), WithEncoding(EncodingUTF16LEBOM)), map[string]plugintest.ProvisionCase{
+		"utf-16le with bom": {
+			ItemFields: map[sdk.FieldName]string{
+				"Config": "pw=é€",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Files: map[string]sdk.OutputFile{
+					"/tmp/config.ini": {
+						Contents: []byte{0xFF, 0xFE, 'p', 0, 'w', 0, '=', 0, 0xE9, 0x00, 0xAC, 0x20},
+						Mode:     0600,
+					},
+				},
+			},
+		},
+	})
+}
+
+func TestEncodeContentsRoundTrip(t *testing.T) {
+	// Covers 1, 2, 3, and 4 byte UTF-8 sequences, the last of which are encoded as surrogate pairs in UTF-16.
+	const text = "user = wendy\r\npassword = pässwörd/密码/🔑\r\n"
+
+	for encoding, tc := range map[Encoding]struct {
+		order binary.ByteOrder
+		bom   []byte
+	}{
+		EncodingUTF16LE:    {order: binary.LittleEndian},
+		EncodingUTF16LEBOM: {order: binary.LittleEndian, bom: []byte{0xFF, 0xFE}},
+		EncodingUTF16BE:    {order: binary.BigEndian},
+		EncodingUTF16BEBOM: {order: binary.BigEndian, bom: []byte{0xFE, 0xFF}},
+	} {
+		encoded, err := encodeContents([]byte(text), encoding)
+		assert.NoError(t, err, encoding)
+
+		if len(tc.bom) > 0 {
+			assert.Equal(t, tc.bom, encoded[:2], encoding)
+			encoded = encoded[2:]
+		}
+		units := make([]uint16, len(encoded)/2)
+		for i := range units {
+			units[i] = tc.order.Uint16(encoded[2*i:])
+		}
+		assert.Equal(t, text, string(utf16.Decode(units)), encoding)
+	}
+
+	encoded, err := encodeContents([]byte(text), EncodingUTF8)
+	assert.NoError(t, err)
+	assert.Equal(t, text, string(encoded))
+
+	_, err = encodeContents([]byte{'p', 'w', '=', 0xFF}, EncodingUTF16LE)
+	assert.EqualError(t, err, "file contents are not valid UTF-8, so they can't be encoded as utf-16le")
+
+	_, err = encodeContents([]byte(text), "latin1")
+	assert.EqualError(t, err, "unsupported encoding 'latin1'")
+}
@@ -0,0 +1,122 @@
+package provision
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+const (
+	// ansibleVaultHeader is the first line of files encrypted by WithEncryption.
+	ansibleVaultHeader = "$ANSIBLE_VAULT;1.1;AES256"
+	// ansibleVaultSaltSize is the size of the random salt that the keys are derived with.
+	ansibleVaultSaltSize = 32
+	// ansibleVaultIterations is the number of PBKDF2 iterations that Ansible Vault derives the keys with.
+	ansibleVaultIterations = 10000
+	// ansibleVaultLineLength is the length of the lines that the hex encoded vault text is wrapped at.
+	ansibleVaultLineLength = 80
+)
+
+// EncryptedFile returns a file provisioner that stores the contents encrypted with the password in the specified field,
+// for executables that expect their credentials to be encrypted at rest. See WithEncryption for the format of the file.
+func EncryptedFile(fileContents ItemToFileContents, keyField sdk.FieldName, opts ...FileOption) sdk.Provisioner {
+	return TempFile(fileContents, append([]FileOption{WithEncryption(keyField)}, opts...)...)
+}
+
+// WithEncryption can be used to encrypt the file contents as an Ansible Vault file, version 1.1, using the value of the
+// specified field as the vault password. The resulting file can be decrypted by ansible-vault and anything else that
+// reads that format. The encryption is applied last, after the contents have been converted, transcoded, and
+// compressed. As specified by Ansible Vault, the keys are derived using PBKDF2-HMAC-SHA256 with 10,000 iterations and a
+// random salt, the contents are encrypted with AES-256-CTR and authenticated with HMAC-SHA256. Since the salt is
+// generated randomly every time the file is written, the file is different for every run, even though the contents are
+// the same. Use WithEncryptionKeyEnvVar to pass the password to the executable.
+func WithEncryption(keyField sdk.FieldName) FileOption {
+	return func(p *FileProvisioner) {
+		p.encryptionKeyField = keyField
+	}
+}
+
+// WithEncryptionKeyEnvVar can be used in combination with WithEncryption to set an environment variable to the value of
+// the key field, for executables that read the password to decrypt the file with from the environment.
+func WithEncryptionKeyEnvVar(envVarName string) FileOption {
+	return func(p *FileProvisioner) {
+		p.encryptionKeyEnvVar = envVarName
+	}
+}
+
+// encryptionKey returns the value of the key field of provision.WithEncryption.
+func (p FileProvisioner) encryptionKey(in sdk.ProvisionInput) (string, error) {
+	key, ok := in.ItemFields[p.encryptionKeyField]
+	if !ok {
+		return "", fmt.Errorf("no value present in the item for field '%s'", p.encryptionKeyField)
+	}
+	if key == "" {
+		return "", fmt.Errorf("the encryption key in field '%s' can't be empty", p.encryptionKeyField)
+	}
+	return key, nil
+}
+
+// encryptContents encrypts the contents as an Ansible Vault file with the password, see WithEncryption.
+func encryptContents(contents []byte, password string) ([]byte, error) {
+	salt, err := randomBytes(ansibleVaultSaltSize)
+	if err != nil {
+		return nil, fmt.Errorf("generating salt: %w", err)
+	}
+	cipherKey, hmacKey, iv := ansibleVaultKeys(password, salt)
+	block, err := aes.NewCipher(cipherKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Ansible Vault pads the contents to the AES block size, even though CTR mode doesn't require it.
+	padding := aes.BlockSize - len(contents)%aes.BlockSize
+	ciphertext := append(append([]byte{}, contents...), make([]byte, padding)...)
+	for i := len(contents); i < len(ciphertext); i++ {
+		ciphertext[i] = byte(padding)
+	}
+	cipher.NewCTR(block, iv).XORKeyStream(ciphertext, ciphertext)
+
+	mac := hmac.New(sha256.New, hmacKey)
+	mac.Write(ciphertext)
+
+	// The salt, MAC, and ciphertext are hex encoded on separate lines, which are hex encoded once more as a whole.
+	vaultText := hex.EncodeToString([]byte(strings.Join([]string{
+		hex.EncodeToString(salt),
+		hex.EncodeToString(mac.Sum(nil)),
+		hex.EncodeToString(ciphertext),
+	}, "\n")))
+
+	var result strings.Builder
+	result.WriteString(ansibleVaultHeader + "\n")
+	for len(vaultText) > ansibleVaultLineLength {
+		result.WriteString(vaultText[:ansibleVaultLineLength] + "\n")
+		vaultText = vaultText[ansibleVaultLineLength:]
+	}
+	result.WriteString(vaultText + "\n")
+	return []byte(result.String()), nil
+}
+
+// provisionEncryptionKey sets the environment variable of provision.WithEncryptionKeyEnvVar to the key.
+func (p FileProvisioner) provisionEncryptionKey(in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindEnvVar,
+			Target: p.encryptionKeyEnvVar,
+		})
+		return
+	}
+	out.AddEnvVar(p.encryptionKeyEnvVar, in.ItemFields[p.encryptionKeyField])
+}
+
+// ansibleVaultKeys derives the AES key, the HMAC key, and the initial counter of Ansible Vault from the password and
+// the salt.
+func ansibleVaultKeys(password string, salt []byte) (cipherKey []byte, hmacKey []byte, iv []byte) {
+	derived := pbkdf2SHA256([]byte(password), salt, ansibleVaultIterations, 2*32+aes.BlockSize)
+	return derived[:32], derived[32:64], derived[64:]
+}
@@ -0,0 +1,132 @@
+package provision
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+// decryptFile decrypts an Ansible Vault 1.1 file, following the format that ansible-vault reads.
+func decryptFile(t *testing.T, encrypted []byte, password string) ([]byte, error) {
+	t.Helper()
+	lines := strings.Split(strings.TrimSuffix(string(encrypted), "\n"), "\n")
+	if !assert.Equal(t, "$ANSIBLE_VAULT;1.1;AES256", lines[0]) {
+		t.FailNow()
+	}
+	for _, line := range lines[1:] {
+		assert.LessOrEqual(t, len(line), 80)
+	}
+
+	vaultText, err := hex.DecodeString(strings.Join(lines[1:], ""))
+	assert.NoError(t, err)
+	parts := strings.Split(string(vaultText), "\n")
+	if !assert.Len(t, parts, 3) {
+		t.FailNow()
+	}
+	salt, err := hex.DecodeString(parts[0])
+	assert.NoError(t, err)
+	expectedMAC, err := hex.DecodeString(parts[1])
+	assert.NoError(t, err)
+	ciphertext, err := hex.DecodeString(parts[2])
+	assert.NoError(t, err)
+
+	derived := pbkdf2SHA256([]byte(password), salt, 10000, 80)
+	mac := hmac.New(sha256.New, derived[32:64])
+	mac.Write(ciphertext)
+	if !hmac.Equal(expectedMAC, mac.Sum(nil)) {
+		return nil, errors.New("HMAC verification failed")
+	}
+
+	block, err := aes.NewCipher(derived[:32])
+	assert.NoError(t, err)
+	plaintext := make([]byte, len(ciphertext))
+	cipher.NewCTR(block, derived[64:]).XORKeyStream(plaintext, ciphertext)
+	padding := int(plaintext[len(plaintext)-1])
+	if !assert.True(t, padding >= 1 && padding <= aes.BlockSize) {
+		t.FailNow()
+	}
+	return plaintext[:len(plaintext)-padding], nil
+}
+
+func TestWithEncryption(t *testing.T) {
+	fields := map[sdk.FieldName]string{
+		"Token":          "tok_EXAMPLE",
+		"Encryption Key": "correct horse battery staple",
+	}
+	provisioner := EncryptedFile(FieldAsFile("Token"), "Encryption Key", Filename("token.vault"), WithEncryptionKeyEnvVar("TOOL_VAULT_PASSWORD"))
+
+	first := plugintest.RunProvision(t, provisioner, fields)
+	plugintest.AssertNoErrors(t, first)
+	plugintest.AssertEnvVar(t, first, "TOOL_VAULT_PASSWORD", "correct horse battery staple")
+	assert.NotContains(t, string(first.Files["/tmp/token.vault"]), "tok_EXAMPLE")
+
+	decrypted, err := decryptFile(t, first.Files["/tmp/token.vault"], "correct horse battery staple")
+	assert.NoError(t, err)
+	assert.Equal(t, "tok_EXAMPLE", string(decrypted))
+
+	_, err = decryptFile(t, first.Files["/tmp/token.vault"], "wrong password")
+	assert.Error(t, err)
+
+	second := plugintest.RunProvision(t, provisioner, fields)
+	plugintest.AssertNoErrors(t, second)
+	assert.NotEqual(t, first.Files["/tmp/token.vault"], second.Files["/tmp/token.vault"], "the salt should be random")
+}
+
+func TestWithEncryptionPadsFullBlocks(t *testing.T) {
+	result := plugintest.RunProvision(t, EncryptedFile(FieldAsFile("Token"), "Key", Filename("token.vault")), map[sdk.FieldName]string{
+		"Token": strings.Repeat("x", aes.BlockSize),
+		"Key":   "hunter2",
+	})
+	plugintest.AssertNoErrors(t, result)
+
+	decrypted, err := decryptFile(t, result.Files["/tmp/token.vault"], "hunter2")
+	assert.NoError(t, err)
+	assert.Equal(t, strings.Repeat("x", aes.BlockSize), string(decrypted))
+}
+
+func TestWithEncryptionAfterGzip(t *testing.T) {
+	result := plugintest.RunProvision(t, EncryptedFile(FieldAsFile("Token"), "Key", Filename("token.gz.vault"), WithGzip(-1)), map[sdk.FieldName]string{
+		"Token": "tok_EXAMPLE",
+		"Key":   "hunter2",
+	})
+	plugintest.AssertNoErrors(t, result)
+
+	decrypted, err := decryptFile(t, result.Files["/tmp/token.gz.vault"], "hunter2")
+	assert.NoError(t, err)
+	assert.Equal(t, []byte{0x1f, 0x8b}, decrypted[:2], "the contents should be compressed before being encrypted")
+}
+
+func TestWithEncryptionErrors(t *testing.T) {
+	plugintest.TestProvisioner(t, EncryptedFile(FieldAsFile("Token"), "Key"), map[string]plugintest.ProvisionCase{
+		"key missing": {
+			ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "no value present in the item for field 'Key'"}}},
+			},
+		},
+		"key empty": {
+			ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE", "Key": ""},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "the encryption key in field 'Key' can't be empty"}}},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), WithEncryptionKeyEnvVar("TOOL_VAULT_KEY")), map[string]plugintest.ProvisionCase{
+		"key env var without encryption": {
+			ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "WithEncryptionKeyEnvVar requires WithEncryption to be set as well"}}},
+			},
+		},
+	})
+}
@@ -4,9 +4,17 @@ import (
 	"bytes"
 	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"os"
 	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
 	"text/template"
+	"time"
 
 	"github.com/1Password/shell-plugins/sdk"
 )
@@ -16,12 +24,49 @@ type FileProvisioner struct {
 	sdk.Provisioner
 
 	fileContents        ItemToFileContents
+	fileMode            os.FileMode
 	outfileName         string
+	outfileExtension    string
 	outpathFixed        string
-	outpathEnvVar       string
+	outpathEnvVars      []string
 	outdirEnvVar        string
 	setOutpathAsArg     bool
 	outpathArgTemplates []string
+	outpathArgIndex     *int
+	outpathArgPriority  *int
+	secureDelete        bool
+	appendToFile        bool
+	lineEndings         LineEndings
+	noCleanup           bool
+	failIfExists        bool
+	retryAttempts       int
+	retryBackoff        time.Duration
+	pathKey             string
+	replacements        []placeholderReplacement
+	symlinkPath         string
+	gzip                bool
+	gzipLevel           int
+	ramDisk             RAMDiskMode
+	refreshTTL          time.Duration
+	refreshers          *fileRefreshers
+	cacheKey            string
+	cacheTTL            time.Duration
+	validateFormat      ConfigFormat
+	checksumEnvVar      string
+	checksumAlgo        string
+	checksumEncoding    string
+	relativeArgBase     string
+	encoding            Encoding
+	encryptionKeyField  sdk.FieldName
+	encryptionKeyEnvVar string
+	filenameField       sdk.FieldName
+	filenameFormat      string
+}
+
+// placeholderReplacement specifies a placeholder in a user-owned file that gets replaced with the output path.
+type placeholderReplacement struct {
+	targetPath  string
+	placeholder string
 }
 
 type ItemToFileContents func(in sdk.ProvisionInput) ([]byte, error)
@@ -37,11 +82,112 @@ func FieldAsFile(fieldName sdk.FieldName) ItemToFileContents {
 	})
 }
 
+// FieldAsFileFuzzy can be used to store the value of a single field as a file, like FieldAsFile, but matches the field
+// name case-insensitively and ignoring differences in whitespace, so that "API Token" also matches a field named
+// "api  token". An exact match is always preferred. If multiple fields match and none of them exactly, provisioning
+// fails with an error that lists them, instead of picking one arbitrarily.
+func FieldAsFileFuzzy(fieldName sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		if value, ok := in.ItemFields[fieldName]; ok {
+			return []byte(value), nil
+		}
+
+		var matches []string
+		var value string
+		for name, v := range in.ItemFields {
+			if normalizeFieldName(name) == normalizeFieldName(fieldName) {
+				matches = append(matches, fmt.Sprintf("'%s'", name))
+				value = v
+			}
+		}
+
+		switch len(matches) {
+		case 0:
+			return nil, fmt.Errorf("no value present in the item for field '%s'", fieldName)
+		case 1:
+			return []byte(value), nil
+		default:
+			sort.Strings(matches)
+			return nil, fmt.Errorf("field '%s' is ambiguous, it matches fields %s", fieldName, strings.Join(matches, ", "))
+		}
+	})
+}
+
+// normalizeFieldName returns the field name in lowercase and with all whitespace collapsed into single spaces.
+func normalizeFieldName(name sdk.FieldName) string {
+	return strings.Join(strings.Fields(strings.ToLower(name.String())), " ")
+}
+
+// FieldAsFileWithDefault can be used to store the value of a single field as a file, like FieldAsFile, but falls back
+// to the default value if the field is not present in the item, instead of failing. A field that is present but
+// empty is stored as is.
+func FieldAsFileWithDefault(fieldName sdk.FieldName, defaultValue string) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		if value, ok := in.ItemFields[fieldName]; ok {
+			return []byte(value), nil
+		}
+		return []byte(defaultValue), nil
+	})
+}
+
+// FieldAsFileBase64 can be used to store the base64-decoded value of a single field as a file. This is useful
+// when the field contains a base64-encoded blob, but the executable expects the raw bytes on disk. Both the
+// standard and the URL-safe encoding are supported, with or without padding.
+func FieldAsFileBase64(fieldName sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		value, err := FieldAsFile(fieldName)(in)
+		if err != nil {
+			return nil, err
+		}
+
+		decoded, err := decodeBase64(string(value))
+		if err != nil {
+			return nil, fmt.Errorf("value of field '%s' is not valid base64", fieldName)
+		}
+
+		return decoded, nil
+	})
+}
+
+// decodeBase64 decodes the specified value, trying the standard and URL-safe encodings with and without padding.
+func decodeBase64(value string) ([]byte, error) {
+	value = strings.TrimSpace(value)
+
+	var err error
+	for _, encoding := range []*base64.Encoding{
+		base64.StdEncoding,
+		base64.RawStdEncoding,
+		base64.URLEncoding,
+		base64.RawURLEncoding,
+	} {
+		var decoded []byte
+		decoded, err = encoding.DecodeString(value)
+		if err == nil {
+			return decoded, nil
+		}
+	}
+
+	return nil, err
+}
+
+// DocumentAsFile can be used to store the contents of a file attached to the item as a file. This is useful for
+// binary secrets that can't be stored in a field, such as a .p12 keystore. The contents are passed on as is, without
+// making a copy. Like any other provisioned file, the file gets removed after the executable exits.
+func DocumentAsFile(attachmentName string) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		if contents, ok := in.ItemFiles[attachmentName]; ok {
+			return contents, nil
+		}
+		return nil, fmt.Errorf("no file named '%s' attached to the item", attachmentName)
+	})
+}
+
 // TempFile returns a file provisioner and takes a function that maps a 1Password item to the contents of
 // a single file.
 func TempFile(fileContents ItemToFileContents, opts ...FileOption) sdk.Provisioner {
 	p := FileProvisioner{
 		fileContents: fileContents,
+		fileMode:     defaultFileMode,
 	}
 	for _, opt := range opts {
 		opt(&p)
@@ -52,27 +198,138 @@ func TempFile(fileContents ItemToFileContents, opts ...FileOption) sdk.Provision
 // FileOption can be used to influence the behavior of the file provisioner.
 type FileOption func(*FileProvisioner)
 
+// defaultFileMode makes sure secret files are only readable and writable by the current user, which is
+// also what most executables require for files containing credentials.
+const defaultFileMode os.FileMode = 0600
+
+// WithFileMode can be used to tell the file provisioner to write the file with specific permissions, instead
+// of the default 0600. Files that the provisioner writes itself, like with WithNoCleanup or WithTTL, get exactly
+// these permissions, regardless of the umask. See sdk.OutputFile for the files in the provision output.
+func WithFileMode(mode os.FileMode) FileOption {
+	return func(p *FileProvisioner) {
+		p.fileMode = mode
+	}
+}
+
 // AtFixedPath can be used to tell the file provisioner to store the credential at a specific location, instead of
 // an autogenerated temp dir. This is useful for executables that can only load credentials from a specific path.
+// Missing parent directories are created, accessible only by the current user, and removed again after the
+// executable exits, unless they are not empty anymore. Directories that already existed are never removed. A leading
+// "~" is expanded to the home directory, and environment variables of the user are expanded as well, using $VAR or
+// ${VAR} on Unix and %VAR% on Windows, e.g. "%APPDATA%\tool\creds". Provisioning fails if a variable is not set.
+// If the file at the fixed path already has the contents and mode that would be provisioned, it's not rewritten.
 func AtFixedPath(path string) FileOption {
 	return func(p *FileProvisioner) {
 		p.outpathFixed = path
 	}
 }
 
+// FailIfExists can be used in combination with provision.AtFixedPath to make provisioning fail if there already is a
+// file at the fixed path, instead of overwriting it, so that a plugin under development can't destroy a user's real
+// config file. A file with exactly the contents that would be provisioned is assumed to be left over from a previous
+// run that didn't get to clean up, and is reused. This option can't be combined with provision.AppendToFile.
+func FailIfExists() FileOption {
+	return func(p *FileProvisioner) {
+		p.failIfExists = true
+	}
+}
+
 // Filename can be used to tell the file provisioner to store the credential with a specific name, instead of
 // an autogenerated name. The specified filename will be appended to the path of the autogenerated temp dir.
-// Gets ignored if the provision.AtFixedPath option is also set.
+// Gets ignored if the provision.AtFixedPath option is also set. The filename can't contain path separators; use
+// ProvisionInput.FromTempDirSubpath to provision files in a subdirectory of the temp dir.
 func Filename(name string) FileOption {
 	return func(p *FileProvisioner) {
 		p.outfileName = name
 	}
 }
 
-// SetPathAsEnvVar can be used to provision the temporary file path as an environment variable.
-func SetPathAsEnvVar(envVarName string) FileOption {
+// FilenameFromField can be used like provision.Filename, but computes the filename from the value of a field of the
+// item, for executables that expect the filename to contain the name of the account or profile. The %s in the format
+// gets replaced with the value, e.g. "%s.json". Path separators and characters that are illegal in filenames are
+// replaced with an underscore, and leading and trailing dots are removed, so that the value can't refer to a parent
+// directory. Provisioning fails if the field is missing or nothing is left of its value. Since the item fields are not
+// known when the file gets cleaned up, this option can't be combined with provision.WithSecureDelete or
+// provision.WithNoCleanup.
+func FilenameFromField(fieldName sdk.FieldName, format string) FileOption {
+	return func(p *FileProvisioner) {
+		p.filenameField = fieldName
+		p.filenameFormat = format
+	}
+}
+
+// FileExtension can be used to tell the file provisioner to append an extension to the autogenerated filename,
+// which is useful for executables that only accept files with a certain extension. Both "json" and ".json" are
+// accepted. Since the extension is part of the filename, it can't contain characters that are illegal in Windows
+// filenames. Gets ignored if the provision.AtFixedPath or provision.Filename option is also set.
+func FileExtension(ext string) FileOption {
 	return func(p *FileProvisioner) {
-		p.outpathEnvVar = envVarName
+		if ext = strings.TrimLeft(ext, "."); ext != "" {
+			p.outfileExtension = "." + ext
+		}
+	}
+}
+
+// LineEndings specifies the line endings that the file provisioner should write files with.
+type LineEndings string
+
+const (
+	// LineEndingsUnchanged leaves the line endings of the file contents as they are.
+	LineEndingsUnchanged LineEndings = ""
+	// LineEndingsLF converts all line endings to "\n".
+	LineEndingsLF LineEndings = "lf"
+	// LineEndingsCRLF converts all line endings to "\r\n".
+	LineEndingsCRLF LineEndings = "crlf"
+	// LineEndingsNative converts all line endings to "\r\n" on Windows and to "\n" on all other platforms.
+	LineEndingsNative LineEndings = "native"
+)
+
+// WithLineEndings can be used to tell the file provisioner to convert the line endings of the file contents before
+// writing the file. This is useful for executables on Windows that can't parse config files with bare "\n" line
+// endings, which is what templated file contents result in.
+func WithLineEndings(style LineEndings) FileOption {
+	return func(p *FileProvisioner) {
+		p.lineEndings = style
+	}
+}
+
+// WithGzip can be used to gzip the file contents before writing the file, for executables that accept compressed
+// config or payloads. The level is one of the compress/gzip levels, e.g. gzip.DefaultCompression. The contents are
+// compressed after converting line endings. If the filename is generated, ".gz" is appended to it, after the
+// extension set using provision.FileExtension if any.
+func WithGzip(level int) FileOption {
+	return func(p *FileProvisioner) {
+		p.gzip = true
+		p.gzipLevel = level
+	}
+}
+
+// convertLineEndings converts all line endings in the contents to the specified style.
+func convertLineEndings(contents []byte, style LineEndings) []byte {
+	if style == LineEndingsNative {
+		style = LineEndingsLF
+		if runtime.GOOS == "windows" {
+			style = LineEndingsCRLF
+		}
+	}
+
+	switch style {
+	case LineEndingsLF:
+		return bytes.ReplaceAll(contents, []byte("\r\n"), []byte("\n"))
+	case LineEndingsCRLF:
+		lf := bytes.ReplaceAll(contents, []byte("\r\n"), []byte("\n"))
+		return bytes.ReplaceAll(lf, []byte("\n"), []byte("\r\n"))
+	default:
+		return contents
+	}
+}
+
+// SetPathAsEnvVar can be used to provision the temporary file path as an environment variable. If multiple names are
+// specified, all of them are set to the path, which is useful for executables that have renamed an environment
+// variable but still support the old name, e.g. SetPathAsEnvVar("TOOL_CONFIG_FILE", "TOOL_CONFIG").
+func SetPathAsEnvVar(envVarNames ...string) FileOption {
+	return func(p *FileProvisioner) {
+		p.outpathEnvVars = append(p.outpathEnvVars, envVarNames...)
 	}
 }
 
@@ -95,48 +352,688 @@ func AddArgs(argTemplates ...string) FileOption {
 	}
 }
 
+// RelativeArgPath can be used in combination with provision.AddArgs and its variants to pass the path of the file in
+// the args relative to the specified base dir, for executables that resolve the path against their working directory.
+// Like with provision.AtFixedPath, "~" and environment variables in the base dir are expanded. If the file is not
+// located in the base dir, the absolute path is passed instead, and a warning is reported.
+func RelativeArgPath(baseDir string) FileOption {
+	return func(p *FileProvisioner) {
+		p.relativeArgBase = baseDir
+	}
+}
+
+// argPath returns the path of the file to pass in the args, which is relative to the base dir of RelativeArgPath, if
+// set and possible.
+func (p FileProvisioner) argPath(outpath string, out *sdk.ProvisionOutput) string {
+	if p.relativeArgBase == "" {
+		return outpath
+	}
+
+	rel, err := filepath.Rel(p.relativeArgBase, outpath)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{
+			Message: fmt.Sprintf("the file %s is not located in %s, so its absolute path is passed as an arg instead of a relative one", outpath, p.relativeArgBase),
+		})
+		return outpath
+	}
+	return rel
+}
+
+// WithSecureDelete can be used to tell the file provisioner to overwrite the file with zeros before removing it
+// during deprovisioning. This is a best-effort overwrite before unlinking: on journaling or copy-on-write file
+// systems, on SSDs, or with snapshots, copies of the contents can still remain on disk. Since the file has to be
+// located again during deprovisioning, this option requires the provision.AtFixedPath or provision.Filename option
+// to be set as well.
+func WithSecureDelete() FileOption {
+	return func(p *FileProvisioner) {
+		p.secureDelete = true
+	}
+}
+
+// BindPathAs can be used to make the path of the provisioned file available to provisioners that run after this one,
+// under the specified key. They can look it up using ProvisionOutput.PathFor, and file contents can refer to it
+// using ProvisionInput.BoundPaths or "{{ path "key" }}" in FileContentsFromTemplate.
+func BindPathAs(key string) FileOption {
+	return func(p *FileProvisioner) {
+		p.pathKey = key
+	}
+}
+
+// WithRetry can be used to retry getting the file contents if it fails, which is useful if the contents are fetched
+// from an upstream service that can fail intermittently. The contents are fetched at most the specified number of
+// attempts, waiting the backoff before the second attempt and doubling it before each next one. Retrying stops when
+// provisioning gets aborted. If all attempts fail, the error of the last attempt is reported.
+func WithRetry(attempts int, backoff time.Duration) FileOption {
+	return func(p *FileProvisioner) {
+		p.retryAttempts = attempts
+		p.retryBackoff = backoff
+	}
+}
+
+// contents returns the file contents, retrying if the provision.WithRetry option is set, and reusing the cached
+// contents if the provision.WithContentsCache option is set.
+func (p FileProvisioner) contents(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) ([]byte, error) {
+	in.BoundPaths = out.Paths
+
+	if p.cacheKey == "" {
+		return p.generateContents(ctx, in)
+	}
+
+	if contents, ok := p.cachedContents(in); ok {
+		out.AddLog(p.logEntry("reused cached file contents (%d bytes)", len(contents)))
+		return contents, nil
+	}
+
+	// Values of referenced items are resolved with the access of the invoking user, so they must not be cached.
+	resolvedReference := false
+	if resolve := in.ResolveReference; resolve != nil {
+		in.ResolveReference = func(ref string) (string, error) {
+			resolvedReference = true
+			return resolve(ref)
+		}
+	}
+
+	contents, err := p.generateContents(ctx, in)
+	if err != nil || in.DryRun {
+		return contents, err
+	}
+	if resolvedReference {
+		out.AddLog(p.logEntry("not caching file contents, since they contain values of referenced items"))
+		return contents, nil
+	}
+
+	err = p.cacheContents(in, out, contents)
+	if err != nil {
+		return nil, fmt.Errorf("caching file contents: %w", err)
+	}
+	return contents, nil
+}
+
+// generateContents runs the contents function, retrying if the provision.WithRetry option is set, and validates the
+// result if the provision.ValidateAs option is set.
+func (p FileProvisioner) generateContents(ctx context.Context, in sdk.ProvisionInput) ([]byte, error) {
+	backoff := p.retryBackoff
+	for attempt := 1; ; attempt++ {
+		contents, err := p.fileContents(in)
+		if err == nil && p.validateFormat != "" {
+			// Retrying won't help if the contents are malformed.
+			if err := validateContents(p.validateFormat, contents); err != nil {
+				return nil, err
+			}
+			return contents, nil
+		}
+		if err == nil || attempt >= p.retryAttempts {
+			return contents, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// encodedContents returns the file contents with the line endings converted, transcoded, compressed, and encrypted,
+// if these options are set.
+func (p FileProvisioner) encodedContents(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) ([]byte, error) {
+	contents, err := p.contents(ctx, in, out)
+	if err != nil {
+		return nil, err
+	}
+
+	contents = convertLineEndings(contents, p.lineEndings)
+	contents, err = encodeContents(contents, p.encoding)
+	if err != nil {
+		return nil, err
+	}
+	if p.gzip {
+		contents, err = gzipContents(contents, p.gzipLevel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if p.encryptionKeyField != "" {
+		key, err := p.encryptionKey(in)
+		if err != nil {
+			return nil, err
+		}
+		contents, err = encryptContents(contents, key)
+		if err != nil {
+			return nil, fmt.Errorf("encrypting file contents: %w", err)
+		}
+	}
+	return contents, nil
+}
+
+// WithNoCleanup can be used while debugging a plugin to keep the provisioned file around after the executable exits,
+// so that it can be inspected. The file is written outside of the temp dir, which gets removed after the executable
+// exits, and every run reports a warning with the path of the file that contains the secret. Like WithSecureDelete,
+// this option requires the provision.AtFixedPath or provision.Filename option to be set as well. Never ship a plugin
+// with this option set.
+func WithNoCleanup() FileOption {
+	return func(p *FileProvisioner) {
+		p.noCleanup = true
+	}
+}
+
+// retainedDir returns the directory that files are written to if WithNoCleanup is set. It's derived from the temp
+// dir, so that the file can be located again during deprovisioning and doesn't clash with files of other runs.
+func retainedDir(tempDir string) string {
+	return filepath.Join(os.TempDir(), fmt.Sprintf("op-plugin-debug-%x", sha256.Sum256([]byte(tempDir)))[:32])
+}
+
+// AddArgsAt works like provision.AddArgs, but inserts the args into the command line at the specified index instead
+// of appending them. This is useful for executables that require the file path before a subcommand. Index 0 is the
+// executable itself, so index 1 inserts the args right after the executable. An index past the end of the command
+// line appends the args, and a negative index counts from the end of the command line. Since other provisioners can
+// also add args, the index is relative to the command line at the time this provisioner runs.
+func AddArgsAt(index int, argTemplates ...string) FileOption {
+	return func(p *FileProvisioner) {
+		p.setOutpathAsArg = true
+		p.outpathArgTemplates = argTemplates
+		p.outpathArgIndex = &index
+	}
+}
+
+// AddArgsWithPriority works like provision.AddArgs, but adds the args with the specified priority, so that their
+// position on the command line doesn't depend on the order in which the provisioners run. This is useful when the
+// executable expects the file path and args provisioned by other provisioners in a specific order. Args with a lower
+// priority come first, and all prioritized args come after the args that were appended without a priority.
+func AddArgsWithPriority(priority int, argTemplates ...string) FileOption {
+	return func(p *FileProvisioner) {
+		p.setOutpathAsArg = true
+		p.outpathArgTemplates = argTemplates
+		p.outpathArgPriority = &priority
+	}
+}
+
+// AppendToFile can be used in combination with provision.AtFixedPath to append the file contents to an existing file
+// at the fixed path, instead of overwriting it. This is useful for executables that expect their credentials to be
+// part of the user's existing config. The original state of the file is backed up in the temp dir and restored
+// exactly during deprovisioning, including removing the file if it didn't exist before.
+func AppendToFile() FileOption {
+	return func(p *FileProvisioner) {
+		p.appendToFile = true
+	}
+}
+
+// SymlinkFromFixedPath can be used to make the file available at a fixed path, e.g. "~/.config/tool/creds", without
+// overwriting what the user has at that path: the file is written to the temp dir as usual, and a symlink to it is
+// created at the fixed path. Like with provision.AtFixedPath, "~" and environment variables in the path are expanded.
+// Whatever was at the fixed path before, a regular file or a symlink, is backed up in the temp dir and restored during
+// deprovisioning, before the temp dir gets removed. Env vars and args that contain the path of the file refer to the
+// fixed path. This option can't be combined with provision.AtFixedPath, provision.AppendToFile, or
+// provision.WithNoCleanup.
+func SymlinkFromFixedPath(path string) FileOption {
+	return func(p *FileProvisioner) {
+		p.symlinkPath = path
+	}
+}
+
+// ReplaceInFile can be used to replace all occurrences of the placeholder in an existing file at the target path with
+// the output path, for executables that read the path of the secret file from a config file, e.g. a config template
+// containing "__TOKEN_FILE__". Like with provision.AtFixedPath, "~" and environment variables in the target path are
+// expanded. The original contents of the target file are backed up in the temp dir and restored exactly during
+// deprovisioning. Provisioning fails if the target file doesn't exist or doesn't contain the placeholder.
+func ReplaceInFile(targetPath string, placeholder string) FileOption {
+	return func(p *FileProvisioner) {
+		p.replacements = append(p.replacements, placeholderReplacement{
+			targetPath:  targetPath,
+			placeholder: placeholder,
+		})
+	}
+}
+
 func (p FileProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
-	contents, err := p.fileContents(in)
+	// Reject incompatible options before generating the contents or touching any files.
+	if err := p.validateOptions(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	p, err := p.expandPaths(in.HomeDir)
 	if err != nil {
 		out.AddError(err)
 		return
 	}
 
-	outpath := ""
-	if p.outpathFixed != "" {
-		// Default to the provision.AtFixedPath option
-		outpath = p.outpathFixed
-	} else if p.outfileName != "" {
-		// Fall back to the provision.Filename option
-		outpath = in.FromTempDir(p.outfileName)
+	if p.filenameField != "" {
+		filename, err := filenameFromField(in, p.filenameField, p.filenameFormat)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+		p.outfileName = filename
+	}
+
+	contents, err := p.encodedContents(ctx, in, out)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	// Computing the contents could have taken a while, so make sure provisioning hasn't been aborted in the meantime.
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	outpath, err := p.outpath(in)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	var checksum string
+	if p.checksumEnvVar != "" {
+		checksum, err = p.checksum(contents)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+	}
+
+	if p.failIfExists && p.outpathFixed != "" {
+		err = checkNotExists(in.FS(), outpath, contents)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+	}
+
+	if !in.DryRun && p.outpathFixed != "" && !p.noCleanup {
+		err = createParentDirs(in.FS(), in.TempDir, outpath)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+	}
+
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindFile,
+			Target: outpath,
+			Size:   len(contents),
+		})
+	} else if p.appendToFile {
+		err = p.appendToExistingFile(in.FS(), in.TempDir, outpath, contents)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+		out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindFile, Target: outpath, Size: len(contents)})
+		out.AddLog(p.logEntry("appended secret to file %s (%d bytes)", outpath, len(contents)))
+	} else if p.refreshTTL > 0 {
+		err = p.startRefreshing(in, outpath, contents)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+		out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindFile, Target: outpath, Mode: p.fileMode, Size: len(contents)})
+		out.AddLog(p.logEntry("provisioned secret file at %s (%d bytes), refreshing every %s", outpath, len(contents), refreshInterval(p.refreshTTL)))
+	} else if p.noCleanup {
+		// Write the file directly, since files in the provision output get removed after the executable exits.
+		err = in.FS().MkdirAll(filepath.Dir(outpath), 0700)
+		if err == nil && outpath != p.outpathFixed {
+			// The retained dir should only be accessible by the current user, regardless of the umask.
+			err = in.FS().Chmod(filepath.Dir(outpath), 0700)
+		}
+		written := false
+		if err == nil {
+			written, err = writeFileIfChanged(in.FS(), outpath, contents, p.fileMode)
+		}
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+		out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{
+			Message: fmt.Sprintf("cleanup is disabled: the secret file %s will not be removed after the executable exits", outpath),
+		})
+		if written {
+			out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindFile, Target: outpath, Mode: p.fileMode, Size: len(contents)})
+			out.AddLog(p.logEntry("provisioned secret file at %s (%d bytes) without cleanup", outpath, len(contents)))
+		} else {
+			out.AddLog(p.logEntry("left secret file at %s unchanged, since it's up to date", outpath))
+		}
+	} else if p.outpathFixed != "" && fileUpToDate(in.FS(), outpath, contents, p.fileMode) {
+		// Rewriting the file at the fixed path would only change its modification time, which can trigger watchers.
+		// It still gets removed after the executable exits.
+		out.AddLog(p.logEntry("left secret file at %s unchanged, since it's up to date", outpath))
 	} else {
-		// If both are undefined, resort to generating a random filename
-		fileName, err := randomFilename()
+		out.AddFile(outpath, sdk.OutputFile{
+			Contents: contents,
+			Mode:     p.fileMode,
+		})
+		out.AddLog(p.logEntry("provisioned secret file at %s (%d bytes)", outpath, len(contents)))
+	}
+
+	if !in.DryRun && p.outpathFixed != "" && !p.appendToFile && !p.noCleanup {
+		// Deprovisioning can happen without this run having provisioned the file, e.g. when rolling back, so only
+		// files that are recorded here are ever removed from the fixed path.
+		err = recordProvisioned(in.FS(), in.TempDir, outpath)
+		if err != nil {
+			out.AddError(fmt.Errorf("recording provisioned file %s: %w", outpath, err))
+			return
+		}
+	}
+
+	if p.symlinkPath != "" {
+		outpath, err = p.linkFromFixedPath(in, outpath, out)
 		if err != nil {
-			// This should only fail in rare circumstances
-			out.AddError(fmt.Errorf("generating random file name: %s", err))
+			out.AddError(err)
 			return
 		}
-		outpath = in.FromTempDir(fileName)
 	}
 
-	out.AddSecretFile(outpath, contents)
+	err = p.replacePlaceholders(in, outpath, out)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	p.provisionOutpath(outpath, in.DryRun, out)
+	if p.checksumEnvVar != "" {
+		p.provisionChecksum(checksum, in.DryRun, out)
+	}
+	if p.encryptionKeyEnvVar != "" {
+		p.provisionEncryptionKey(in, out)
+	}
+}
+
+// expandPaths returns the provisioner with "~" and environment variables expanded in all paths outside of the temp
+// dir, see expandPath.
+func (p FileProvisioner) expandPaths(homeDir string) (FileProvisioner, error) {
+	var err error
+	if p.outpathFixed != "" {
+		p.outpathFixed, err = expandPath(p.outpathFixed, homeDir)
+		if err != nil {
+			return p, fmt.Errorf("invalid fixed path: %w", err)
+		}
+	}
+
+	if p.relativeArgBase != "" {
+		p.relativeArgBase, err = expandPath(p.relativeArgBase, homeDir)
+		if err != nil {
+			return p, fmt.Errorf("invalid base dir for relative arg path: %w", err)
+		}
+	}
+
+	if p.symlinkPath != "" {
+		p.symlinkPath, err = expandPath(p.symlinkPath, homeDir)
+		if err != nil {
+			return p, fmt.Errorf("invalid symlink path: %w", err)
+		}
+	}
+
+	// The replacements are copied, since they're shared with the provisioner that the receiver is a copy of.
+	replacements := make([]placeholderReplacement, len(p.replacements))
+	for i, r := range p.replacements {
+		r.targetPath, err = expandPath(r.targetPath, homeDir)
+		if err != nil {
+			return p, fmt.Errorf("invalid path to replace in: %w", err)
+		}
+		replacements[i] = r
+	}
+	p.replacements = replacements
+	return p, nil
+}
+
+// linkFromFixedPath creates the symlink from the fixed path of SymlinkFromFixedPath to the file in the temp dir,
+// after backing up whatever is at the fixed path. Returns the fixed path, which is passed to the executable instead
+// of the path in the temp dir.
+func (p FileProvisioner) linkFromFixedPath(in sdk.ProvisionInput, outpath string, out *sdk.ProvisionOutput) (string, error) {
+	linkPath := p.symlinkPath
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindFile,
+			Target: linkPath,
+		})
+		return linkPath, nil
+	}
+
+	fsys := in.FS()
+	err := backupLink(fsys, in.TempDir, linkPath)
+	if err != nil {
+		return "", err
+	}
+
+	err = fsys.MkdirAll(filepath.Dir(linkPath), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	// The file at the fixed path is kept in the backup, so it can be removed to make room for the symlink.
+	err = fsys.Remove(linkPath)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	err = fsys.Symlink(outpath, linkPath)
+	if err != nil {
+		return "", fmt.Errorf("creating symlink %s: %w", linkPath, err)
+	}
+	out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindFile, Target: linkPath, Mode: os.ModeSymlink})
+	out.AddLog(p.logEntry("created symlink %s to %s", linkPath, outpath))
+	return linkPath, nil
+}
+
+// unlinkFromFixedPath removes the symlink created by linkFromFixedPath and restores what was at the fixed path
+// before.
+func (p FileProvisioner) unlinkFromFixedPath(in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	linkPath := p.symlinkPath
+	err := restoreLink(in.FS(), in.TempDir, linkPath)
+	if errors.Is(err, errNoBackup) {
+		// No symlink was created, e.g. because provisioning was skipped or failed.
+		return
+	} else if err != nil {
+		out.AddError(fmt.Errorf("restoring %s: %w", linkPath, err))
+		return
+	}
+	out.AddLog(p.logEntry("removed symlink and restored %s", linkPath))
+}
+
+// replacePlaceholders replaces the placeholders in the target files of ReplaceInFile with the output path, after
+// backing up the target files in the temp dir.
+func (p FileProvisioner) replacePlaceholders(in sdk.ProvisionInput, outpath string, out *sdk.ProvisionOutput) error {
+	fsys := in.FS()
+	for _, r := range p.replacements {
+		targetPath := r.targetPath
+		if r.placeholder == "" {
+			return fmt.Errorf("replacing in %s: placeholder can't be empty", targetPath)
+		}
+
+		if in.DryRun {
+			out.AddDryRunEntry(sdk.DryRunEntry{
+				Kind:   sdk.DryRunKindFile,
+				Target: targetPath,
+			})
+			continue
+		}
+
+		err := backupFile(fsys, in.TempDir, targetPath)
+		if err != nil {
+			return err
+		}
+
+		backup, err := readBackup(fsys, in.TempDir, targetPath)
+		if err != nil {
+			return err
+		}
+		if !backup.Existed {
+			return fmt.Errorf("replacing in %s: file does not exist", targetPath)
+		}
+
+		count := bytes.Count(backup.Contents, []byte(r.placeholder))
+		if count == 0 {
+			return fmt.Errorf("replacing in %s: placeholder '%s' not found", targetPath, r.placeholder)
+		}
+
+		replaced := bytes.ReplaceAll(backup.Contents, []byte(r.placeholder), []byte(outpath))
+		err = writeFileAtomic(fsys, targetPath, replaced, backup.Mode)
+		if err != nil {
+			return err
+		}
+		out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindFile, Target: targetPath, Mode: backup.Mode, Size: len(replaced)})
+		out.AddLog(p.logEntry("replaced %d occurrences of %s in %s with the file path", count, r.placeholder, targetPath))
+	}
+	return nil
+}
+
+// restorePlaceholders restores the target files of ReplaceInFile to their original contents.
+func (p FileProvisioner) restorePlaceholders(in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	for _, r := range p.replacements {
+		targetPath := r.targetPath
+		err := restoreFile(in.FS(), in.TempDir, targetPath)
+		if errors.Is(err, errNoBackup) {
+			// Nothing was replaced, e.g. because provisioning was skipped or failed.
+			continue
+		} else if err != nil {
+			out.AddError(fmt.Errorf("restoring %s: %w", targetPath, err))
+			continue
+		}
+		out.AddLog(p.logEntry("restored file %s", targetPath))
+	}
+}
+
+// appendToExistingFile backs up the file at the fixed path and appends the contents to it. The file is written
+// directly instead of through the provision output, since the file is owned by the user and should be restored
+// instead of deleted after the executable exits.
+func (p FileProvisioner) appendToExistingFile(fsys sdk.FileSystem, tempDir string, outpath string, contents []byte) error {
+	if p.outpathFixed == "" {
+		return fmt.Errorf("appending to a file requires the file path to be set using AtFixedPath")
+	}
+
+	err := backupFile(fsys, tempDir, outpath)
+	if err != nil {
+		return err
+	}
+
+	backup, err := readBackup(fsys, tempDir, outpath)
+	if err != nil {
+		return err
+	}
+
+	mode := p.fileMode
+	merged := contents
+	if backup.Existed {
+		mode = backup.Mode
+		merged = append([]byte{}, backup.Contents...)
+		if len(merged) > 0 && merged[len(merged)-1] != '\n' {
+			merged = append(merged, '\n')
+		}
+		merged = append(merged, contents...)
+	}
+
+	_, err = writeFileIfChanged(fsys, outpath, merged, mode)
+	return err
+}
+
+// validateOptions returns an error if the options of the file provisioner can't be combined.
+func (p FileProvisioner) validateOptions() error {
+	switch {
+	case p.filenameField != "" && (p.secureDelete || p.noCleanup):
+		return fmt.Errorf("FilenameFromField can't be combined with WithSecureDelete or WithNoCleanup")
+	case p.symlinkPath != "" && (p.outpathFixed != "" || p.appendToFile || p.noCleanup):
+		return fmt.Errorf("symlinking from a fixed path can't be combined with AtFixedPath, AppendToFile, or WithNoCleanup")
+	case p.refreshTTL > 0 && (p.appendToFile || p.noCleanup):
+		return fmt.Errorf("refreshing the file can't be combined with AppendToFile or WithNoCleanup")
+	case p.failIfExists && p.appendToFile:
+		return fmt.Errorf("FailIfExists can't be combined with AppendToFile")
+	case p.encryptionKeyEnvVar != "" && p.encryptionKeyField == "":
+		return fmt.Errorf("WithEncryptionKeyEnvVar requires WithEncryption to be set as well")
+	case p.secureDelete && p.outpathFixed == "" && p.outfileName == "":
+		return fmt.Errorf("secure delete requires the file path to be set using AtFixedPath or Filename")
+	case p.noCleanup && p.outpathFixed == "" && p.outfileName == "":
+		return fmt.Errorf("disabling cleanup requires the file path to be set using AtFixedPath or Filename")
+	}
+	return nil
+}
+
+// outpath returns the path the file should be provisioned at, based on the specified options. If that path is on the
+// RAM disk, the directory on the RAM disk is created as well, unless this is a dry run.
+func (p FileProvisioner) outpath(in sdk.ProvisionInput) (string, error) {
+	dir, err := p.fileDir(in.FS(), in.TempDir)
+	if err != nil {
+		return "", err
+	}
+
+	outpath, err := p.outpathIn(in.TempDir, dir)
+	if err != nil {
+		return "", err
+	}
+
+	if !in.DryRun && p.outpathFixed == "" && dir != in.TempDir {
+		err = createRAMDiskDir(in.FS(), in.TempDir)
+		if err != nil {
+			return "", fmt.Errorf("creating directory on RAM disk: %w", err)
+		}
+	}
+	return outpath, nil
+}
+
+// outpathIn returns the path the file should be provisioned at if it's not at a fixed path, using the specified dir.
+func (p FileProvisioner) outpathIn(tempDir string, dir string) (string, error) {
+	if outpath, ok, err := p.knownOutpath(tempDir, dir); err != nil {
+		return "", err
+	} else if ok {
+		return outpath, nil
+	}
+
+	// If the path is not known upfront, resort to generating a random filename
+	fileName, err := randomFilename()
+	if err != nil {
+		// This should only fail in rare circumstances
+		return "", fmt.Errorf("generating random file name: %s", err)
+	}
+	if p.outfileExtension != "" {
+		if err := validateFileExtension(p.outfileExtension); err != nil {
+			return "", err
+		}
+		fileName += p.outfileExtension
+	}
+	if p.gzip {
+		fileName += ".gz"
+	}
+	return filepath.Join(dir, fileName), nil
+}
+
+// provisionOutpath makes the output path available to the executable, through environment variables or args.
+// During a dry run, these get recorded to the dry run log instead.
+func (p FileProvisioner) provisionOutpath(outpath string, dryRun bool, out *sdk.ProvisionOutput) {
+	if p.pathKey != "" {
+		out.BindPath(p.pathKey, outpath)
+	}
+
+	addEnvVar := func(name string, value string) {
+		out.AddNonSensitiveEnvVar(name, value)
+		out.AddLog(p.logEntry("set %s to %s", name, value))
+	}
+	if dryRun {
+		addEnvVar = func(name string, value string) {
+			out.AddDryRunEntry(sdk.DryRunEntry{
+				Kind:   sdk.DryRunKindEnvVar,
+				Target: name,
+			})
+		}
+	}
 
-	if p.outpathEnvVar != "" {
-		// Populate the specified environment variable with the output path.
-		out.AddEnvVar(p.outpathEnvVar, outpath)
+	for _, envVarName := range p.outpathEnvVars {
+		// Populate the specified environment variables with the output path.
+		addEnvVar(envVarName, outpath)
 	}
 
 	if p.outdirEnvVar != "" {
 		// Populate the specified environment variable with the output dir.
 		dir := filepath.Dir(outpath)
-		out.AddEnvVar(p.outpathEnvVar, dir)
+		addEnvVar(p.outdirEnvVar, dir)
 	}
 
 	// Add args to specify the output path.
 	if p.setOutpathAsArg {
 		tmplData := struct{ Path string }{
-			Path: outpath,
+			Path: p.argPath(outpath, out),
 		}
 
 		// Resolve arg templates with the resulting output path injected.
@@ -159,18 +1056,320 @@ func (p FileProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, o
 			argsResolved[i] = result.String()
 		}
 
-		out.AddArgs(argsResolved...)
+		if dryRun {
+			out.AddDryRunEntry(sdk.DryRunEntry{
+				Kind:   sdk.DryRunKindArgs,
+				Target: strings.Join(argsResolved, " "),
+			})
+		} else if p.outpathArgPriority != nil {
+			out.AddPrioritizedArgs(*p.outpathArgPriority, argsResolved...)
+			out.AddLog(p.logEntry("added %d args with the file path with priority %d", len(argsResolved), *p.outpathArgPriority))
+		} else if p.outpathArgIndex != nil {
+			out.InsertArgs(*p.outpathArgIndex, argsResolved...)
+			out.AddLog(p.logEntry("inserted %d args with the file path at index %d", len(argsResolved), *p.outpathArgIndex))
+		} else {
+			out.AddArgs(argsResolved...)
+			out.AddLog(p.logEntry("added %d args with the file path", len(argsResolved)))
+		}
+	}
+}
+
+// checkNotExists returns an error if there is a file at the path, unless it has exactly the specified contents, in
+// which case it's a file that was provisioned by a previous run.
+func checkNotExists(fsys sdk.FileSystem, path string, contents []byte) error {
+	info, err := fsys.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if info.Mode().IsRegular() {
+		existing, err := fsys.ReadFile(path)
+		if err == nil && bytes.Equal(existing, contents) {
+			return nil
+		}
+	}
+	return fmt.Errorf("file %s already exists: refusing to overwrite it, since FailIfExists is set", path)
+}
+
+// validateFilename makes sure the filename can't be used to escape the temp dir, since files outside of it won't
+// be cleaned up and could overwrite existing files.
+func validateFilename(name string) error {
+	if name == "." || name == ".." || strings.ContainsAny(name, `/\`) || strings.ContainsRune(name, filepath.Separator) {
+		return fmt.Errorf("invalid filename '%s': filenames can't contain path separators or refer to a parent directory", name)
+	}
+	return nil
+}
+
+// filenameFromField formats the filename for provision.FilenameFromField with the sanitized value of the field.
+func filenameFromField(in sdk.ProvisionInput, fieldName sdk.FieldName, format string) (string, error) {
+	if strings.Count(strings.ReplaceAll(format, "%%", ""), "%") != 1 || !strings.Contains(format, "%s") {
+		return "", fmt.Errorf("invalid filename format '%s': it has to contain %%s exactly once", format)
+	}
+	value, ok := in.ItemFields[fieldName]
+	if !ok {
+		return "", fmt.Errorf("no value present in the item for field '%s'", fieldName)
+	}
+
+	sanitized := strings.Map(func(r rune) rune {
+		if r < 0x20 || strings.ContainsRune(`<>:"/\|?*`, r) {
+			return '_'
+		}
+		return r
+	}, value)
+	sanitized = strings.Trim(sanitized, ". ")
+	if sanitized == "" {
+		return "", fmt.Errorf("the value of field '%s' can't be used as a filename", fieldName)
+	}
+
+	filename := fmt.Sprintf(format, sanitized)
+	if err := validateFilename(filename); err != nil {
+		return "", err
+	}
+	return filename, nil
+}
+
+// validateFileExtension makes sure the extension results in a filename that is legal on all platforms, including
+// Windows, which doesn't allow certain characters and trailing dots or spaces in filenames.
+func validateFileExtension(ext string) error {
+	hasControlChars := strings.IndexFunc(ext, func(r rune) bool { return r < 0x20 }) >= 0
+	if hasControlChars || strings.ContainsAny(ext, `<>:"/\|?*`) || strings.TrimRight(ext, ". ") != ext {
+		return fmt.Errorf("invalid file extension '%s': extensions can't contain path separators or characters that are illegal in filenames", ext)
+	}
+	return nil
+}
+
+// knownOutpath returns the output path if it can be determined without generating a random filename.
+// Files with a name set using provision.Filename are written to the specified dir, see fileDir.
+func (p FileProvisioner) knownOutpath(tempDir string, dir string) (string, bool, error) {
+	if p.outpathFixed != "" {
+		// Default to the provision.AtFixedPath option
+		return p.outpathFixed, true, nil
+	} else if p.outfileName != "" {
+		// Fall back to the provision.Filename option
+		if err := validateFilename(p.outfileName); err != nil {
+			return "", false, err
+		}
+		if p.noCleanup {
+			return filepath.Join(retainedDir(tempDir), p.outfileName), true, nil
+		}
+		return filepath.Join(dir, p.outfileName), true, nil
 	}
+	return "", false, nil
 }
 
 func (p FileProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
-	// Nothing to do here: deleting the files gets taken care of.
+	if in.DryRun {
+		return
+	}
+
+	p, err := p.expandPaths(in.HomeDir)
+	if err != nil {
+		// Provisioning failed for the same reason, so there's nothing to clean up.
+		return
+	}
+
+	if p.refreshTTL > 0 {
+		p.stopRefreshing(in, out)
+	}
+
+	p.restorePlaceholders(in, out)
+	if p.symlinkPath != "" {
+		// This needs to happen before the temp dir gets removed, since the backup is stored there.
+		p.unlinkFromFixedPath(in, out)
+	}
+
+	if p.ramDisk != RAMDiskNever {
+		// Remove the directory on the RAM disk after everything else has been cleaned up.
+		defer p.removeRAMDiskDir(in, out)
+	}
+
+	// Set if the file could not be removed, in which case its parent directories can't be removed either.
+	leftBehind := false
+	if p.outpathFixed != "" && !p.noCleanup {
+		// Runs after the file at the fixed path has been restored or scrubbed.
+		defer func() {
+			if !leftBehind {
+				p.removeParentDirs(in, out)
+			}
+		}()
+	}
+
+	if p.noCleanup {
+		if outpath, ok, err := p.knownOutpath(in.TempDir, in.TempDir); ok && err == nil {
+			out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{
+				Message: fmt.Sprintf("cleanup is disabled: the secret file %s has been retained", outpath),
+			})
+			out.AddLog(p.logEntry("retained secret file %s", outpath))
+		}
+		return
+	}
+
+	if p.appendToFile && p.outpathFixed != "" {
+		err := restoreFile(in.FS(), in.TempDir, p.outpathFixed)
+		if errors.Is(err, errNoBackup) {
+			// Nothing was appended to the file, e.g. because provisioning was skipped or failed.
+			return
+		} else if err != nil {
+			out.AddError(fmt.Errorf("restoring %s: %w", p.outpathFixed, err))
+			return
+		}
+		out.AddLog(p.logEntry("restored file %s", p.outpathFixed))
+		return
+	}
+
+	dir, err := p.fileDir(in.FS(), in.TempDir)
+	if err != nil {
+		return
+	}
+
+	// Files with a random name are located in the temp dir and get removed along with it.
+	outpath, ok, err := p.knownOutpath(in.TempDir, dir)
+	if !ok || err != nil {
+		return
+	}
+	if p.outpathFixed != "" && !wasProvisioned(in.FS(), in.TempDir, outpath) {
+		// The file at the fixed path wasn't put in place by this run, e.g. because provisioning was skipped or
+		// failed, so it belongs to the user and must be left alone.
+		return
+	}
+	defer func() {
+		if !leftBehind {
+			_ = in.FS().Remove(provisionedMarkerPath(in.TempDir, outpath))
+		}
+	}()
+
+	if !p.secureDelete {
+		// Removing the file is taken care of as well, but doing it here allows verifying that nothing was left
+		// behind, e.g. because another process still has the file open or locked.
+		err = removeAndVerify(in.FS(), outpath)
+		if err != nil {
+			leftBehind = true
+			out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{
+				Message: fmt.Sprintf("the secret file %s could not be removed and has been left behind: %s", outpath, err),
+			})
+			out.AddLog(p.logEntry("failed to remove secret file %s: %s", outpath, err))
+			return
+		}
+		out.AddLog(p.logEntry("removed secret file %s", outpath))
+		return
+	}
+
+	err = scrubFile(in.FS(), outpath)
+	if err != nil {
+		leftBehind = true
+		out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{
+			Message: fmt.Sprintf("the secret file %s could not be securely deleted and has been left behind: %s", outpath, err),
+		})
+		out.AddLog(p.logEntry("failed to securely delete secret file %s: %s", outpath, err))
+		return
+	}
+	out.AddLog(p.logEntry("securely deleted secret file %s", outpath))
+}
+
+// removeAndVerify removes the file at the specified path, if it exists, and returns an error if the file is still
+// present afterwards.
+func removeAndVerify(fsys sdk.FileSystem, path string) error {
+	err := fsys.Remove(path)
+	if err == nil || os.IsNotExist(err) {
+		if _, statErr := fsys.Lstat(path); !os.IsNotExist(statErr) {
+			if statErr != nil {
+				return statErr
+			}
+			return fmt.Errorf("the file still exists after removing it")
+		}
+		return nil
+	}
+	return err
+}
+
+// removeParentDirs removes the parent directories of the fixed path that were created during provisioning, along
+// with the file itself, since it's located in a directory that didn't exist before.
+func (p FileProvisioner) removeParentDirs(in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	fsys := in.FS()
+	if _, err := fsys.Stat(createdDirsPath(in.TempDir, p.outpathFixed)); os.IsNotExist(err) {
+		return
+	}
+
+	err := fsys.Remove(p.outpathFixed)
+	if err != nil && !os.IsNotExist(err) {
+		out.AddError(fmt.Errorf("removing %s: %w", p.outpathFixed, err))
+		return
+	}
+
+	kept, err := removeCreatedDirs(fsys, in.TempDir, p.outpathFixed)
+	if err != nil {
+		out.AddError(fmt.Errorf("removing parent directories of %s: %w", p.outpathFixed, err))
+		return
+	}
+	if len(kept) > 0 {
+		out.AddLog(p.logEntry("kept directory %s created for %s, since it's not empty", kept[0], p.outpathFixed))
+	}
+}
+
+// removeRAMDiskDir removes the directory on the RAM disk that the file was written to, if any.
+func (p FileProvisioner) removeRAMDiskDir(in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	dir := ramDiskDir(in.TempDir)
+	fsys := in.FS()
+	if _, err := fsys.Stat(dir); os.IsNotExist(err) {
+		return
+	}
+
+	err := fsys.RemoveAll(dir)
+	if err != nil {
+		out.AddError(fmt.Errorf("removing %s: %w", dir, err))
+		return
+	}
+	out.AddLog(p.logEntry("removed RAM disk directory %s", dir))
+}
+
+// logEntry returns a log entry for this provisioner. Only metadata such as paths and sizes should be logged, never
+// the file contents.
+func (p FileProvisioner) logEntry(format string, args ...any) sdk.LogEntry {
+	return sdk.LogEntry{
+		Provisioner: p.Description(),
+		Message:     fmt.Sprintf(format, args...),
+	}
+}
+
+// scrubFile overwrites the contents of the file at the specified path with zeros and removes it afterwards.
+// It's a no-op if the file has already been removed. Anything other than a regular file, such as a symlink
+// that a user has put in place of a fixed path, is left untouched.
+func scrubFile(fsys sdk.FileSystem, path string) error {
+	info, err := fsys.Lstat(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if !info.Mode().IsRegular() {
+		return nil
+	}
+
+	err = fsys.OverwriteFile(path, make([]byte, info.Size()))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	err = fsys.Remove(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
 }
 
 func (p FileProvisioner) Description() string {
 	return "Provision secret file"
 }
 
+// randomFilename generates a filename from 16 bytes read from crypto/rand, so that generated names are both
+// unpredictable and practically collision-free. An error is returned if the OS entropy source fails, instead
+// of falling back to a predictable name. It doesn't use any global state like the math/rand source, so it's safe to
+// call from concurrent provisions.
 func randomFilename() (string, error) {
 	b := make([]byte, 16)
 	_, err := rand.Read(b)
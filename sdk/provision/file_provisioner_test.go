@@ -0,0 +1,1409 @@
+package provision
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldAsFileBase64(t *testing.T) {
+	cases := map[string]struct {
+		value    string
+		expected []byte
+		err      bool
+	}{
+		"standard encoding": {
+			value:    "aGVsbG8/d29ybGQ+",
+			expected: []byte("hello?world>"),
+		},
+		"URL-safe encoding": {
+			value:    "aGVsbG8_d29ybGQ-",
+			expected: []byte("hello?world>"),
+		},
+		"without padding": {
+			value:    "aGVsbG8",
+			expected: []byte("hello"),
+		},
+		"surrounded by whitespace": {
+			value:    "\n  aGVsbG8=\n",
+			expected: []byte("hello"),
+		},
+		"invalid base64": {
+			value: "not base64!",
+			err:   true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			in := sdk.ProvisionInput{
+				ItemFields: map[sdk.FieldName]string{
+					"Key": tc.value,
+				},
+			}
+
+			result, err := FieldAsFileBase64("Key")(in)
+			if tc.err {
+				assert.Error(t, err)
+				assert.NotContains(t, err.Error(), tc.value)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestFieldAsFileWithDefault(t *testing.T) {
+	cases := map[string]struct {
+		fields   map[sdk.FieldName]string
+		expected string
+	}{
+		"present": {
+			fields:   map[sdk.FieldName]string{"Region": "eu-west-1"},
+			expected: "eu-west-1",
+		},
+		"present but empty": {
+			fields:   map[sdk.FieldName]string{"Region": ""},
+			expected: "",
+		},
+		"absent": {
+			fields:   map[sdk.FieldName]string{},
+			expected: "us-east-1",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := FieldAsFileWithDefault("Region", "us-east-1")(sdk.ProvisionInput{ItemFields: tc.fields})
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(result))
+		})
+	}
+}
+
+func TestRandomFilename(t *testing.T) {
+	seen := make(map[string]struct{})
+	for i := 0; i < 1000; i++ {
+		name, err := randomFilename()
+		assert.NoError(t, err)
+		assert.Regexp(t, "^[0-9a-f]{32}$", name)
+		assert.NotContains(t, seen, name)
+		seen[name] = struct{}{}
+	}
+}
+
+// TestRandomFilenameConcurrent is meant to be run with -race, to make sure randomFilename doesn't touch any shared
+// state when files are provisioned concurrently.
+func TestRandomFilenameConcurrent(t *testing.T) {
+	const goroutines = 32
+	const namesPerGoroutine = 100
+
+	var wg sync.WaitGroup
+	names := make(chan string, goroutines*namesPerGoroutine)
+	errs := make(chan error, goroutines*namesPerGoroutine)
+	for i := 0; i < goroutines; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < namesPerGoroutine; j++ {
+				name, err := randomFilename()
+				if err != nil {
+					errs <- err
+					continue
+				}
+				names <- name
+			}
+		}()
+	}
+	wg.Wait()
+	close(names)
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+	seen := make(map[string]struct{})
+	for name := range names {
+		assert.NotContains(t, seen, name)
+		seen[name] = struct{}{}
+	}
+	assert.Len(t, seen, goroutines*namesPerGoroutine)
+}
+
+func TestFileExtension(t *testing.T) {
+	for _, ext := range []string{"json", ".json"} {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		in := sdk.ProvisionInput{
+			TempDir:    "/tmp",
+			FileSystem: plugintest.NewMemoryFileSystem(),
+			ItemFields: map[sdk.FieldName]string{"Key": "{}"},
+		}
+
+		TempFile(FieldAsFile("Key"), FileExtension(ext)).Provision(context.Background(), in, &out)
+
+		assert.Empty(t, out.Diagnostics.Errors)
+		assert.Len(t, out.Files, 1)
+		for path := range out.Files {
+			assert.Regexp(t, "^/tmp/[0-9a-f]{32}\\.json$", path)
+		}
+	}
+}
+
+func TestSecureDelete(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "credentials")
+	err := os.WriteFile(path, []byte("secret"), 0600)
+	assert.NoError(t, err)
+
+	provisioner := TempFile(FieldAsFile("Key"), Filename("credentials"), WithSecureDelete(), WithRAMDisk(RAMDiskNever))
+	in := sdk.DeprovisionInput{TempDir: tempDir}
+
+	out := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), in, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+	assert.NoFileExists(t, path)
+
+	// Deprovisioning again should be a no-op now that the file is gone.
+	provisioner.Deprovision(context.Background(), in, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+}
+
+// overwriteRecordingFileSystem records the data that files are overwritten with.
+type overwriteRecordingFileSystem struct {
+	*plugintest.MemoryFileSystem
+
+	overwritten map[string][]byte
+}
+
+func (fsys *overwriteRecordingFileSystem) OverwriteFile(name string, data []byte) error {
+	fsys.overwritten[name] = data
+	return fsys.MemoryFileSystem.OverwriteFile(name, data)
+}
+
+func TestSecureDeleteUsesFileSystem(t *testing.T) {
+	fsys := &overwriteRecordingFileSystem{MemoryFileSystem: plugintest.NewMemoryFileSystem(), overwritten: make(map[string][]byte)}
+	assert.NoError(t, fsys.WriteFile("/tmp/op-test/credentials", []byte("secret"), 0600))
+
+	provisioner := TempFile(FieldAsFile("Key"), Filename("credentials"), WithSecureDelete())
+	out := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp/op-test", FileSystem: fsys}, &out)
+
+	assert.Empty(t, out.Diagnostics.Errors)
+	assert.Equal(t, map[string][]byte{"/tmp/op-test/credentials": make([]byte, 6)}, fsys.overwritten)
+	assert.Empty(t, fsys.Paths())
+}
+
+func TestDeprovisionLeavesFixedPathThatWasNotProvisioned(t *testing.T) {
+	for description, opts := range map[string][]FileOption{
+		"remove":        {AtFixedPath("/home/user/.tool/credentials")},
+		"secure delete": {AtFixedPath("/home/user/.tool/credentials"), WithSecureDelete()},
+	} {
+		t.Run(description, func(t *testing.T) {
+			fsys := plugintest.NewMemoryFileSystem()
+			assert.NoError(t, fsys.WriteFile("/home/user/.tool/credentials", []byte("user data"), 0600))
+
+			// Deprovisioning without provisioning first, e.g. when a Composite rolls back.
+			out := sdk.DeprovisionOutput{}
+			TempFile(FieldAsFile("Key"), opts...).Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp/op-test", FileSystem: fsys}, &out)
+			assert.Empty(t, out.Diagnostics.Errors)
+
+			contents, err := fsys.ReadFile("/home/user/.tool/credentials")
+			assert.NoError(t, err)
+			assert.Equal(t, "user data", string(contents))
+		})
+	}
+}
+
+func TestDeprovisionRemovesProvisionedFixedPath(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	provisioner := TempFile(FieldAsFile("Key"), AtFixedPath("/home/user/.tool/credentials"))
+
+	out := sdk.ProvisionOutput{Files: make(map[string]sdk.OutputFile)}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp/op-test",
+		FileSystem: fsys,
+		ItemFields: map[sdk.FieldName]string{"Key": "secret"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	// Writing the files is taken care of by the CLI.
+	for path, file := range out.Files {
+		assert.NoError(t, fsys.WriteFile(path, file.Contents, 0600))
+	}
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp/op-test", FileSystem: fsys}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+	_, err := fsys.Stat("/home/user/.tool/credentials")
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestSecureDeleteLeavesSymlinksUntouched(t *testing.T) {
+	tempDir := t.TempDir()
+	target := filepath.Join(tempDir, "target")
+	err := os.WriteFile(target, []byte("user data"), 0600)
+	assert.NoError(t, err)
+
+	link := filepath.Join(tempDir, "link")
+	err = os.Symlink(target, link)
+	assert.NoError(t, err)
+
+	err = scrubFile(sdk.OSFileSystem{}, link)
+	assert.NoError(t, err)
+
+	contents, err := os.ReadFile(target)
+	assert.NoError(t, err)
+	assert.Equal(t, "user data", string(contents))
+}
+
+func TestFileProvisionerDryRun(t *testing.T) {
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+		CommandLine: []string{"mysql"},
+	}
+	in := sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		FileSystem: plugintest.NewMemoryFileSystem(),
+		DryRun:     true,
+		ItemFields: map[sdk.FieldName]string{"Key": "secret"},
+	}
+
+	provisioner := TempFile(FieldAsFile("Key"), Filename("my.cnf"), SetPathAsEnvVar("MYSQL_CONFIG"), AddArgs("--defaults-file={{ .Path }}"))
+	provisioner.Provision(context.Background(), in, &out)
+
+	assert.Empty(t, out.Files)
+	assert.Empty(t, out.Environment)
+	assert.Equal(t, []string{"mysql"}, out.CommandLine)
+	assert.Equal(t, []sdk.DryRunEntry{
+		{Kind: sdk.DryRunKindFile, Target: "/tmp/my.cnf", Size: 6},
+		{Kind: sdk.DryRunKindEnvVar, Target: "MYSQL_CONFIG"},
+		{Kind: sdk.DryRunKindArgs, Target: "--defaults-file=/tmp/my.cnf"},
+	}, out.DryRunLog)
+}
+
+func TestFilenameRejectsPathTraversal(t *testing.T) {
+	for _, name := range []string{"../../etc/passwd", "..", "sub/file", `sub\file`} {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		in := sdk.ProvisionInput{
+			TempDir:    "/tmp",
+			ItemFields: map[sdk.FieldName]string{"Key": "secret"},
+		}
+
+		TempFile(FieldAsFile("Key"), Filename(name)).Provision(context.Background(), in, &out)
+
+		assert.Empty(t, out.Files, name)
+		assert.Len(t, out.Diagnostics.Errors, 1, name)
+	}
+}
+
+func TestAppendToFile(t *testing.T) {
+	cases := map[string]struct {
+		existing *string
+		expected string
+	}{
+		"existing file without trailing newline": {
+			existing: stringPtr("[default]\nregion = eu-west-1"),
+			expected: "[default]\nregion = eu-west-1\n[work]\ntoken = secret\n",
+		},
+		"existing file with trailing newline": {
+			existing: stringPtr("[default]\n"),
+			expected: "[default]\n[work]\ntoken = secret\n",
+		},
+		"no existing file": {
+			expected: "[work]\ntoken = secret\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			tempDir := t.TempDir()
+			path := filepath.Join(t.TempDir(), "credentials")
+			if tc.existing != nil {
+				err := os.WriteFile(path, []byte(*tc.existing), 0640)
+				assert.NoError(t, err)
+			}
+
+			provisioner := TempFile(FieldAsFile("Section"), AtFixedPath(path), AppendToFile())
+			out := sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			}
+			in := sdk.ProvisionInput{
+				TempDir:    tempDir,
+				ItemFields: map[sdk.FieldName]string{"Section": "[work]\ntoken = secret\n"},
+			}
+			provisioner.Provision(context.Background(), in, &out)
+			assert.Empty(t, out.Diagnostics.Errors)
+			assert.Empty(t, out.Files)
+
+			contents, err := os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(contents))
+
+			deprovisionOut := sdk.DeprovisionOutput{}
+			provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: tempDir}, &deprovisionOut)
+			assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+			if tc.existing == nil {
+				assert.NoFileExists(t, path)
+				return
+			}
+
+			contents, err = os.ReadFile(path)
+			assert.NoError(t, err)
+			assert.Equal(t, *tc.existing, string(contents))
+
+			info, err := os.Stat(path)
+			assert.NoError(t, err)
+			assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		})
+	}
+}
+
+func stringPtr(s string) *string {
+	return &s
+}
+
+func TestWithLineEndings(t *testing.T) {
+	cases := map[string]struct {
+		style    LineEndings
+		expected string
+	}{
+		"unchanged": {
+			style:    LineEndingsUnchanged,
+			expected: "[default]\r\nkey = value\n",
+		},
+		"LF": {
+			style:    LineEndingsLF,
+			expected: "[default]\nkey = value\n",
+		},
+		"CRLF": {
+			style:    LineEndingsCRLF,
+			expected: "[default]\r\nkey = value\r\n",
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			out := sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			}
+			in := sdk.ProvisionInput{
+				TempDir:    "/tmp",
+				FileSystem: plugintest.NewMemoryFileSystem(),
+				ItemFields: map[sdk.FieldName]string{"Config": "[default]\r\nkey = value\n"},
+			}
+
+			TempFile(FieldAsFile("Config"), Filename("config"), WithLineEndings(tc.style)).Provision(context.Background(), in, &out)
+
+			assert.Empty(t, out.Diagnostics.Errors)
+			assert.Equal(t, tc.expected, string(out.Files[filepath.Join("/tmp", "config")].Contents))
+		})
+	}
+}
+
+func TestFileExtensionIsLegalOnWindows(t *testing.T) {
+	for _, ext := range []string{"json:stream", "json.", "json ", "js|on", "json\n"} {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		in := sdk.ProvisionInput{
+			TempDir:    "/tmp",
+			ItemFields: map[sdk.FieldName]string{"Key": "{}"},
+		}
+
+		TempFile(FieldAsFile("Key"), FileExtension(ext)).Provision(context.Background(), in, &out)
+
+		assert.Empty(t, out.Files, ext)
+		assert.Len(t, out.Diagnostics.Errors, 1, ext)
+	}
+}
+
+func TestFileProvisionerLog(t *testing.T) {
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+		CommandLine: []string{"mysql"},
+	}
+	in := sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		FileSystem: plugintest.NewMemoryFileSystem(),
+		ItemFields: map[sdk.FieldName]string{"Key": "hunter2"},
+	}
+
+	provisioner := TempFile(FieldAsFile("Key"), Filename("my.cnf"), SetPathAsEnvVar("MYSQL_CONFIG"), AddArgs("--defaults-file={{ .Path }}"))
+	provisioner.Provision(context.Background(), in, &out)
+
+	assert.Equal(t, []sdk.LogEntry{
+		{Provisioner: "Provision secret file", Message: "provisioned secret file at /tmp/my.cnf (7 bytes)"},
+		{Provisioner: "Provision secret file", Message: "set MYSQL_CONFIG to /tmp/my.cnf"},
+		{Provisioner: "Provision secret file", Message: "added 1 args with the file path"},
+	}, out.Log)
+	for _, entry := range out.Log {
+		assert.NotContains(t, entry.Message, "hunter2")
+	}
+}
+
+func TestDocumentAsFile(t *testing.T) {
+	keystore := []byte{0x30, 0x82, 0x00, 0xff}
+	plugintest.TestProvisioner(t, TempFile(DocumentAsFile("keystore.p12"), Filename("keystore.p12")), map[string]plugintest.ProvisionCase{
+		"attachment": {
+			ItemFiles: map[string][]byte{"keystore.p12": keystore},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Files: map[string]sdk.OutputFile{
+					"/tmp/keystore.p12": {Contents: keystore, Mode: 0600},
+				},
+			},
+		},
+		"missing attachment": {
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "no file named 'keystore.p12' attached to the item"}},
+				},
+			},
+		},
+	})
+}
+
+func TestFileProvisionerCancelledContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	in := sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		ItemFields: map[sdk.FieldName]string{"Key": "secret"},
+	}
+
+	TempFile(FieldAsFile("Key"), SetPathAsEnvVar("KEY_FILE")).Provision(ctx, in, &out)
+
+	assert.Empty(t, out.Files)
+	assert.Empty(t, out.Environment)
+	assert.Equal(t, []sdk.Error{{Message: context.Canceled.Error()}}, out.Diagnostics.Errors)
+}
+
+func TestWithNoCleanup(t *testing.T) {
+	tempDir := t.TempDir()
+	provisioner := TempFile(FieldAsFile("Key"), Filename("credentials"), SetPathAsEnvVar("KEY_FILE"), WithNoCleanup())
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	in := sdk.ProvisionInput{
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Key": "secret"},
+	}
+	provisioner.Provision(context.Background(), in, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+	assert.Len(t, out.Diagnostics.Warnings, 1)
+	assert.Empty(t, out.Files)
+
+	path := out.Environment["KEY_FILE"]
+	assert.Equal(t, filepath.Join(retainedDir(tempDir), "credentials"), path)
+	assert.NotContains(t, path, tempDir)
+	t.Cleanup(func() {
+		os.RemoveAll(filepath.Dir(path))
+	})
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: tempDir}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.Len(t, deprovisionOut.Diagnostics.Warnings, 1)
+
+	contents, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "secret", string(contents))
+}
+
+func TestWithFileMode(t *testing.T) {
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Key"), Filename("credentials"), WithFileMode(0640)), map[string]plugintest.ProvisionCase{
+		"mode": {
+			ItemFields: map[sdk.FieldName]string{"Key": "secret"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Files: map[string]sdk.OutputFile{
+					"/tmp/credentials": {Contents: []byte("secret"), Mode: 0640},
+				},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Key"), Filename("credentials")), map[string]plugintest.ProvisionCase{
+		"default mode": {
+			ItemFields: map[sdk.FieldName]string{"Key": "secret"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Files: map[string]sdk.OutputFile{
+					"/tmp/credentials": {Contents: []byte("secret"), Mode: 0600},
+				},
+			},
+		},
+	})
+}
+
+func TestWithFileModeOnDisk(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("Windows doesn't support Unix permissions")
+	}
+	tempDir := t.TempDir()
+	provisioner := TempFile(FieldAsFile("Key"), Filename("credentials"), SetPathAsEnvVar("KEY_FILE"), WithFileMode(0660), WithNoCleanup())
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Key": "secret"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	path := out.Environment["KEY_FILE"]
+	t.Cleanup(func() {
+		os.RemoveAll(filepath.Dir(path))
+	})
+
+	// Files that the provisioner writes itself get the mode regardless of the umask, which usually leaves out group
+	// write permissions.
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+}
+
+// writeCountingFileSystem counts the number of files written, apart from the markers of provisioned files.
+type writeCountingFileSystem struct {
+	*plugintest.MemoryFileSystem
+
+	writes int
+}
+
+func (fsys *writeCountingFileSystem) WriteFile(name string, data []byte, perm os.FileMode) error {
+	if !strings.HasPrefix(filepath.Base(name), ".provisioned-") {
+		fsys.writes++
+	}
+	return fsys.MemoryFileSystem.WriteFile(name, data, perm)
+}
+
+func TestWithNoCleanupSkipsUnchangedFile(t *testing.T) {
+	fsys := &writeCountingFileSystem{MemoryFileSystem: plugintest.NewMemoryFileSystem()}
+	provisioner := TempFile(FieldAsFile("Key"), Filename("credentials"), WithNoCleanup())
+	provision := func(key string) sdk.ProvisionOutput {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		provisioner.Provision(context.Background(), sdk.ProvisionInput{
+			TempDir:    "/tmp/op-test",
+			FileSystem: fsys,
+			ItemFields: map[sdk.FieldName]string{"Key": key},
+		}, &out)
+		assert.Empty(t, out.Diagnostics.Errors)
+		return out
+	}
+
+	out := provision("secret")
+	assert.Equal(t, 1, fsys.writes)
+	assert.Len(t, out.Actions, 1)
+
+	// Nothing gets written if the retained file is up to date.
+	out = provision("secret")
+	assert.Equal(t, 1, fsys.writes)
+	assert.Empty(t, out.Actions)
+
+	out = provision("rotated")
+	assert.Equal(t, 2, fsys.writes)
+	assert.Len(t, out.Actions, 1)
+	contents, err := fsys.ReadFile(filepath.Join(retainedDir("/tmp/op-test"), "credentials"))
+	assert.NoError(t, err)
+	assert.Equal(t, "rotated", string(contents))
+}
+
+func TestAtFixedPathSkipsUnchangedFile(t *testing.T) {
+	fsys := &writeCountingFileSystem{MemoryFileSystem: plugintest.NewMemoryFileSystem()}
+	assert.NoError(t, fsys.MkdirAll("/home/user/.tool", 0700))
+	provisioner := TempFile(FieldAsFile("Key"), AtFixedPath("/home/user/.tool/credentials"))
+	provision := func(key string) sdk.ProvisionOutput {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		provisioner.Provision(context.Background(), sdk.ProvisionInput{
+			TempDir:    "/tmp/op-test",
+			FileSystem: fsys,
+			ItemFields: map[sdk.FieldName]string{"Key": key},
+		}, &out)
+		assert.Empty(t, out.Diagnostics.Errors)
+		return out
+	}
+
+	// The file at the fixed path is left over from a previous run and has exactly the contents to provision.
+	assert.NoError(t, fsys.WriteFile("/home/user/.tool/credentials", []byte("secret"), 0600))
+	fsys.writes = 0
+
+	out := provision("secret")
+	assert.Empty(t, out.Files)
+	assert.Empty(t, out.Actions)
+	assert.Equal(t, 0, fsys.writes)
+
+	out = provision("rotated")
+	assert.Equal(t, []byte("rotated"), out.Files["/home/user/.tool/credentials"].Contents)
+	assert.Len(t, out.Actions, 1)
+}
+
+func TestFileProvisionerConcurrentProvisions(t *testing.T) {
+	// Provisions that run in parallel with different temp dirs must never write to the same path, even if the file
+	// name is fixed.
+	fsys := plugintest.NewMemoryFileSystem()
+	provisioner := TempFile(FieldAsFile("Key"), Filename("credentials"), SetPathAsEnvVar("KEY_FILE"))
+	tempDirs := []string{"/tmp/op-run-1", "/tmp/op-run-2"}
+	keys := []string{"secret-1", "secret-2"}
+
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	outs := make([]sdk.ProvisionOutput, len(tempDirs))
+	for i := range tempDirs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			outs[i] = sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			}
+			<-start
+			provisioner.Provision(context.Background(), sdk.ProvisionInput{
+				TempDir:    tempDirs[i],
+				FileSystem: fsys,
+				ItemFields: map[sdk.FieldName]string{"Key": keys[i]},
+			}, &outs[i])
+
+			// Write the files into the shared file system, so that colliding paths would overwrite each other.
+			for path, file := range outs[i].Files {
+				assert.NoError(t, fsys.WriteFile(path, file.Contents, file.Mode))
+			}
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	for i, out := range outs {
+		assert.Empty(t, out.Diagnostics.Errors)
+		path := out.Environment["KEY_FILE"]
+		assert.Equal(t, filepath.Join(tempDirs[i], "credentials"), path)
+
+		contents, err := fsys.ReadFile(path)
+		assert.NoError(t, err)
+		assert.Equal(t, keys[i], string(contents))
+	}
+}
+
+func TestWithRetry(t *testing.T) {
+	calls := 0
+	flaky := func(in sdk.ProvisionInput) ([]byte, error) {
+		calls++
+		if calls < 3 {
+			return nil, fmt.Errorf("attempt %d failed", calls)
+		}
+		return []byte("token"), nil
+	}
+	in := sdk.ProvisionInput{TempDir: "/tmp", FileSystem: plugintest.NewMemoryFileSystem()}
+	newOutput := func() sdk.ProvisionOutput {
+		return sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+	}
+
+	out := newOutput()
+	TempFile(flaky, Filename("token"), WithRetry(3, time.Millisecond)).Provision(context.Background(), in, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+	assert.Equal(t, "token", string(out.Files["/tmp/token"].Contents))
+	assert.Equal(t, 3, calls)
+
+	calls = 0
+	out = newOutput()
+	TempFile(flaky, Filename("token"), WithRetry(2, time.Millisecond)).Provision(context.Background(), in, &out)
+	assert.Equal(t, []sdk.Error{{Message: "attempt 2 failed"}}, out.Diagnostics.Errors)
+	assert.Empty(t, out.Files)
+
+	calls = 0
+	out = newOutput()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	TempFile(flaky, Filename("token"), WithRetry(3, time.Hour)).Provision(ctx, in, &out)
+	assert.Equal(t, []sdk.Error{{Message: context.Canceled.Error()}}, out.Diagnostics.Errors)
+	assert.Equal(t, 1, calls)
+}
+
+func TestAppendToFileInMemory(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	err := fsys.WriteFile("/home/wendy/.tool/credentials", []byte("[default]\n"), 0640)
+	assert.NoError(t, err)
+
+	provisioner := TempFile(FieldAsFile("Section"), AtFixedPath("/home/wendy/.tool/credentials"), AppendToFile())
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		FileSystem: fsys,
+		ItemFields: map[sdk.FieldName]string{"Section": "[work]\n"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	contents, err := fsys.ReadFile("/home/wendy/.tool/credentials")
+	assert.NoError(t, err)
+	assert.Equal(t, "[default]\n[work]\n", string(contents))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp", FileSystem: fsys}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+	contents, err = fsys.ReadFile("/home/wendy/.tool/credentials")
+	assert.NoError(t, err)
+	assert.Equal(t, "[default]\n", string(contents))
+	info, err := fsys.Stat("/home/wendy/.tool/credentials")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode())
+	assert.Equal(t, []string{"/home/wendy/.tool/credentials"}, fsys.Paths())
+}
+
+func TestReplaceInFile(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	original := "token_file: __TOKEN_FILE__\nbackup_token_file: __TOKEN_FILE__\n"
+	err := fsys.WriteFile("/home/wendy/.tool/config.yml", []byte(original), 0644)
+	assert.NoError(t, err)
+
+	provisioner := TempFile(FieldAsFile("Token"), Filename("token"), ReplaceInFile("~/.tool/config.yml", "__TOKEN_FILE__"))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		HomeDir:    "/home/wendy",
+		TempDir:    "/tmp",
+		FileSystem: fsys,
+		ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+	assert.Contains(t, out.Files, "/tmp/token")
+
+	contents, err := fsys.ReadFile("/home/wendy/.tool/config.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "token_file: /tmp/token\nbackup_token_file: /tmp/token\n", string(contents))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{
+		HomeDir:    "/home/wendy",
+		TempDir:    "/tmp",
+		FileSystem: fsys,
+	}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+	contents, err = fsys.ReadFile("/home/wendy/.tool/config.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, original, string(contents))
+	info, err := fsys.Stat("/home/wendy/.tool/config.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0644), info.Mode())
+}
+
+func TestReplaceInFileExpandsPath(t *testing.T) {
+	t.Setenv("TOOL_CONFIG_DIR", "/home/wendy/.tool")
+	fsys := plugintest.NewMemoryFileSystem()
+	err := fsys.WriteFile("/home/wendy/.tool/config.yml", []byte("token_file: __TOKEN_FILE__\n"), 0644)
+	assert.NoError(t, err)
+
+	provisioner := TempFile(FieldAsFile("Token"), Filename("token"), ReplaceInFile("$TOOL_CONFIG_DIR/config.yml", "__TOKEN_FILE__"))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		FileSystem: fsys,
+		ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	contents, err := fsys.ReadFile("/home/wendy/.tool/config.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "token_file: /tmp/token\n", string(contents))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp", FileSystem: fsys}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+	contents, err = fsys.ReadFile("/home/wendy/.tool/config.yml")
+	assert.NoError(t, err)
+	assert.Equal(t, "token_file: __TOKEN_FILE__\n", string(contents))
+}
+
+func TestSymlinkFromFixedPathUnknownHomeDir(t *testing.T) {
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	TempFile(FieldAsFile("Token"), SymlinkFromFixedPath("~/.tool/creds")).Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		FileSystem: plugintest.NewMemoryFileSystem(),
+		ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+	}, &out)
+	assert.Equal(t, []sdk.Error{{Message: "invalid symlink path: expanding ~/.tool/creds: the home directory is unknown"}}, out.Diagnostics.Errors)
+	assert.Empty(t, out.Files)
+}
+
+func TestReplaceInFileMissingPlaceholder(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	err := fsys.WriteFile("/home/wendy/.tool/config.yml", []byte("token_file: ~/token\n"), 0644)
+	assert.NoError(t, err)
+
+	provisioner := TempFile(FieldAsFile("Token"), Filename("token"), ReplaceInFile("~/.tool/config.yml", "__TOKEN_FILE__"))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		HomeDir:    "/home/wendy",
+		TempDir:    "/tmp",
+		FileSystem: fsys,
+		ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+	}, &out)
+	assert.Equal(t, []sdk.Error{{Message: "replacing in /home/wendy/.tool/config.yml: placeholder '__TOKEN_FILE__' not found"}}, out.Diagnostics.Errors)
+}
+
+func TestDeprovisionReportsErrors(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	err := fsys.WriteFile(backupPath("/tmp", "/home/wendy/.tool/credentials"), []byte("corrupted"), 0600)
+	assert.NoError(t, err)
+
+	provisioner := TempFile(FieldAsFile("Section"), AtFixedPath("/home/wendy/.tool/credentials"), AppendToFile())
+	out := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp", FileSystem: fsys}, &out)
+
+	assert.Len(t, out.Diagnostics.Errors, 1)
+	assert.Contains(t, out.Diagnostics.Errors[0].Message, "restoring /home/wendy/.tool/credentials: ")
+	assert.Empty(t, out.Log)
+}
+
+// lockedFileSystem fails to remove the file at the locked path, like removing a file does while another process has
+// it open or locked.
+type lockedFileSystem struct {
+	*plugintest.MemoryFileSystem
+
+	locked string
+	err    error
+}
+
+func (fsys lockedFileSystem) Remove(name string) error {
+	if name == fsys.locked {
+		return &os.PathError{Op: "remove", Path: name, Err: fsys.err}
+	}
+	return fsys.MemoryFileSystem.Remove(name)
+}
+
+func TestDeprovisionVerifiesRemoval(t *testing.T) {
+	for name, removeErr := range map[string]error{
+		"none": nil,
+		// ERROR_SHARING_VIOLATION, returned on Windows if another process has the file open.
+		"locked file on Windows": syscall.Errno(32),
+		// Returned on Linux if the file is in use, e.g. because it's a mount point.
+		"busy file on Linux": syscall.EBUSY,
+	} {
+		t.Run(name, func(t *testing.T) {
+			var fsys sdk.FileSystem = plugintest.NewMemoryFileSystem()
+			if removeErr != nil {
+				fsys = lockedFileSystem{MemoryFileSystem: fsys.(*plugintest.MemoryFileSystem), locked: "/tmp/token", err: removeErr}
+			}
+			assert.NoError(t, fsys.WriteFile("/tmp/token", []byte("hunter2"), 0600))
+
+			provisioner := TempFile(FieldAsFile("Token"), Filename("token"))
+			out := sdk.DeprovisionOutput{}
+			provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp", FileSystem: fsys}, &out)
+			assert.Empty(t, out.Diagnostics.Errors)
+
+			_, err := fsys.Lstat("/tmp/token")
+			if removeErr == nil {
+				assert.True(t, os.IsNotExist(err))
+				assert.Empty(t, out.Diagnostics.Warnings)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Len(t, out.Diagnostics.Warnings, 1)
+			assert.Contains(t, out.Diagnostics.Warnings[0].Message, "the secret file /tmp/token could not be removed and has been left behind: ")
+			assert.Contains(t, out.Diagnostics.Warnings[0].Message, removeErr.Error())
+		})
+	}
+}
+
+func TestSymlinkFromFixedPath(t *testing.T) {
+	const linkPath = "/home/wendy/.config/tool/creds"
+
+	for name, setup := range map[string]func(t *testing.T, fsys *plugintest.MemoryFileSystem){
+		"regular file": func(t *testing.T, fsys *plugintest.MemoryFileSystem) {
+			assert.NoError(t, fsys.WriteFile(linkPath, []byte("original"), 0640))
+		},
+		"dangling symlink": func(t *testing.T, fsys *plugintest.MemoryFileSystem) {
+			assert.NoError(t, fsys.Symlink("/home/wendy/.creds-missing", linkPath))
+		},
+		"nothing": func(t *testing.T, fsys *plugintest.MemoryFileSystem) {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fsys := plugintest.NewMemoryFileSystem()
+			setup(t, fsys)
+			before, _ := fsys.Lstat(linkPath)
+			beforeLink, _ := fsys.Readlink(linkPath)
+			beforeContents, _ := fsys.ReadFile(linkPath)
+
+			provisioner := TempFile(FieldAsFile("Token"), Filename("creds"), SymlinkFromFixedPath("~/.config/tool/creds"), SetPathAsEnvVar("TOOL_CREDS"))
+			out := sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			}
+			provisioner.Provision(context.Background(), sdk.ProvisionInput{
+				HomeDir:    "/home/wendy",
+				TempDir:    "/tmp",
+				FileSystem: fsys,
+				ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			}, &out)
+			assert.Empty(t, out.Diagnostics.Errors)
+			assert.Contains(t, out.Files, "/tmp/creds")
+			assert.Equal(t, map[string]string{"TOOL_CREDS": linkPath}, out.Environment)
+
+			target, err := fsys.Readlink(linkPath)
+			assert.NoError(t, err)
+			assert.Equal(t, "/tmp/creds", target)
+
+			deprovisionOut := sdk.DeprovisionOutput{}
+			provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{
+				HomeDir:    "/home/wendy",
+				TempDir:    "/tmp",
+				FileSystem: fsys,
+			}, &deprovisionOut)
+			assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+			after, _ := fsys.Lstat(linkPath)
+			afterLink, _ := fsys.Readlink(linkPath)
+			afterContents, _ := fsys.ReadFile(linkPath)
+			assert.Equal(t, before, after)
+			assert.Equal(t, beforeLink, afterLink)
+			assert.Equal(t, beforeContents, afterContents)
+		})
+	}
+}
+
+func TestSymlinkFromFixedPathOnDisk(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("creating symlinks requires elevated privileges on Windows")
+	}
+
+	homeDir := t.TempDir()
+	tempDir := t.TempDir()
+	linkPath := filepath.Join(homeDir, ".tool", "creds")
+	assert.NoError(t, os.MkdirAll(filepath.Dir(linkPath), 0700))
+	assert.NoError(t, os.WriteFile(linkPath, []byte("original"), 0600))
+
+	provisioner := TempFile(FieldAsFile("Token"), Filename("creds"), SymlinkFromFixedPath("~/.tool/creds"))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		HomeDir:    homeDir,
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	// Write the file the way the CLI would.
+	for path, file := range out.Files {
+		assert.NoError(t, os.WriteFile(path, file.Contents, file.Mode))
+	}
+	contents, err := os.ReadFile(linkPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "hunter2", string(contents))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{HomeDir: homeDir, TempDir: tempDir}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+	info, err := os.Lstat(linkPath)
+	assert.NoError(t, err)
+	assert.True(t, info.Mode().IsRegular())
+	contents, err = os.ReadFile(linkPath)
+	assert.NoError(t, err)
+	assert.Equal(t, "original", string(contents))
+}
+
+func TestFileProvisionerValidatesOptionsFirst(t *testing.T) {
+	for description, opts := range map[string][]FileOption{
+		"symlink":        {AtFixedPath("/tmp/creds"), SymlinkFromFixedPath("~/.tool/creds")},
+		"refresh":        {AppendToFile(), AtFixedPath("/tmp/creds"), WithTTL(time.Minute)},
+		"fail if exists": {AppendToFile(), AtFixedPath("/tmp/creds"), FailIfExists()},
+		"encryption":     {WithEncryptionKeyEnvVar("KEY")},
+		"filename field": {FilenameFromField("Name", "%s.json"), WithSecureDelete()},
+		"secure delete":  {WithSecureDelete()},
+	} {
+		t.Run(description, func(t *testing.T) {
+			generated := false
+			contents := func(in sdk.ProvisionInput) ([]byte, error) {
+				generated = true
+				return []byte("hunter2"), nil
+			}
+			fsys := plugintest.NewMemoryFileSystem()
+			out := sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			}
+			TempFile(contents, opts...).Provision(context.Background(), sdk.ProvisionInput{TempDir: "/tmp", FileSystem: fsys}, &out)
+
+			assert.Len(t, out.Diagnostics.Errors, 1)
+			assert.False(t, generated, "the contents must not be generated if the options can't be combined")
+			assert.Empty(t, fsys.Paths())
+			assert.Empty(t, out.Cache.Puts)
+		})
+	}
+}
+
+func TestSymlinkFromFixedPathConflictingOptions(t *testing.T) {
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), AtFixedPath("/tmp/creds"), SymlinkFromFixedPath("~/.tool/creds")), map[string]plugintest.ProvisionCase{
+		"at fixed path": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "symlinking from a fixed path can't be combined with AtFixedPath, AppendToFile, or WithNoCleanup"}},
+				},
+			},
+		},
+	})
+}
+
+func TestWithGzip(t *testing.T) {
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	in := sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		FileSystem: plugintest.NewMemoryFileSystem(),
+		ItemFields: map[sdk.FieldName]string{"Config": "key = value\n"},
+	}
+
+	TempFile(FieldAsFile("Config"), FileExtension("toml"), WithLineEndings(LineEndingsCRLF), WithGzip(gzip.BestCompression)).Provision(context.Background(), in, &out)
+
+	assert.Empty(t, out.Diagnostics.Errors)
+	assert.Len(t, out.Files, 1)
+	for path, file := range out.Files {
+		assert.Regexp(t, "^/tmp/[0-9a-f]{32}\\.toml\\.gz$", path)
+
+		r, err := gzip.NewReader(bytes.NewReader(file.Contents))
+		assert.NoError(t, err)
+		contents, err := io.ReadAll(r)
+		assert.NoError(t, err)
+		assert.Equal(t, "key = value\r\n", string(contents))
+	}
+}
+
+func TestWithGzipInvalidLevel(t *testing.T) {
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Config"), WithGzip(42)), map[string]plugintest.ProvisionCase{
+		"invalid level": {
+			ItemFields: map[sdk.FieldName]string{"Config": "key = value"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "gzip: invalid compression level: 42"}},
+				},
+			},
+		},
+	})
+}
+
+func TestFieldAsFileFuzzy(t *testing.T) {
+	cases := map[string]struct {
+		fields   map[sdk.FieldName]string
+		expected string
+		err      string
+	}{
+		"exact match": {
+			fields:   map[sdk.FieldName]string{"API Token": "exact", "api token": "fuzzy"},
+			expected: "exact",
+		},
+		"case and whitespace": {
+			fields:   map[sdk.FieldName]string{"api  token ": "fuzzy"},
+			expected: "fuzzy",
+		},
+		"ambiguous": {
+			fields: map[sdk.FieldName]string{"api token": "one", "API  TOKEN": "two"},
+			err:    "field 'API Token' is ambiguous, it matches fields 'API  TOKEN', 'api token'",
+		},
+		"no match": {
+			fields: map[sdk.FieldName]string{"Token": "other"},
+			err:    "no value present in the item for field 'API Token'",
+		},
+	}
+
+	for name, c := range cases {
+		t.Run(name, func(t *testing.T) {
+			contents, err := FieldAsFileFuzzy("API Token")(sdk.ProvisionInput{ItemFields: c.fields})
+			if c.err != "" {
+				assert.EqualError(t, err, c.err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, c.expected, string(contents))
+		})
+	}
+}
+
+func TestAtFixedPathCreatesParentDirs(t *testing.T) {
+	for name, addUserFile := range map[string]bool{
+		"removes created dirs": false,
+		"keeps non-empty dirs": true,
+	} {
+		t.Run(name, func(t *testing.T) {
+			fsys := plugintest.NewMemoryFileSystem()
+			assert.NoError(t, fsys.MkdirAll("/home/wendy", 0755))
+
+			provisioner := TempFile(FieldAsFile("Token"), AtFixedPath("/home/wendy/.config/tool/creds"))
+			out := sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			}
+			provisioner.Provision(context.Background(), sdk.ProvisionInput{
+				TempDir:    "/tmp",
+				FileSystem: fsys,
+				ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+			}, &out)
+			assert.Empty(t, out.Diagnostics.Errors)
+			assert.Contains(t, out.Files, "/home/wendy/.config/tool/creds")
+
+			for _, dir := range []string{"/home/wendy/.config", "/home/wendy/.config/tool"} {
+				info, err := fsys.Stat(dir)
+				assert.NoError(t, err)
+				assert.Equal(t, os.ModeDir|0700, info.Mode())
+			}
+
+			// The file in the provision output gets written by the CLI.
+			assert.NoError(t, fsys.WriteFile("/home/wendy/.config/tool/creds", []byte("tok_EXAMPLE"), 0600))
+			if addUserFile {
+				assert.NoError(t, fsys.WriteFile("/home/wendy/.config/other", []byte("user data"), 0600))
+			}
+
+			deprovisionOut := sdk.DeprovisionOutput{}
+			provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp", FileSystem: fsys}, &deprovisionOut)
+			assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+			_, err := fsys.Stat("/home/wendy/.config/tool")
+			assert.True(t, os.IsNotExist(err))
+			_, err = fsys.Stat("/home/wendy/.config")
+			assert.Equal(t, os.IsNotExist(err), !addUserFile)
+			_, err = fsys.Stat("/home/wendy")
+			assert.NoError(t, err)
+
+			if addUserFile {
+				assert.Equal(t, []string{"/home/wendy/.config/other"}, fsys.Paths())
+			} else {
+				assert.Empty(t, fsys.Paths())
+			}
+		})
+	}
+}
+
+func TestSetPathAsEnvVar(t *testing.T) {
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), Filename("config"), SetPathAsEnvVar("TOOL_CONFIG_FILE", "TOOL_CONFIG"), SetOutputDirAsEnvVar("TOOL_CONFIG_DIR")), map[string]plugintest.ProvisionCase{
+		"multiple names": {
+			ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"TOOL_CONFIG_FILE": "/tmp/config",
+					"TOOL_CONFIG":      "/tmp/config",
+					"TOOL_CONFIG_DIR":  "/tmp",
+				},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/config": {Contents: []byte("tok_EXAMPLE"), Mode: 0600},
+				},
+				NonSensitiveEnvVars: map[string]bool{
+					"TOOL_CONFIG_FILE": true,
+					"TOOL_CONFIG":      true,
+					"TOOL_CONFIG_DIR":  true,
+				},
+			},
+		},
+	})
+}
+
+func TestFailIfExists(t *testing.T) {
+	for name, c := range map[string]struct {
+		existing string
+		err      string
+	}{
+		"no file": {},
+		"user file": {
+			existing: "user data",
+			err:      "file /home/wendy/.tool/creds already exists: refusing to overwrite it, since FailIfExists is set",
+		},
+		"left over from previous run": {
+			existing: "tok_EXAMPLE",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fsys := plugintest.NewMemoryFileSystem()
+			assert.NoError(t, fsys.MkdirAll("/home/wendy/.tool", 0755))
+			if c.existing != "" {
+				assert.NoError(t, fsys.WriteFile("/home/wendy/.tool/creds", []byte(c.existing), 0600))
+			}
+
+			provisioner := TempFile(FieldAsFile("Token"), AtFixedPath("/home/wendy/.tool/creds"), FailIfExists())
+			out := sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			}
+			provisioner.Provision(context.Background(), sdk.ProvisionInput{
+				TempDir:    "/tmp",
+				FileSystem: fsys,
+				ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+			}, &out)
+
+			if c.err == "" {
+				assert.Empty(t, out.Diagnostics.Errors)
+				if c.existing == "" {
+					assert.Contains(t, out.Files, "/home/wendy/.tool/creds")
+				} else {
+					// The left-over file already has the right contents, so it's not rewritten.
+					assert.Empty(t, out.Files)
+				}
+			} else {
+				assert.Equal(t, []sdk.Error{{Message: c.err}}, out.Diagnostics.Errors)
+				assert.Empty(t, out.Files)
+			}
+		})
+	}
+}
+
+func TestRelativeArgPath(t *testing.T) {
+	files := map[string]sdk.OutputFile{
+		"/tmp/config": {Contents: []byte("hunter2"), Mode: 0600},
+	}
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), Filename("config"), AddArgs("--config", "{{ .Path }}"), RelativeArgPath("/tmp")), map[string]plugintest.ProvisionCase{
+		"in base dir": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				CommandLine: []string{"--config", "config"},
+				Files:       files,
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), Filename("config"), AddArgs("--config={{ .Path }}"), RelativeArgPath("/")), map[string]plugintest.ProvisionCase{
+		"in subdirectory of base dir": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				CommandLine: []string{"--config=tmp/config"},
+				Files:       files,
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), Filename("config"), AddArgs("--config", "{{ .Path }}"), RelativeArgPath("~/project")), map[string]plugintest.ProvisionCase{
+		"outside of base dir": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				CommandLine: []string{"--config", "/tmp/config"},
+				Files:       files,
+				Diagnostics: sdk.Diagnostics{
+					Warnings: []sdk.Warning{{Message: "the file /tmp/config is not located in ~/project, so its absolute path is passed as an arg instead of a relative one"}},
+				},
+			},
+		},
+	})
+}
+
+func TestFilenameFromField(t *testing.T) {
+	provisioner := TempFile(FieldAsFile("Token"), FilenameFromField("Account", "%s.json"), SetPathAsEnvVar("TOOL_CONFIG"))
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"default": {
+			ItemFields: map[sdk.FieldName]string{"Account": "acme-prod", "Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{"TOOL_CONFIG": "/tmp/acme-prod.json"},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/acme-prod.json": {Contents: []byte("hunter2"), Mode: 0600},
+				},
+			},
+		},
+		"sanitizes separators": {
+			ItemFields: map[sdk.FieldName]string{"Account": "../../.ssh/id_rsa", "Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{"TOOL_CONFIG": "/tmp/_.._.ssh_id_rsa.json"},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/_.._.ssh_id_rsa.json": {Contents: []byte("hunter2"), Mode: 0600},
+				},
+			},
+		},
+		"sanitizes illegal characters": {
+			ItemFields: map[sdk.FieldName]string{"Account": `acme:prod\eu?`, "Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{"TOOL_CONFIG": "/tmp/acme_prod_eu_.json"},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/acme_prod_eu_.json": {Contents: []byte("hunter2"), Mode: 0600},
+				},
+			},
+		},
+		"parent dir": {
+			ItemFields: map[sdk.FieldName]string{"Account": "..", "Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "the value of field 'Account' can't be used as a filename"}}},
+			},
+		},
+		"field missing": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "no value present in the item for field 'Account'"}}},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), FilenameFromField("Account", "config")), map[string]plugintest.ProvisionCase{
+		"invalid format": {
+			ItemFields: map[sdk.FieldName]string{"Account": "acme-prod", "Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "invalid filename format 'config': it has to contain %s exactly once"}}},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), FilenameFromField("Account", "%s.json"), WithSecureDelete()), map[string]plugintest.ProvisionCase{
+		"secure delete": {
+			ItemFields: map[sdk.FieldName]string{"Account": "acme-prod", "Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "FilenameFromField can't be combined with WithSecureDelete or WithNoCleanup"}}},
+			},
+		},
+	})
+}
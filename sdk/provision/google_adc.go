@@ -0,0 +1,106 @@
+package provision
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// googleServiceAccountType is the value of the "type" key in a Google service account key file.
+const googleServiceAccountType = "service_account"
+
+// GoogleADC returns a file provisioner that writes a Google service account key as a JSON file and sets
+// GOOGLE_APPLICATION_CREDENTIALS to its path, which is where Google's client libraries and tools look for
+// Application Default Credentials. The key can either be taken whole from a field, e.g. FieldAsFile("Credentials"),
+// or assembled from multiple fields using GoogleServiceAccountKeyFromFields. The key is validated before it gets
+// written, see GoogleServiceAccountKey. The same options as for TempFile can be used to change where the file is
+// stored or how its path is passed to the executable.
+func GoogleADC(key ItemToFileContents, opts ...FileOption) sdk.Provisioner {
+	defaults := []FileOption{
+		FileExtension("json"),
+		SetPathAsEnvVar("GOOGLE_APPLICATION_CREDENTIALS"),
+	}
+	return TempFile(GoogleServiceAccountKey(key), append(defaults, opts...)...)
+}
+
+// GoogleServiceAccountKey can be used to validate that the file contents are a Google service account key: a JSON
+// object with "type" set to "service_account", a "client_email", and a PEM-encoded "private_key". Provisioning fails
+// with an error that doesn't contain the key if it's invalid, so that the executable doesn't fail in a more obscure
+// way later on.
+func GoogleServiceAccountKey(key ItemToFileContents) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		contents, err := key(in)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateGoogleServiceAccountKey(contents)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Google service account key: %w", err)
+		}
+		return contents, nil
+	})
+}
+
+// GoogleServiceAccountKeyFromFields can be used to assemble a Google service account key from multiple fields. The
+// mapping specifies the key in the JSON object of each field, e.g. "client_email" or "private_key", like for
+// FieldsAsJSON. The "type" key is set to "service_account" if the mapping doesn't contain it.
+func GoogleServiceAccountKeyFromFields(mapping map[string]sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		contents, err := FieldsAsJSON(mapping)(in)
+		if err != nil {
+			return nil, err
+		}
+
+		var key map[string]any
+		err = json.Unmarshal(contents, &key)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := key["type"]; !ok {
+			key["type"] = googleServiceAccountType
+		}
+		return json.MarshalIndent(key, "", "  ")
+	})
+}
+
+// validateGoogleServiceAccountKey checks that the contents contain the keys that are required to authenticate as a
+// service account. The errors never contain any values.
+func validateGoogleServiceAccountKey(contents []byte) error {
+	var key struct {
+		Type        *string `json:"type"`
+		ClientEmail *string `json:"client_email"`
+		PrivateKey  *string `json:"private_key"`
+	}
+	if err := json.Unmarshal(contents, &key); err != nil {
+		return errors.New("not a JSON object")
+	}
+
+	var missing []string
+	for _, required := range []struct {
+		name  string
+		value *string
+	}{
+		{name: "type", value: key.Type},
+		{name: "client_email", value: key.ClientEmail},
+		{name: "private_key", value: key.PrivateKey},
+	} {
+		if required.value == nil || *required.value == "" {
+			missing = append(missing, required.name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("missing %s", strings.Join(missing, ", "))
+	}
+
+	if *key.Type != googleServiceAccountType {
+		return fmt.Errorf("expected type '%s'", googleServiceAccountType)
+	}
+	if !strings.Contains(*key.PrivateKey, "-----BEGIN") {
+		return errors.New("private_key is not PEM-encoded")
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package provision
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// secretReferencePrefix is the scheme that secret references start with.
+const secretReferencePrefix = "op://"
+
+// FieldFromItem can be used to store the value of a field of another item than the one being provisioned as a file,
+// for values that are shared across items, such as a company-wide CA certificate or an organization token. The item is
+// referenced by a secret reference of the form "op://<vault>/<item>", e.g.
+// FieldFromItem("op://Shared/Company CA", "certificate").
+//
+// The reference is resolved on every run with the access of the user that invokes the executable, using
+// ProvisionInput.ResolveReference. Contents that contain the value of a referenced item are never stored by
+// WithContentsCache, so that they can't be reused by a user who doesn't have access to the referenced item.
+func FieldFromItem(ref string, fieldName sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		if err := validateItemReference(ref); err != nil {
+			return nil, err
+		}
+		if fieldName == "" || strings.Contains(fieldName.String(), "/") {
+			return nil, fmt.Errorf("invalid field name '%s' for referenced item %s", fieldName, ref)
+		}
+		if in.ResolveReference == nil {
+			return nil, fmt.Errorf("can't resolve %s: referencing other items is not supported by this version of the 1Password CLI", ref)
+		}
+
+		value, err := in.ResolveReference(strings.TrimSuffix(ref, "/") + "/" + fieldName.String())
+		switch {
+		case errors.Is(err, sdk.ErrReferencedItemNotFound):
+			return nil, fmt.Errorf("the referenced item %s doesn't exist or you don't have access to it", ref)
+		case errors.Is(err, sdk.ErrReferencedFieldNotFound):
+			return nil, fmt.Errorf("no value present in the referenced item %s for field '%s'", ref, fieldName)
+		case err != nil:
+			return nil, fmt.Errorf("resolving field '%s' of %s: %w", fieldName, ref, err)
+		}
+		return []byte(value), nil
+	})
+}
+
+// validateItemReference returns an error if the reference doesn't have the form "op://<vault>/<item>".
+func validateItemReference(ref string) error {
+	segments := strings.Split(strings.TrimSuffix(strings.TrimPrefix(ref, secretReferencePrefix), "/"), "/")
+	if !strings.HasPrefix(ref, secretReferencePrefix) || len(segments) != 2 || segments[0] == "" || segments[1] == "" {
+		return fmt.Errorf("invalid item reference '%s': expected the form %s<vault>/<item>", ref, secretReferencePrefix)
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFieldFromItem(t *testing.T) {
+	resolve := func(ref string) (string, error) {
+		switch ref {
+		case "op://Shared/Company CA/certificate":
+			return "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n", nil
+		case "op://Shared/Company CA/key":
+			return "", fmt.Errorf("%w: %s", sdk.ErrReferencedFieldNotFound, ref)
+		case "op://Shared/Offline/certificate":
+			return "", errors.New("connection refused")
+		default:
+			return "", fmt.Errorf("%w: %s", sdk.ErrReferencedItemNotFound, ref)
+		}
+	}
+
+	for description, scenario := range map[string]struct {
+		ref           string
+		fieldName     sdk.FieldName
+		resolve       func(string) (string, error)
+		expected      string
+		expectedError string
+	}{
+		"resolves field": {
+			ref:       "op://Shared/Company CA",
+			fieldName: "certificate",
+			resolve:   resolve,
+			expected:  "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+		},
+		"trailing slash": {
+			ref:       "op://Shared/Company CA/",
+			fieldName: "certificate",
+			resolve:   resolve,
+			expected:  "-----BEGIN CERTIFICATE-----\nMIIB\n-----END CERTIFICATE-----\n",
+		},
+		"item not found": {
+			ref:           "op://Shared/Missing",
+			fieldName:     "certificate",
+			resolve:       resolve,
+			expectedError: "the referenced item op://Shared/Missing doesn't exist or you don't have access to it",
+		},
+		"field not found": {
+			ref:           "op://Shared/Company CA",
+			fieldName:     "key",
+			resolve:       resolve,
+			expectedError: "no value present in the referenced item op://Shared/Company CA for field 'key'",
+		},
+		"resolver fails": {
+			ref:           "op://Shared/Offline",
+			fieldName:     "certificate",
+			resolve:       resolve,
+			expectedError: "resolving field 'certificate' of op://Shared/Offline: connection refused",
+		},
+		"resolving not supported": {
+			ref:           "op://Shared/Company CA",
+			fieldName:     "certificate",
+			expectedError: "can't resolve op://Shared/Company CA: referencing other items is not supported by this version of the 1Password CLI",
+		},
+		"reference includes field": {
+			ref:           "op://Shared/Company CA/certificate",
+			fieldName:     "certificate",
+			resolve:       resolve,
+			expectedError: "invalid item reference 'op://Shared/Company CA/certificate': expected the form op://<vault>/<item>",
+		},
+		"not a secret reference": {
+			ref:           "Shared/Company CA",
+			fieldName:     "certificate",
+			resolve:       resolve,
+			expectedError: "invalid item reference 'Shared/Company CA': expected the form op://<vault>/<item>",
+		},
+		"invalid field name": {
+			ref:           "op://Shared/Company CA",
+			fieldName:     "section/certificate",
+			resolve:       resolve,
+			expectedError: "invalid field name 'section/certificate' for referenced item op://Shared/Company CA",
+		},
+	} {
+		t.Run(description, func(t *testing.T) {
+			contents, err := FieldFromItem(scenario.ref, scenario.fieldName)(sdk.ProvisionInput{
+				ResolveReference: scenario.resolve,
+			})
+			if scenario.expectedError != "" {
+				assert.EqualError(t, err, scenario.expectedError)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, scenario.expected, string(contents))
+		})
+	}
+}
+
+func TestFieldFromItemIsNotCached(t *testing.T) {
+	calls := 0
+	provisioner := TempFile(FieldFromItem("op://Shared/Company CA", "certificate"), Filename("ca.pem"), WithContentsCache("ca", time.Hour))
+
+	for i := 0; i < 2; i++ {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		provisioner.Provision(context.Background(), sdk.ProvisionInput{
+			TempDir:    "/tmp",
+			FileSystem: plugintest.NewMemoryFileSystem(),
+			ResolveReference: func(ref string) (string, error) {
+				calls++
+				return "-----BEGIN CERTIFICATE-----\n", nil
+			},
+		}, &out)
+
+		assert.Empty(t, out.Diagnostics.Errors)
+		assert.Equal(t, []byte("-----BEGIN CERTIFICATE-----\n"), out.Files["/tmp/ca.pem"].Contents)
+		assert.Empty(t, out.Cache.Puts, "values of referenced items must not be cached")
+	}
+	assert.Equal(t, 2, calls)
+}
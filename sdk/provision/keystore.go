@@ -0,0 +1,127 @@
+package provision
+
+import (
+	"crypto"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// KeystoreFormat is the file format of a keystore.
+type KeystoreFormat string
+
+const (
+	// KeystorePKCS12 is the PKCS#12 format, which is the default keystore format since Java 9 and is also supported
+	// by OpenSSL.
+	KeystorePKCS12 KeystoreFormat = "pkcs12"
+
+	// KeystoreJKS is the proprietary Java KeyStore format. Writing it is not supported, since Java has been able to
+	// load PKCS#12 keystores for a long time, so use KeystorePKCS12 instead.
+	KeystoreJKS KeystoreFormat = "jks"
+)
+
+// keystoreAlias is the alias of the entry in the keystore.
+const keystoreAlias = "1"
+
+// Keystore returns a file provisioner that builds a keystore from the PEM-encoded certificate and private key in the
+// item, protected by the password in the password field, for Java-based executables that can't load PEM files. See
+// KeystoreContents for how the keystore is built. If passwordEnvVar is not empty, it gets set to the password. The
+// same options as for TempFile can be used to pass the path of the keystore to the executable, for example
+// SetPathAsEnvVar.
+func Keystore(certField sdk.FieldName, keyField sdk.FieldName, passwordField sdk.FieldName, format KeystoreFormat, passwordEnvVar string, opts ...FileOption) sdk.Provisioner {
+	file := TempFile(KeystoreContents(certField, keyField, passwordField, format), append([]FileOption{FileExtension("p12")}, opts...)...)
+	if passwordEnvVar == "" {
+		return file
+	}
+	return Composite(file, EnvVars(map[string]sdk.FieldName{passwordEnvVar: passwordField}))
+}
+
+// KeystoreContents can be used to store a certificate and its private key as a keystore in the specified format,
+// protected by the password in the password field. The certificate field can contain a chain of multiple
+// certificates, with the leaf certificate first. The key can be an RSA, ECDSA, or Ed25519 key in the PKCS#1, PKCS#8,
+// or SEC 1 format. Provisioning fails if the key doesn't belong to the leaf certificate. Only the PKCS#12 format is
+// supported. The entry in the keystore has the alias "1".
+func KeystoreContents(certField sdk.FieldName, keyField sdk.FieldName, passwordField sdk.FieldName, format KeystoreFormat) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		if format != KeystorePKCS12 {
+			return nil, fmt.Errorf("unsupported keystore format '%s', only '%s' is supported", format, KeystorePKCS12)
+		}
+
+		values := make(map[sdk.FieldName]string)
+		for _, fieldName := range []sdk.FieldName{certField, keyField, passwordField} {
+			value, ok := in.ItemFields[fieldName]
+			if !ok {
+				return nil, fmt.Errorf("no value present in the item for field '%s'", fieldName)
+			}
+			values[fieldName] = value
+		}
+
+		chain, err := parseCertificateChain(values[certField])
+		if err != nil {
+			return nil, fmt.Errorf("value of field '%s' is not a valid certificate: %w", certField, err)
+		}
+
+		key, err := parsePrivateKey(values[keyField])
+		if err != nil {
+			return nil, fmt.Errorf("value of field '%s' is not a valid private key: %w", keyField, err)
+		}
+
+		publicKey, ok := key.Public().(interface{ Equal(crypto.PublicKey) bool })
+		if !ok || !publicKey.Equal(chain[0].PublicKey) {
+			return nil, fmt.Errorf("the private key in field '%s' doesn't belong to the certificate in field '%s'", keyField, certField)
+		}
+
+		return encodePKCS12(key, chain, values[passwordField], keystoreAlias)
+	})
+}
+
+// parseCertificateChain parses all PEM-encoded certificates in the value.
+func parseCertificateChain(value string) ([]*x509.Certificate, error) {
+	blocks, err := pemBlocks(value, "CERTIFICATE")
+	if err != nil {
+		return nil, err
+	}
+
+	var chain []*x509.Certificate
+	for block, rest := pem.Decode(blocks); block != nil; block, rest = pem.Decode(rest) {
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cert)
+	}
+	return chain, nil
+}
+
+// parsePrivateKey parses a PEM-encoded private key in the PKCS#1, PKCS#8, or SEC 1 format.
+func parsePrivateKey(value string) (crypto.Signer, error) {
+	blocks, err := pemBlocks(value, "PRIVATE KEY")
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(blocks)
+	var key any
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported %s block", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("unsupported key type")
+	}
+	return signer, nil
+}
@@ -0,0 +1,195 @@
+package provision
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"encoding/hex"
+	"encoding/pem"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeystore(t *testing.T) {
+	cert, key := generateTestCertificate(t)
+	_, otherKey := generateTestCertificate(t)
+
+	provisioner := Keystore("Certificate", "Private Key", "Password", KeystorePKCS12, "KEYSTORE_PASSWORD", SetPathAsEnvVar("KEYSTORE"))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		FileSystem: plugintest.NewMemoryFileSystem(),
+		ItemFields: map[sdk.FieldName]string{
+			"Certificate": cert,
+			"Private Key": key,
+			"Password":    "hunter2",
+		},
+	}, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+
+	path := out.Environment["KEYSTORE"]
+	assert.Regexp(t, `^/tmp/[a-z0-9]+\.p12$`, path)
+	assert.Equal(t, "hunter2", out.Environment["KEYSTORE_PASSWORD"])
+	require.Contains(t, out.Files, path)
+
+	decodedCert, decodedKey := decodeTestPKCS12(t, out.Files[path].Contents, "hunter2")
+	certBlock, _ := pem.Decode([]byte(cert))
+	assert.Equal(t, certBlock.Bytes, decodedCert)
+	keyBlock, _ := pem.Decode([]byte(key))
+	assert.Equal(t, keyBlock.Bytes, decodedKey)
+
+	for name, c := range map[string]struct {
+		fields map[sdk.FieldName]string
+		format KeystoreFormat
+		err    string
+	}{
+		"key doesn't match certificate": {
+			fields: map[sdk.FieldName]string{"Certificate": cert, "Private Key": otherKey, "Password": "hunter2"},
+			format: KeystorePKCS12,
+			err:    "the private key in field 'Private Key' doesn't belong to the certificate in field 'Certificate'",
+		},
+		"invalid certificate": {
+			fields: map[sdk.FieldName]string{"Certificate": key, "Private Key": key, "Password": "hunter2"},
+			format: KeystorePKCS12,
+			err:    "value of field 'Certificate' is not a valid certificate: expected a CERTIFICATE block, but found a PRIVATE KEY block",
+		},
+		"missing password": {
+			fields: map[sdk.FieldName]string{"Certificate": cert, "Private Key": key},
+			format: KeystorePKCS12,
+			err:    "no value present in the item for field 'Password'",
+		},
+		"JKS": {
+			fields: map[sdk.FieldName]string{"Certificate": cert, "Private Key": key, "Password": "hunter2"},
+			format: KeystoreJKS,
+			err:    "unsupported keystore format 'jks', only 'pkcs12' is supported",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := KeystoreContents("Certificate", "Private Key", "Password", c.format)(sdk.ProvisionInput{ItemFields: c.fields})
+			assert.EqualError(t, err, c.err)
+		})
+	}
+}
+
+func TestPKCS12KeyDerivation(t *testing.T) {
+	// The expected values are the output of "openssl kdf" for the same parameters.
+	assert.Equal(t,
+		"c6f16b6898729e518e0ae65f5a88faabef67170e0141f8e75569236c902f46e6497a398619a9e8ac7c6bb802b26d9ee0c5ce1258e723d96d80302efe876a3f66",
+		hex.EncodeToString(pkcs12KDF(sha256.New, []byte("passwd"), []byte("salt"), 3, 1000, 64)),
+	)
+	assert.Equal(t,
+		"fa9c158e678bfe94189b0b1a707a0921672fdc9f11fa978805969df312c2c8ef2c981020be9fda5485f3a5aa6b65e6b9941fca9df03878b1ff7283d685f50679",
+		hex.EncodeToString(pbkdf2SHA256([]byte("passwd"), []byte("salt"), 1000, 64)),
+	)
+}
+
+// generateTestCertificate returns a PEM-encoded self-signed certificate and its PKCS#8 private key.
+func generateTestCertificate(t *testing.T) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "example.com"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	require.NoError(t, err)
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert})),
+		string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}))
+}
+
+// decodeTestPKCS12 verifies the MAC of a PKCS#12 file written by encodePKCS12, and returns the DER-encoded
+// certificate and PKCS#8 private key in it.
+func decodeTestPKCS12(t *testing.T, p12 []byte, password string) (cert []byte, key []byte) {
+	var pfx pkcs12PFX
+	_, err := asn1.Unmarshal(p12, &pfx)
+	require.NoError(t, err)
+	assert.Equal(t, 3, pfx.Version)
+
+	var authSafeContents []byte
+	_, err = asn1.Unmarshal(pfx.AuthSafe.Content.Bytes, &authSafeContents)
+	require.NoError(t, err)
+
+	macKey := pkcs12KDF(sha256.New, bmpPassword(password), pfx.MacData.MacSalt, 3, pfx.MacData.Iterations, sha256.Size)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(authSafeContents)
+	assert.Equal(t, mac.Sum(nil), pfx.MacData.Mac.Digest, "MAC doesn't match")
+
+	var authSafe []pkcs12ContentInfo
+	_, err = asn1.Unmarshal(authSafeContents, &authSafe)
+	require.NoError(t, err)
+
+	for _, contentInfo := range authSafe {
+		var safeContents []byte
+		_, err = asn1.Unmarshal(contentInfo.Content.Bytes, &safeContents)
+		require.NoError(t, err)
+		var bags []pkcs12SafeBag
+		_, err = asn1.Unmarshal(safeContents, &bags)
+		require.NoError(t, err)
+
+		for _, bag := range bags {
+			switch {
+			case bag.ID.Equal(oidCertBag):
+				var certBag pkcs12CertBag
+				_, err = asn1.Unmarshal(bag.Value.Bytes, &certBag)
+				require.NoError(t, err)
+				_, err = asn1.Unmarshal(certBag.Data.Bytes, &cert)
+				require.NoError(t, err)
+			case bag.ID.Equal(oidPKCS8ShroudedKeyBag):
+				key = decryptTestKeyBag(t, bag.Value.Bytes, password)
+			}
+			assert.Len(t, bag.Attributes, 2)
+		}
+	}
+	return cert, key
+}
+
+func decryptTestKeyBag(t *testing.T, bag []byte, password string) []byte {
+	var info pkcs12EncryptedPrivateKeyInfo
+	_, err := asn1.Unmarshal(bag, &info)
+	require.NoError(t, err)
+	var params pkcs12PBES2Params
+	_, err = asn1.Unmarshal(info.Algorithm.Parameters.FullBytes, &params)
+	require.NoError(t, err)
+	var kdfParams pkcs12PBKDF2Params
+	_, err = asn1.Unmarshal(params.KeyDerivationFunc.Parameters.FullBytes, &kdfParams)
+	require.NoError(t, err)
+	var iv []byte
+	_, err = asn1.Unmarshal(params.EncryptionScheme.Parameters.FullBytes, &iv)
+	require.NoError(t, err)
+
+	block, err := aes.NewCipher(pbkdf2SHA256([]byte(password), kdfParams.Salt, kdfParams.Iterations, 32))
+	require.NoError(t, err)
+	decrypted := make([]byte, len(info.Data))
+	cipher.NewCBCDecrypter(block, iv).CryptBlocks(decrypted, info.Data)
+	decrypted = decrypted[:len(decrypted)-int(decrypted[len(decrypted)-1])]
+
+	parsed, err := x509.ParsePKCS8PrivateKey(decrypted)
+	require.NoError(t, err)
+	_, ok := parsed.(crypto.Signer)
+	assert.True(t, ok)
+	return decrypted
+}
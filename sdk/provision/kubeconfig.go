@@ -0,0 +1,120 @@
+package provision
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"gopkg.in/yaml.v3"
+)
+
+// kubeconfigName is the name of the cluster, user, and context in the generated kubeconfig.
+const kubeconfigName = "1password"
+
+// KubeconfigFields specifies which fields of the item contain the cluster and the credentials to authenticate with.
+// Either the token field or the client certificate and key fields have to be set.
+type KubeconfigFields struct {
+	// Server is the field containing the URL of the Kubernetes API server.
+	Server sdk.FieldName
+
+	// (Optional) CertificateAuthority is the field containing the certificate authority of the cluster, either
+	// PEM-encoded or base64-encoded PEM.
+	CertificateAuthority sdk.FieldName
+
+	// (Optional) Token is the field containing the bearer token to authenticate with.
+	Token sdk.FieldName
+
+	// (Optional) ClientCertificate and ClientKey are the fields containing the client certificate and key to
+	// authenticate with, either PEM-encoded or base64-encoded PEM.
+	ClientCertificate sdk.FieldName
+	ClientKey         sdk.FieldName
+}
+
+// Kubeconfig returns a file provisioner that writes a kubeconfig for a single cluster and sets KUBECONFIG to its
+// path. The same options as for TempFile can be used to change where the file is stored or how its path is passed
+// to the executable.
+func Kubeconfig(fields KubeconfigFields, opts ...FileOption) sdk.Provisioner {
+	defaults := []FileOption{
+		FileExtension("yaml"),
+		SetPathAsEnvVar("KUBECONFIG"),
+	}
+	return TempFile(KubeconfigContents(fields), append(defaults, opts...)...)
+}
+
+// KubeconfigContents can be used to store the fields as a kubeconfig YAML file. If the item has a value for the
+// token field, token authentication is used. Otherwise, client certificate authentication is used.
+func KubeconfigContents(fields KubeconfigFields) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		server, ok := in.ItemFields[fields.Server]
+		if !ok || server == "" {
+			return nil, fmt.Errorf("no value present in the item for field '%s'", fields.Server)
+		}
+
+		cluster := map[string]any{
+			"server": server,
+		}
+		if ca, ok := in.ItemFields[fields.CertificateAuthority]; ok && fields.CertificateAuthority != "" {
+			data, err := kubeconfigData(ca)
+			if err != nil {
+				return nil, fmt.Errorf("value of field '%s' is not a valid certificate", fields.CertificateAuthority)
+			}
+			cluster["certificate-authority-data"] = data
+		}
+
+		user := map[string]any{}
+		if token, ok := in.ItemFields[fields.Token]; ok && fields.Token != "" {
+			user["token"] = token
+		} else {
+			cert, hasCert := in.ItemFields[fields.ClientCertificate]
+			key, hasKey := in.ItemFields[fields.ClientKey]
+			if fields.ClientCertificate == "" || fields.ClientKey == "" || !hasCert || !hasKey {
+				return nil, errors.New("kubeconfig requires either a token or a client certificate and key")
+			}
+
+			certData, err := kubeconfigData(cert)
+			if err != nil {
+				return nil, fmt.Errorf("value of field '%s' is not a valid certificate", fields.ClientCertificate)
+			}
+			keyData, err := kubeconfigData(key)
+			if err != nil {
+				return nil, fmt.Errorf("value of field '%s' is not a valid key", fields.ClientKey)
+			}
+			user["client-certificate-data"] = certData
+			user["client-key-data"] = keyData
+		}
+
+		return yaml.Marshal(map[string]any{
+			"apiVersion":      "v1",
+			"kind":            "Config",
+			"current-context": kubeconfigName,
+			"clusters": []any{
+				map[string]any{"name": kubeconfigName, "cluster": cluster},
+			},
+			"users": []any{
+				map[string]any{"name": kubeconfigName, "user": user},
+			},
+			"contexts": []any{
+				map[string]any{"name": kubeconfigName, "context": map[string]any{
+					"cluster": kubeconfigName,
+					"user":    kubeconfigName,
+				}},
+			},
+		})
+	})
+}
+
+// kubeconfigData returns the value as the base64-encoded PEM that kubeconfig expects for "*-data" keys. The value can
+// either be PEM-encoded already, or base64-encoded PEM in any of the supported base64 encodings.
+func kubeconfigData(value string) (string, error) {
+	value = strings.TrimSpace(value)
+	if !strings.HasPrefix(value, "-----BEGIN") {
+		decoded, err := decodeBase64(value)
+		if err != nil || !strings.HasPrefix(strings.TrimSpace(string(decoded)), "-----BEGIN") {
+			return "", errors.New("not PEM-encoded")
+		}
+		value = strings.TrimSpace(string(decoded))
+	}
+	return base64.StdEncoding.EncodeToString([]byte(value + "\n")), nil
+}
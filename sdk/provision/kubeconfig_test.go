@@ -0,0 +1,111 @@
+package provision
+
+import (
+	"context"
+	"encoding/base64"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+const testCertificate = "-----BEGIN CERTIFICATE-----\nMIIBEXAMPLE\n-----END CERTIFICATE-----"
+
+func TestKubeconfigContents(t *testing.T) {
+	fields := KubeconfigFields{
+		Server:               "Server",
+		CertificateAuthority: "CA",
+		Token:                "Token",
+		ClientCertificate:    "Certificate",
+		ClientKey:            "Key",
+	}
+	encodedCertificate := base64.StdEncoding.EncodeToString([]byte(testCertificate + "\n"))
+
+	cases := map[string]struct {
+		itemFields map[sdk.FieldName]string
+		user       map[string]any
+		err        bool
+	}{
+		"token": {
+			itemFields: map[sdk.FieldName]string{
+				"Server": "https://k8s.example.com",
+				"CA":     testCertificate,
+				"Token":  "secret",
+			},
+			user: map[string]any{"token": "secret"},
+		},
+		"client certificate": {
+			itemFields: map[sdk.FieldName]string{
+				"Server":      "https://k8s.example.com",
+				"CA":          encodedCertificate,
+				"Certificate": testCertificate,
+				"Key":         base64.RawURLEncoding.EncodeToString([]byte(testCertificate)),
+			},
+			user: map[string]any{
+				"client-certificate-data": encodedCertificate,
+				"client-key-data":         encodedCertificate,
+			},
+		},
+		"no credentials": {
+			itemFields: map[sdk.FieldName]string{
+				"Server": "https://k8s.example.com",
+			},
+			err: true,
+		},
+		"invalid certificate authority": {
+			itemFields: map[sdk.FieldName]string{
+				"Server": "https://k8s.example.com",
+				"CA":     "not a certificate",
+				"Token":  "secret",
+			},
+			err: true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			result, err := KubeconfigContents(fields)(sdk.ProvisionInput{ItemFields: tc.itemFields})
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			var config map[string]any
+			require.NoError(t, yaml.Unmarshal(result, &config))
+			assert.Equal(t, "1password", config["current-context"])
+			assert.Equal(t, []any{map[string]any{
+				"name": "1password",
+				"cluster": map[string]any{
+					"server":                     "https://k8s.example.com",
+					"certificate-authority-data": encodedCertificate,
+				},
+			}}, config["clusters"])
+			assert.Equal(t, []any{map[string]any{"name": "1password", "user": tc.user}}, config["users"])
+		})
+	}
+}
+
+func TestKubeconfig(t *testing.T) {
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	in := sdk.ProvisionInput{
+		TempDir:    "/tmp",
+		FileSystem: plugintest.NewMemoryFileSystem(),
+		ItemFields: map[sdk.FieldName]string{
+			"Server": "https://k8s.example.com",
+			"Token":  "secret",
+		},
+	}
+
+	Kubeconfig(KubeconfigFields{Server: "Server", Token: "Token"}).Provision(context.Background(), in, &out)
+
+	require.Empty(t, out.Diagnostics.Errors)
+	assert.Regexp(t, "^/tmp/[0-9a-f]{32}\\.yaml$", out.Environment["KUBECONFIG"])
+	assert.Contains(t, out.Files, out.Environment["KUBECONFIG"])
+}
@@ -0,0 +1,112 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"sort"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// MultiFileProvisioner provisions multiple secret files at once.
+type MultiFileProvisioner struct {
+	sdk.Provisioner
+
+	files            []FileProvisioner
+	singleFileOption bool
+}
+
+// TempFiles returns a provisioner that provisions multiple files from a single item, which is useful for executables
+// that require several files at once, like a certificate, key, and CA bundle. The keys of the map are the names of the
+// files, which are stored in the temp dir like with Filename. The options are applied to every file, so options that
+// set the path of a single file, such as AtFixedPath, Filename, SetPathAsEnvVar, AddArgs, or BindPathAs, can't be used.
+// Instead, the path of each file is bound to its name, see BindPathAs, and SetOutputDirAsEnvVar can be used to pass
+// the directory that contains all files.
+//
+// Provisioning is atomic: the contents of all files are generated before any file is provisioned, so if any of them
+// fails, no file is provisioned at all. All files are deprovisioned together as well.
+func TempFiles(files map[string]ItemToFileContents, opts ...FileOption) sdk.Provisioner {
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p := MultiFileProvisioner{}
+	for _, name := range names {
+		file := FileProvisioner{
+			fileContents: files[name],
+			fileMode:     defaultFileMode,
+		}
+		for _, opt := range opts {
+			opt(&file)
+		}
+		if file.outpathFixed != "" || file.outfileName != "" || file.filenameField != "" || len(file.outpathEnvVars) > 0 ||
+			file.setOutpathAsArg || file.pathKey != "" || file.appendToFile || file.symlinkPath != "" || len(file.replacements) > 0 {
+			p.singleFileOption = true
+		}
+
+		file.outfileName = name
+		file.pathKey = name
+		if file.cacheKey != "" {
+			// Every file needs its own cache entry.
+			file.cacheKey += "/" + name
+		}
+		p.files = append(p.files, file)
+	}
+	return p
+}
+
+func (p MultiFileProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	if p.singleFileOption {
+		out.AddError(fmt.Errorf("options that set the path of a single file can't be used with multiple files, use the paths bound to the names of the files instead"))
+		return
+	}
+
+	// Generate the contents of all files first, so that no file gets provisioned if any of them fails.
+	scratch := newScratchOutput(out)
+	files := make([]FileProvisioner, len(p.files))
+	for i, file := range p.files {
+		if err := file.validateOptions(); err != nil {
+			out.AddError(err)
+			return
+		}
+
+		contents, err := file.contents(ctx, in, scratch)
+		if err != nil {
+			out.AddError(err)
+			return
+		}
+
+		file.fileContents = func(sdk.ProvisionInput) ([]byte, error) { return contents, nil }
+		file.cacheKey = ""
+		file.retryAttempts = 0
+		files[i] = file
+	}
+
+	for i, file := range files {
+		file.Provision(ctx, in, scratch)
+		if len(scratch.Diagnostics.Errors) > 0 {
+			// Only report the errors, so that no partial set of files gets written.
+			out.Diagnostics.Errors = append(out.Diagnostics.Errors, scratch.Diagnostics.Errors...)
+			provisioned := make([]sdk.Provisioner, i)
+			for j := range provisioned {
+				provisioned[j] = files[j]
+			}
+			rollback(ctx, provisioned, in, out)
+			return
+		}
+	}
+
+	applyScratchOutput(out, scratch)
+}
+
+func (p MultiFileProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	for i := len(p.files) - 1; i >= 0; i-- {
+		p.files[i].Deprovision(ctx, in, out)
+	}
+}
+
+func (p MultiFileProvisioner) Description() string {
+	return fmt.Sprintf("Provision %d secret files", len(p.files))
+}
@@ -0,0 +1,138 @@
+package provision
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTempFiles(t *testing.T) {
+	provisioner := TempFiles(map[string]ItemToFileContents{
+		"cert.pem": FieldAsFile("Certificate"),
+		"key.pem":  FieldAsFile("Private Key"),
+	}, SetOutputDirAsEnvVar("TLS_DIR"))
+
+	plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+		"all fields present": {
+			ItemFields: map[sdk.FieldName]string{
+				"Certificate": "cert",
+				"Private Key": "key",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"TLS_DIR": "/tmp",
+				},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/cert.pem": {Contents: []byte("cert"), Mode: 0600},
+					"/tmp/key.pem":  {Contents: []byte("key"), Mode: 0600},
+				},
+				Paths: map[string]string{
+					"cert.pem": "/tmp/cert.pem",
+					"key.pem":  "/tmp/key.pem",
+				},
+			},
+		},
+		"one field missing": {
+			ItemFields: map[sdk.FieldName]string{
+				"Certificate": "cert",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "no value present in the item for field 'Private Key'"}},
+				},
+			},
+		},
+	})
+}
+
+type warningProvisioner struct {
+	sdk.Provisioner
+}
+
+func (p warningProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{Message: "the token expires soon"})
+}
+
+func (p warningProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+}
+
+func (p warningProvisioner) Description() string {
+	return "warn"
+}
+
+func TestTempFilesKeepsWarnings(t *testing.T) {
+	provisioner := Composite(warningProvisioner{}, TempFiles(map[string]ItemToFileContents{"token": FieldAsFile("Token")}))
+	result := plugintest.RunProvision(t, provisioner, map[sdk.FieldName]string{"Token": "hunter2"})
+	plugintest.AssertNoErrors(t, result)
+	assert.Equal(t, []sdk.Warning{{Message: "the token expires soon"}}, result.Output.Diagnostics.Warnings)
+}
+
+func TestTempFilesGeneratesAllContentsFirst(t *testing.T) {
+	var events []string
+	file := func(name string, fail bool) ItemToFileContents {
+		return func(in sdk.ProvisionInput) ([]byte, error) {
+			events = append(events, "generate "+name)
+			if fail {
+				return nil, assert.AnError
+			}
+			return []byte(name), nil
+		}
+	}
+	provisioner := TempFiles(map[string]ItemToFileContents{
+		"a": file("a", false),
+		"b": file("b", true),
+		"c": file("c", false),
+	})
+
+	result := plugintest.RunProvision(t, provisioner, nil)
+	assert.Equal(t, []string{assert.AnError.Error()}, result.Errors)
+	assert.Empty(t, result.Output.Files)
+	assert.Empty(t, result.Output.Log, "no file should have been provisioned")
+	assert.Equal(t, []string{"generate a", "generate b"}, events)
+}
+
+func TestTempFilesRejectsSingleFileOptions(t *testing.T) {
+	provisioner := TempFiles(map[string]ItemToFileContents{
+		"cert.pem": FieldAsFile("Certificate"),
+		"key.pem":  FieldAsFile("Private Key"),
+	}, SetPathAsEnvVar("CERT_FILE"))
+
+	result := plugintest.RunProvision(t, provisioner, map[sdk.FieldName]string{"Certificate": "cert", "Private Key": "key"})
+	assert.Equal(t, []string{"options that set the path of a single file can't be used with multiple files, use the paths bound to the names of the files instead"}, result.Errors)
+}
+
+func TestTempFilesDeprovisionsAllFiles(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	provisioner := TempFiles(map[string]ItemToFileContents{
+		"cert.pem": FieldAsFile("Certificate"),
+		"key.pem":  FieldAsFile("Private Key"),
+	}, WithSecureDelete())
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    "/tmp/op-test",
+		FileSystem: fsys,
+		ItemFields: map[sdk.FieldName]string{"Certificate": "cert", "Private Key": "key"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	// Writing the files is taken care of by the CLI.
+	for path, file := range out.Files {
+		assert.NoError(t, fsys.WriteFile(path, file.Contents, 0600))
+	}
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp/op-test", FileSystem: fsys}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+	for path := range out.Files {
+		_, err := fsys.Stat(path)
+		assert.Truef(t, os.IsNotExist(err), "%s should have been removed", path)
+	}
+}
@@ -0,0 +1,23 @@
+//go:build !windows
+
+package provision
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+func mkfifo(path string) error {
+	return syscall.Mkfifo(path, uint32(defaultFileMode))
+}
+
+// openPipeForWriting opens the named pipe for writing without blocking. It returns a nil file if the pipe has not
+// been opened for reading yet.
+func openPipeForWriting(path string) (*os.File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+	if errors.Is(err, syscall.ENXIO) {
+		return nil, nil
+	}
+	return f, err
+}
@@ -0,0 +1,193 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// pipeOpenInterval is how often the pipe writer checks whether the executable has opened the pipe for reading.
+const pipeOpenInterval = 20 * time.Millisecond
+
+// NamedPipeProvisioner provisions one or more secrets through a named pipe (FIFO), so that the secret only lives
+// in kernel buffers instead of on disk.
+type NamedPipeProvisioner struct {
+	sdk.Provisioner
+
+	file    FileProvisioner
+	writers *pipeWriters
+}
+
+// NamedPipe returns a provisioner that creates a named pipe in the temp dir and writes the file contents to it once
+// the executable opens the pipe for reading. The contents are written only once. The same options as for TempFile
+// can be used to specify where the pipe is created and how its path is passed to the executable, for example
+// SetPathAsEnvVar or AddArgs. Named pipes are not supported on Windows.
+func NamedPipe(fileContents ItemToFileContents, opts ...FileOption) sdk.Provisioner {
+	file := FileProvisioner{
+		fileContents: fileContents,
+	}
+	for _, opt := range opts {
+		opt(&file)
+	}
+	return NamedPipeProvisioner{
+		file: file,
+		writers: &pipeWriters{
+			byTempDir: make(map[string][]*pipeWriter),
+		},
+	}
+}
+
+func (p NamedPipeProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	if err := p.file.validateOptions(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	contents, err := p.file.contents(ctx, in, out)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	outpath, err := p.file.outpath(in)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindFile,
+			Target: outpath,
+			Size:   len(contents),
+		})
+	} else {
+		err = mkfifo(outpath)
+		if err != nil {
+			out.AddError(fmt.Errorf("creating named pipe: %w", err))
+			return
+		}
+
+		p.writers.start(in.TempDir, outpath, contents)
+		out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindFile, Target: outpath, Mode: os.ModeNamedPipe | defaultFileMode, Size: len(contents)})
+	}
+
+	p.file.provisionOutpath(outpath, in.DryRun, out)
+}
+
+func (p NamedPipeProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	for _, err := range p.writers.stop(in.TempDir) {
+		out.AddError(err)
+	}
+	if p.file.ramDisk != RAMDiskNever {
+		p.file.removeRAMDiskDir(in, out)
+	}
+}
+
+func (p NamedPipeProvisioner) Description() string {
+	return "Provision secret through a named pipe"
+}
+
+// pipeWriters keeps track of the pipe writers that are running for each provisioning run, identified by temp dir,
+// so that they can be stopped during deprovisioning.
+type pipeWriters struct {
+	mu        sync.Mutex
+	byTempDir map[string][]*pipeWriter
+}
+
+type pipeWriter struct {
+	path string
+	stop chan struct{}
+	done chan error
+}
+
+func (w *pipeWriters) start(tempDir string, path string, contents []byte) {
+	writer := &pipeWriter{
+		path: path,
+		stop: make(chan struct{}),
+		done: make(chan error, 1),
+	}
+
+	w.mu.Lock()
+	w.byTempDir[tempDir] = append(w.byTempDir[tempDir], writer)
+	w.mu.Unlock()
+
+	go func() {
+		writer.done <- writer.write(contents)
+	}()
+}
+
+// stop stops all pipe writers for the specified temp dir, regardless of whether the executable read from the
+// pipes, and removes the pipes.
+func (w *pipeWriters) stop(tempDir string) (errs []error) {
+	w.mu.Lock()
+	writers := w.byTempDir[tempDir]
+	delete(w.byTempDir, tempDir)
+	w.mu.Unlock()
+
+	for _, writer := range writers {
+		close(writer.stop)
+		if err := <-writer.done; err != nil {
+			errs = append(errs, fmt.Errorf("writing to named pipe %s: %w", writer.path, err))
+		}
+
+		err := os.Remove(writer.path)
+		if err != nil && !os.IsNotExist(err) {
+			errs = append(errs, fmt.Errorf("removing named pipe %s: %w", writer.path, err))
+		}
+	}
+	return errs
+}
+
+// write waits until the pipe is opened for reading and writes the contents to it, unless it gets stopped first.
+func (w *pipeWriter) write(contents []byte) error {
+	for {
+		f, err := openPipeForWriting(w.path)
+		if err != nil {
+			return err
+		}
+
+		if f != nil {
+			return w.writeOpened(f, contents)
+		}
+
+		select {
+		case <-w.stop:
+			return nil
+		case <-time.After(pipeOpenInterval):
+		}
+	}
+}
+
+// writeOpened writes the contents to the opened pipe. If the writer gets stopped before the executable has read all
+// contents, the write is aborted.
+func (w *pipeWriter) writeOpened(f *os.File, contents []byte) error {
+	written := make(chan struct{})
+	defer close(written)
+	go func() {
+		select {
+		case <-w.stop:
+			_ = f.SetWriteDeadline(time.Now())
+		case <-written:
+		}
+	}()
+
+	_, err := f.Write(contents)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+//go:build !windows
+
+package provision
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNamedPipe(t *testing.T) {
+	tempDir := t.TempDir()
+	provisioner := NamedPipe(FieldAsFile("Token"), Filename("token"), SetPathAsEnvVar("TOKEN_FILE"))
+
+	in := sdk.ProvisionInput{
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Token": "secret"},
+	}
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), in, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+
+	path := filepath.Join(defaultFileDir(t, tempDir), "token")
+	assert.Equal(t, path, out.Environment["TOKEN_FILE"])
+	assert.Empty(t, out.Files)
+
+	info, err := os.Lstat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.ModeNamedPipe, info.Mode().Type())
+
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, "secret", string(contents))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: tempDir}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.NoFileExists(t, path)
+	assert.NoDirExists(t, ramDiskDir(tempDir))
+}
+
+func TestNamedPipeDeprovisionWithoutReader(t *testing.T) {
+	tempDir := t.TempDir()
+	provisioner := NamedPipe(FieldAsFile("Token"), Filename("token"))
+
+	in := sdk.ProvisionInput{
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Token": "secret"},
+	}
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), in, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: tempDir}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.NoDirExists(t, ramDiskDir(tempDir))
+	assert.NoFileExists(t, filepath.Join(tempDir, "token"))
+}
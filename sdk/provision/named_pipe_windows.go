@@ -0,0 +1,16 @@
+package provision
+
+import (
+	"errors"
+	"os"
+)
+
+var errNamedPipesNotSupported = errors.New("named pipes are not supported on Windows")
+
+func mkfifo(path string) error {
+	return errNamedPipesNotSupported
+}
+
+func openPipeForWriting(path string) (*os.File, error) {
+	return nil, errNamedPipesNotSupported
+}
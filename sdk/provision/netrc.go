@@ -0,0 +1,87 @@
+package provision
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// NetrcEntry specifies a single machine entry in a netrc file.
+type NetrcEntry struct {
+	// Machine is the host name that the credentials are used for, e.g. "api.example.com".
+	Machine string
+
+	// Login is the field containing the username.
+	Login sdk.FieldName
+
+	// Password is the field containing the password or token.
+	Password sdk.FieldName
+}
+
+// Netrc returns a file provisioner that writes a netrc file with a single machine entry and sets NETRC to its path,
+// which is read by git, curl, and many other tools. To add the entry to the user's own netrc file instead, use
+// provision.AtFixedPath with provision.AppendToFile. The same options as for TempFile can be used to change where the
+// file is stored or how its path is passed to the executable.
+func Netrc(machine string, loginField sdk.FieldName, passwordField sdk.FieldName, opts ...FileOption) sdk.Provisioner {
+	defaults := []FileOption{
+		SetPathAsEnvVar("NETRC"),
+	}
+	return TempFile(NetrcContents(NetrcEntry{Machine: machine, Login: loginField, Password: passwordField}), append(defaults, opts...)...)
+}
+
+// NetrcContents can be used to store one or more machine entries in netrc format, one entry per line, e.g.
+// "machine api.example.com login wendy password hunter2". Values that contain whitespace or quotes are wrapped in
+// double quotes, with quotes and backslashes escaped. Values that contain line breaks are rejected, since they can't
+// be represented safely.
+func NetrcContents(entries ...NetrcEntry) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		var netrc strings.Builder
+		for _, entry := range entries {
+			machine, err := netrcToken(entry.Machine)
+			if err != nil {
+				return nil, fmt.Errorf("invalid machine name: %w", err)
+			}
+
+			tokens := []string{"machine", machine}
+			for _, field := range []struct {
+				keyword string
+				name    sdk.FieldName
+			}{
+				{keyword: "login", name: entry.Login},
+				{keyword: "password", name: entry.Password},
+			} {
+				value, ok := in.ItemFields[field.name]
+				if !ok {
+					return nil, fmt.Errorf("no value present in the item for field '%s'", field.name)
+				}
+
+				token, err := netrcToken(value)
+				if err != nil {
+					return nil, fmt.Errorf("value of field '%s' %w", field.name, err)
+				}
+				tokens = append(tokens, field.keyword, token)
+			}
+
+			netrc.WriteString(strings.Join(tokens, " "))
+			netrc.WriteString("\n")
+		}
+		return []byte(netrc.String()), nil
+	})
+}
+
+// netrcToken returns the value as a single netrc token, quoting it if necessary.
+func netrcToken(value string) (string, error) {
+	if value == "" {
+		return "", fmt.Errorf("can't be empty")
+	}
+	if strings.ContainsAny(value, "\r\n") {
+		return "", fmt.Errorf("can't contain line breaks")
+	}
+	if !strings.ContainsAny(value, " \t\"\\") {
+		return value, nil
+	}
+
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return `"` + escaped + `"`, nil
+}
@@ -0,0 +1,82 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+)
+
+func TestNetrc(t *testing.T) {
+	plugintest.TestProvisioner(t, Netrc("api.example.com", "Username", "Token", Filename("netrc")), map[string]plugintest.ProvisionCase{
+		"default": {
+			ItemFields: map[sdk.FieldName]string{
+				"Username": "wendy",
+				"Token":    "tok_EXAMPLE",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"NETRC": "/tmp/netrc",
+				},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/netrc": {
+						Contents: []byte("machine api.example.com login wendy password tok_EXAMPLE\n"),
+						Mode:     0600,
+					},
+				},
+			},
+		},
+		"values with spaces and quotes": {
+			ItemFields: map[sdk.FieldName]string{
+				"Username": "wendy appleseed",
+				"Token":    `hunter "2" \o/`,
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Environment: map[string]string{
+					"NETRC": "/tmp/netrc",
+				},
+				Files: map[string]sdk.OutputFile{
+					"/tmp/netrc": {
+						Contents: []byte(`machine api.example.com login "wendy appleseed" password "hunter \"2\" \\o/"` + "\n"),
+						Mode:     0600,
+					},
+				},
+			},
+		},
+		"line break": {
+			ItemFields: map[sdk.FieldName]string{
+				"Username": "wendy",
+				"Token":    "tok_EXAMPLE\nmachine evil.example.com",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "value of field 'Token' can't contain line breaks"}},
+				},
+			},
+		},
+	})
+}
+
+func TestNetrcContentsMultipleEntries(t *testing.T) {
+	contents := NetrcContents(
+		NetrcEntry{Machine: "github.com", Login: "Username", Password: "Token"},
+		NetrcEntry{Machine: "api.github.com", Login: "Username", Password: "Token"},
+	)
+
+	plugintest.TestProvisioner(t, TempFile(contents, Filename("netrc")), map[string]plugintest.ProvisionCase{
+		"multiple entries": {
+			ItemFields: map[sdk.FieldName]string{
+				"Username": "wendy",
+				"Token":    "ghp_EXAMPLE",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Files: map[string]sdk.OutputFile{
+					"/tmp/netrc": {
+						Contents: []byte("machine github.com login wendy password ghp_EXAMPLE\nmachine api.github.com login wendy password ghp_EXAMPLE\n"),
+						Mode:     0600,
+					},
+				},
+			},
+		},
+	})
+}
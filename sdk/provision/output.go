@@ -0,0 +1,99 @@
+package provision
+
+import (
+	"context"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// newScratchOutput returns an empty provision output that starts off with the same command line and stdin as the
+// specified output. Provisioners can be run against it to find out what they would provision, without
+// affecting the actual output.
+func newScratchOutput(out *sdk.ProvisionOutput) *sdk.ProvisionOutput {
+	return &sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		CommandLine: append([]string(nil), out.CommandLine...),
+		Files:       make(map[string]sdk.OutputFile),
+		Stdin:       out.Stdin,
+		Paths:       copyPaths(out.Paths),
+		ArgGroups:   append([]sdk.ArgGroup(nil), out.ArgGroups...),
+		Cache: sdk.CacheOperations{
+			Puts: make(sdk.CacheState),
+		},
+	}
+}
+
+// applyScratchOutput applies everything that got provisioned to the scratch output to the actual output.
+func applyScratchOutput(out *sdk.ProvisionOutput, scratch *sdk.ProvisionOutput) {
+	// The actions have been recorded on the scratch output already, so the fields are set directly.
+	for name, value := range scratch.Environment {
+		out.Environment[name] = value
+		if scratch.IsSensitiveEnvVar(name) {
+			delete(out.NonSensitiveEnvVars, name)
+		} else {
+			if out.NonSensitiveEnvVars == nil {
+				out.NonSensitiveEnvVars = make(map[string]bool)
+			}
+			out.NonSensitiveEnvVars[name] = true
+		}
+	}
+
+	for path, file := range scratch.Files {
+		out.Files[path] = file
+	}
+
+	out.CommandLine = scratch.CommandLine
+	out.ArgGroups = scratch.ArgGroups
+
+	if scratch.Stdin != nil {
+		out.Stdin = scratch.Stdin
+	}
+
+	for key, path := range scratch.Paths {
+		out.BindPath(key, path)
+	}
+
+	if len(scratch.Cache.Puts) > 0 && out.Cache.Puts == nil {
+		out.Cache.Puts = make(sdk.CacheState)
+	}
+	for key, entry := range scratch.Cache.Puts {
+		out.Cache.Puts[key] = entry
+	}
+	out.Cache.Removes = append(out.Cache.Removes, scratch.Cache.Removes...)
+
+	out.Diagnostics.Errors = append(out.Diagnostics.Errors, scratch.Diagnostics.Errors...)
+	out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, scratch.Diagnostics.Warnings...)
+	out.DryRunLog = append(out.DryRunLog, scratch.DryRunLog...)
+	out.Log = append(out.Log, scratch.Log...)
+	out.Actions = append(out.Actions, scratch.Actions...)
+}
+
+// rollback deprovisions the specified provisioners in reverse order, after provisioning failed, and reports what
+// happened while doing so on the provision output.
+func rollback(ctx context.Context, provisioners []sdk.Provisioner, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	rollbackIn := sdk.DeprovisionInput{
+		HomeDir:    in.HomeDir,
+		TempDir:    in.TempDir,
+		DryRun:     in.DryRun,
+		FileSystem: in.FileSystem,
+	}
+	rollbackOut := sdk.DeprovisionOutput{}
+	for i := len(provisioners) - 1; i >= 0; i-- {
+		provisioners[i].Deprovision(ctx, rollbackIn, &rollbackOut)
+	}
+
+	out.Diagnostics.Errors = append(out.Diagnostics.Errors, rollbackOut.Diagnostics.Errors...)
+	out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, rollbackOut.Diagnostics.Warnings...)
+	out.Log = append(out.Log, rollbackOut.Log...)
+}
+
+func copyPaths(paths map[string]string) map[string]string {
+	if paths == nil {
+		return nil
+	}
+	result := make(map[string]string, len(paths))
+	for key, path := range paths {
+		result[key] = path
+	}
+	return result
+}
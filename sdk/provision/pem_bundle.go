@@ -0,0 +1,76 @@
+package provision
+
+import (
+	"bytes"
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// PEMBundle returns a file provisioner that stores a certificate and its private key as a single PEM file, with the
+// certificate first. See PEMBundleContents for how the field values are handled.
+func PEMBundle(certField sdk.FieldName, keyField sdk.FieldName, opts ...FileOption) sdk.Provisioner {
+	return TempFile(PEMBundleContents(certField, keyField), opts...)
+}
+
+// PEMBundleContents can be used to store a certificate and its private key as a single PEM file, with the certificate
+// first. The certificate field can contain a chain of multiple certificates. Values without PEM markers are treated
+// as raw base64-encoded DER and wrapped in "CERTIFICATE" and "PRIVATE KEY" blocks respectively. Every block has to
+// be valid PEM.
+func PEMBundleContents(certField sdk.FieldName, keyField sdk.FieldName) ItemToFileContents {
+	return ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		var bundle []byte
+		for _, field := range []struct {
+			name      sdk.FieldName
+			blockType string
+		}{
+			{name: certField, blockType: "CERTIFICATE"},
+			{name: keyField, blockType: "PRIVATE KEY"},
+		} {
+			value, ok := in.ItemFields[field.name]
+			if !ok {
+				return nil, fmt.Errorf("no value present in the item for field '%s'", field.name)
+			}
+
+			blocks, err := pemBlocks(value, field.blockType)
+			if err != nil {
+				return nil, fmt.Errorf("value of field '%s' is not valid PEM: %w", field.name, err)
+			}
+			bundle = append(bundle, blocks...)
+		}
+		return bundle, nil
+	})
+}
+
+// pemBlocks parses all PEM blocks in the value and encodes them again, which normalizes line endings and wrapping.
+// If the value doesn't contain PEM markers, it's treated as the base64-encoded contents of a single block.
+func pemBlocks(value string, defaultType string) ([]byte, error) {
+	value = strings.TrimSpace(strings.ReplaceAll(value, "\r\n", "\n"))
+	if !strings.Contains(value, "-----BEGIN") {
+		der, err := decodeBase64(strings.Join(strings.Fields(value), ""))
+		if err != nil || len(der) == 0 {
+			return nil, fmt.Errorf("no PEM block found")
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: defaultType, Bytes: der}), nil
+	}
+
+	var result bytes.Buffer
+	rest := []byte(value)
+	for len(bytes.TrimSpace(rest)) > 0 {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return nil, fmt.Errorf("malformed PEM block")
+		}
+		if !strings.HasSuffix(block.Type, defaultType) {
+			return nil, fmt.Errorf("expected a %s block, but found a %s block", defaultType, block.Type)
+		}
+		err := pem.Encode(&result, block)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return result.Bytes(), nil
+}
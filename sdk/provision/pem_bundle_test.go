@@ -0,0 +1,70 @@
+package provision
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"strings"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPEMBundleContents(t *testing.T) {
+	cert := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("certificate")}))
+	intermediate := string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: []byte("intermediate")}))
+	key := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: []byte("key")}))
+
+	cases := map[string]struct {
+		cert     string
+		key      string
+		expected string
+		err      bool
+	}{
+		"PEM": {
+			cert:     cert,
+			key:      key,
+			expected: cert + key,
+		},
+		"chain with CRLF line endings": {
+			cert:     strings.ReplaceAll(cert+intermediate, "\n", "\r\n"),
+			key:      key,
+			expected: cert + intermediate + key,
+		},
+		"raw base64": {
+			cert:     base64.StdEncoding.EncodeToString([]byte("certificate")),
+			key:      base64.StdEncoding.EncodeToString([]byte("key")),
+			expected: cert + string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte("key")})),
+		},
+		"key and certificate swapped": {
+			cert: key,
+			key:  cert,
+			err:  true,
+		},
+		"malformed PEM": {
+			cert: "-----BEGIN CERTIFICATE-----\nnot base64!\n",
+			key:  key,
+			err:  true,
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			in := sdk.ProvisionInput{
+				ItemFields: map[sdk.FieldName]string{
+					"Certificate": tc.cert,
+					"Private Key": tc.key,
+				},
+			}
+
+			result, err := PEMBundleContents("Certificate", "Private Key")(in)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, string(result))
+		})
+	}
+}
@@ -0,0 +1,374 @@
+package provision
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/asn1"
+	"hash"
+	"unicode/utf16"
+)
+
+// pkcs12Iterations is the number of iterations used to derive the encryption key and the MAC key from the password,
+// which is the default of OpenSSL.
+const pkcs12Iterations = 2048
+
+var (
+	oidData                = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 7, 1}
+	oidPKCS8ShroudedKeyBag = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 2}
+	oidCertBag             = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 12, 10, 1, 3}
+	oidX509Certificate     = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 22, 1}
+	oidFriendlyName        = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 20}
+	oidLocalKeyID          = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 9, 21}
+	oidPBES2               = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 13}
+	oidPBKDF2              = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 5, 12}
+	oidHMACWithSHA256      = asn1.ObjectIdentifier{1, 2, 840, 113549, 2, 9}
+	oidAES256CBC           = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 1, 42}
+	oidSHA256              = asn1.ObjectIdentifier{2, 16, 840, 1, 101, 3, 4, 2, 1}
+)
+
+// The ASN.1 structures of a PKCS#12 file, as specified in https://datatracker.ietf.org/doc/html/rfc7292.
+type pkcs12PFX struct {
+	Version  int
+	AuthSafe pkcs12ContentInfo
+	MacData  pkcs12MacData
+}
+
+type pkcs12ContentInfo struct {
+	ContentType asn1.ObjectIdentifier
+	Content     asn1.RawValue
+}
+
+type pkcs12MacData struct {
+	Mac        pkcs12DigestInfo
+	MacSalt    []byte
+	Iterations int
+}
+
+type pkcs12DigestInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Digest    []byte
+}
+
+type pkcs12SafeBag struct {
+	ID         asn1.ObjectIdentifier
+	Value      asn1.RawValue
+	Attributes []pkcs12Attribute `asn1:"set,optional"`
+}
+
+type pkcs12Attribute struct {
+	ID    asn1.ObjectIdentifier
+	Value asn1.RawValue
+}
+
+type pkcs12CertBag struct {
+	ID   asn1.ObjectIdentifier
+	Data asn1.RawValue
+}
+
+type pkcs12EncryptedPrivateKeyInfo struct {
+	Algorithm pkix.AlgorithmIdentifier
+	Data      []byte
+}
+
+type pkcs12PBES2Params struct {
+	KeyDerivationFunc pkix.AlgorithmIdentifier
+	EncryptionScheme  pkix.AlgorithmIdentifier
+}
+
+type pkcs12PBKDF2Params struct {
+	Salt       []byte
+	Iterations int
+	KeyLength  int
+	PRF        pkix.AlgorithmIdentifier
+}
+
+// encodePKCS12 encodes the private key and its certificate chain, with the leaf certificate first, as a PKCS#12
+// file protected by the password. The key is encrypted with AES-256-CBC using a key derived with PBKDF2, and the
+// file is integrity-protected with an HMAC-SHA256, which is what current versions of OpenSSL and Java use by
+// default. The certificates are not encrypted. Both the key and the leaf certificate get the alias as their
+// friendly name, which Java uses as the alias of the keystore entry.
+func encodePKCS12(key any, chain []*x509.Certificate, password string, alias string) ([]byte, error) {
+	localKeyID := sha256.Sum256(chain[0].Raw)
+	attributes, err := pkcs12BagAttributes(alias, localKeyID[:])
+	if err != nil {
+		return nil, err
+	}
+
+	keyBag, err := pkcs12KeyBag(key, password, attributes)
+	if err != nil {
+		return nil, err
+	}
+
+	var certBags []pkcs12SafeBag
+	for i, cert := range chain {
+		certBag, err := pkcs12CertificateBag(cert)
+		if err != nil {
+			return nil, err
+		}
+		if i == 0 {
+			certBag.Attributes = attributes
+		}
+		certBags = append(certBags, certBag)
+	}
+
+	var authSafe []pkcs12ContentInfo
+	for _, bags := range [][]pkcs12SafeBag{certBags, {keyBag}} {
+		safeContents, err := asn1.Marshal(bags)
+		if err != nil {
+			return nil, err
+		}
+		contentInfo, err := pkcs12DataContentInfo(safeContents)
+		if err != nil {
+			return nil, err
+		}
+		authSafe = append(authSafe, contentInfo)
+	}
+
+	authSafeContents, err := asn1.Marshal(authSafe)
+	if err != nil {
+		return nil, err
+	}
+	authSafeInfo, err := pkcs12DataContentInfo(authSafeContents)
+	if err != nil {
+		return nil, err
+	}
+
+	macSalt, err := randomBytes(16)
+	if err != nil {
+		return nil, err
+	}
+	macKey := pkcs12KDF(sha256.New, bmpPassword(password), macSalt, 3, pkcs12Iterations, sha256.Size)
+	mac := hmac.New(sha256.New, macKey)
+	mac.Write(authSafeContents)
+
+	return asn1.Marshal(pkcs12PFX{
+		Version:  3,
+		AuthSafe: authSafeInfo,
+		MacData: pkcs12MacData{
+			Mac: pkcs12DigestInfo{
+				Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidSHA256, Parameters: asn1.NullRawValue},
+				Digest:    mac.Sum(nil),
+			},
+			MacSalt:    macSalt,
+			Iterations: pkcs12Iterations,
+		},
+	})
+}
+
+// pkcs12BagAttributes returns the attributes that link the private key to its certificate.
+func pkcs12BagAttributes(alias string, localKeyID []byte) ([]pkcs12Attribute, error) {
+	encodedAlias := utf16.Encode([]rune(alias))
+	bmpAlias := make([]byte, 0, 2*len(encodedAlias))
+	for _, c := range encodedAlias {
+		bmpAlias = append(bmpAlias, byte(c>>8), byte(c))
+	}
+	friendlyName, err := asn1.Marshal(asn1.RawValue{Tag: asn1.TagBMPString, Bytes: bmpAlias})
+	if err != nil {
+		return nil, err
+	}
+
+	keyID, err := asn1.Marshal(localKeyID)
+	if err != nil {
+		return nil, err
+	}
+
+	return []pkcs12Attribute{
+		{ID: oidFriendlyName, Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: friendlyName}},
+		{ID: oidLocalKeyID, Value: asn1.RawValue{Tag: asn1.TagSet, IsCompound: true, Bytes: keyID}},
+	}, nil
+}
+
+// pkcs12KeyBag returns a bag with the private key encrypted using PBES2.
+func pkcs12KeyBag(key any, password string, attributes []pkcs12Attribute) (pkcs12SafeBag, error) {
+	pkcs8, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+
+	salt, err := randomBytes(16)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	iv, err := randomBytes(aes.BlockSize)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+
+	// PBES2 uses the password as UTF-8, unlike the PKCS#12 key derivation used for the MAC.
+	encryptionKey := pbkdf2SHA256([]byte(password), salt, pkcs12Iterations, 32)
+	block, err := aes.NewCipher(encryptionKey)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	padding := aes.BlockSize - len(pkcs8)%aes.BlockSize
+	encrypted := append(pkcs8, make([]byte, padding)...)
+	for i := len(pkcs8); i < len(encrypted); i++ {
+		encrypted[i] = byte(padding)
+	}
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(encrypted, encrypted)
+
+	pbkdf2Params, err := asn1.Marshal(pkcs12PBKDF2Params{
+		Salt:       salt,
+		Iterations: pkcs12Iterations,
+		KeyLength:  32,
+		PRF:        pkix.AlgorithmIdentifier{Algorithm: oidHMACWithSHA256, Parameters: asn1.NullRawValue},
+	})
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	encodedIV, err := asn1.Marshal(iv)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	pbes2Params, err := asn1.Marshal(pkcs12PBES2Params{
+		KeyDerivationFunc: pkix.AlgorithmIdentifier{Algorithm: oidPBKDF2, Parameters: asn1.RawValue{FullBytes: pbkdf2Params}},
+		EncryptionScheme:  pkix.AlgorithmIdentifier{Algorithm: oidAES256CBC, Parameters: asn1.RawValue{FullBytes: encodedIV}},
+	})
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+
+	encryptedKeyInfo, err := asn1.Marshal(pkcs12EncryptedPrivateKeyInfo{
+		Algorithm: pkix.AlgorithmIdentifier{Algorithm: oidPBES2, Parameters: asn1.RawValue{FullBytes: pbes2Params}},
+		Data:      encrypted,
+	})
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+
+	return pkcs12SafeBag{
+		ID:         oidPKCS8ShroudedKeyBag,
+		Value:      explicitTag(encryptedKeyInfo),
+		Attributes: attributes,
+	}, nil
+}
+
+// pkcs12CertificateBag returns a bag with the certificate.
+func pkcs12CertificateBag(cert *x509.Certificate) (pkcs12SafeBag, error) {
+	data, err := asn1.Marshal(cert.Raw)
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	certBag, err := asn1.Marshal(pkcs12CertBag{ID: oidX509Certificate, Data: explicitTag(data)})
+	if err != nil {
+		return pkcs12SafeBag{}, err
+	}
+	return pkcs12SafeBag{ID: oidCertBag, Value: explicitTag(certBag)}, nil
+}
+
+// pkcs12DataContentInfo wraps the contents in a content info of the data type.
+func pkcs12DataContentInfo(contents []byte) (pkcs12ContentInfo, error) {
+	data, err := asn1.Marshal(contents)
+	if err != nil {
+		return pkcs12ContentInfo{}, err
+	}
+	return pkcs12ContentInfo{ContentType: oidData, Content: explicitTag(data)}, nil
+}
+
+// explicitTag wraps the DER-encoded value in an explicit [0] tag. This can't be done with struct tags, since those
+// are ignored for asn1.RawValue.
+func explicitTag(der []byte) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: 0, IsCompound: true, Bytes: der}
+}
+
+// bmpPassword encodes the password as a null-terminated BMPString, as used by the PKCS#12 key derivation.
+func bmpPassword(password string) []byte {
+	encoded := utf16.Encode([]rune(password))
+	result := make([]byte, 0, 2*len(encoded)+2)
+	for _, c := range encoded {
+		result = append(result, byte(c>>8), byte(c))
+	}
+	return append(result, 0, 0)
+}
+
+// pkcs12KDF derives a key from the password as specified in appendix B.2 of RFC 7292. The ID specifies the purpose
+// of the key, e.g. 3 for a MAC key.
+func pkcs12KDF(newHash func() hash.Hash, password []byte, salt []byte, id byte, iterations int, size int) []byte {
+	u := newHash().Size()
+	v := newHash().BlockSize()
+
+	d := make([]byte, v)
+	for i := range d {
+		d[i] = id
+	}
+
+	repeat := func(b []byte) []byte {
+		if len(b) == 0 {
+			return nil
+		}
+		result := make([]byte, v*((len(b)+v-1)/v))
+		for i := range result {
+			result[i] = b[i%len(b)]
+		}
+		return result
+	}
+	input := append(repeat(salt), repeat(password)...)
+
+	var result []byte
+	for len(result) < size {
+		h := newHash()
+		h.Write(d)
+		h.Write(input)
+		a := h.Sum(nil)
+		for i := 1; i < iterations; i++ {
+			h.Reset()
+			h.Write(a)
+			a = h.Sum(a[:0])
+		}
+		result = append(result, a...)
+
+		if len(result) >= size {
+			break
+		}
+
+		// Add B + 1 to every v-byte block of the input, where B consists of repetitions of A.
+		b := make([]byte, v)
+		for i := range b {
+			b[i] = a[i%u]
+		}
+		for start := 0; start < len(input); start += v {
+			carry := 1
+			for i := v - 1; i >= 0; i-- {
+				sum := int(input[start+i]) + int(b[i]) + carry
+				input[start+i] = byte(sum)
+				carry = sum >> 8
+			}
+		}
+	}
+	return result[:size]
+}
+
+// pbkdf2SHA256 derives a key from the password using PBKDF2 with HMAC-SHA256, as specified in RFC 8018.
+func pbkdf2SHA256(password []byte, salt []byte, iterations int, size int) []byte {
+	prf := hmac.New(sha256.New, password)
+	var result []byte
+	for block := uint32(1); len(result) < size; block++ {
+		prf.Reset()
+		prf.Write(salt)
+		prf.Write([]byte{byte(block >> 24), byte(block >> 16), byte(block >> 8), byte(block)})
+		u := prf.Sum(nil)
+		t := append([]byte{}, u...)
+		for i := 1; i < iterations; i++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for j := range t {
+				t[j] ^= u[j]
+			}
+		}
+		result = append(result, t...)
+	}
+	return result[:size]
+}
+
+// randomBytes returns the specified number of cryptographically secure random bytes.
+func randomBytes(n int) ([]byte, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	return b, err
+}
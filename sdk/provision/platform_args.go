@@ -0,0 +1,27 @@
+package provision
+
+import (
+	"runtime"
+)
+
+// DefaultPlatform is the key in the map passed to PlatformArgs with the args to use on platforms that are not in the map.
+const DefaultPlatform = "default"
+
+// PlatformArgs returns the args for the current platform, based on runtime.GOOS, or the args set for DefaultPlatform
+// if the current platform is not in the map. This is useful for executables that take different flags on different
+// platforms, for example:
+//
+//	AddArgs(PlatformArgs(map[string][]string{
+//		"windows":       {"/config:{{ .Path }}"},
+//		DefaultPlatform: {"--config", "{{ .Path }}"},
+//	})...)
+func PlatformArgs(args map[string][]string) []string {
+	return platformArgs(runtime.GOOS, args)
+}
+
+func platformArgs(goos string, args map[string][]string) []string {
+	if selected, ok := args[goos]; ok {
+		return selected
+	}
+	return args[DefaultPlatform]
+}
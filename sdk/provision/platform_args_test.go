@@ -0,0 +1,24 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlatformArgs(t *testing.T) {
+	args := map[string][]string{
+		"windows":       {"/config:{{ .Path }}"},
+		DefaultPlatform: {"--config", "{{ .Path }}"},
+	}
+
+	assert.Equal(t, []string{"/config:{{ .Path }}"}, platformArgs("windows", args))
+	assert.Equal(t, []string{"--config", "{{ .Path }}"}, platformArgs("linux", args))
+	assert.Equal(t, []string{"--config", "{{ .Path }}"}, platformArgs("darwin", args))
+
+	// Platforms can also be excluded explicitly, falling back only when they are missing from the map.
+	args["darwin"] = nil
+	assert.Empty(t, platformArgs("darwin", args))
+
+	assert.Empty(t, platformArgs("linux", map[string][]string{"windows": {"/config"}}))
+}
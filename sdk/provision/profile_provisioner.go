@@ -0,0 +1,108 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// defaultProfileName is the profile that ProfileAware selects if the user didn't select one.
+const defaultProfileName = "default"
+
+// ProfileAwareProvisioner runs a provisioner with the fields of the profile that the user selected.
+type ProfileAwareProvisioner struct {
+	sdk.Provisioner
+
+	envVarName  string
+	provisioner sdk.Provisioner
+}
+
+// ProfileAware returns a provisioner that runs the specified provisioner with the fields of a single profile, for
+// items that hold the credentials of multiple profiles in sections, e.g. one section per AWS profile. The profile is
+// selected by the environment variable, e.g. AWS_PROFILE, unless SelectedProfile is already set on the provision
+// input. The fields of the section with the name of the profile are merged into ItemFields, taking precedence over
+// the fields outside of any section, and SelectedProfile is set to the profile.
+//
+// If the environment variable is not set, the "default" section is used if the item has one, and only the fields
+// outside of any section otherwise. If a profile is selected but the item has no section with that name,
+// provisioning fails with an error that lists the profiles the item does have.
+func ProfileAware(envVarName string, provisioner sdk.Provisioner) sdk.Provisioner {
+	return ProfileAwareProvisioner{
+		envVarName:  envVarName,
+		provisioner: provisioner,
+	}
+}
+
+func (p ProfileAwareProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	in, err := p.SelectProfile(in)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if in.SelectedProfile != "" {
+		out.AddLog(sdk.LogEntry{
+			Provisioner: p.Description(),
+			Message:     fmt.Sprintf("selected profile %s", in.SelectedProfile),
+		})
+	}
+	p.provisioner.Provision(ctx, in, out)
+}
+
+// SelectProfile returns the provision input that the wrapped provisioner is run with: the fields of the selected
+// profile merged into ItemFields, and SelectedProfile set to that profile. This allows validating the fields that
+// will actually be provisioned before provisioning.
+func (p ProfileAwareProvisioner) SelectProfile(in sdk.ProvisionInput) (sdk.ProvisionInput, error) {
+	profile := in.SelectedProfile
+	if profile == "" {
+		profile = os.Getenv(p.envVarName)
+	}
+
+	var fields map[sdk.FieldName]string
+	if profile != "" {
+		var ok bool
+		fields, ok = in.ItemFieldGroups[profile]
+		if !ok {
+			return in, fmt.Errorf("profile '%s' is not present in the item, available profiles: %s", profile, p.availableProfiles(in))
+		}
+	} else if defaultFields, ok := in.ItemFieldGroups[defaultProfileName]; ok {
+		profile, fields = defaultProfileName, defaultFields
+	}
+
+	merged := make(map[sdk.FieldName]string, len(in.ItemFields)+len(fields))
+	for name, value := range in.ItemFields {
+		merged[name] = value
+	}
+	for name, value := range fields {
+		merged[name] = value
+	}
+	in.ItemFields = merged
+	in.SelectedProfile = profile
+	return in, nil
+}
+
+func (p ProfileAwareProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	p.provisioner.Deprovision(ctx, in, out)
+}
+
+func (p ProfileAwareProvisioner) Description() string {
+	return fmt.Sprintf("%s (profile selected by %s)", p.provisioner.Description(), p.envVarName)
+}
+
+// availableProfiles returns the names of the sections of the item, for error messages.
+func (p ProfileAwareProvisioner) availableProfiles(in sdk.ProvisionInput) string {
+	if len(in.ItemFieldGroups) == 0 {
+		return "none"
+	}
+
+	profiles := make([]string, 0, len(in.ItemFieldGroups))
+	for profile := range in.ItemFieldGroups {
+		profiles = append(profiles, profile)
+	}
+	sort.Strings(profiles)
+	return strings.Join(profiles, ", ")
+}
@@ -0,0 +1,71 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+)
+
+func TestProfileAware(t *testing.T) {
+	provisioner := ProfileAware("TOOL_PROFILE", EnvVars(map[string]sdk.FieldName{
+		"TOOL_TOKEN":  "Token",
+		"TOOL_REGION": "Region",
+	}))
+	groups := map[string]map[sdk.FieldName]string{
+		"default": {"Token": "tok_DEFAULT"},
+		"work":    {"Token": "tok_WORK", "Region": "eu-west-1"},
+	}
+
+	t.Run("selected by env var", func(t *testing.T) {
+		t.Setenv("TOOL_PROFILE", "work")
+		plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+			"default": {
+				ItemFields:      map[sdk.FieldName]string{"Token": "tok_TOP_LEVEL", "Region": "us-east-1"},
+				ItemFieldGroups: groups,
+				ExpectedOutput: sdk.ProvisionOutput{
+					Environment: map[string]string{
+						"TOOL_TOKEN":  "tok_WORK",
+						"TOOL_REGION": "eu-west-1",
+					},
+				},
+			},
+			"profile not present": {
+				ItemFieldGroups: map[string]map[sdk.FieldName]string{
+					"personal": {"Token": "tok_PERSONAL"},
+					"ci":       {"Token": "tok_CI"},
+				},
+				ExpectedOutput: sdk.ProvisionOutput{
+					Environment: map[string]string{},
+					Diagnostics: sdk.Diagnostics{
+						Errors: []sdk.Error{{Message: "profile 'work' is not present in the item, available profiles: ci, personal"}},
+					},
+				},
+			},
+		})
+	})
+
+	t.Run("no profile selected", func(t *testing.T) {
+		t.Setenv("TOOL_PROFILE", "")
+		plugintest.TestProvisioner(t, provisioner, map[string]plugintest.ProvisionCase{
+			"default section": {
+				ItemFields:      map[sdk.FieldName]string{"Region": "us-east-1"},
+				ItemFieldGroups: groups,
+				ExpectedOutput: sdk.ProvisionOutput{
+					Environment: map[string]string{
+						"TOOL_TOKEN":  "tok_DEFAULT",
+						"TOOL_REGION": "us-east-1",
+					},
+				},
+			},
+			"no sections": {
+				ItemFields: map[sdk.FieldName]string{"Token": "tok_TOP_LEVEL"},
+				ExpectedOutput: sdk.ProvisionOutput{
+					Environment: map[string]string{
+						"TOOL_TOKEN": "tok_TOP_LEVEL",
+					},
+				},
+			},
+		})
+	})
+}
@@ -0,0 +1,100 @@
+package provision
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path/filepath"
+	"runtime"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// RAMDiskMode specifies whether the file provisioner writes files to a RAM-backed file system, so that secrets never
+// reach persistent storage.
+type RAMDiskMode string
+
+const (
+	// RAMDiskAuto writes files to the RAM disk if one is available, and to the temp dir otherwise, which is the default.
+	RAMDiskAuto RAMDiskMode = ""
+	// RAMDiskNever always writes files to the temp dir.
+	RAMDiskNever RAMDiskMode = "never"
+	// RAMDiskRequired writes files to the RAM disk, and fails provisioning if none is available.
+	RAMDiskRequired RAMDiskMode = "required"
+)
+
+// ramDiskRoot is the tmpfs mount that is available on most Linux distributions.
+var ramDiskRoot = "/dev/shm"
+
+// WithRAMDisk can be used to change whether the file is written to a RAM-backed file system instead of the temp dir,
+// which keeps the secret off persistent storage. By default, the RAM disk is used if one is available, falling back
+// to the temp dir silently otherwise. Use RAMDiskNever to opt out, or RAMDiskRequired to fail provisioning without a
+// RAM disk. Currently, only /dev/shm on Linux is supported. The file is stored in a directory that is only accessible
+// by the current user and is derived from the temp dir, and that directory is removed during deprovisioning. RAM disks
+// are never used if provision.AtFixedPath or provision.WithNoCleanup is set.
+func WithRAMDisk(mode RAMDiskMode) FileOption {
+	return func(p *FileProvisioner) {
+		p.ramDisk = mode
+	}
+}
+
+// ramDiskDir returns the directory on the RAM disk that files of the run with the specified temp dir are written to.
+func ramDiskDir(tempDir string) string {
+	return filepath.Join(ramDiskRoot, fmt.Sprintf("op-plugin-%x", sha256.Sum256([]byte(tempDir)))[:32])
+}
+
+// ramDiskAvailable returns whether the RAM disk exists and is writable, by creating and removing a probe directory.
+func ramDiskAvailable(fsys sdk.FileSystem) bool {
+	if runtime.GOOS != "linux" {
+		return false
+	}
+
+	info, err := fsys.Stat(ramDiskRoot)
+	if err != nil || !info.IsDir() {
+		return false
+	}
+
+	suffix, err := randomBytes(8)
+	if err != nil {
+		return false
+	}
+	probe := filepath.Join(ramDiskRoot, fmt.Sprintf(".op-plugin-probe-%x", suffix))
+	if err := fsys.MkdirAll(probe, 0700); err != nil {
+		return false
+	}
+	_ = fsys.Remove(probe)
+	return true
+}
+
+// fileDir returns the directory that files with a generated name or a name set using provision.Filename are written
+// to: the directory on the RAM disk if a RAM disk is available and WithRAMDisk isn't set to RAMDiskNever, or the temp
+// dir otherwise.
+func (p FileProvisioner) fileDir(fsys sdk.FileSystem, tempDir string) (string, error) {
+	if p.ramDisk == RAMDiskNever || p.noCleanup {
+		return tempDir, nil
+	}
+
+	dir := ramDiskDir(tempDir)
+	if info, err := fsys.Stat(dir); err == nil && info.IsDir() {
+		// The directory has already been created during provisioning.
+		return dir, nil
+	}
+	if ramDiskAvailable(fsys) {
+		return dir, nil
+	}
+
+	if p.ramDisk == RAMDiskRequired {
+		return "", fmt.Errorf("no RAM disk available to write the file to")
+	}
+	return tempDir, nil
+}
+
+// createRAMDiskDir creates the RAM disk directory for the specified temp dir, accessible only by the current user.
+func createRAMDiskDir(fsys sdk.FileSystem, tempDir string) error {
+	dir := ramDiskDir(tempDir)
+	err := fsys.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+	// The permissions passed to MkdirAll are affected by the umask.
+	return fsys.Chmod(dir, 0700)
+}
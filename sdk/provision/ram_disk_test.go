@@ -0,0 +1,115 @@
+package provision
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithRAMDisk(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("RAM disks are only supported on Linux")
+	}
+
+	original := ramDiskRoot
+	ramDiskRoot = t.TempDir()
+	t.Cleanup(func() { ramDiskRoot = original })
+
+	tempDir := t.TempDir()
+	provisioner := TempFile(FieldAsFile("Token"), Filename("token"), WithRAMDisk(RAMDiskRequired), SetPathAsEnvVar("TOKEN_FILE"))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+	}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	expectedPath := filepath.Join(ramDiskDir(tempDir), "token")
+	assert.Contains(t, out.Files, expectedPath)
+	assert.Equal(t, expectedPath, out.Environment["TOKEN_FILE"])
+
+	info, err := os.Stat(ramDiskDir(tempDir))
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0700), info.Mode().Perm())
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: tempDir}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+	_, err = os.Stat(ramDiskDir(tempDir))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestRAMDiskIsUsedByDefault(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("RAM disks are only supported on Linux")
+	}
+
+	original := ramDiskRoot
+	ramDiskRoot = t.TempDir()
+	t.Cleanup(func() { ramDiskRoot = original })
+
+	tempDir := t.TempDir()
+	for mode, expectedDir := range map[RAMDiskMode]string{
+		RAMDiskAuto:  ramDiskDir(tempDir),
+		RAMDiskNever: tempDir,
+	} {
+		out := sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		}
+		TempFile(FieldAsFile("Token"), Filename("token"), WithRAMDisk(mode)).Provision(context.Background(), sdk.ProvisionInput{
+			TempDir:    tempDir,
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+		}, &out)
+
+		assert.Empty(t, out.Diagnostics.Errors)
+		assert.Contains(t, out.Files, filepath.Join(expectedDir, "token"), "mode %q", mode)
+	}
+}
+
+func TestWithRAMDiskUnavailable(t *testing.T) {
+	original := ramDiskRoot
+	ramDiskRoot = filepath.Join(t.TempDir(), "missing")
+	t.Cleanup(func() { ramDiskRoot = original })
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), Filename("token")), map[string]plugintest.ProvisionCase{
+		"falls back to temp dir": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Files: map[string]sdk.OutputFile{
+					"/tmp/token": {Contents: []byte("hunter2"), Mode: 0600},
+				},
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, TempFile(FieldAsFile("Token"), Filename("token"), WithRAMDisk(RAMDiskRequired)), map[string]plugintest.ProvisionCase{
+		"required": {
+			ItemFields: map[sdk.FieldName]string{"Token": "hunter2"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "no RAM disk available to write the file to"}},
+				},
+			},
+		},
+	})
+}
+
+// defaultFileDir returns the directory that files with a name set using Filename are written to by default on this
+// machine: the directory on the RAM disk if one is available, or the temp dir otherwise.
+func defaultFileDir(t *testing.T, tempDir string) string {
+	t.Helper()
+	dir, err := FileProvisioner{}.fileDir(sdk.OSFileSystem{}, tempDir)
+	assert.NoError(t, err)
+	return dir
+}
@@ -0,0 +1,167 @@
+package provision
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// minRefreshRetryInterval is the minimum time between two attempts to refresh a file after refreshing failed.
+const minRefreshRetryInterval = time.Second
+
+// WithTTL can be used for short-lived credentials, such as STS tokens or OIDC tokens, that can expire while a
+// long-running executable still needs them. The contents function is run again and the file is rewritten atomically
+// before the contents expire: after 80% of the TTL has passed. Since the file has to be rewritten while the executable
+// runs, it's written directly instead of through the provision output, and removed again during deprovisioning.
+//
+// If refreshing fails, the file is left as is, since the previous contents could still be valid, and refreshing is
+// retried every tenth of the TTL, but at most once per second. The executable is not interrupted. Failures are
+// reported as warnings once the executable exits, unless a later attempt succeeded.
+func WithTTL(ttl time.Duration) FileOption {
+	return func(p *FileProvisioner) {
+		p.refreshTTL = ttl
+		p.refreshers = &fileRefreshers{
+			byTempDir: make(map[string][]*fileRefresher),
+		}
+	}
+}
+
+// refreshInterval returns how often a file with the specified TTL gets refreshed.
+func refreshInterval(ttl time.Duration) time.Duration {
+	return ttl - ttl/5
+}
+
+// refreshRetryInterval returns how long to wait before refreshing again after refreshing a file with the specified
+// TTL failed.
+func refreshRetryInterval(ttl time.Duration) time.Duration {
+	if ttl/10 < minRefreshRetryInterval {
+		return minRefreshRetryInterval
+	}
+	return ttl / 10
+}
+
+// startRefreshing writes the file and keeps refreshing it in the background until deprovisioning.
+func (p FileProvisioner) startRefreshing(in sdk.ProvisionInput, outpath string, contents []byte) error {
+	fsys := in.FS()
+	err := writeFileAtomic(fsys, outpath, contents, p.fileMode)
+	if err != nil {
+		return err
+	}
+
+	// Refreshing has to generate new contents, instead of reusing the cached contents.
+	in.Cache = nil
+	p.refreshers.start(in.TempDir, outpath, p.refreshTTL, func(ctx context.Context) error {
+		// The bound paths and the log of this run are not available anymore, so use a scratch output.
+		contents, err := p.encodedContents(ctx, in, &sdk.ProvisionOutput{Paths: in.BoundPaths})
+		if err != nil {
+			return err
+		}
+		return writeFileAtomic(fsys, outpath, contents, p.fileMode)
+	})
+	return nil
+}
+
+// stopRefreshing stops refreshing the files of this run, reports any refresh failures, and removes the files.
+func (p FileProvisioner) stopRefreshing(in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	for _, refresher := range p.refreshers.stop(in.TempDir) {
+		if refresher.failures > 0 {
+			out.Diagnostics.Warnings = append(out.Diagnostics.Warnings, sdk.Warning{
+				Message: fmt.Sprintf("refreshing %s failed, the file may have expired: %s (failed attempts: %d)", refresher.path, refresher.lastErr, refresher.failures),
+			})
+		}
+
+		if p.secureDelete {
+			// The file gets scrubbed and removed afterwards.
+			continue
+		}
+
+		err := in.FS().Remove(refresher.path)
+		if err != nil && !os.IsNotExist(err) {
+			out.AddError(fmt.Errorf("removing %s: %w", refresher.path, err))
+			continue
+		}
+		out.AddLog(p.logEntry("refreshed secret file %s %d times and removed it", refresher.path, refresher.refreshes))
+	}
+}
+
+// fileRefreshers keeps track of the files that are being refreshed for each provisioning run, identified by temp
+// dir, so that refreshing can be stopped during deprovisioning.
+type fileRefreshers struct {
+	mu        sync.Mutex
+	byTempDir map[string][]*fileRefresher
+}
+
+type fileRefresher struct {
+	path   string
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	// These are only accessed by the refresh goroutine until done is closed.
+	refreshes int
+	failures  int
+	lastErr   error
+}
+
+func (r *fileRefreshers) start(tempDir string, path string, ttl time.Duration, refresh func(ctx context.Context) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	refresher := &fileRefresher{
+		path:   path,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+
+	r.mu.Lock()
+	r.byTempDir[tempDir] = append(r.byTempDir[tempDir], refresher)
+	r.mu.Unlock()
+
+	go refresher.run(ctx, ttl, refresh)
+}
+
+// stop stops refreshing all files for the specified temp dir and waits for refreshes that are in progress.
+func (r *fileRefreshers) stop(tempDir string) []*fileRefresher {
+	r.mu.Lock()
+	refreshers := r.byTempDir[tempDir]
+	delete(r.byTempDir, tempDir)
+	r.mu.Unlock()
+
+	for _, refresher := range refreshers {
+		refresher.cancel()
+		<-refresher.done
+	}
+	return refreshers
+}
+
+func (r *fileRefresher) run(ctx context.Context, ttl time.Duration, refresh func(ctx context.Context) error) {
+	defer close(r.done)
+
+	timer := time.NewTimer(refreshInterval(ttl))
+	defer timer.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+
+		err := refresh(ctx)
+		if ctx.Err() != nil {
+			// Deprovisioning started while refreshing, so the result doesn't matter anymore.
+			return
+		}
+		if err != nil {
+			r.failures++
+			r.lastErr = err
+			timer.Reset(refreshRetryInterval(ttl))
+			continue
+		}
+
+		r.refreshes++
+		r.failures = 0
+		r.lastErr = nil
+		timer.Reset(refreshInterval(ttl))
+	}
+}
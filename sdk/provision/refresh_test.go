@@ -0,0 +1,84 @@
+package provision
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWithTTL(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	var calls int32
+	contents := ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		return []byte(fmt.Sprintf("token-%d", atomic.AddInt32(&calls, 1))), nil
+	})
+
+	provisioner := TempFile(contents, Filename("token"), WithTTL(50*time.Millisecond))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{TempDir: "/tmp", FileSystem: fsys}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+	assert.Empty(t, out.Files)
+
+	written, err := fsys.ReadFile("/tmp/token")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", string(written))
+
+	assert.Eventually(t, func() bool {
+		written, err := fsys.ReadFile("/tmp/token")
+		return err == nil && string(written) == "token-3"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp", FileSystem: fsys}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.Empty(t, deprovisionOut.Diagnostics.Warnings)
+	assert.Empty(t, fsys.Paths())
+
+	// No refreshes happen after deprovisioning.
+	callsAfterDeprovision := atomic.LoadInt32(&calls)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, callsAfterDeprovision, atomic.LoadInt32(&calls))
+}
+
+func TestWithTTLRefreshFails(t *testing.T) {
+	fsys := plugintest.NewMemoryFileSystem()
+	var calls int32
+	contents := ItemToFileContents(func(in sdk.ProvisionInput) ([]byte, error) {
+		if atomic.AddInt32(&calls, 1) > 1 {
+			return nil, errors.New("token endpoint unavailable")
+		}
+		return []byte("token-1"), nil
+	})
+
+	provisioner := TempFile(contents, Filename("token"), WithTTL(50*time.Millisecond))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{TempDir: "/tmp", FileSystem: fsys}, &out)
+	assert.Empty(t, out.Diagnostics.Errors)
+
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt32(&calls) >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// The previous contents are kept when refreshing fails.
+	written, err := fsys.ReadFile("/tmp/token")
+	assert.NoError(t, err)
+	assert.Equal(t, "token-1", string(written))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: "/tmp", FileSystem: fsys}, &deprovisionOut)
+	assert.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.Equal(t, []sdk.Warning{{Message: "refreshing /tmp/token failed, the file may have expired: token endpoint unavailable (failed attempts: 1)"}}, deprovisionOut.Diagnostics.Warnings)
+}
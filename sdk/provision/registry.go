@@ -0,0 +1,207 @@
+package provision
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// ProvisionerFactory builds a provisioner from the params of a ProvisionerSpec. Factories should return an error for
+// params they don't recognize, so that a typo in a spec doesn't silently result in a different provisioner.
+type ProvisionerFactory func(params map[string]string) (sdk.Provisioner, error)
+
+// ProvisionerSpec declares a provisioner by the name it's registered under in a Registry, along with the params that
+// get passed to its factory. If WhenFields is set, the provisioner only runs if the item has a value for all of these
+// fields, see When and HasFields, so that a single spec can provision different variants of a credential.
+type ProvisionerSpec struct {
+	Name       string            `json:"name"`
+	Params     map[string]string `json:"params,omitempty"`
+	WhenFields []sdk.FieldName   `json:"when_fields,omitempty"`
+}
+
+// ParseSpecs parses a JSON array of provisioner specs, e.g.:
+//
+//	[
+//		{"name": "field-as-env-var", "params": {"env_var": "TOOL_TOKEN", "field": "Token"}, "when_fields": ["Token"]},
+//		{"name": "temp-file", "params": {"field": "Private Key", "env_var": "TOOL_KEY_FILE"}}
+//	]
+func ParseSpecs(data []byte) ([]ProvisionerSpec, error) {
+	var specs []ProvisionerSpec
+	err := json.Unmarshal(data, &specs)
+	if err != nil {
+		return nil, fmt.Errorf("parsing provisioner specs: %w", err)
+	}
+	return specs, nil
+}
+
+// Registry keeps track of provisioner factories by name, so that provisioners can be assembled from specs at runtime
+// instead of being wired statically. It's safe for concurrent use.
+type Registry struct {
+	mu        sync.RWMutex
+	factories map[string]ProvisionerFactory
+}
+
+// NewRegistry returns an empty registry. Use DefaultRegistry for a registry with the provisioners of this package.
+func NewRegistry() *Registry {
+	return &Registry{
+		factories: make(map[string]ProvisionerFactory),
+	}
+}
+
+// DefaultRegistry returns a new registry with the following provisioners of this package registered:
+//   - "env-vars": EnvVars, with each param mapping an environment variable name to a field name.
+//   - "field-as-env-var": FieldAsEnvVar, using the "env_var" and "field" params.
+//   - "field-as-arg": FieldAsArg, using the "field" and "format" params.
+//   - "temp-file": TempFile with FieldAsFile, using the "field" param, and optionally the "filename" param for
+//     Filename and the "env_var" param for SetPathAsEnvVar.
+//
+// Specs with params other than these fail to build. More provisioners can be registered on the returned registry.
+func DefaultRegistry() *Registry {
+	r := NewRegistry()
+	for name, factory := range map[string]ProvisionerFactory{
+		"env-vars":         envVarsFromParams,
+		"field-as-env-var": fieldAsEnvVarFromParams,
+		"field-as-arg":     fieldAsArgFromParams,
+		"temp-file":        tempFileFromParams,
+	} {
+		// Can't fail, since the registry is empty and the names are distinct.
+		_ = r.Register(name, factory)
+	}
+	return r
+}
+
+// Register registers the factory under the specified name. Returns an error if the name is empty or already taken.
+func (r *Registry) Register(name string, factory ProvisionerFactory) error {
+	if name == "" {
+		return fmt.Errorf("provisioner name can't be empty")
+	}
+	if factory == nil {
+		return fmt.Errorf("factory of provisioner '%s' can't be nil", name)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.factories[name]; ok {
+		return fmt.Errorf("a provisioner named '%s' is already registered", name)
+	}
+	r.factories[name] = factory
+	return nil
+}
+
+// Lookup returns the factory registered under the specified name, if any.
+func (r *Registry) Lookup(name string) (ProvisionerFactory, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	factory, ok := r.factories[name]
+	return factory, ok
+}
+
+// Names returns the names of all registered provisioners in alphabetical order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build assembles the provisioners declared by the specs into a single provisioner that runs them in order, see
+// Composite. Returns an error if a spec refers to a provisioner that's not registered, or if its params are invalid.
+func (r *Registry) Build(specs ...ProvisionerSpec) (sdk.Provisioner, error) {
+	var provisioners []sdk.Provisioner
+	for i, spec := range specs {
+		factory, ok := r.Lookup(spec.Name)
+		if !ok {
+			return nil, fmt.Errorf("spec %d: no provisioner named '%s' is registered, available provisioners: %s", i, spec.Name, strings.Join(r.Names(), ", "))
+		}
+
+		provisioner, err := factory(spec.Params)
+		if err != nil {
+			return nil, fmt.Errorf("spec %d: building provisioner '%s': %w", i, spec.Name, err)
+		}
+		if len(spec.WhenFields) > 0 {
+			provisioner = When(HasFields(spec.WhenFields...), provisioner)
+		}
+		provisioners = append(provisioners, provisioner)
+	}
+	return Composite(provisioners...), nil
+}
+
+// checkParams returns an error if any of the required params is missing or empty, or if there's a param that is
+// neither required nor optional.
+func checkParams(params map[string]string, required []string, optional ...string) error {
+	for _, name := range required {
+		if params[name] == "" {
+			return fmt.Errorf("missing required param '%s'", name)
+		}
+	}
+
+	supported := make(map[string]bool)
+	for _, name := range append(append([]string{}, required...), optional...) {
+		supported[name] = true
+	}
+	var unknown []string
+	for name := range params {
+		if !supported[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	if len(unknown) == 0 {
+		return nil
+	}
+
+	// Sort the names, so that the same param is reported if more than one is unknown.
+	sort.Strings(unknown)
+	names := append(append([]string{}, required...), optional...)
+	sort.Strings(names)
+	return fmt.Errorf("unknown param '%s', supported params: %s", unknown[0], strings.Join(names, ", "))
+}
+
+func envVarsFromParams(params map[string]string) (sdk.Provisioner, error) {
+	if len(params) == 0 {
+		return nil, fmt.Errorf("at least one environment variable has to be specified")
+	}
+	schema := make(map[string]sdk.FieldName, len(params))
+	for envVarName, fieldName := range params {
+		schema[envVarName] = sdk.FieldName(fieldName)
+	}
+	return EnvVars(schema), nil
+}
+
+func fieldAsEnvVarFromParams(params map[string]string) (sdk.Provisioner, error) {
+	if err := checkParams(params, []string{"env_var", "field"}); err != nil {
+		return nil, err
+	}
+	return FieldAsEnvVar(params["env_var"], sdk.FieldName(params["field"])), nil
+}
+
+func fieldAsArgFromParams(params map[string]string) (sdk.Provisioner, error) {
+	if err := checkParams(params, []string{"field", "format"}); err != nil {
+		return nil, err
+	}
+	return FieldAsArg(sdk.FieldName(params["field"]), params["format"]), nil
+}
+
+func tempFileFromParams(params map[string]string) (sdk.Provisioner, error) {
+	if err := checkParams(params, []string{"field"}, "filename", "env_var"); err != nil {
+		return nil, err
+	}
+	var opts []FileOption
+	if filename := params["filename"]; filename != "" {
+		if err := validateFilename(filename); err != nil {
+			return nil, err
+		}
+		opts = append(opts, Filename(filename))
+	}
+	if envVarName := params["env_var"]; envVarName != "" {
+		opts = append(opts, SetPathAsEnvVar(envVarName))
+	}
+	return TempFile(FieldAsFile(sdk.FieldName(params["field"])), opts...), nil
+}
@@ -0,0 +1,60 @@
+package provision
+
+import (
+	"context"
+	"errors"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// StdinProvisioner provisions a secret through the standard input of the executable, for executables that can read
+// a secret from stdin, such as "gh auth login --with-token".
+type StdinProvisioner struct {
+	sdk.Provisioner
+
+	contents ItemToFileContents
+}
+
+// Stdin returns a provisioner that writes the contents to the standard input of the executable. Since the executable
+// only has a single stdin, only one provisioner can provision stdin.
+func Stdin(contents ItemToFileContents) sdk.Provisioner {
+	return StdinProvisioner{
+		contents: contents,
+	}
+}
+
+func (p StdinProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	contents, err := p.contents(in)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if out.Stdin != nil {
+		out.AddError(errors.New("stdin has already been provisioned by another provisioner"))
+		return
+	}
+
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind: sdk.DryRunKindStdin,
+			Size: len(contents),
+		})
+		return
+	}
+
+	out.SetStdin(contents)
+}
+
+func (p StdinProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	// Nothing to do here: stdin gets closed once the contents have been written to it.
+}
+
+func (p StdinProvisioner) Description() string {
+	return "Provision secret through stdin"
+}
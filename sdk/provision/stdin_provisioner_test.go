@@ -0,0 +1,50 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+)
+
+func TestStdin(t *testing.T) {
+	plugintest.TestProvisioner(t, Stdin(FieldAsFile("Token")), map[string]plugintest.ProvisionCase{
+		"default": {
+			ItemFields: map[sdk.FieldName]string{
+				"Token": "ghp_EXAMPLE",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Stdin: []byte("ghp_EXAMPLE"),
+			},
+		},
+	})
+
+	plugintest.TestProvisioner(t, Composite(Stdin(FieldAsFile("Token")), Stdin(FieldAsFile("Token"))), map[string]plugintest.ProvisionCase{
+		"stdin provisioned twice": {
+			ItemFields: map[sdk.FieldName]string{
+				"Token": "ghp_EXAMPLE",
+			},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Stdin: []byte("ghp_EXAMPLE"),
+				Diagnostics: sdk.Diagnostics{
+					Errors: []sdk.Error{{Message: "stdin has already been provisioned by another provisioner"}},
+				},
+			},
+		},
+	})
+
+	// Args provisioned alongside stdin are passed as usual.
+	plugintest.TestProvisioner(t, Composite(Stdin(FieldAsFile("Token")), FieldAsArg("Username", "--user=%s")), map[string]plugintest.ProvisionCase{
+		"with args": {
+			ItemFields: map[sdk.FieldName]string{
+				"Token":    "ghp_EXAMPLE",
+				"Username": "wendy",
+			},
+			CommandLine: []string{"gh", "auth", "login", "--with-token"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Stdin:       []byte("ghp_EXAMPLE"),
+				CommandLine: []string{"gh", "auth", "login", "--with-token", "--user=wendy"},
+			},
+		},
+	})
+}
@@ -0,0 +1,55 @@
+package provision
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/ini.v1"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormat is the format of a config file, used to validate the generated file contents with ValidateAs.
+type ConfigFormat string
+
+const (
+	ConfigFormatJSON ConfigFormat = "JSON"
+	ConfigFormatYAML ConfigFormat = "YAML"
+	ConfigFormatTOML ConfigFormat = "TOML"
+	ConfigFormatINI  ConfigFormat = "INI"
+)
+
+// ValidateAs can be used to make sure the generated file contents are well-formed in the specified format before the
+// file gets provisioned, so that a bug in a template or in the way fields are assembled into a config file gets
+// reported as such, instead of as a cryptic parse error by the executable. The contents are validated before the line
+// endings are converted or the contents are compressed.
+func ValidateAs(format ConfigFormat) FileOption {
+	return func(p *FileProvisioner) {
+		p.validateFormat = format
+	}
+}
+
+// validateContents returns an error if the contents are not valid in the specified format.
+func validateContents(format ConfigFormat, contents []byte) error {
+	var err error
+	switch format {
+	case ConfigFormatJSON:
+		var result any
+		err = json.Unmarshal(contents, &result)
+	case ConfigFormatYAML:
+		var result any
+		err = yaml.Unmarshal(contents, &result)
+	case ConfigFormatTOML:
+		var result map[string]any
+		err = toml.Unmarshal(contents, &result)
+	case ConfigFormatINI:
+		_, err = ini.Load(contents)
+	default:
+		return fmt.Errorf("unsupported config format '%s' to validate against", format)
+	}
+
+	if err != nil {
+		return fmt.Errorf("generated file is not valid %s: %w", format, err)
+	}
+	return nil
+}
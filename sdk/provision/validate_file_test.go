@@ -0,0 +1,44 @@
+package provision
+
+import (
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateAs(t *testing.T) {
+	for format, contents := range map[ConfigFormat]string{
+		ConfigFormatJSON: `{"token": "tok_EXAMPLE"}`,
+		ConfigFormatYAML: "token: tok_EXAMPLE\n",
+		ConfigFormatTOML: "token = \"tok_EXAMPLE\"\n",
+		ConfigFormatINI:  "[default]\ntoken = tok_EXAMPLE\n",
+	} {
+		plugintest.TestProvisioner(t, TempFile(FieldAsFile("Config"), Filename("config"), ValidateAs(format)), map[string]plugintest.ProvisionCase{
+			"valid " + string(format): {
+				ItemFields: map[sdk.FieldName]string{
+					"Config": contents,
+				},
+				ExpectedOutput: sdk.ProvisionOutput{
+					Files: map[string]sdk.OutputFile{
+						"/tmp/config": {Contents: []byte(contents), Mode: 0600},
+					},
+				},
+			},
+		})
+	}
+
+	for format, contents := range map[ConfigFormat]string{
+		ConfigFormatJSON: `{"token": "tok_EXAMPLE",}`,
+		ConfigFormatYAML: "token: [tok_EXAMPLE\n",
+		ConfigFormatTOML: "token = tok_EXAMPLE\n",
+		ConfigFormatINI:  "[default\ntoken = tok_EXAMPLE\n",
+	} {
+		result := plugintest.RunProvision(t, TempFile(FieldAsFile("Config"), Filename("config"), ValidateAs(format)), map[sdk.FieldName]string{
+			"Config": contents,
+		})
+		assert.Empty(t, result.Files, format)
+		plugintest.AssertErrorContains(t, result, "generated file is not valid "+string(format)+": ")
+	}
+}
@@ -0,0 +1,298 @@
+package provision
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"gopkg.in/yaml.v3"
+)
+
+// YAMLMergeProvisioner provisions one or more secrets by merging a YAML fragment into an existing YAML config file.
+type YAMLMergeProvisioner struct {
+	sdk.Provisioner
+
+	path     string
+	fragment ItemToFileContents
+}
+
+// YAMLMergeFile returns a provisioner that deep-merges the YAML fragment into the YAML document at the specified path,
+// which is useful for executables like kubectl that expect credentials to be part of the user's existing config. Like
+// with provision.AtFixedPath, "~" and environment variables in the path are expanded. Nested mappings are merged key by
+// key, lists are appended to, and any other value in the fragment replaces the existing value. If the file doesn't
+// exist yet, it gets created.
+//
+// During deprovisioning, exactly the merged keys and list items are removed again and replaced values are restored,
+// so that changes that the executable made to other parts of the document survive. Key order and comments are not
+// preserved.
+func YAMLMergeFile(path string, fragment ItemToFileContents) sdk.Provisioner {
+	return YAMLMergeProvisioner{
+		path:     path,
+		fragment: fragment,
+	}
+}
+
+func (p YAMLMergeProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	fragment, err := p.fragment(in)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	fragmentDoc, err := parseYAMLMapping(fragment)
+	if err != nil {
+		out.AddError(fmt.Errorf("parsing YAML fragment: %w", err))
+		return
+	}
+
+	if err := ctx.Err(); err != nil {
+		out.AddError(err)
+		return
+	}
+
+	path, err := expandPath(p.path, in.HomeDir)
+	if err != nil {
+		out.AddError(fmt.Errorf("invalid path: %w", err))
+		return
+	}
+	if in.DryRun {
+		out.AddDryRunEntry(sdk.DryRunEntry{
+			Kind:   sdk.DryRunKindFile,
+			Target: path,
+			Size:   len(fragment),
+		})
+		return
+	}
+
+	fsys := in.FS()
+	err = backupFile(fsys, in.TempDir, path)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	backup, err := readBackup(fsys, in.TempDir, path)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	doc, err := parseYAMLMapping(backup.Contents)
+	if err != nil {
+		out.AddError(fmt.Errorf("parsing %s: %w", path, err))
+		return
+	}
+
+	// The fragment is needed again during deprovisioning to find out which keys have to be removed.
+	err = writeFileAtomic(fsys, fragmentPath(in.TempDir, path), fragment, 0600)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+
+	mergeYAML(doc, fragmentDoc)
+	err = writeYAML(fsys, path, doc, backup)
+	if err != nil {
+		out.AddError(err)
+		return
+	}
+	out.AddAction(sdk.ProvisionAction{Kind: sdk.ActionKindFile, Target: path, Size: len(fragment)})
+}
+
+func (p YAMLMergeProvisioner) Deprovision(ctx context.Context, in sdk.DeprovisionInput, out *sdk.DeprovisionOutput) {
+	if in.DryRun {
+		return
+	}
+
+	path, err := expandPath(p.path, in.HomeDir)
+	if err != nil {
+		// Provisioning failed for the same reason, so there's nothing to clean up.
+		return
+	}
+	err = p.unmerge(in.FS(), in.TempDir, path)
+	if err != nil {
+		out.AddError(fmt.Errorf("removing merged YAML from %s: %w", path, err))
+	}
+}
+
+// unmerge removes the fragment that got merged into the file during provisioning, based on the original state of
+// the file recorded in the temp dir.
+func (p YAMLMergeProvisioner) unmerge(fsys sdk.FileSystem, tempDir string, path string) error {
+	backup, err := readBackup(fsys, tempDir, path)
+	if errors.Is(err, errNoBackup) {
+		// Nothing was merged into the file.
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	fragment, err := fsys.ReadFile(fragmentPath(tempDir, path))
+	if err != nil {
+		return err
+	}
+
+	fragmentDoc, err := parseYAMLMapping(fragment)
+	if err != nil {
+		return err
+	}
+
+	original, err := parseYAMLMapping(backup.Contents)
+	if err != nil {
+		return err
+	}
+
+	current, err := fsys.ReadFile(path)
+	if os.IsNotExist(err) {
+		current = nil
+	} else if err != nil {
+		return err
+	}
+
+	doc, err := parseYAMLMapping(current)
+	if err != nil {
+		return err
+	}
+
+	unmergeYAML(doc, original, fragmentDoc)
+	if len(doc) == 0 && !backup.Existed {
+		err = fsys.Remove(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		err = writeYAML(fsys, path, doc, backup)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = fsys.Remove(fragmentPath(tempDir, path))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return fsys.Remove(backupPath(tempDir, path))
+}
+
+func (p YAMLMergeProvisioner) Description() string {
+	return fmt.Sprintf("Merge secrets into YAML file %s", p.path)
+}
+
+// fragmentPath returns the path in the temp dir where the fragment that got merged into the specified file is stored.
+func fragmentPath(tempDir string, path string) string {
+	return filepath.Join(tempDir, fmt.Sprintf(".yaml-fragment-%x", sha256.Sum256([]byte(path))))
+}
+
+// parseYAMLMapping parses a YAML document that consists of a mapping. An empty document results in an empty mapping.
+func parseYAMLMapping(contents []byte) (map[string]any, error) {
+	var doc map[string]any
+	err := yaml.Unmarshal(contents, &doc)
+	if err != nil {
+		return nil, err
+	}
+	if doc == nil {
+		doc = make(map[string]any)
+	}
+	return doc, nil
+}
+
+// writeYAML writes the document to the specified path, using the permissions of the original file if it existed.
+func writeYAML(fsys sdk.FileSystem, path string, doc map[string]any, backup fileBackup) error {
+	contents, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	mode := defaultFileMode
+	if backup.Existed {
+		mode = backup.Mode
+	}
+	_, err = writeFileIfChanged(fsys, path, contents, mode)
+	return err
+}
+
+// mergeYAML deep-merges the fragment into the document.
+func mergeYAML(doc map[string]any, fragment map[string]any) {
+	for key, value := range fragment {
+		existing, ok := doc[key]
+		if !ok {
+			doc[key] = value
+			continue
+		}
+
+		switch value := value.(type) {
+		case map[string]any:
+			if existing, ok := existing.(map[string]any); ok {
+				mergeYAML(existing, value)
+				continue
+			}
+		case []any:
+			if existing, ok := existing.([]any); ok {
+				doc[key] = append(existing, value...)
+				continue
+			}
+		}
+		doc[key] = value
+	}
+}
+
+// unmergeYAML reverts mergeYAML: it removes the keys and list items of the fragment from the document, and restores
+// the values from the original document that were replaced. Anything else in the document is left untouched.
+func unmergeYAML(doc map[string]any, original map[string]any, fragment map[string]any) {
+	for key, value := range fragment {
+		current, ok := doc[key]
+		if !ok {
+			continue
+		}
+		originalValue, existed := original[key]
+
+		switch value := value.(type) {
+		case map[string]any:
+			currentMap, ok := current.(map[string]any)
+			originalMap, wasMap := originalValue.(map[string]any)
+			if ok && (!existed || wasMap) {
+				unmergeYAML(currentMap, originalMap, value)
+				if len(currentMap) == 0 && !existed {
+					delete(doc, key)
+				}
+				continue
+			}
+		case []any:
+			currentList, ok := current.([]any)
+			_, wasList := originalValue.([]any)
+			if ok && (!existed || wasList) {
+				currentList = removeYAMLListItems(currentList, value)
+				if len(currentList) == 0 && !existed {
+					delete(doc, key)
+				} else {
+					doc[key] = currentList
+				}
+				continue
+			}
+		}
+
+		if existed {
+			doc[key] = originalValue
+		} else {
+			delete(doc, key)
+		}
+	}
+}
+
+// removeYAMLListItems removes one occurrence of each of the items from the list, starting from the end, since
+// merged items were appended.
+func removeYAMLListItems(list []any, items []any) []any {
+	for i := len(items) - 1; i >= 0; i-- {
+		for j := len(list) - 1; j >= 0; j-- {
+			if reflect.DeepEqual(list[j], items[i]) {
+				list = append(list[:j:j], list[j+1:]...)
+				break
+			}
+		}
+	}
+	return list
+}
@@ -0,0 +1,160 @@
+package provision
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/plugintest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v3"
+)
+
+func TestYAMLMergeFile(t *testing.T) {
+	homeDir := t.TempDir()
+	tempDir := t.TempDir()
+	path := filepath.Join(homeDir, ".kube", "config")
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0700))
+	require.NoError(t, os.WriteFile(path, []byte(`
+current-context: personal
+contexts:
+  - name: personal
+    context:
+      user: me
+users:
+  - name: me
+preferences:
+  colors: true
+`), 0640))
+
+	provisioner := YAMLMergeFile("~/.kube/config", FileContentsFromTemplate(`
+current-context: work
+contexts:
+  - name: work
+    context:
+      user: work
+users:
+  - name: work
+    user:
+      token: {{ .Token }}
+`))
+
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		HomeDir:    homeDir,
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Token": "secret"},
+	}, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+	assert.Empty(t, out.Files)
+
+	assert.Equal(t, map[string]any{
+		"current-context": "work",
+		"contexts": []any{
+			map[string]any{"name": "personal", "context": map[string]any{"user": "me"}},
+			map[string]any{"name": "work", "context": map[string]any{"user": "work"}},
+		},
+		"users": []any{
+			map[string]any{"name": "me"},
+			map[string]any{"name": "work", "user": map[string]any{"token": "secret"}},
+		},
+		"preferences": map[string]any{"colors": true},
+	}, readYAML(t, path))
+
+	// Simulate the executable changing an untouched part of the config.
+	doc := readYAML(t, path)
+	doc["preferences"] = map[string]any{"colors": false}
+	contents, err := yaml.Marshal(doc)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, contents, 0640))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{HomeDir: homeDir, TempDir: tempDir}, &deprovisionOut)
+	require.Empty(t, deprovisionOut.Diagnostics.Errors)
+
+	assert.Equal(t, map[string]any{
+		"current-context": "personal",
+		"contexts": []any{
+			map[string]any{"name": "personal", "context": map[string]any{"user": "me"}},
+		},
+		"users": []any{
+			map[string]any{"name": "me"},
+		},
+		"preferences": map[string]any{"colors": false},
+	}, readYAML(t, path))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+}
+
+func TestYAMLMergeFileWithoutExistingFile(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+
+	provisioner := YAMLMergeFile(path, FieldAsFile("Config"))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Config": "auth:\n  token: secret\n"},
+	}, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+	assert.Equal(t, map[string]any{"auth": map[string]any{"token": "secret"}}, readYAML(t, path))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: tempDir}, &deprovisionOut)
+	require.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.NoFileExists(t, path)
+}
+
+func TestYAMLMergeFileExpandsPath(t *testing.T) {
+	tempDir := t.TempDir()
+	configDir := t.TempDir()
+	t.Setenv("TOOL_CONFIG_DIR", configDir)
+
+	provisioner := YAMLMergeFile("$TOOL_CONFIG_DIR/config.yaml", FieldAsFile("Config"))
+	out := sdk.ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]sdk.OutputFile),
+	}
+	provisioner.Provision(context.Background(), sdk.ProvisionInput{
+		TempDir:    tempDir,
+		ItemFields: map[sdk.FieldName]string{"Config": "auth:\n  token: secret\n"},
+	}, &out)
+	require.Empty(t, out.Diagnostics.Errors)
+	assert.Equal(t, map[string]any{"auth": map[string]any{"token": "secret"}}, readYAML(t, filepath.Join(configDir, "config.yaml")))
+
+	deprovisionOut := sdk.DeprovisionOutput{}
+	provisioner.Deprovision(context.Background(), sdk.DeprovisionInput{TempDir: tempDir}, &deprovisionOut)
+	require.Empty(t, deprovisionOut.Diagnostics.Errors)
+	assert.NoFileExists(t, filepath.Join(configDir, "config.yaml"))
+}
+
+func TestYAMLMergeFileInvalidPath(t *testing.T) {
+	plugintest.TestProvisioner(t, YAMLMergeFile("$TOOL_UNSET_CONFIG_DIR/config.yaml", FieldAsFile("Config")), map[string]plugintest.ProvisionCase{
+		"unset environment variable": {
+			ItemFields: map[sdk.FieldName]string{"Config": "auth:\n  token: secret\n"},
+			ExpectedOutput: sdk.ProvisionOutput{
+				Diagnostics: sdk.Diagnostics{Errors: []sdk.Error{{Message: "invalid path: expanding $TOOL_UNSET_CONFIG_DIR/config.yaml: environment variable TOOL_UNSET_CONFIG_DIR is not set"}}},
+			},
+		},
+	})
+}
+
+func readYAML(t *testing.T, path string) map[string]any {
+	contents, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	var doc map[string]any
+	require.NoError(t, yaml.Unmarshal(contents, &doc))
+	return doc
+}
@@ -1,9 +1,15 @@
 package sdk
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -14,11 +20,13 @@ type Provisioner interface {
 	Description() string
 
 	// Provision gets called before running the plugin's executable to provision the necessary fields
-	// from the 1Password item in a way that the executable understands.
+	// from the 1Password item in a way that the executable understands. If the context gets cancelled,
+	// provisioning should be aborted by reporting the error of the context, and any I/O should use the context.
 	Provision(ctx context.Context, input ProvisionInput, output *ProvisionOutput)
 
 	// Deprovision gets called after the plugin's executable exits, so that the plugin can clean up and
-	// wipe any sensitive material created in the provision phase.
+	// wipe any sensitive material created in the provision phase. Cleaning up should not be skipped if the
+	// context has been cancelled.
 	Deprovision(ctx context.Context, input DeprovisionInput, output *DeprovisionOutput)
 }
 
@@ -31,7 +39,8 @@ type ProvisionInput struct {
 	// This directory will automatically be deleted after the executable exits.
 	TempDir string
 
-	// DryRun can be used to opt out
+	// DryRun can be used to opt out of provisioning anything to the disk or the environment. Provisioners that
+	// support dry runs record what they would have provisioned to DryRunLog on ProvisionOutput instead.
 	DryRun bool
 
 	// Cache can contain data that got added in the provision step from previous runs for this credential.
@@ -39,13 +48,63 @@ type ProvisionInput struct {
 
 	// ItemFields contains the field names and their corresponding (sensitive) values.
 	ItemFields map[FieldName]string
+
+	// ItemFieldGroups contains the fields of the sections of the item, keyed by section name, for items that hold
+	// multiple sets of credentials, such as one per profile. The fields of the sections are not part of ItemFields.
+	ItemFieldGroups map[string]map[FieldName]string
+
+	// SelectedProfile is the name of the section in ItemFieldGroups whose fields are provisioned, if any. It gets
+	// populated by provision.ProfileAware, which also merges the fields of the profile into ItemFields.
+	SelectedProfile string
+
+	// SelectedEnvironment is the name of the environment whose credentials are provisioned, e.g. "staging" or "prod",
+	// if the user selected one, for plugins that use provision.ForEnvironment. It can be populated from a flag, and
+	// provision.SelectEnvironment populates it from an environment variable otherwise.
+	SelectedEnvironment string
+
+	// ItemFiles contains the names of the files attached to the item, or the file of a Document item, and their
+	// corresponding (sensitive) contents. This can be used for binary secrets, such as keystores.
+	ItemFiles map[string][]byte
+
+	// BoundPaths contains the paths that provisioners that ran before have bound to a key, see ProvisionOutput.BindPath.
+	// It gets populated by the provisioners in the provision package before getting the file contents, so that the
+	// contents can refer to other provisioned files.
+	BoundPaths map[string]string
+
+	// (Optional) ResolveReference resolves a secret reference to a field of another item than the one being
+	// provisioned, e.g. "op://Shared/Company CA/certificate", to the (sensitive) value of the field. Since functions
+	// can't be sent over RPC, it's populated on the plugin side by the RPC server, which resolves references through
+	// the proto.ReferenceResolver that the 1Password CLI serves for the provision request, with the access of the user
+	// that invokes the executable. It's nil if the CLI doesn't support resolving references. The resolver returns an
+	// error that wraps ErrReferencedItemNotFound or ErrReferencedFieldNotFound if the reference can't be resolved.
+	// Resolved values must never be cached, since another user sharing the plugin may not have access to the
+	// referenced item. Use provision.FieldFromItem to access it.
+	ResolveReference func(ref string) (string, error)
+
+	// (Optional) FileSystem is used by provisioners that modify files directly. Defaults to the OS file system if
+	// not set. Use FS to access it.
+	FileSystem FileSystem
 }
 
+var (
+	// ErrReferencedItemNotFound is returned by ProvisionInput.ResolveReference if the referenced item doesn't exist or
+	// the user doesn't have access to it.
+	ErrReferencedItemNotFound = errors.New("referenced item not found")
+
+	// ErrReferencedFieldNotFound is returned by ProvisionInput.ResolveReference if the referenced item exists, but
+	// doesn't contain the referenced field.
+	ErrReferencedFieldNotFound = errors.New("referenced field not found")
+)
+
 // DeprovisionInput contains info that provisioners can use to deprovision credentials.
 type DeprovisionInput struct {
 	HomeDir string
 	TempDir string
 	DryRun  bool
+
+	// (Optional) FileSystem is used by provisioners that modify files directly. Defaults to the OS file system if
+	// not set. Use FS to access it.
+	FileSystem FileSystem
 }
 
 // ProvisionOutput contains the sensitive values that the Provisioner outputs.
@@ -67,17 +126,135 @@ type ProvisionOutput struct {
 	// data from previous runs, use Cache on ProvisionInput.
 	Cache CacheOperations
 
+	// Stdin can be used to provision credentials through the standard input of the executable. The result of this
+	// will be written to the executable's stdin, after which stdin gets closed. Use SetStdin to set it.
+	//
+	// Stdin is delivered exactly once: it's written in full to the stdin of the process that gets started, and the
+	// process reads EOF after the contents, so a read after the secret has been consumed never blocks. If the
+	// executable runs multiple stages, e.g. a login step that reads the secret followed by the actual command, only the
+	// stage that reads stdin first receives the contents, and all later stages see an empty, closed stdin. There's
+	// only one stdin, so only one provisioner can claim it.
+	Stdin []byte
+
 	// Diagnostics can be used to report errors.
 	Diagnostics Diagnostics
+
+	// DryRunLog contains what provisioners would have provisioned if DryRun on ProvisionInput wasn't set. This can be
+	// used to preview a provisioner while developing a plugin. It never contains any (sensitive) values.
+	DryRunLog []DryRunEntry
+
+	// Log contains metadata about what the provisioners did, such as the paths of the files they provisioned. This
+	// can be used to debug why provisioning fails. It never contains any (sensitive) values.
+	Log []LogEntry
+
+	// Paths contains the paths that provisioners have bound to a key, so that provisioners that run later can
+	// refer to them. Use BindPath and PathFor to access it.
+	Paths map[string]string
+
+	// Actions contains what the provisioners provisioned, such as the environment variables they set and the files
+	// they wrote, so that it can be shown to the user, e.g. by "op plugin inspect". It never contains any (sensitive)
+	// values. Actions are recorded automatically by AddEnvVar, AddArgs, InsertArgs, AddPrioritizedArgs, AddFile, and
+	// SetStdin. Provisioners that modify files directly should record these using AddAction.
+	Actions []ProvisionAction
+
+	// NonSensitiveEnvVars contains the names of the environment variables in Environment whose values are not
+	// secret, such as the paths of provisioned files, so that they can be displayed, e.g. when the environment of an
+	// interactive shell is echoed. All other environment variables are sensitive: their values should never be
+	// displayed or end up in the history of a shell. Use AddNonSensitiveEnvVar and IsSensitiveEnvVar to access it.
+	NonSensitiveEnvVars map[string]bool
+
+	// ArgGroups describes the args at the end of the command line that have been added using AddPrioritizedArgs, in
+	// the order in which they appear on the command line. Use AddPrioritizedArgs to modify it.
+	ArgGroups []ArgGroup
 }
 
+// ArgGroup describes a group of consecutive args on the command line that have been added with a priority.
+type ArgGroup struct {
+	// Priority is the priority that the args have been added with. Groups with a lower priority come first.
+	Priority int
+
+	// Size is the number of args in the group.
+	Size int
+}
+
+// ProvisionAction describes a single thing that a provisioner provisioned, without any (sensitive) values.
+type ProvisionAction struct {
+	// Kind describes what was provisioned.
+	Kind ActionKind
+
+	// Target is the file path or the environment variable name, depending on the kind. It's empty for args and
+	// stdin, since these can contain (sensitive) values.
+	Target string
+
+	// Mode is the file mode of the file, if a file was provisioned. A zero mode means the default mode of 0600.
+	Mode os.FileMode
+
+	// Size is the size of the file contents or stdin in bytes, or the number of args, depending on the kind.
+	Size int
+}
+
+type ActionKind string
+
+const (
+	ActionKindFile   ActionKind = "file"
+	ActionKindEnvVar ActionKind = "env"
+	ActionKindArgs   ActionKind = "args"
+	ActionKindStdin  ActionKind = "stdin"
+
+	// ActionKindCredentialStore is an entry in the OS credential store. The target is "<service>/<account>".
+	ActionKindCredentialStore ActionKind = "credential-store"
+)
+
+// DryRunEntry describes a single thing that a provisioner would have provisioned, without any (sensitive) values.
+type DryRunEntry struct {
+	// Kind describes what would have been provisioned.
+	Kind DryRunKind
+
+	// Target is the file path, the environment variable name, or the args, depending on the kind.
+	Target string
+
+	// Size is the size of the file contents in bytes, if a file would have been provisioned.
+	Size int
+}
+
+type DryRunKind string
+
+const (
+	DryRunKindFile   DryRunKind = "file"
+	DryRunKindEnvVar DryRunKind = "env"
+	DryRunKindArgs   DryRunKind = "args"
+	DryRunKindStdin  DryRunKind = "stdin"
+
+	// DryRunKindCredentialStore is an entry in the OS credential store. The target is "<service>/<account>".
+	DryRunKindCredentialStore DryRunKind = "credential-store"
+)
+
 type DeprovisionOutput struct {
 	Diagnostics Diagnostics
+
+	// Log contains metadata about what the provisioners did to deprovision. It never contains any (sensitive) values.
+	Log []LogEntry
+}
+
+// LogEntry describes a single step that a provisioner took during provisioning or deprovisioning. It should only
+// contain metadata, such as paths, sizes, or environment variable names, and never any (sensitive) values.
+type LogEntry struct {
+	// Provisioner is the description of the provisioner that took the step.
+	Provisioner string
+
+	// Message describes the step, e.g. "provisioned secret file at /tmp/x.json (412 bytes)".
+	Message string
 }
 
 // OutputFile contains the sensitive file info and contents that the provisioner outputs.
 type OutputFile struct {
 	Contents []byte
+
+	// (Optional) Mode specifies the permissions the file should be written with. The mode is passed on as is to
+	// whatever writes the files of the provision output, which is responsible for applying it, so the SDK doesn't
+	// guarantee whether the umask applies. If not set, the default mode of 0600 is used. Platforms that don't
+	// support Unix permissions ignore this value.
+	Mode os.FileMode
 }
 
 // CacheState represents the state of the encrypted cache for a given plugin and item.
@@ -97,14 +274,92 @@ type CacheEntry struct {
 	ExpiresAt time.Time
 }
 
-// AddEnvVar adds an environment variable to the provision output.
+// AddEnvVar adds an environment variable to the provision output. The value is treated as sensitive, see
+// AddNonSensitiveEnvVar for values that aren't secret.
 func (out *ProvisionOutput) AddEnvVar(name string, value string) {
 	out.Environment[name] = value
+	delete(out.NonSensitiveEnvVars, name)
+	out.AddAction(ProvisionAction{Kind: ActionKindEnvVar, Target: name})
+}
+
+// AddNonSensitiveEnvVar adds an environment variable whose value is not secret to the provision output, such as the
+// path of a provisioned file, so that its value can be displayed.
+func (out *ProvisionOutput) AddNonSensitiveEnvVar(name string, value string) {
+	out.AddEnvVar(name, value)
+	if out.NonSensitiveEnvVars == nil {
+		out.NonSensitiveEnvVars = make(map[string]bool)
+	}
+	out.NonSensitiveEnvVars[name] = true
+}
+
+// IsSensitiveEnvVar returns whether the value of the provisioned environment variable is sensitive, which is the
+// case unless it has been added using AddNonSensitiveEnvVar.
+func (out *ProvisionOutput) IsSensitiveEnvVar(name string) bool {
+	return !out.NonSensitiveEnvVars[name]
 }
 
-// AddArgs can be used to add additional arguments to the command line of the provision output.
+// AddArgs can be used to add additional arguments to the command line of the provision output. The arguments are
+// appended, but stay in front of the arguments that have been added using AddPrioritizedArgs.
 func (out *ProvisionOutput) AddArgs(args ...string) {
-	out.CommandLine = append(out.CommandLine, args...)
+	out.insertArgsAt(out.prioritizedArgsStart(), args)
+	out.AddAction(ProvisionAction{Kind: ActionKindArgs, Size: len(args)})
+}
+
+// InsertArgs can be used to insert additional arguments into the command line of the provision output at the
+// specified index. Since the first element of the command line is the executable itself, index 1 inserts the
+// arguments right after the executable. An index past the end of the command line appends the arguments, and a
+// negative index counts from the end, so -1 inserts the arguments before the last element. The arguments that have
+// been added using AddPrioritizedArgs are not part of the command line that the index refers to.
+func (out *ProvisionOutput) InsertArgs(index int, args ...string) {
+	end := out.prioritizedArgsStart()
+	if index < 0 {
+		index += end
+		if index < 0 {
+			index = 0
+		}
+	}
+	if index > end {
+		index = end
+	}
+
+	out.insertArgsAt(index, args)
+	out.AddAction(ProvisionAction{Kind: ActionKindArgs, Size: len(args)})
+}
+
+// AddPrioritizedArgs can be used to add arguments to the end of the command line of the provision output in a
+// deterministic order, regardless of the order in which the provisioners run. Arguments with a lower priority come
+// before arguments with a higher priority, and arguments with the same priority keep the order in which they were
+// added. Prioritized arguments always come after the arguments added using AddArgs and InsertArgs.
+func (out *ProvisionOutput) AddPrioritizedArgs(priority int, args ...string) {
+	index := out.prioritizedArgsStart()
+	group := 0
+	for ; group < len(out.ArgGroups) && out.ArgGroups[group].Priority <= priority; group++ {
+		index += out.ArgGroups[group].Size
+	}
+
+	out.insertArgsAt(index, args)
+	out.ArgGroups = append(out.ArgGroups[:group], append([]ArgGroup{{Priority: priority, Size: len(args)}}, out.ArgGroups[group:]...)...)
+	out.AddAction(ProvisionAction{Kind: ActionKindArgs, Size: len(args)})
+}
+
+// prioritizedArgsStart returns the index of the first argument on the command line that has been added using
+// AddPrioritizedArgs, or the length of the command line if there is none.
+func (out *ProvisionOutput) prioritizedArgsStart() int {
+	start := len(out.CommandLine)
+	for _, group := range out.ArgGroups {
+		start -= group.Size
+	}
+	if start < 0 {
+		return 0
+	}
+	return start
+}
+
+func (out *ProvisionOutput) insertArgsAt(index int, args []string) {
+	commandLine := make([]string, 0, len(out.CommandLine)+len(args))
+	commandLine = append(commandLine, out.CommandLine[:index]...)
+	commandLine = append(commandLine, args...)
+	out.CommandLine = append(commandLine, out.CommandLine[index:]...)
 }
 
 // AddSecretFile can be used to add a file containing secrets to the provision output.
@@ -114,6 +369,35 @@ func (out *ProvisionOutput) AddSecretFile(path string, contents []byte) {
 	})
 }
 
+// AddSecretFileReader works like AddSecretFile, but reads the contents from the reader, for large secrets like
+// keystores or certificate bundles that are produced by a stream. The provision output is handed to the CLI in one
+// piece, so the contents still end up in memory once, but if the reader reports its size, like *os.File,
+// *bytes.Reader, or *bytes.Buffer do, it's read into a buffer of exactly that size, instead of one that keeps growing
+// and copying the contents read so far.
+func (out *ProvisionOutput) AddSecretFileReader(path string, r io.Reader, mode os.FileMode) error {
+	var size int64
+	switch r := r.(type) {
+	case interface{ Len() int }:
+		size = int64(r.Len())
+	case interface{ Stat() (os.FileInfo, error) }:
+		if info, err := r.Stat(); err == nil && info.Mode().IsRegular() {
+			size = info.Size()
+		}
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, size+bytes.MinRead))
+	_, err := buf.ReadFrom(r)
+	if err != nil {
+		return fmt.Errorf("reading contents of %s: %w", path, err)
+	}
+
+	out.AddFile(path, OutputFile{
+		Contents: buf.Bytes(),
+		Mode:     mode,
+	})
+	return nil
+}
+
 // AddNonSecretFile can be used to add a file that does not contain secrets to the provision output.
 func (out *ProvisionOutput) AddNonSecretFile(path string, contents []byte) {
 	out.AddFile(path, OutputFile{
@@ -124,6 +408,78 @@ func (out *ProvisionOutput) AddNonSecretFile(path string, contents []byte) {
 // AddFile can be used to add a file to the provision output.
 func (out *ProvisionOutput) AddFile(path string, file OutputFile) {
 	out.Files[path] = file
+	out.AddAction(ProvisionAction{Kind: ActionKindFile, Target: path, Mode: file.Mode, Size: len(file.Contents)})
+}
+
+// ProvisionedFiles returns the contents of all files that have been provisioned so far, keyed by path. This can be
+// used in tests to check what a provisioner wrote, e.g. to verify that an importer reads it back the same way. The
+// result is a copy, so modifying it doesn't affect the provision output.
+func (out *ProvisionOutput) ProvisionedFiles() map[string][]byte {
+	files := make(map[string][]byte, len(out.Files))
+	for path, file := range out.Files {
+		files[path] = append([]byte(nil), file.Contents...)
+	}
+	return files
+}
+
+// ProvisionedEnvVars returns all environment variables that have been provisioned so far. The result is a copy, so
+// modifying it doesn't affect the provision output.
+func (out *ProvisionOutput) ProvisionedEnvVars() map[string]string {
+	envVars := make(map[string]string, len(out.Environment))
+	for name, value := range out.Environment {
+		envVars[name] = value
+	}
+	return envVars
+}
+
+// SetStdin can be used to set the (possibly sensitive) contents that will be written to the standard input of the
+// executable, see Stdin for how the contents are delivered. If another provisioner has already set stdin, the
+// contents are left untouched and an error is reported instead.
+func (out *ProvisionOutput) SetStdin(contents []byte) {
+	if out.Stdin != nil {
+		out.AddError(errors.New("stdin has already been provisioned by another provisioner"))
+		return
+	}
+	out.Stdin = contents
+	out.AddAction(ProvisionAction{Kind: ActionKindStdin, Size: len(contents)})
+}
+
+// BindPath can be used to make the path of a provisioned file available to provisioners that run later under the
+// specified key. Binding a key again replaces the previous path.
+func (out *ProvisionOutput) BindPath(key string, path string) {
+	if out.Paths == nil {
+		out.Paths = make(map[string]string)
+	}
+	out.Paths[key] = path
+}
+
+// PathFor returns the path that a provisioner that ran before has bound to the key. The second return value is
+// false if no path has been bound to the key, for example because that provisioner hasn't run yet.
+func (out *ProvisionOutput) PathFor(key string) (string, bool) {
+	path, ok := out.Paths[key]
+	return path, ok
+}
+
+// AddAction can be used to record what the provisioner provisioned, if it didn't use the other methods of the
+// provision output to do so, e.g. because it modified a file directly. The action should never contain any
+// (sensitive) values.
+func (out *ProvisionOutput) AddAction(action ProvisionAction) {
+	out.Actions = append(out.Actions, action)
+}
+
+// AddDryRunEntry can be used to record what would have been provisioned during a dry run.
+func (out *ProvisionOutput) AddDryRunEntry(entry DryRunEntry) {
+	out.DryRunLog = append(out.DryRunLog, entry)
+}
+
+// AddLog can be used to record a step the provisioner took. The entry should never contain any (sensitive) values.
+func (out *ProvisionOutput) AddLog(entry LogEntry) {
+	out.Log = append(out.Log, entry)
+}
+
+// AddLog can be used to record a step the provisioner took. The entry should never contain any (sensitive) values.
+func (out *DeprovisionOutput) AddLog(entry LogEntry) {
+	out.Log = append(out.Log, entry)
 }
 
 // AddError can be used to report an error to the provision output. If the provision output contains one
@@ -132,6 +488,36 @@ func (out *ProvisionOutput) AddError(err error) {
 	out.Diagnostics.Errors = append(out.Diagnostics.Errors, Error{err.Error()})
 }
 
+// AddError can be used to report an error to the deprovision output, e.g. when a file could not be restored or a
+// socket could not be removed. Errors are reported to the user, but don't stop the other provisioners from cleaning
+// up, so provisioners should keep cleaning up as much as they can after reporting an error.
+func (out *DeprovisionOutput) AddError(err error) {
+	out.Diagnostics.Errors = append(out.Diagnostics.Errors, Error{err.Error()})
+}
+
+// FS returns the file system that provisioners should use to modify files directly.
+func (in *ProvisionInput) FS() FileSystem {
+	if in.FileSystem == nil {
+		return OSFileSystem{}
+	}
+	return in.FileSystem
+}
+
+// FS returns the file system that provisioners should use to modify files directly.
+func (in *DeprovisionInput) FS() FileSystem {
+	if in.FileSystem == nil {
+		return OSFileSystem{}
+	}
+	return in.FileSystem
+}
+
+// LookupEnv returns the value of the environment variable in the environment that the executable is invoked from,
+// e.g. to include the current AWS_REGION in a config file. The environment is deliberately not exposed as a whole, so
+// that provisioners can only read the variables they explicitly ask for and never write the environment to a file.
+func (in *ProvisionInput) LookupEnv(name string) (string, bool) {
+	return os.LookupEnv(name)
+}
+
 // FromHomeDir returns a path with the user's home directory prepended.
 func (in *ProvisionInput) FromHomeDir(path ...string) string {
 	return filepath.Join(append([]string{in.HomeDir}, path...)...)
@@ -142,6 +528,37 @@ func (in *ProvisionInput) FromTempDir(path ...string) string {
 	return filepath.Join(append([]string{in.TempDir}, path...)...)
 }
 
+// FromTempDirSubpath returns a path with the current execution's temp directory prepended, like FromTempDir, but also
+// creates the intermediate directories with 0700 permissions. This can be used to lay out multiple related files in
+// a predictable subdirectory, e.g. FromTempDirSubpath("gcloud", "credentials.json"). The subdirectories get removed
+// along with the temp directory. An error is returned if the path would end up outside of the temp directory.
+func (in *ProvisionInput) FromTempDirSubpath(path ...string) (string, error) {
+	fullPath := in.FromTempDir(path...)
+
+	rel, err := filepath.Rel(in.TempDir, fullPath)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is not inside the temp directory", filepath.Join(path...))
+	}
+
+	err = os.MkdirAll(filepath.Dir(fullPath), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	// The permissions passed to MkdirAll are affected by the umask and don't apply to directories that already
+	// existed, so make sure explicitly that only the current user can access the subdirectories.
+	dir := filepath.Dir(fullPath)
+	for dir != filepath.Clean(in.TempDir) && dir != filepath.Dir(dir) {
+		err = os.Chmod(dir, 0700)
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Dir(dir)
+	}
+
+	return fullPath, nil
+}
+
 // Get returns the cached value at the specified key if it exists. The data can be returned either as a []byte
 // or unmarshaled as JSON.
 func (c CacheState) Get(key string, out any) (ok bool) {
@@ -1,8 +1,14 @@
 package sdk
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/stretchr/testify/assert"
@@ -122,3 +128,189 @@ func TestCacheOperationsPutStruct(t *testing.T) {
 
 	assert.Equal(t, structData, structResult)
 }
+
+func TestProvisionOutputInsertArgs(t *testing.T) {
+	cases := map[string]struct {
+		index    int
+		expected []string
+	}{
+		"after the executable": {
+			index:    1,
+			expected: []string{"tool", "--config", "/tmp/file", "subcommand", "--flag"},
+		},
+		"at the start": {
+			index:    0,
+			expected: []string{"--config", "/tmp/file", "tool", "subcommand", "--flag"},
+		},
+		"past the end": {
+			index:    10,
+			expected: []string{"tool", "subcommand", "--flag", "--config", "/tmp/file"},
+		},
+		"negative index": {
+			index:    -1,
+			expected: []string{"tool", "subcommand", "--config", "/tmp/file", "--flag"},
+		},
+		"negative index before the start": {
+			index:    -10,
+			expected: []string{"--config", "/tmp/file", "tool", "subcommand", "--flag"},
+		},
+	}
+
+	for name, tc := range cases {
+		t.Run(name, func(t *testing.T) {
+			out := ProvisionOutput{
+				CommandLine: []string{"tool", "subcommand", "--flag"},
+			}
+			out.InsertArgs(tc.index, "--config", "/tmp/file")
+			assert.Equal(t, tc.expected, out.CommandLine)
+		})
+	}
+}
+
+func TestProvisionOutputAddPrioritizedArgs(t *testing.T) {
+	out := ProvisionOutput{
+		CommandLine: []string{"tool", "subcommand"},
+	}
+
+	out.AddPrioritizedArgs(20, "--token", "secret")
+	out.AddPrioritizedArgs(10, "--config", "/tmp/file")
+	out.AddPrioritizedArgs(20, "--verbose")
+	out.AddArgs("--flag")
+	out.InsertArgs(-1, "--region", "eu")
+	assert.Equal(t, []string{"tool", "subcommand", "--region", "eu", "--flag", "--config", "/tmp/file", "--token", "secret", "--verbose"}, out.CommandLine)
+	assert.Equal(t, []ArgGroup{{Priority: 10, Size: 2}, {Priority: 20, Size: 2}, {Priority: 20, Size: 1}}, out.ArgGroups)
+	assert.Len(t, out.Actions, 5)
+}
+
+func TestProvisionOutputSensitiveEnvVars(t *testing.T) {
+	out := ProvisionOutput{
+		Environment: make(map[string]string),
+	}
+
+	out.AddEnvVar("TOKEN", "secret")
+	out.AddNonSensitiveEnvVar("TOKEN_FILE", "/tmp/token")
+	assert.True(t, out.IsSensitiveEnvVar("TOKEN"))
+	assert.False(t, out.IsSensitiveEnvVar("TOKEN_FILE"))
+
+	// Overwriting an env var without marking it as non-sensitive makes it sensitive again.
+	out.AddEnvVar("TOKEN_FILE", "secret")
+	assert.True(t, out.IsSensitiveEnvVar("TOKEN_FILE"))
+	assert.Equal(t, map[string]string{"TOKEN": "secret", "TOKEN_FILE": "secret"}, out.Environment)
+}
+
+func TestProvisionOutputAddSecretFileReader(t *testing.T) {
+	contents := bytes.Repeat([]byte("secret"), 1<<18)
+	path := filepath.Join(t.TempDir(), "keystore.p12")
+	require.NoError(t, os.WriteFile(path, contents, 0600))
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	for name, r := range map[string]io.Reader{
+		"bytes reader": bytes.NewReader(contents),
+		"file":         file,
+		"unknown size": io.MultiReader(bytes.NewReader(contents)),
+	} {
+		out := ProvisionOutput{
+			Files: make(map[string]OutputFile),
+		}
+		err := out.AddSecretFileReader("/tmp/keystore.p12", r, 0600)
+		require.NoError(t, err, name)
+		assert.Equal(t, contents, out.Files["/tmp/keystore.p12"].Contents, name)
+		assert.Equal(t, os.FileMode(0600), out.Files["/tmp/keystore.p12"].Mode, name)
+		if name != "unknown size" {
+			// The buffer was allocated once with the right size, instead of growing while reading.
+			assert.LessOrEqual(t, cap(out.Files["/tmp/keystore.p12"].Contents), len(contents)+bytes.MinRead, name)
+		}
+	}
+
+	out := ProvisionOutput{
+		Files: make(map[string]OutputFile),
+	}
+	err = out.AddSecretFileReader("/tmp/keystore.p12", iotest.ErrReader(errors.New("connection reset")), 0600)
+	assert.EqualError(t, err, "reading contents of /tmp/keystore.p12: connection reset")
+	assert.Empty(t, out.Files)
+}
+
+func TestProvisionOutputSetStdinOnce(t *testing.T) {
+	out := ProvisionOutput{}
+	out.SetStdin([]byte("first"))
+	out.SetStdin([]byte("second"))
+
+	assert.Equal(t, []byte("first"), out.Stdin)
+	assert.Equal(t, []Error{{Message: "stdin has already been provisioned by another provisioner"}}, out.Diagnostics.Errors)
+	assert.Equal(t, []ProvisionAction{{Kind: ActionKindStdin, Size: 5}}, out.Actions)
+}
+
+func TestProvisionInputFromTempDirSubpath(t *testing.T) {
+	in := ProvisionInput{
+		TempDir: t.TempDir(),
+	}
+
+	path, err := in.FromTempDirSubpath("gcloud", "configurations", "credentials.json")
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(in.TempDir, "gcloud", "configurations", "credentials.json"), path)
+
+	info, err := os.Stat(filepath.Dir(path))
+	require.NoError(t, err)
+	assert.True(t, info.IsDir())
+	assert.NoFileExists(t, path)
+
+	_, err = in.FromTempDirSubpath("..", "escaped")
+	assert.Error(t, err)
+}
+
+func TestProvisionOutputAccessorsReturnCopies(t *testing.T) {
+	out := ProvisionOutput{
+		Environment: map[string]string{"TOKEN_FILE": "/tmp/token"},
+		Files: map[string]OutputFile{
+			"/tmp/token": {Contents: []byte("secret")},
+		},
+	}
+
+	files := out.ProvisionedFiles()
+	assert.Equal(t, map[string][]byte{"/tmp/token": []byte("secret")}, files)
+	files["/tmp/token"][0] = 'S'
+	files["/tmp/other"] = nil
+	assert.Equal(t, "secret", string(out.Files["/tmp/token"].Contents))
+	assert.Len(t, out.Files, 1)
+
+	envVars := out.ProvisionedEnvVars()
+	assert.Equal(t, map[string]string{"TOKEN_FILE": "/tmp/token"}, envVars)
+	envVars["TOKEN_FILE"] = "/tmp/other"
+	assert.Equal(t, "/tmp/token", out.Environment["TOKEN_FILE"])
+}
+
+func TestProvisionOutputPathFor(t *testing.T) {
+	out := ProvisionOutput{}
+
+	_, ok := out.PathFor("config")
+	assert.False(t, ok)
+
+	out.BindPath("config", "/tmp/config")
+	path, ok := out.PathFor("config")
+	assert.True(t, ok)
+	assert.Equal(t, "/tmp/config", path)
+}
+
+func TestProvisionOutputActions(t *testing.T) {
+	out := ProvisionOutput{
+		Environment: make(map[string]string),
+		Files:       make(map[string]OutputFile),
+		CommandLine: []string{"tool"},
+	}
+
+	out.AddEnvVar("TOKEN", "secret")
+	out.AddFile("/tmp/credentials", OutputFile{Contents: []byte("secret"), Mode: 0600})
+	out.AddArgs("--token", "secret")
+	out.InsertArgs(1, "--verbose")
+	out.SetStdin([]byte("secret"))
+
+	assert.Equal(t, []ProvisionAction{
+		{Kind: ActionKindEnvVar, Target: "TOKEN"},
+		{Kind: ActionKindFile, Target: "/tmp/credentials", Mode: 0600, Size: 6},
+		{Kind: ActionKindArgs, Size: 2},
+		{Kind: ActionKindArgs, Size: 1},
+		{Kind: ActionKindStdin, Size: 6},
+	}, out.Actions)
+}
@@ -0,0 +1,35 @@
+//go:build !windows
+
+package sdk
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProvisionInputFromTempDirSubpathIgnoresUmask(t *testing.T) {
+	previous := syscall.Umask(0)
+	t.Cleanup(func() { syscall.Umask(previous) })
+
+	in := ProvisionInput{
+		TempDir: t.TempDir(),
+	}
+
+	// A directory that already exists with permissive permissions gets locked down as well.
+	err := os.Mkdir(filepath.Join(in.TempDir, "gcloud"), 0755)
+	require.NoError(t, err)
+
+	path, err := in.FromTempDirSubpath("gcloud", "configurations", "credentials.json")
+	require.NoError(t, err)
+
+	for _, dir := range []string{filepath.Dir(path), filepath.Dir(filepath.Dir(path))} {
+		info, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0700), info.Mode().Perm(), dir)
+	}
+}
@@ -0,0 +1,17 @@
+package sdk
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProvisionInputFromTempDirOnWindows(t *testing.T) {
+	in := ProvisionInput{TempDir: `C:\Users\wendy\AppData\Local\Temp\op-123`}
+
+	path := in.FromTempDir("config", "credentials.json")
+
+	assert.Equal(t, `C:\Users\wendy\AppData\Local\Temp\op-123\config\credentials.json`, path)
+	assert.True(t, filepath.IsAbs(path))
+}
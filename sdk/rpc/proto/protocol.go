@@ -81,6 +81,10 @@ type ProvisionCredentialRequest struct {
 	ProvisionerID
 	sdk.ProvisionInput
 	sdk.ProvisionOutput
+
+	// ReferenceResolverID is the ID of the go-plugin MuxBroker stream on which the 1Password CLI serves a
+	// ReferenceResolver for this request, or 0 if the CLI doesn't support resolving secret references.
+	ReferenceResolverID uint32
 }
 
 // DeprovisionCredentialRequest augments sdk.DeprovisionInput with a CredentialID so Deprovision() can be called over RPC.
@@ -0,0 +1,75 @@
+package proto
+
+import (
+	"errors"
+	"fmt"
+	"net/rpc"
+
+	"github.com/1Password/shell-plugins/sdk"
+)
+
+// The kinds of errors that ResolveReferenceResponse.ErrorKind can hold. Errors returned by RPC calls lose their type,
+// so these are passed explicitly and turned back into the corresponding sdk errors by ReferenceResolverClient.
+const (
+	ReferenceErrorItemNotFound  = "item_not_found"
+	ReferenceErrorFieldNotFound = "field_not_found"
+)
+
+// ResolveReferenceRequest asks the 1Password CLI to resolve a secret reference, see sdk.ProvisionInput.ResolveReference.
+type ResolveReferenceRequest struct {
+	Ref string
+}
+
+// ResolveReferenceResponse contains the (sensitive) value of the referenced field.
+type ResolveReferenceResponse struct {
+	Value string
+	// ErrorKind is set to one of the ReferenceError constants if the reference could not be resolved because the item
+	// or the field doesn't exist.
+	ErrorKind string
+}
+
+// ReferenceResolver is the RPC service that the 1Password CLI serves to the plugin for the duration of a provision
+// call, so that the plugin can resolve secret references with the access of the user that invokes the executable.
+// Since sdk.ProvisionInput is sent over RPC, it can't carry the resolver function itself.
+type ReferenceResolver struct {
+	Resolve func(ref string) (string, error)
+}
+
+// ResolveReference resolves the reference in the request using the Resolve function of the resolver.
+func (r *ReferenceResolver) ResolveReference(req ResolveReferenceRequest, resp *ResolveReferenceResponse) error {
+	value, err := r.Resolve(req.Ref)
+	switch {
+	case errors.Is(err, sdk.ErrReferencedItemNotFound):
+		resp.ErrorKind = ReferenceErrorItemNotFound
+	case errors.Is(err, sdk.ErrReferencedFieldNotFound):
+		resp.ErrorKind = ReferenceErrorFieldNotFound
+	case err != nil:
+		return err
+	default:
+		resp.Value = value
+	}
+	return nil
+}
+
+// ReferenceResolverClient returns a function that can be used as sdk.ProvisionInput.ResolveReference, which resolves
+// references by calling the ReferenceResolver that's served on the other end of the client as "Plugin".
+func ReferenceResolverClient(client *rpc.Client) func(ref string) (string, error) {
+	return func(ref string) (string, error) {
+		var resp ResolveReferenceResponse
+		err := client.Call("Plugin.ResolveReference", ResolveReferenceRequest{Ref: ref}, &resp)
+		if err != nil {
+			return "", err
+		}
+
+		switch resp.ErrorKind {
+		case "":
+			return resp.Value, nil
+		case ReferenceErrorItemNotFound:
+			return "", fmt.Errorf("%w: %s", sdk.ErrReferencedItemNotFound, ref)
+		case ReferenceErrorFieldNotFound:
+			return "", fmt.Errorf("%w: %s", sdk.ErrReferencedFieldNotFound, ref)
+		default:
+			return "", fmt.Errorf("resolving %s failed: %s", ref, resp.ErrorKind)
+		}
+	}
+}
@@ -16,13 +16,15 @@ type RPCPlugin struct {
 
 // Server registers the RPC provider server with the RPC server that
 // go-plugin is setting up.
-func (p *RPCPlugin) Server(*plugin.MuxBroker) (any, error) {
+func (p *RPCPlugin) Server(broker *plugin.MuxBroker) (any, error) {
 	pl, err := p.RPCPlugin()
 	if err != nil {
 		return nil, err
 	}
 
-	return newServer(pl), nil
+	srv := newServer(pl)
+	srv.broker = broker
+	return srv, nil
 }
 
 // Client always returns an error; we're only implementing a server.
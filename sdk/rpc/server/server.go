@@ -3,11 +3,13 @@ package server
 import (
 	"context"
 	"fmt"
+	"net/rpc"
 	"runtime/debug"
 
 	"github.com/1Password/shell-plugins/sdk"
 	"github.com/1Password/shell-plugins/sdk/rpc/proto"
 	"github.com/1Password/shell-plugins/sdk/schema"
+	"github.com/hashicorp/go-plugin"
 )
 
 type errFunctionFieldNotSet struct {
@@ -31,6 +33,11 @@ type RPCServer struct {
 	importers    map[proto.CredentialID]sdk.Importer
 	provisioners map[proto.ProvisionerID]sdk.Provisioner
 	needsAuth    map[proto.ExecutableID]sdk.NeedsAuthentication
+	credentials  map[proto.CredentialID]*schema.CredentialType
+
+	// broker is used to connect to the services that the 1Password CLI serves for a single call, such as the
+	// proto.ReferenceResolver. It's nil if the server is not served through go-plugin.
+	broker *plugin.MuxBroker
 }
 
 func newServer(p schema.Plugin) *RPCServer {
@@ -73,6 +80,7 @@ func newServer(p schema.Plugin) *RPCServer {
 	}
 
 	s.p = p
+	s.credentials = credentials
 	return s
 }
 
@@ -140,9 +148,43 @@ func (t *RPCServer) CredentialImport(req proto.ImportCredentialRequest, resp *sd
 	}
 	*resp = req.ImportOutput
 	importer(context.Background(), req.ImportInput, resp)
+	resp.Deduplicate()
+	if credential, ok := t.credentials[req.CredentialID]; ok {
+		var fieldNames []sdk.FieldName
+		for _, field := range credential.Fields {
+			fieldNames = append(fieldNames, field.Name)
+		}
+		resp.Rank(fieldNames)
+		validateCandidates(*credential, resp)
+	}
+	for _, attempt := range resp.Attempts {
+		for _, candidate := range attempt.Candidates {
+			attempt.Diagnostics.Redact(fieldValues(candidate.Fields)...)
+		}
+	}
 	return nil
 }
 
+// validateCandidates validates the fields of all import candidates against the credential schema. Invalid candidates
+// are not dropped, but downgraded: they're moved after the valid candidates and a warning gets reported.
+func validateCandidates(credential schema.CredentialType, out *sdk.ImportOutput) {
+	for _, attempt := range out.Attempts {
+		var valid, invalid []sdk.ImportCandidate
+		for _, candidate := range attempt.Candidates {
+			if err := credential.ValidateFields(candidate.Fields); err != nil {
+				attempt.AddWarning(err.Error())
+				invalid = append(invalid, candidate)
+			} else {
+				valid = append(valid, candidate)
+			}
+		}
+
+		if len(invalid) > 0 {
+			attempt.Candidates = append(valid, invalid...)
+		}
+	}
+}
+
 // CredentialProvisionerDescription is a remote version of the the Description() method of the sdk.Provisioner
 // interface. The call is forwarded to the Description() function of the Provisioner of the credential identified by
 // req.CredentialID.
@@ -155,6 +197,12 @@ func (t *RPCServer) CredentialProvisionerDescription(req proto.ProvisionerID, re
 	return nil
 }
 
+// profileSelector is implemented by provisioners that provision the fields of a single profile of the item, such as
+// provision.ProfileAwareProvisioner.
+type profileSelector interface {
+	SelectProfile(in sdk.ProvisionInput) (sdk.ProvisionInput, error)
+}
+
 // CredentialProvisionerProvision is a remote version of the the Provision() method of the sdk.Provisioner
 // interface. The call is forwarded to the Provision() function of the Provisioner of the credential identified by
 // req.CredentialID.
@@ -162,6 +210,7 @@ func (t *RPCServer) CredentialProvisionerProvision(req proto.ProvisionCredential
 	defer func() {
 		if err := recover(); err != nil {
 			diagnostics := getPanicDiagnostics(err)
+			diagnostics.Redact(provisionedValues(req.ProvisionInput, resp)...)
 			resp.Diagnostics = diagnostics
 		}
 	}()
@@ -170,18 +219,107 @@ func (t *RPCServer) CredentialProvisionerProvision(req proto.ProvisionCredential
 		return err
 	}
 	*resp = req.ProvisionOutput
+	if credential, ok := t.getCredential(req.ProvisionerID); ok {
+		// Validate the fields that the provisioner will actually get, which for profile aware provisioners includes
+		// the fields of the selected profile.
+		in := req.ProvisionInput
+		if selector, ok := provisioner.(profileSelector); ok {
+			in, err = selector.SelectProfile(in)
+			if err != nil {
+				resp.AddError(err)
+				return nil
+			}
+		}
+
+		// Fail fast with a single actionable error, instead of letting the provisioner fail on the first missing field.
+		if err := credential.ValidateRequiredFields(in.ItemFields); err != nil {
+			resp.AddError(err)
+			return nil
+		}
+		if err := credential.ValidateFields(in.ItemFields); err != nil {
+			resp.AddError(err)
+			return nil
+		}
+	}
+	if req.ReferenceResolverID != 0 {
+		resolve, closeResolver := t.referenceResolver(req.ReferenceResolverID)
+		defer closeResolver()
+		req.ProvisionInput.ResolveReference = resolve
+	}
 	provisioner.Provision(context.Background(), req.ProvisionInput, resp)
+	resp.Diagnostics.Redact(provisionedValues(req.ProvisionInput, resp)...)
 	return nil
 }
 
+// referenceResolver connects to the proto.ReferenceResolver that the 1Password CLI serves on the broker stream with the
+// specified ID, and returns a function that resolves references through it, along with a function that closes the
+// connection. The CLI only serves the resolver for a single request, so the resolver is never reused across
+// requests, which could be made on behalf of different users. If the connection fails, resolving references fails
+// with the error, but provisioners that don't resolve references are not affected.
+func (t *RPCServer) referenceResolver(id uint32) (func(ref string) (string, error), func()) {
+	if t.broker == nil {
+		return nil, func() {}
+	}
+
+	conn, err := t.broker.Dial(id)
+	if err != nil {
+		return func(ref string) (string, error) {
+			return "", fmt.Errorf("connecting to the reference resolver of the 1Password CLI: %w", err)
+		}, func() {}
+	}
+	client := rpc.NewClient(conn)
+	return proto.ReferenceResolverClient(client), func() { _ = client.Close() }
+}
+
+// ServeReferenceResolver can be used by the 1Password CLI to serve a proto.ReferenceResolver with the resolve function
+// on the broker, for a single provision request. The returned ID has to be passed as
+// proto.ProvisionCredentialRequest.ReferenceResolverID.
+func ServeReferenceResolver(broker *plugin.MuxBroker, resolve func(ref string) (string, error)) uint32 {
+	id := broker.NextId()
+	go broker.AcceptAndServe(id, &proto.ReferenceResolver{Resolve: resolve})
+	return id
+}
+
+// fieldValues returns the (sensitive) values of the fields, so that they can be redacted from diagnostics.
+func fieldValues(fields map[sdk.FieldName]string) []string {
+	values := make([]string, 0, len(fields))
+	for _, value := range fields {
+		values = append(values, value)
+	}
+	return values
+}
+
+// provisionedValues returns the (sensitive) values that a provisioner had access to or provisioned, so that they can
+// be redacted from diagnostics: the values of the item fields and files, the values of the sensitive environment
+// variables, and the contents of the provisioned files.
+func provisionedValues(in sdk.ProvisionInput, out *sdk.ProvisionOutput) []string {
+	values := fieldValues(in.ItemFields)
+	for _, fields := range in.ItemFieldGroups {
+		values = append(values, fieldValues(fields)...)
+	}
+	for _, contents := range in.ItemFiles {
+		values = append(values, string(contents))
+	}
+	for name, value := range out.Environment {
+		if out.IsSensitiveEnvVar(name) {
+			values = append(values, value)
+		}
+	}
+	for _, file := range out.Files {
+		values = append(values, string(file.Contents))
+	}
+	return values
+}
+
 // CredentialProvisionerDeprovision is a remote version of the the Deprovision() method of the sdk.Provisioner
 // interface. The call is forwarded to the Deprovision() function of the Provisioner of the credential identified by
 // req.CredentialID.
 func (t *RPCServer) CredentialProvisionerDeprovision(req proto.DeprovisionCredentialRequest, resp *sdk.DeprovisionOutput) error {
 	defer func() {
 		if err := recover(); err != nil {
+			// Keep the errors reported before the panic, since they can point to resources that were not cleaned up.
 			diagnostics := getPanicDiagnostics(err)
-			resp.Diagnostics = diagnostics
+			resp.Diagnostics.Errors = append(resp.Diagnostics.Errors, diagnostics.Errors...)
 		}
 	}()
 	provisioner, err := t.getProvisioner(req.ProvisionerID)
@@ -204,6 +342,33 @@ func (t *RPCServer) getProvisioner(provisionerID proto.ProvisionerID) (sdk.Provi
 	return provisioner, nil
 }
 
+// getCredential returns the schema of the credential that the specified provisioner provisions, if it is defined in
+// this plugin.
+func (t *RPCServer) getCredential(provisionerID proto.ProvisionerID) (*schema.CredentialType, bool) {
+	if provisionerID.IsDefaultProvisioner {
+		credential, ok := t.credentials[provisionerID.Credential]
+		return credential, ok
+	}
+
+	executableID := int(provisionerID.CredentialUsage.Executable)
+	usageID := provisionerID.CredentialUsage.Usage
+	if executableID < 0 || executableID >= len(t.p.Executables) || usageID < 0 || usageID >= len(t.p.Executables[executableID].Uses) {
+		return nil, false
+	}
+
+	usage := t.p.Executables[executableID].Uses[usageID]
+	if usage.Name == "" || (usage.Plugin != "" && usage.Plugin != t.p.Name) {
+		return nil, false
+	}
+
+	for _, credential := range t.credentials {
+		if credential.Name == usage.Name {
+			return credential, true
+		}
+	}
+	return nil, false
+}
+
 func getPanicDiagnostics(err any) sdk.Diagnostics {
 	caughtPanic := fmt.Errorf("locally built plugin panicked: %s\nstack trace:\n%s", err, string(debug.Stack()))
 	return sdk.Diagnostics{Errors: []sdk.Error{{Message: caughtPanic.Error()}}}
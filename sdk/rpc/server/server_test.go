@@ -0,0 +1,192 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/rpc"
+	"testing"
+
+	"github.com/1Password/shell-plugins/sdk"
+	"github.com/1Password/shell-plugins/sdk/provision"
+	"github.com/1Password/shell-plugins/sdk/rpc/proto"
+	"github.com/1Password/shell-plugins/sdk/schema"
+	"github.com/hashicorp/go-plugin"
+	"github.com/stretchr/testify/assert"
+)
+
+// testRPCPlugin serves the plugin like RPCPlugin does, and gives the test access to the client side of the connection.
+type testRPCPlugin struct {
+	RPCPlugin
+}
+
+type testRPCClient struct {
+	broker *plugin.MuxBroker
+	client *rpc.Client
+}
+
+func (p *testRPCPlugin) Client(broker *plugin.MuxBroker, client *rpc.Client) (any, error) {
+	return testRPCClient{broker: broker, client: client}, nil
+}
+
+// dispense connects to the plugin through go-plugin, the same way the 1Password CLI does.
+func dispense(t *testing.T, p schema.Plugin) testRPCClient {
+	client, _ := plugin.TestPluginRPCConn(t, map[string]plugin.Plugin{
+		"plugin": &testRPCPlugin{RPCPlugin{RPCPlugin: func() (schema.Plugin, error) { return p, nil }}},
+	}, nil)
+	t.Cleanup(func() { _ = client.Close() })
+
+	raw, err := client.Dispense("plugin")
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	return raw.(testRPCClient)
+}
+
+func TestProvisionResolvesReferences(t *testing.T) {
+	rpcClient := dispense(t, schema.Plugin{
+		Name: "example",
+		Credentials: []schema.CredentialType{
+			{
+				Name:               "Example Credential",
+				DefaultProvisioner: provision.TempFile(provision.FieldFromItem("op://Shared/Company CA", "certificate"), provision.Filename("ca.pem"), provision.WithRAMDisk(provision.RAMDiskNever)),
+			},
+		},
+	})
+
+	provisionVia := func(resolve func(ref string) (string, error)) sdk.ProvisionOutput {
+		req := proto.ProvisionCredentialRequest{
+			ProvisionerID:  proto.ProvisionerID{IsDefaultProvisioner: true, Credential: 0},
+			ProvisionInput: sdk.ProvisionInput{TempDir: "/tmp"},
+			ProvisionOutput: sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			},
+		}
+		if resolve != nil {
+			req.ReferenceResolverID = ServeReferenceResolver(rpcClient.broker, resolve)
+		}
+
+		var resp sdk.ProvisionOutput
+		err := rpcClient.client.Call("Plugin.CredentialProvisionerProvision", req, &resp)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	t.Run("resolved", func(t *testing.T) {
+		var refs []string
+		resp := provisionVia(func(ref string) (string, error) {
+			refs = append(refs, ref)
+			return "-----BEGIN CERTIFICATE-----\n", nil
+		})
+		assert.Empty(t, resp.Diagnostics.Errors)
+		assert.Equal(t, []string{"op://Shared/Company CA/certificate"}, refs)
+		assert.Equal(t, []byte("-----BEGIN CERTIFICATE-----\n"), resp.Files["/tmp/ca.pem"].Contents)
+	})
+
+	t.Run("item not found", func(t *testing.T) {
+		resp := provisionVia(func(ref string) (string, error) {
+			return "", fmt.Errorf("%w: %s", sdk.ErrReferencedItemNotFound, ref)
+		})
+		assert.Equal(t, []sdk.Error{{Message: "the referenced item op://Shared/Company CA doesn't exist or you don't have access to it"}}, resp.Diagnostics.Errors)
+	})
+
+	t.Run("field not found", func(t *testing.T) {
+		resp := provisionVia(func(ref string) (string, error) {
+			return "", fmt.Errorf("%w: %s", sdk.ErrReferencedFieldNotFound, ref)
+		})
+		assert.Equal(t, []sdk.Error{{Message: "no value present in the referenced item op://Shared/Company CA for field 'certificate'"}}, resp.Diagnostics.Errors)
+	})
+
+	t.Run("resolver not served", func(t *testing.T) {
+		resp := provisionVia(nil)
+		assert.Equal(t, []sdk.Error{{Message: "can't resolve op://Shared/Company CA: referencing other items is not supported by this version of the 1Password CLI"}}, resp.Diagnostics.Errors)
+	})
+}
+
+// leakingProvisioner provisions values derived from the item, and then includes them in its diagnostics by accident.
+type leakingProvisioner struct {
+	sdk.Provisioner
+}
+
+func (p leakingProvisioner) Provision(ctx context.Context, in sdk.ProvisionInput, out *sdk.ProvisionOutput) {
+	token := "derived-" + in.ItemFields["Token"]
+	out.AddEnvVar("TOKEN", token)
+	out.AddNonSensitiveEnvVar("TOKEN_REGION", "eu-west-1")
+	out.AddFile("/tmp/config.json", sdk.OutputFile{Contents: []byte(`{"token":"` + token + `"}`)})
+	out.AddError(fmt.Errorf("unexpected token %s in %s for eu-west-1", token, `{"token":"`+token+`"}`))
+}
+
+func TestProvisionRedactsProvisionedValues(t *testing.T) {
+	rpcClient := dispense(t, schema.Plugin{
+		Name: "example",
+		Credentials: []schema.CredentialType{
+			{
+				Name:               "Example Credential",
+				DefaultProvisioner: leakingProvisioner{},
+			},
+		},
+	})
+
+	req := proto.ProvisionCredentialRequest{
+		ProvisionerID: proto.ProvisionerID{IsDefaultProvisioner: true, Credential: 0},
+		ProvisionInput: sdk.ProvisionInput{
+			TempDir:    "/tmp",
+			ItemFields: map[sdk.FieldName]string{"Token": "tok_EXAMPLE"},
+		},
+		ProvisionOutput: sdk.ProvisionOutput{
+			Environment: make(map[string]string),
+			Files:       make(map[string]sdk.OutputFile),
+		},
+	}
+	var resp sdk.ProvisionOutput
+	err := rpcClient.client.Call("Plugin.CredentialProvisionerProvision", req, &resp)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []sdk.Error{{Message: "unexpected token <redacted> in <redacted> for eu-west-1"}}, resp.Diagnostics.Errors)
+}
+
+func TestProvisionValidatesFieldsOfSelectedProfile(t *testing.T) {
+	rpcClient := dispense(t, schema.Plugin{
+		Name: "example",
+		Credentials: []schema.CredentialType{
+			{
+				Name:               "Example Credential",
+				Fields:             []schema.CredentialField{{Name: "Token"}},
+				DefaultProvisioner: provision.ProfileAware("EXAMPLE_PROFILE", provision.EnvVars(map[string]sdk.FieldName{"TOKEN": "Token"})),
+			},
+		},
+	})
+
+	provisionProfile := func(profile string) sdk.ProvisionOutput {
+		req := proto.ProvisionCredentialRequest{
+			ProvisionerID: proto.ProvisionerID{IsDefaultProvisioner: true, Credential: 0},
+			ProvisionInput: sdk.ProvisionInput{
+				TempDir:         "/tmp",
+				SelectedProfile: profile,
+				ItemFieldGroups: map[string]map[sdk.FieldName]string{
+					"default": {"Token": "tok_DEFAULT"},
+					"empty":   {},
+				},
+			},
+			ProvisionOutput: sdk.ProvisionOutput{
+				Environment: make(map[string]string),
+				Files:       make(map[string]sdk.OutputFile),
+			},
+		}
+		var resp sdk.ProvisionOutput
+		err := rpcClient.client.Call("Plugin.CredentialProvisionerProvision", req, &resp)
+		assert.NoError(t, err)
+		return resp
+	}
+
+	t.Run("field is in the selected profile", func(t *testing.T) {
+		resp := provisionProfile("default")
+		assert.Empty(t, resp.Diagnostics.Errors)
+		assert.Equal(t, "tok_DEFAULT", resp.Environment["TOKEN"])
+	})
+
+	t.Run("field is missing from the selected profile", func(t *testing.T) {
+		resp := provisionProfile("empty")
+		assert.Equal(t, []sdk.Error{{Message: "missing required fields: [Token]"}}, resp.Diagnostics.Errors)
+	})
+}
@@ -3,6 +3,8 @@ package schema
 import (
 	"fmt"
 	"net/url"
+	"regexp"
+	"strings"
 
 	"github.com/1Password/shell-plugins/sdk"
 )
@@ -48,6 +50,11 @@ type CredentialField struct {
 
 	// (Optional) Describes how values of this field look like, such as the length, charset, etc.
 	Composition *ValueComposition
+
+	// (Optional) A regular expression that values of this field have to match, e.g. "^AKIA[0-9A-Z]{16}$". Values are
+	// validated when importing and provisioning, so that a malformed value produces an actionable error instead of
+	// a confusing failure in the executable.
+	ValidationRegex string
 }
 
 func (c CredentialType) Field(name string) *CredentialField {
@@ -59,6 +66,83 @@ func (c CredentialType) Field(name string) *CredentialField {
 	return nil
 }
 
+// ValidateValue checks whether the specified value matches the validation regex of the field, if set. The value itself
+// is never included in the returned error, since it can be sensitive.
+func (f CredentialField) ValidateValue(value string) error {
+	if f.ValidationRegex == "" {
+		return nil
+	}
+
+	re, err := regexp.Compile(f.ValidationRegex)
+	if err != nil {
+		return fmt.Errorf("invalid validation regex for field '%s': %w", f.Name, err)
+	}
+
+	if !re.MatchString(value) {
+		return fmt.Errorf("value of field '%s' does not match the expected format %s", f.Name, f.ValidationRegex)
+	}
+
+	return nil
+}
+
+// ValidateFields checks whether the values of the specified item fields are valid for this credential type. Fields
+// that are not part of the credential type or that are not present are not validated, see ValidateRequiredFields for
+// when a field is present. All invalid fields are reported in a single error.
+func (c CredentialType) ValidateFields(fields map[sdk.FieldName]string) error {
+	var messages []string
+	for _, field := range c.Fields {
+		value, ok := field.lookup(fields)
+		if !ok {
+			continue
+		}
+
+		if err := field.ValidateValue(value); err != nil {
+			messages = append(messages, err.Error())
+		}
+	}
+
+	if len(messages) > 0 {
+		return fmt.Errorf("invalid %s: %s", c.Name, strings.Join(messages, "; "))
+	}
+
+	return nil
+}
+
+// ValidateRequiredFields checks whether the specified item fields contain a value for every field of this credential
+// type that is not optional. A value for one of the alternative names of a field also counts. A field is present as
+// soon as the item contains it, even if its value is empty, which is the same semantic that provisioners use to tell
+// a missing field from an empty one, e.g. provision.FieldAsFileWithDefault. Whether an empty value is valid is up to
+// the field's validation, see ValidateFields. All missing fields are reported in a single error.
+func (c CredentialType) ValidateRequiredFields(fields map[sdk.FieldName]string) error {
+	var missing []string
+	for _, field := range c.Fields {
+		if _, ok := field.lookup(fields); field.Optional || ok {
+			continue
+		}
+		missing = append(missing, field.Name.String())
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("missing required fields: [%s]", strings.Join(missing, ", "))
+	}
+
+	return nil
+}
+
+// lookup returns the value of this field in the fields, under its name or one of its alternative names, and whether
+// the field is present. Empty values count as present.
+func (f CredentialField) lookup(fields map[sdk.FieldName]string) (string, bool) {
+	if value, ok := fields[f.Name]; ok {
+		return value, true
+	}
+	for _, name := range f.AlternativeNames {
+		if value, ok := fields[sdk.FieldName(name)]; ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
 // ValueComposition describes what a value for a certain field looks like. This gets used for various purposes,
 // including but not limited to the Save in 1Password functionality and secrets scanning functionality.
 type ValueComposition struct {
@@ -120,6 +204,7 @@ func (c CredentialType) Validate() (bool, ValidationReport) {
 	allFieldsHaveDescriptionSet := true
 	allFieldsInTitleCase := true
 	allCompositionsValid := true
+	allValidationRegexesValid := true
 	hasSecretField := false
 	for _, f := range c.Fields {
 		if f.Name == "" {
@@ -138,6 +223,11 @@ func (c CredentialType) Validate() (bool, ValidationReport) {
 				allCompositionsValid = false
 			}
 		}
+		if f.ValidationRegex != "" {
+			if _, err := regexp.Compile(f.ValidationRegex); err != nil {
+				allValidationRegexesValid = false
+			}
+		}
 		if f.Secret {
 			hasSecretField = true
 		}
@@ -168,6 +258,12 @@ func (c CredentialType) Validate() (bool, ValidationReport) {
 		Severity:    ValidationSeverityError,
 	})
 
+	report.AddCheck(ValidationCheck{
+		Description: "All specified validation regexes are valid",
+		Assertion:   allValidationRegexesValid,
+		Severity:    ValidationSeverityError,
+	})
+
 	report.AddCheck(ValidationCheck{
 		Description: "Has at least 1 field that is secret",
 		Assertion:   hasSecretField,
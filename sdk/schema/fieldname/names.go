@@ -43,6 +43,7 @@ const (
 	PublicKey       = sdk.FieldName("Public Key")
 	PrivateKey      = sdk.FieldName("Private Key")
 	Region          = sdk.FieldName("Region")
+	Registry        = sdk.FieldName("Registry")
 	Secret          = sdk.FieldName("Secret")
 	SecretAccessKey = sdk.FieldName("Secret Access Key")
 	Subdomain       = sdk.FieldName("Subdomain")
@@ -93,6 +94,7 @@ func ListAll() []sdk.FieldName {
 		PublicKey,
 		PrivateKey,
 		Region,
+		Registry,
 		Secret,
 		SecretAccessKey,
 		Token,